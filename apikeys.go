@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiKeyPrefix starts every API key, which tells them apart from JWTs in an
+// Authorization header.
+const apiKeyPrefix = "todo_"
+
+// apiKeyHeader is the other header API keys are accepted in.
+const apiKeyHeader = "X-API-Key"
+
+const maxAPIKeyNameLength = 255
+
+var errInvalidAPIKey = errors.New("Invalid or revoked API key")
+
+// APIKey is a long-lived credential for scripts, acting as the user who
+// created it. Only its hash is stored; the key itself is returned once,
+// when it is created.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// newAPIKey returns a random key and the prefix of it shown in listings.
+func newAPIKey() (key, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:len(apiKeyPrefix)+6], nil
+}
+
+// hashAPIKey is what is stored of key. Keys are random enough that a plain
+// SHA-256 can't be brute-forced.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// principalForAPIKey returns the user key was created by, and records that
+// it was used.
+func principalForAPIKey(ctx context.Context, key string) (principal, error) {
+	var keyID int
+	var user User
+	err := db.QueryRowContext(ctx, `
+SELECT k.id, u.id, u.username, u.role
+FROM api_keys k
+JOIN users u ON u.id = k.user_id
+WHERE k.key_hash = ?`, hashAPIKey(key)).Scan(&keyID, &user.ID, &user.Username, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return principal{}, errInvalidAPIKey
+	}
+	if err != nil {
+		return principal{}, err
+	}
+
+	if _, err = db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now().UTC(), keyID); err != nil {
+		slog.WarnContext(ctx, "Error recording API key use", "ID", keyID, "error", err)
+	}
+	return principal{owner: user.Username, userID: user.ID, role: user.Role}, nil
+}
+
+// ListAPIKeysHandler lists the caller's API keys, without the keys
+// themselves.
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUser(w, r) {
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), "SELECT id, name, prefix, created_at, last_used_at FROM api_keys WHERE user_id = ? ORDER BY id", principalFrom(r.Context()).userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying API keys", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err = rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt); err != nil {
+			slog.ErrorContext(r.Context(), "Error scanning API key", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "Error iterating API keys", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKeyHandler creates an API key named by the body for the caller.
+// The response is the only time the key is shown.
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUser(w, r) {
+		return
+	}
+
+	var data APIKey
+	if err := decodeBody(r, &data); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	var errs validationErrors
+	errs.requireText("name", &data.Name, maxAPIKeyNameLength)
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	key := APIKey{Name: data.Name, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	var err error
+	if key.Key, key.Prefix, err = newAPIKey(); err != nil {
+		slog.ErrorContext(r.Context(), "Error generating API key", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	key.ID, err = dbDialect.insertID(r.Context(), db, "INSERT INTO api_keys (user_id, name, prefix, key_hash, created_at) VALUES (?, ?, ?, ?, ?)",
+		principalFrom(r.Context()).userID, key.Name, key.Prefix, hashAPIKey(key.Key), key.CreatedAt)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error inserting API key", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Created API key", "ID", key.ID, "Name", key.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", apiBase(r.Context())+"/apikeys/"+strconv.Itoa(key.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// DeleteAPIKeyHandler revokes one of the caller's API keys.
+func DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUser(w, r) {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.ExecContext(r.Context(), "DELETE FROM api_keys WHERE id = ? AND user_id = ?", id, principalFrom(r.Context()).userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting API key", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting rows affected", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		writeErrorCode(w, r, codeAPIKeyNotFound, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Revoked API key", "ID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
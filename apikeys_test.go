@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	ctx := context.Background()
+	todoRepo.Create(ctx, principal{owner: alice.Username, userID: alice.ID}, Todo{Task: "Alice's todo"})
+	todoRepo.Create(ctx, principal{owner: bob.Username, userID: bob.ID}, Todo{Task: "Bob's todo"})
+
+	token, _ := issueToken(alice, time.Now())
+	req := httptest.NewRequest("POST", "/apikeys", bytes.NewBufferString(`{"name": "CI"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", status, rr.Body.String())
+	}
+	var created APIKey
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Key, apiKeyPrefix) || !strings.HasPrefix(created.Key, created.Prefix) || created.Name != "CI" {
+		t.Fatalf("Expected a new key named CI, got %+v", created)
+	}
+
+	for name, set := range map[string]func(*http.Request){
+		"X-API-Key":     func(req *http.Request) { req.Header.Set(apiKeyHeader, created.Key) },
+		"Authorization": func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+created.Key) },
+		"Basic auth":    func(req *http.Request) { req.SetBasicAuth("calendar", created.Key) },
+	} {
+		req = httptest.NewRequest("GET", "/todos", nil)
+		set(req)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("Expected status 200 with the key in %s, got %d", name, status)
+		}
+		var todos []Todo
+		json.Unmarshal(rr.Body.Bytes(), &todos)
+		if len(todos) != 1 || todos[0].Task != "Alice's todo" {
+			t.Errorf("Expected only alice's todo with the key in %s, got %+v", name, todos)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/apikeys", nil)
+	req.Header.Set(apiKeyHeader, created.Key)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var keys []APIKey
+	json.Unmarshal(rr.Body.Bytes(), &keys)
+	if len(keys) != 1 || keys[0].ID != created.ID || keys[0].Key != "" || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected the used key without its secret, got %+v", keys)
+	}
+
+	bobToken, _ := issueToken(bob, time.Now())
+	req = httptest.NewRequest("DELETE", "/apikeys/"+strconv.Itoa(created.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+bobToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status 404 revoking someone else's key, got %d", status)
+	}
+
+	req = httptest.NewRequest("DELETE", "/apikeys/"+strconv.Itoa(created.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", status)
+	}
+
+	req = httptest.NewRequest("GET", "/todos", nil)
+	req.Header.Set(apiKeyHeader, created.Key)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with a revoked key, got %d", status)
+	}
+}
+
+func TestAPIKeysNeedAUser(t *testing.T) {
+	router := setupRouter()
+
+	req := httptest.NewRequest("POST", "/apikeys", bytes.NewBufferString(`{"name": "CI"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("Expected status 403 without a user account, got %d", status)
+	}
+}
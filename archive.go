@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var errNotDone = errors.New("Only done todos can be archived")
+
+// ArchiveHandler archives a done todo, leaving it out of the default list
+// of todos. Archiving an archived todo keeps it as it was.
+func ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, true)
+}
+
+// UnarchiveHandler brings an archived todo back into the default list.
+func UnarchiveHandler(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, false)
+}
+
+// setArchived archives or unarchives the todo of the route and answers
+// with the todo, like the other updates of todos.
+func setArchived(w http.ResponseWriter, r *http.Request, archive bool) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	todo, _, err := todoRepo.Update(ctx, principalFrom(ctx), id, func(todo *Todo) error {
+		if err := checkPreconditions(r, *todo, 0); err != nil {
+			return err
+		}
+		switch {
+		case !archive:
+			todo.ArchivedAt = nil
+		case !todo.Done:
+			return errNotDone
+		case todo.ArchivedAt == nil:
+			now := time.Now().UTC().Truncate(time.Second)
+			todo.ArchivedAt = &now
+		}
+		return nil
+	}, UpdateOptions{})
+	if writePreconditionError(w, r, err) {
+		return
+	}
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errNotDone) {
+		writeErrorCode(w, r, codeTodoNotDone, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error archiving todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Archived todo", "ID", id, "archived", archive)
+
+	body, etag, err := encodeWithETag(todo)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// ArchiveDoneHandler archives every done todo the caller can change in one
+// transaction, or only those completed before ?completed_before=, and
+// reports how many it archived.
+func ArchiveDoneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := principalFrom(ctx)
+	scope, args := caller.todoWriteScope("")
+	where := " WHERE done = TRUE AND archived_at IS NULL AND " + scope
+	if v := r.URL.Query().Get("completed_before"); v != "" {
+		before, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, "Invalid completed_before! completed_before must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		where += " AND completed_at < ?"
+		args = append(args, before)
+	}
+
+	var ids []int
+	var events []todoEvent
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT id FROM todos"+where+dbDialect.forUpdate(), args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil || len(ids) == 0 {
+			return err
+		}
+
+		events, err = trackChanges(ctx, tx, caller, ids, func() error {
+			_, err := tx.ExecContext(ctx, "UPDATE todos SET archived_at = ?, version = version + 1"+where,
+				append([]any{time.Now().UTC().Truncate(time.Second)}, args...)...)
+			return err
+		})
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error archiving todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	todoEvents.publishAll(events)
+
+	slog.InfoContext(ctx, "Archived done todos", "count", len(ids))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"archived": len(ids)})
+}
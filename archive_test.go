@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+
+	var paths []string
+	for _, body := range []string{`{"task": "Mow lawn", "done": true}`, `{"task": "Water plants", "done": true}`, `{"task": "Fix gate"}`} {
+		rr := requestAs(router, alice, "POST", "/todos", body)
+		var todo Todo
+		json.Unmarshal(rr.Body.Bytes(), &todo)
+		paths = append(paths, "/todos/"+strconv.Itoa(todo.ID))
+	}
+	mow, water, gate := paths[0], paths[1], paths[2]
+	requestAs(router, bob, "POST", "/todos", `{"task": "Bob's chore", "done": true}`)
+
+	if rr := requestAs(router, alice, "POST", gate+"/archive", ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 archiving an open todo, got %d", rr.Code)
+	}
+	if rr := requestAs(router, bob, "POST", mow+"/archive", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 archiving someone else's todo, got %d", rr.Code)
+	}
+	rr := requestAs(router, alice, "POST", mow+"/archive", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 archiving, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var archived Todo
+	json.Unmarshal(rr.Body.Bytes(), &archived)
+	if archived.ArchivedAt == nil {
+		t.Fatalf("Expected archived_at to be set, got %+v", archived)
+	}
+
+	if todos := getTodosAs(t, router, alice); len(todos) != 2 {
+		t.Errorf("Expected the archived todo left out, got %+v", todos)
+	}
+	rr = requestAs(router, alice, "GET", "/todos?archived=true", "")
+	var todos []Todo
+	json.Unmarshal(rr.Body.Bytes(), &todos)
+	if len(todos) != 1 || todos[0].Task != "Mow lawn" {
+		t.Errorf("Expected only the archived todo, got %+v", todos)
+	}
+	if rr = requestAs(router, alice, "GET", "/todos?archived=maybe", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid archived, got %d", rr.Code)
+	}
+
+	rr = requestAs(router, alice, "PATCH", mow, `{"done": false, "version": `+strconv.Itoa(archived.Version)+`}`)
+	json.Unmarshal(rr.Body.Bytes(), &archived)
+	if archived.ArchivedAt != nil {
+		t.Errorf("Expected reopening a todo to unarchive it, got %v", archived.ArchivedAt)
+	}
+	requestAs(router, alice, "PATCH", mow, `{"done": true, "version": `+strconv.Itoa(archived.Version)+`}`)
+
+	rr = requestAs(router, alice, "POST", "/todos/archive?completed_before=2000-01-01T00:00:00Z", "")
+	var result map[string]int
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if result["archived"] != 0 {
+		t.Errorf("Expected nothing completed before 2000 to archive, got %v", result)
+	}
+	rr = requestAs(router, alice, "POST", "/todos/archive", "")
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if rr.Code != http.StatusOK || result["archived"] != 2 {
+		t.Errorf("Expected both done todos archived, got %d %v", rr.Code, result)
+	}
+	if todos := getTodosAs(t, router, alice); len(todos) != 1 || todos[0].Task != "Fix gate" {
+		t.Errorf("Expected only the open todo left, got %+v", todos)
+	}
+	if todos := getTodosAs(t, router, bob); len(todos) != 1 || todos[0].ArchivedAt != nil {
+		t.Errorf("Expected bob's done todo untouched, got %+v", todos)
+	}
+
+	rr = requestAs(router, alice, "POST", water+"/unarchive", "")
+	json.Unmarshal(rr.Body.Bytes(), &archived)
+	if rr.Code != http.StatusOK || archived.ArchivedAt != nil || !archived.Done {
+		t.Errorf("Expected the todo unarchived, got %d %+v", rr.Code, archived)
+	}
+	if todos := getTodosAs(t, router, alice); len(todos) != 2 {
+		t.Errorf("Expected the unarchived todo back in the list, got %+v", todos)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// errAssigneeRequiresUser is the error of ?assignee=me without a user
+// account to be.
+var errAssigneeRequiresUser = errors.New("Invalid assignee! assignee=me needs a user account")
+
+// parseAssignee reads the assignee filter: me, none for unassigned todos,
+// which is 0, or a user ID.
+func parseAssignee(ctx context.Context, v string) (int, error) {
+	switch v {
+	case "me":
+		id := principalFrom(ctx).userID
+		if id == 0 {
+			return 0, errAssigneeRequiresUser
+		}
+		return id, nil
+	case "none":
+		return 0, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil || id <= 0 {
+		return 0, errors.New("Invalid assignee! assignee must be me, none or a user ID")
+	}
+	return id, nil
+}
+
+// assignee is the body of PUT /todos/{id}/assignee.
+type assignee struct {
+	Username string `json:"username"`
+}
+
+// AssignHandler assigns a todo to a user, given {"username": "bob"}. They
+// must be able to see the todo already, so todos are handed to the members
+// of their list, or to their owner.
+func AssignHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	var data assignee
+	if err = decodeBody(r, &data); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	user := principal{owner: strings.ToLower(strings.TrimSpace(data.Username))}
+	err = db.QueryRowContext(ctx, "SELECT id, role FROM users WHERE username = ?", user.owner).Scan(&user.userID, &user.role)
+	if errors.Is(err, sql.ErrNoRows) {
+		var errs validationErrors
+		errs.add("username", "no such user")
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error looking up user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Checked before Update, which holds a connection for its transaction
+	// that the check would wait on with a pool of one, but reported in it,
+	// once the caller may see the todo.
+	_, err = todoRepo.Get(ctx, user, id)
+	visible := !errors.Is(err, errTodoNotFound)
+	if visible && err != nil {
+		slog.ErrorContext(ctx, "Error getting todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	setAssignee(w, r, id, func() (*int, error) {
+		if !visible {
+			var errs validationErrors
+			errs.add("username", "can't see this todo, share its list with them first")
+			return nil, errs
+		}
+		return &user.userID, nil
+	})
+}
+
+// UnassignHandler takes a todo off its assignee's plate.
+func UnassignHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+	setAssignee(w, r, id, func() (*int, error) { return nil, nil })
+}
+
+// setAssignee changes the assignee of the todo with id to what assignee
+// returns and answers with the todo, like the other updates of todos.
+func setAssignee(w http.ResponseWriter, r *http.Request, id int, assignee func() (*int, error)) {
+	ctx := r.Context()
+	caller := principalFrom(ctx)
+	var reassigned bool
+	todo, _, err := todoRepo.Update(ctx, caller, id, func(todo *Todo) error {
+		if err := checkPreconditions(r, *todo, 0); err != nil {
+			return err
+		}
+		assigneeID, err := assignee()
+		if err != nil {
+			return err
+		}
+		reassigned = assigneeID != nil && (todo.AssigneeID == nil || *todo.AssigneeID != *assigneeID)
+		todo.AssigneeID = assigneeID
+		return nil
+	}, UpdateOptions{})
+	if writePreconditionError(w, r, err) {
+		return
+	}
+	var errs validationErrors
+	if errors.As(err, &errs) {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error assigning todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Assigned todo", "ID", id, "assignee", todo.AssigneeID)
+	if reassigned {
+		queueAssignedEmail(ctx, caller, todo)
+	}
+
+	body, etag, err := encodeWithETag(todo)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAssignee(t *testing.T) {
+	ctx := context.WithValue(context.Background(), principalKey, principal{owner: "bob", userID: 7, role: editorRole})
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"me", 7, false},
+		{"none", 0, false},
+		{"12", 12, false},
+		{"0", 0, true},
+		{"-3", 0, true},
+		{"bob", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAssignee(ctx, tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAssignee(%q) = %d, %v, want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if _, err := parseAssignee(context.Background(), "me"); err != errAssigneeRequiresUser {
+		t.Errorf("Expected errAssigneeRequiresUser without a user, got %v", err)
+	}
+}
+
+func TestAssignees(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	seedUser(t, "carol", editorRole)
+
+	rr := requestAs(router, alice, "POST", "/lists", `{"name": "Chores"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr = requestAs(router, alice, "PUT", "/lists/"+strconv.Itoa(list.ID)+"/members/bob", `{"permission": "write"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 sharing the list, got %d", rr.Code)
+	}
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Mow the lawn", "list_id": `+strconv.Itoa(list.ID)+`, "assignee_id": `+strconv.Itoa(alice.ID)+`}`)
+	var lawn Todo
+	json.Unmarshal(rr.Body.Bytes(), &lawn)
+	if lawn.AssigneeID != nil {
+		t.Errorf("Expected assignee_id to be ignored on create, got %d", *lawn.AssigneeID)
+	}
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Water the plants"}`)
+	var plants Todo
+	json.Unmarshal(rr.Body.Bytes(), &plants)
+	lawnPath := "/todos/" + strconv.Itoa(lawn.ID)
+
+	if rr = requestAs(router, alice, "PUT", lawnPath+"/assignee", `{"username": "nobody"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 assigning an unknown user, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "PUT", lawnPath+"/assignee", `{"username": "carol"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 assigning a user who can't see the todo, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "PUT", "/todos/"+strconv.Itoa(plants.ID)+"/assignee", `{"username": "bob"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 assigning an unshared todo, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "PUT", "/todos/"+strconv.Itoa(plants.ID)+"/assignee", `{"username": "bob"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 assigning someone else's todo, got %d", rr.Code)
+	}
+
+	rr = requestAs(router, alice, "PUT", lawnPath+"/assignee", `{"username": "Bob"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 assigning a list member, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var assigned Todo
+	json.Unmarshal(rr.Body.Bytes(), &assigned)
+	if assigned.AssigneeID == nil || *assigned.AssigneeID != bob.ID {
+		t.Errorf("Expected the todo assigned to bob, got %v", assigned.AssigneeID)
+	}
+	if rr.Header().Get("ETag") == "" {
+		t.Error("Expected an ETag on the assigned todo")
+	}
+
+	// With a single connection, as with DB_MAX_OPEN_CONNS=1, nothing may wait
+	// on a second one while Update's transaction holds it.
+	maxOpen := db.Stats().MaxOpenConnections
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.SetMaxOpenConns(maxOpen) })
+	token, _ := issueToken(alice, time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := httptest.NewRequestWithContext(ctx, "PUT", lawnPath+"/assignee", strings.NewReader(`{"username": "bob"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 assigning with a single connection, got %d: %s", rr.Code, rr.Body.String())
+	}
+	db.SetMaxOpenConns(maxOpen)
+	json.Unmarshal(rr.Body.Bytes(), &assigned)
+
+	if rr = requestAs(router, alice, "PUT", lawnPath, `{"id": `+strconv.Itoa(lawn.ID)+`, "task": "Mow the lawn twice", "list_id": `+strconv.Itoa(list.ID)+`, "version": `+strconv.Itoa(assigned.Version)+`}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 updating the todo, got %d", rr.Code)
+	}
+	var updated Todo
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if updated.AssigneeID == nil || *updated.AssigneeID != bob.ID {
+		t.Errorf("Expected PUT to keep the assignee, got %v", updated.AssigneeID)
+	}
+
+	listIDs := func(user User, query string) []int {
+		t.Helper()
+		rr := requestAs(router, user, "GET", "/todos?"+query, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for ?%s, got %d", query, rr.Code)
+		}
+		var todos []Todo
+		json.Unmarshal(rr.Body.Bytes(), &todos)
+		ids := []int{}
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+	if ids := listIDs(bob, "assignee=me"); len(ids) != 1 || ids[0] != lawn.ID {
+		t.Errorf("Expected bob's assigned todo, got %v", ids)
+	}
+	if ids := listIDs(alice, "assignee=me"); len(ids) != 0 {
+		t.Errorf("Expected nothing assigned to alice, got %v", ids)
+	}
+	if ids := listIDs(alice, "assignee=none"); len(ids) != 1 || ids[0] != plants.ID {
+		t.Errorf("Expected the unassigned todo, got %v", ids)
+	}
+	if ids := listIDs(alice, "assignee="+strconv.Itoa(bob.ID)); len(ids) != 1 || ids[0] != lawn.ID {
+		t.Errorf("Expected the todo assigned to bob by ID, got %v", ids)
+	}
+	if rr = requestAs(router, alice, "GET", "/todos?assignee=someone", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid assignee, got %d", rr.Code)
+	}
+
+	if rr = requestAs(router, bob, "DELETE", lawnPath+"/assignee", ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 unassigning, got %d", rr.Code)
+	}
+	if ids := listIDs(bob, "assignee=me"); len(ids) != 0 {
+		t.Errorf("Expected nothing assigned to bob any more, got %v", ids)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Audit log actions.
+const (
+	auditCreated = "created"
+	auditUpdated = "updated"
+	auditDeleted = "deleted"
+)
+
+var auditActions = []string{auditCreated, auditUpdated, auditDeleted}
+
+// unauditedFields are the fields of a todo that aren't recorded as changes:
+// those the database maintains, and the position, which only matters next
+// to other todos.
+var unauditedFields = []string{"id", "created_at", "updated_at", "version", "comment_count", "position", "subtasks"}
+
+// AuditEntry records a change to a todo: who made it, when, and the values
+// of the fields it changed before and after. Creations only have New and
+// deletions only Old, each with every field.
+type AuditEntry struct {
+	ID        int                        `json:"id"`
+	TodoID    int                        `json:"todo_id"`
+	Action    string                     `json:"action"`
+	Actor     string                     `json:"actor"`
+	UserID    *int                       `json:"user_id"`
+	Old       map[string]json.RawMessage `json:"old"`
+	New       map[string]json.RawMessage `json:"new"`
+	CreatedAt time.Time                  `json:"created_at"`
+}
+
+// auditFields returns the audited fields of todo as JSON values.
+func auditFields(todo Todo) (map[string]json.RawMessage, error) {
+	if todo.Tags == nil {
+		todo.Tags = []string{}
+	}
+	encoded, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range unauditedFields {
+		delete(fields, name)
+	}
+	return fields, nil
+}
+
+// auditedTodo is a todo as the audit log records it, along with its owner,
+// who gets it back when its deletion is undone.
+type auditedTodo struct {
+	Todo
+	owner principal
+}
+
+// recordAudit logs the change of a todo from before to after, either of
+// which is nil when the todo was created or deleted. Updates that leave
+// every audited field as it was aren't logged.
+func recordAudit(ctx context.Context, q dbtx, caller principal, before, after *auditedTodo) error {
+	entry := AuditEntry{Action: auditUpdated}
+	var owner principal
+	var err error
+	if before != nil {
+		entry.TodoID, owner = before.ID, before.owner
+		if entry.Old, err = auditFields(before.Todo); err != nil {
+			return err
+		}
+	} else {
+		entry.Action = auditCreated
+	}
+	if after != nil {
+		entry.TodoID, owner = after.ID, after.owner
+		if entry.New, err = auditFields(after.Todo); err != nil {
+			return err
+		}
+	} else {
+		entry.Action = auditDeleted
+	}
+
+	if entry.Action == auditUpdated {
+		for name, value := range entry.Old {
+			if bytes.Equal(value, entry.New[name]) {
+				delete(entry.Old, name)
+				delete(entry.New, name)
+			}
+		}
+		if len(entry.Old) == 0 {
+			return nil
+		}
+	}
+
+	old, err := auditValues(entry.Old)
+	if err != nil {
+		return err
+	}
+	values, err := auditValues(entry.New)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO audit_log (todo_id, action, actor, user_id, old_values, new_values, todo_owner, todo_user_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.TodoID, entry.Action, caller.owner, caller.userIDValue(), old, values, owner.owner, owner.userIDValue(), time.Now().UTC())
+	return err
+}
+
+// auditValues encodes the fields of an entry for its column, NULL without
+// any.
+func auditValues(fields map[string]json.RawMessage) (any, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(fields)
+	return string(encoded), err
+}
+
+// snapshotTodos returns the todos with ids that exist, by id, regardless of
+// who they belong to.
+func snapshotTodos(ctx context.Context, q dbtx, ids []int) (map[int]auditedTodo, error) {
+	snapshot := make(map[int]auditedTodo, len(ids))
+	if len(ids) == 0 {
+		return snapshot, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.QueryContext(ctx, "SELECT "+todoColumns+", owner, user_id FROM todos WHERE id IN ("+placeholders(len(ids))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []Todo
+	var owners []principal
+	for rows.Next() {
+		var owner principal
+		var userID sql.NullInt64
+		todo, err := scanTodo(rows, &owner.owner, &userID)
+		if err != nil {
+			return nil, err
+		}
+		owner.userID = int(userID.Int64)
+		todos, owners = append(todos, todo), append(owners, owner)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err = loadTags(ctx, q, todos); err != nil {
+		return nil, err
+	}
+	for i, todo := range todos {
+		snapshot[todo.ID] = auditedTodo{Todo: todo, owner: owners[i]}
+	}
+	return snapshot, nil
+}
+
+// auditChanges runs apply, which writes to the todos with ids, and logs
+// what it did to each of them as the caller. q should be the transaction
+// apply writes in, so the log is kept if and only if the changes are.
+func auditChanges(ctx context.Context, q dbtx, caller principal, ids []int, apply func() error) error {
+	_, err := trackChanges(ctx, q, caller, ids, apply)
+	return err
+}
+
+// trackChanges is auditChanges that also returns the events for what apply
+// did, to publish once the transaction commits. Todos are only updated
+// when they got a new version.
+func trackChanges(ctx context.Context, q dbtx, caller principal, ids []int, apply func() error) ([]todoEvent, error) {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	before, err := snapshotTodos(ctx, q, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err = apply(); err != nil {
+		return nil, err
+	}
+	after, err := snapshotTodos(ctx, q, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []todoEvent
+	for _, id := range ids {
+		var old, todo *auditedTodo
+		if t, ok := before[id]; ok {
+			old = &t
+		}
+		if t, ok := after[id]; ok {
+			todo = &t
+		}
+		switch {
+		case old == nil && todo == nil:
+			continue
+		case old == nil:
+			events = append(events, todoEvent{Type: "created", Todo: todo.Todo, owner: todo.owner})
+		case todo == nil:
+			events = append(events, todoEvent{Type: "deleted", Todo: old.Todo, owner: old.owner})
+		case todo.Version != old.Version:
+			events = append(events, todoEvent{Type: "updated", Todo: todo.Todo, owner: todo.owner, completed: !old.Done && todo.Done})
+		}
+		if err = recordAudit(ctx, q, caller, old, todo); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// auditCreation logs the creation of the todo with id as the caller.
+func auditCreation(ctx context.Context, q dbtx, caller principal, id int) error {
+	snapshot, err := snapshotTodos(ctx, q, []int{id})
+	if err != nil {
+		return err
+	}
+	todo := snapshot[id]
+	return recordAudit(ctx, q, caller, nil, &todo)
+}
+
+// withDescendants adds the subtasks below each of the todos with ids to
+// them, as deleting a todo deletes those too.
+func withDescendants(ctx context.Context, q dbtx, ids []int) ([]int, error) {
+	all := slices.Clone(ids)
+	for _, id := range ids {
+		descendants, err := descendantIDs(ctx, q, id)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, descendants...)
+	}
+	return all, nil
+}
+
+// auditFilter narrows down the entries of the audit log.
+type auditFilter struct {
+	todoID        int
+	actor, action string
+	since, until  *time.Time
+	limit, offset int
+}
+
+// parseAuditFilter reads ?todo_id=, ?actor=, ?action=, the RFC3339 ?since=
+// and ?until=, and paging.
+func parseAuditFilter(r *http.Request) (auditFilter, error) {
+	query := r.URL.Query()
+	filter := auditFilter{actor: query.Get("actor"), action: query.Get("action")}
+	var err error
+	if filter.limit, err = parseLimit(r); err != nil {
+		return filter, err
+	}
+	if filter.offset, err = parseOffset(r); err != nil {
+		return filter, err
+	}
+	if v := query.Get("todo_id"); v != "" {
+		if filter.todoID, err = strconv.Atoi(v); err != nil {
+			return filter, errors.New("Invalid todo_id! todo_id must be an integer")
+		}
+	}
+	if filter.action != "" && !slices.Contains(auditActions, filter.action) {
+		return filter, fmt.Errorf("Invalid action! action must be one of %s", strings.Join(auditActions, ", "))
+	}
+	bounds := []struct {
+		param string
+		at    **time.Time
+	}{{"since", &filter.since}, {"until", &filter.until}}
+	for _, bound := range bounds {
+		v := query.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid %s! %s must be an RFC3339 timestamp", bound.param, bound.param)
+		}
+		t = t.UTC()
+		*bound.at = &t
+	}
+	return filter, nil
+}
+
+// queryAudit returns the entries matching filter, newest first.
+func queryAudit(ctx context.Context, filter auditFilter) ([]AuditEntry, error) {
+	where, args := []string{"1 = 1"}, []any{}
+	if filter.todoID != 0 {
+		where, args = append(where, "todo_id = ?"), append(args, filter.todoID)
+	}
+	if filter.actor != "" {
+		where, args = append(where, "actor = ?"), append(args, filter.actor)
+	}
+	if filter.action != "" {
+		where, args = append(where, "action = ?"), append(args, filter.action)
+	}
+	if filter.since != nil {
+		where, args = append(where, "created_at >= ?"), append(args, *filter.since)
+	}
+	if filter.until != nil {
+		where, args = append(where, "created_at < ?"), append(args, *filter.until)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT id, todo_id, action, actor, user_id, old_values, new_values, created_at
+FROM audit_log
+WHERE `+strings.Join(where, " AND ")+`
+ORDER BY id DESC
+LIMIT ? OFFSET ?`, append(args, filter.limit, filter.offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var userID sql.NullInt64
+		var old, values sql.NullString
+		if err = rows.Scan(&entry.ID, &entry.TodoID, &entry.Action, &entry.Actor, &userID, &old, &values, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			entry.UserID = &id
+		}
+		if old.Valid {
+			if err = json.Unmarshal([]byte(old.String), &entry.Old); err != nil {
+				return nil, err
+			}
+		}
+		if values.Valid {
+			if err = json.Unmarshal([]byte(values.String), &entry.New); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// writeAudit replies with the entries matching filter.
+func writeAudit(w http.ResponseWriter, r *http.Request, filter auditFilter) {
+	entries, err := queryAudit(r.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying audit log", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// TodoHistoryHandler lists the changes made to a todo the caller can see,
+// newest first.
+func TodoHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.todoID = id
+
+	_, err = todoRepo.Get(ctx, principalFrom(ctx), id)
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error querying todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAudit(w, r, filter)
+}
+
+// AuditHandler lists the changes made to every todo, newest first, for
+// admins. Deleted todos are only found here.
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeAudit(w, r, filter)
+}
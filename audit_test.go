@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func clearAudit(t *testing.T) {
+	t.Helper()
+	if _, err := db.Exec("DELETE FROM audit_log"); err != nil {
+		t.Fatalf("Failed to clear the audit log: %v", err)
+	}
+}
+
+// auditEntries fetches path as user, expecting a list of audit entries.
+func auditEntries(t *testing.T, router http.Handler, user User, path string) []AuditEntry {
+	t.Helper()
+	rr := requestAs(router, user, "GET", path, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %s, got %d: %s", path, rr.Code, rr.Body.String())
+	}
+	var entries []AuditEntry
+	json.Unmarshal(rr.Body.Bytes(), &entries)
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	clearAudit(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	admin := seedUser(t, "root", adminRole)
+
+	rr := requestAs(router, alice, "POST", "/todos", `{"task": "Plan trip", "priority": "low"}`)
+	var todo Todo
+	json.Unmarshal(rr.Body.Bytes(), &todo)
+	path := "/todos/" + strconv.Itoa(todo.ID)
+	rr = requestAs(router, alice, "PATCH", path, `{"done": true, "priority": "high", "version": `+strconv.Itoa(todo.Version)+`}`)
+	json.Unmarshal(rr.Body.Bytes(), &todo)
+	requestAs(router, alice, "PATCH", path, `{"done": true, "version": `+strconv.Itoa(todo.Version)+`}`)
+	requestAs(router, alice, "PUT", path+"/tags/travel", "")
+
+	entries := auditEntries(t, router, alice, path+"/history")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 changes, without the one changing nothing, got %+v", entries)
+	}
+	created, patched, tagged := entries[2], entries[1], entries[0]
+	if created.Action != auditCreated || created.Old != nil || string(created.New["task"]) != `"Plan trip"` {
+		t.Errorf("Unexpected creation %+v", created)
+	}
+	if created.Actor != "alice" || created.UserID == nil || *created.UserID != alice.ID {
+		t.Errorf("Expected alice as the actor, got %q (%v)", created.Actor, created.UserID)
+	}
+	if patched.Action != auditUpdated || len(patched.Old) != 2 ||
+		string(patched.Old["done"]) != "false" || string(patched.New["done"]) != "true" ||
+		string(patched.Old["priority"]) != `"low"` || string(patched.New["priority"]) != `"high"` {
+		t.Errorf("Expected the update to record done and priority, got %+v", patched)
+	}
+	if string(tagged.Old["tags"]) != "[]" || string(tagged.New["tags"]) != `["travel"]` {
+		t.Errorf("Expected the tag change, got %+v", tagged)
+	}
+	if entries := auditEntries(t, router, alice, path+"/history?action=created"); len(entries) != 1 {
+		t.Errorf("Expected the creation alone, got %+v", entries)
+	}
+	if rr = requestAs(router, bob, "GET", path+"/history", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for the history of someone else's todo, got %d", rr.Code)
+	}
+
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Book hotel", "parent_id": `+strconv.Itoa(todo.ID)+`}`)
+	var subtask Todo
+	json.Unmarshal(rr.Body.Bytes(), &subtask)
+	if rr = requestAs(router, alice, "DELETE", path, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting the todo, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "GET", path+"/history", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for the history of a deleted todo, got %d", rr.Code)
+	}
+	for _, id := range []int{todo.ID, subtask.ID} {
+		entries := auditEntries(t, router, admin, "/audit?action=deleted&todo_id="+strconv.Itoa(id))
+		if len(entries) != 1 || entries[0].Actor != "alice" || entries[0].New != nil || entries[0].Old["task"] == nil {
+			t.Errorf("Expected the deletion of todo %d with its values, got %+v", id, entries)
+		}
+	}
+
+	var ids []int
+	for _, task := range []string{"One", "Two"} {
+		rr = requestAs(router, bob, "POST", "/todos", `{"task": "`+task+`"}`)
+		var todo Todo
+		json.Unmarshal(rr.Body.Bytes(), &todo)
+		ids = append(ids, todo.ID)
+	}
+	requestAs(router, bob, "POST", "/todos/complete", `{"ids": [`+strconv.Itoa(ids[0])+`]}`)
+	requestAs(router, bob, "POST", "/todos/batch-delete", `{"ids": [`+strconv.Itoa(ids[0])+`, `+strconv.Itoa(ids[1])+`]}`)
+	if entries := auditEntries(t, router, admin, "/audit?actor=bob&action=updated"); len(entries) != 1 || entries[0].TodoID != ids[0] {
+		t.Errorf("Expected bob's bulk completion, got %+v", entries)
+	}
+	if entries := auditEntries(t, router, admin, "/audit?actor=bob&action=deleted"); len(entries) != 2 {
+		t.Errorf("Expected bob's batch deletion, got %+v", entries)
+	}
+	if entries := auditEntries(t, router, admin, "/audit?limit=2"); len(entries) != 2 || entries[0].ID < entries[1].ID {
+		t.Errorf("Expected a page of the newest changes, got %+v", entries)
+	}
+	since := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if entries := auditEntries(t, router, admin, "/audit?since="+since); len(entries) != 0 {
+		t.Errorf("Expected no changes in the future, got %+v", entries)
+	}
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if entries := auditEntries(t, router, admin, "/audit?limit=100&until="+until); len(entries) != 11 {
+		t.Errorf("Expected every change before now, got %d", len(entries))
+	}
+
+	if rr = requestAs(router, alice, "GET", "/audit", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a non-admin, got %d", rr.Code)
+	}
+	if rr = requestAs(router, admin, "GET", "/audit?action=renamed", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown action, got %d", rr.Code)
+	}
+	if rr = requestAs(router, admin, "GET", "/audit?since=yesterday", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid since, got %d", rr.Code)
+	}
+}
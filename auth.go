@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// adminAPIKey guards the /admin endpoints. It is set from ADMIN_API_KEY;
+// when empty the admin endpoints are disabled.
+var adminAPIKey string
+
+// requireAdminKey only lets requests through that carry the admin API key
+// in the X-API-Key header.
+func requireAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminAPIKey == "" {
+			writeErrorCode(w, r, codeAdminAPIDisabled, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+		key := r.Header.Get(apiKeyHeader)
+		if subtle.ConstantTimeCompare([]byte(key), []byte(adminAPIKey)) != 1 {
+			writeErrorCode(w, r, codeInvalidAdminKey, "Invalid or missing API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jwtSecret signs and verifies the access tokens issued by /auth/login. It
+// is set from JWT_SECRET with AUTH_MODE=jwt; when nil, requests are
+// identified by the X-Owner header instead.
+var jwtSecret []byte
+
+// minJWTSecretLength is the shortest JWT_SECRET accepted, the size of the
+// HS256 hash.
+const minJWTSecretLength = 32
+
+// tokenTTL is how long access tokens stay valid. It is set from JWT_TTL.
+var tokenTTL = 24 * time.Hour
+
+var (
+	errInvalidToken       = errors.New("Invalid or expired token")
+	errMissingCredentials = errors.New("Missing bearer token or API key")
+)
+
+// tokenClaims are the claims of an access token. The subject is the user ID.
+type tokenClaims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// issueToken returns a signed access token for user.
+func issueToken(user User, now time.Time) (string, error) {
+	claims := tokenClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+}
+
+// parseToken verifies an access token and returns the principal it was
+// issued to, with the role it had then.
+func parseToken(token string) (principal, error) {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return principal{}, errInvalidToken
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 || claims.Username == "" {
+		return principal{}, errInvalidToken
+	}
+	return principal{owner: claims.Username, userID: userID, role: claims.Role}, nil
+}
+
+// authenticate returns who the access token or API key of r belongs to.
+// API keys can come in the X-API-Key header, as a bearer token, or as the
+// password of HTTP Basic auth for clients like calendar apps that can't
+// send anything else.
+func authenticate(r *http.Request) (principal, error) {
+	return authenticateCredentials(r.Context(), r.Header.Get(apiKeyHeader), r.Header.Get("Authorization"))
+}
+
+// authenticateCredentials is authenticate for the values of the X-API-Key
+// and Authorization headers, wherever they were sent.
+func authenticateCredentials(ctx context.Context, apiKey, authorization string) (principal, error) {
+	if apiKey != "" {
+		return principalForAPIKey(ctx, apiKey)
+	}
+	if key, ok := basicAuthAPIKey(authorization); ok {
+		return principalForAPIKey(ctx, key)
+	}
+	token, ok := bearerToken(authorization)
+	if !ok {
+		return principal{}, errMissingCredentials
+	}
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return principalForAPIKey(ctx, token)
+	}
+	caller, err := parseToken(token)
+	if err != nil {
+		return caller, err
+	}
+	return currentUser(ctx, caller)
+}
+
+// currentUser returns the caller of an access token as their account is
+// now, so that demoting or deleting a user takes effect right away rather
+// than when their tokens expire. Tokens of deleted users are invalid.
+func currentUser(ctx context.Context, caller principal) (principal, error) {
+	err := db.QueryRowContext(ctx, "SELECT username, role FROM users WHERE id = ?", caller.userID).Scan(&caller.owner, &caller.role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return principal{}, errInvalidToken
+	}
+	return caller, err
+}
+
+// basicAuthAPIKey returns the password of an "Authorization: Basic" header,
+// which must be an API key; the username is ignored. Account passwords are
+// never accepted this way.
+func basicAuthAPIKey(authorization string) (string, bool) {
+	r := http.Request{Header: http.Header{"Authorization": {authorization}}}
+	_, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	return password, true
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// maxBatchSize caps how many todos a single batch request may touch, set
+// from MAX_BATCH_SIZE.
+var maxBatchSize = 100
+
+type batchRequest struct {
+	IDs  []int `json:"ids"`
+	Done *bool `json:"done"`
+}
+
+// decodeBatch reads a batch request body and checks the id list isn't empty
+// or larger than maxBatchSize.
+func decodeBatch(r *http.Request) (batchRequest, error) {
+	var data batchRequest
+	if err := decodeBody(r, &data); err != nil {
+		return data, err
+	}
+	if errs := checkBatchSize("ids", len(data.IDs)); errs != nil {
+		return data, errs
+	}
+	return data, nil
+}
+
+// checkBatchSize checks a batch of n entries isn't empty or larger than
+// maxBatchSize.
+func checkBatchSize(field string, n int) validationErrors {
+	var errs validationErrors
+	if n == 0 {
+		errs.add(field, "must not be empty")
+	} else if n > maxBatchSize {
+		errs.add(field, "must contain at most %d entries", maxBatchSize)
+	}
+	return errs
+}
+
+// placeholders returns n comma separated "?" placeholders for an IN clause.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// BatchDeleteHandler deletes every todo listed in {"ids": [...]} and
+// reports how many were deleted. Ids that don't exist or belong to someone
+// else are ignored.
+func BatchDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := decodeBatch(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	var results []bulkResult
+	var events []todoEvent
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		results, events, err = bulkApply(ctx, tx, principalFrom(ctx), data.IDs, "DELETE FROM todos", "deleted")
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error deleting todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	todoEvents.publishAll(events)
+	deleted := 0
+	for _, result := range results {
+		if result.Status != bulkNotFound {
+			deleted++
+		}
+	}
+
+	slog.InfoContext(ctx, "Batch deleted todos", "requested", len(data.IDs), "deleted", deleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+}
+
+// BatchUpdateHandler sets the done flag of every todo listed in
+// {"ids": [...], "done": true} and reports how many were changed. Todos
+// already in the requested state aren't counted.
+func BatchUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := decodeBatch(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if data.Done == nil {
+		writeError(w, r, "done is required", http.StatusBadRequest)
+		return
+	}
+
+	var events []todoEvent
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		_, events, err = bulkApply(ctx, tx, principalFrom(ctx), data.IDs, `
+UPDATE todos
+SET version = CASE WHEN done = ? THEN version ELSE version + 1 END,
+    done = ?, completed_at = CASE WHEN ? THEN COALESCE(completed_at, CURRENT_TIMESTAMP) END`,
+			"updated", *data.Done, *data.Done, *data.Done)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	todoEvents.publishAll(events)
+	// Only the todos that changed are updated.
+	updated := len(events)
+
+	slog.InfoContext(ctx, "Batch updated todos", "requested", len(data.IDs), "updated", updated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"updated": updated})
+}
+
+// BatchCreateHandler creates every todo in a JSON array in a single
+// transaction and returns them with their IDs. Nothing is created when any
+// of them is invalid.
+func BatchCreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var todos []Todo
+	if err := decodeBody(r, &todos); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	errs := checkBatchSize("todos", len(todos))
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	for i := range todos {
+		todoErrs := validateTodo(&todos[i])
+		todoErrs = append(todoErrs, checkDueDate(todos[i], nil)...)
+		errs = append(errs, indexErrors(i, todoErrs)...)
+	}
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		for i := range todos {
+			refErrs, err := checkTodoRefs(ctx, tx, caller, todos[i])
+			if err != nil {
+				return err
+			}
+			errs = append(errs, indexErrors(i, refErrs)...)
+		}
+		if errs != nil {
+			return errs
+		}
+
+		for i := range todos {
+			id, err := insertTodo(ctx, tx, caller, todos[i])
+			if err != nil {
+				return err
+			}
+			todos[i].ID = id
+			if err = loadTimestamps(ctx, tx, &todos[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, todo := range todos {
+		todoEvents.publish(todoEvent{Type: "created", Todo: todo, owner: caller})
+	}
+	slog.InfoContext(ctx, "Batch created todos", "created", len(todos))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(todos)
+}
+
+// indexErrors points the errors of the i-th todo of a batch at it.
+func indexErrors(i int, errs validationErrors) validationErrors {
+	for j := range errs {
+		errs[j].Field = fmt.Sprintf("[%d].%s", i, errs[j].Field)
+	}
+	return errs
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchDeleteHandler(t *testing.T) {
+	clearTodos(t)
+	first := seedTodo(t, "first", true)
+	second := seedTodo(t, "second", true)
+	kept := seedTodo(t, "kept", false)
+
+	router := setupRouter()
+
+	body := strings.NewReader(fmt.Sprintf(`{"ids":[%d,%d,999999]}`, first, second))
+	req := httptest.NewRequest("POST", "/todos/batch-delete", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var result map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if result["deleted"] != 2 {
+		t.Errorf("Expected 2 deleted, got %d", result["deleted"])
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM todos WHERE id = ?", kept).Scan(&count); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected unlisted todo to survive")
+	}
+}
+
+func TestBatchDeleteHandlerRejectsBadLists(t *testing.T) {
+	router := setupRouter()
+
+	tooMany := make([]string, maxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = "1"
+	}
+
+	for _, body := range []string{`{"ids":[]}`, `{"ids":[` + strings.Join(tooMany, ",") + `]}`} {
+		req := httptest.NewRequest("POST", "/todos/batch-delete", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422, got %d", status)
+		}
+	}
+}
+
+func TestBatchUpdateHandler(t *testing.T) {
+	clearTodos(t)
+	first := seedTodo(t, "first", false)
+	second := seedTodo(t, "second", false)
+	untouched := seedTodo(t, "untouched", false)
+
+	router := setupRouter()
+	events := publishedEvents(t)
+
+	body := strings.NewReader(fmt.Sprintf(`{"ids":[%d,%d],"done":true}`, first, second))
+	req := httptest.NewRequest("POST", "/todos/batch-update", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var result map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if result["updated"] != 2 {
+		t.Errorf("Expected 2 updated, got %d", result["updated"])
+	}
+
+	var done bool
+	if err := db.QueryRow("SELECT done FROM todos WHERE id = ?", untouched).Scan(&done); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if done {
+		t.Errorf("Expected unlisted todo to stay undone")
+	}
+	for _, id := range []int{first, second} {
+		if event := <-events; event.Type != "updated" || !event.completed || event.Todo.ID != id {
+			t.Errorf("Expected todo %d completed, got %+v", id, event)
+		}
+	}
+}
+
+func TestBatchUpdateHandlerRequiresDone(t *testing.T) {
+	router := setupRouter()
+
+	req := httptest.NewRequest("POST", "/todos/batch-update", strings.NewReader(`{"ids":[1]}`))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", status)
+	}
+}
+
+func TestBatchCreateHandler(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	body := strings.NewReader(`[{"task":"first"},{"task":"second","done":true,"tags":["work"]}]`)
+	req := httptest.NewRequest("POST", "/todos/batch", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 2 || todos[0].ID == 0 || todos[1].ID == 0 || todos[1].Tags[0] != "work" {
+		t.Fatalf("Expected 2 created todos with IDs, got %+v", todos)
+	}
+	if count := countTodos(t); count != 2 {
+		t.Errorf("Expected 2 todos in the database, got %d", count)
+	}
+}
+
+func TestBatchCreateHandlerIsAllOrNothing(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	body := strings.NewReader(`[{"task":"fine"},{"task":"  "}]`)
+	req := httptest.NewRequest("POST", "/todos/batch", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d", status)
+	}
+	if !strings.Contains(rr.Body.String(), `"[1].task"`) {
+		t.Errorf("Expected the error to point at [1].task, got %s", rr.Body.String())
+	}
+	if count := countTodos(t); count != 0 {
+		t.Errorf("Expected no todos to be created, got %d", count)
+	}
+}
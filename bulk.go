@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// bulkResult reports what happened to one todo of a bulk operation.
+type bulkResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+const bulkNotFound = "not_found"
+
+// parseIDList reads a comma separated ?ids= list, with the same limits as
+// a batch request body.
+func parseIDList(v string) ([]int, error) {
+	if v == "" {
+		return nil, errors.New("ids must not be empty")
+	}
+	parts := strings.Split(v, ",")
+	if len(parts) > maxBatchSize {
+		return nil, fmt.Errorf("ids must contain at most %d entries", maxBatchSize)
+	}
+	ids := make([]int, len(parts))
+	for i, part := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid id %q! ids must be integers", part)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// bulkApply locks the caller's todos among ids, runs stmt on them and
+// returns a result per requested id: status for the todos that exist and
+// bulkNotFound for the rest, along with the events to publish once tx
+// commits. stmt gets stmtArgs, then the ids followed by the caller's scope
+// as arguments. The bulk and batch endpoints all go through it.
+func bulkApply(ctx context.Context, tx *sql.Tx, caller principal, ids []int, stmt, status string, stmtArgs ...any) ([]bulkResult, []todoEvent, error) {
+	scope, scopeArgs := caller.todoWriteScope("")
+	var args []any
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, scopeArgs...)
+	where := " WHERE id IN (" + placeholders(len(ids)) + ") AND " + scope
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM todos"+where+dbDialect.forUpdate(), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	found := make(map[int]bool, len(ids))
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		found[id] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var events []todoEvent
+	if len(found) > 0 {
+		// Deleting todos deletes their subtasks too.
+		audited, err := withDescendants(ctx, tx, slices.Collect(maps.Keys(found)))
+		if err != nil {
+			return nil, nil, err
+		}
+		events, err = trackChanges(ctx, tx, caller, audited, func() error {
+			_, err := tx.ExecContext(ctx, stmt+where, append(stmtArgs, args...)...)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	results := make([]bulkResult, len(ids))
+	for i, id := range ids {
+		results[i] = bulkResult{ID: id, Status: bulkNotFound}
+		if found[id] {
+			results[i].Status = status
+		}
+	}
+	return results, events, nil
+}
+
+// BulkDeleteHandler deletes the todos listed in ?ids=1,2,3 in one
+// transaction and reports the outcome for each id.
+func BulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ids, err := parseIDList(r.URL.Query().Get("ids"))
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var results []bulkResult
+	var events []todoEvent
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		results, events, err = bulkApply(ctx, tx, principalFrom(ctx), ids, "DELETE FROM todos", "deleted")
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error deleting todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	todoEvents.publishAll(events)
+
+	slog.InfoContext(ctx, "Bulk deleted todos", "requested", len(ids))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]bulkResult{"results": results})
+}
+
+// CompleteHandler marks the todos listed in {"ids": [...]} done in one
+// transaction and reports the outcome for each id.
+func CompleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := decodeBatch(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	var results []bulkResult
+	var events []todoEvent
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		results, events, err = bulkApply(ctx, tx, principalFrom(ctx), data.IDs,
+			"UPDATE todos SET "+completeAssignments, "completed")
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error completing todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	todoEvents.publishAll(events)
+
+	slog.InfoContext(ctx, "Bulk completed todos", "requested", len(data.IDs))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]bulkResult{"results": results})
+}
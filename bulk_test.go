@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBulkDeleteHandler(t *testing.T) {
+	clearTodos(t)
+	first := seedTodo(t, "first", false)
+	kept := seedTodo(t, "kept", false)
+
+	router := setupRouter()
+	events := publishedEvents(t)
+
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/todos?ids=%d,999999", first), nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var body struct {
+		Results []bulkResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	want := []bulkResult{{ID: first, Status: "deleted"}, {ID: 999999, Status: "not_found"}}
+	if fmt.Sprint(body.Results) != fmt.Sprint(want) {
+		t.Errorf("Expected results %v, got %v", want, body.Results)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM todos WHERE id = ?", kept).Scan(&count); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected unlisted todo to survive")
+	}
+	if event := <-events; event.Type != "deleted" || event.Todo.ID != first {
+		t.Errorf("Expected todo %d deleted, got %+v", first, event)
+	}
+}
+
+func TestBulkDeleteHandlerRejectsBadIDs(t *testing.T) {
+	router := setupRouter()
+
+	for _, query := range []string{"", "?ids=", "?ids=1,two"} {
+		req := httptest.NewRequest("DELETE", "/todos"+query, nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, status)
+		}
+	}
+}
+
+func TestCompleteHandler(t *testing.T) {
+	clearTodos(t)
+	pending := seedTodo(t, "pending", false)
+	done := seedTodo(t, "already done", true)
+
+	router := setupRouter()
+
+	body := strings.NewReader(fmt.Sprintf(`{"ids":[%d,%d,999999]}`, pending, done))
+	req := httptest.NewRequest("POST", "/todos/complete", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var result struct {
+		Results []bulkResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	want := []bulkResult{{ID: pending, Status: "completed"}, {ID: done, Status: "completed"}, {ID: 999999, Status: "not_found"}}
+	if fmt.Sprint(result.Results) != fmt.Sprint(want) {
+		t.Errorf("Expected results %v, got %v", want, result.Results)
+	}
+
+	var isDone bool
+	if err := db.QueryRow("SELECT done FROM todos WHERE id = ?", pending).Scan(&isDone); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if !isDone {
+		t.Errorf("Expected todo %d to be done", pending)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// businessHours describes the window due dates must fall in when the
+// enforce_business_hours feature flag is on.
+type businessHours struct {
+	days     [7]bool       // indexed by time.Weekday
+	open     time.Duration // offset from midnight, inclusive
+	close    time.Duration // offset from midnight, exclusive
+	location *time.Location
+}
+
+// enforcedBusinessHours is nil unless ENFORCE_BUSINESS_HOURS is enabled.
+var enforcedBusinessHours *businessHours
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// loadBusinessHours reads the business hours configuration. It returns nil when ENFORCE_BUSINESS_HOURS isn't set to true.
+//
+//	BUSINESS_HOURS  opening and closing time, default "09:00-17:00"
+//	BUSINESS_DAYS   day range or comma separated list, default "Mon-Fri"
+//	BUSINESS_TZ     IANA time zone the hours are expressed in, default UTC
+func loadBusinessHours() (*businessHours, error) {
+	enforce, _ := strconv.ParseBool(conf.get("ENFORCE_BUSINESS_HOURS"))
+	if !enforce {
+		return nil, nil
+	}
+
+	return parseBusinessHours(
+		conf.get("BUSINESS_HOURS"),
+		conf.get("BUSINESS_DAYS"),
+		conf.get("BUSINESS_TZ"),
+	)
+}
+
+func parseBusinessHours(hours, days, tz string) (*businessHours, error) {
+	var b businessHours
+	var err error
+
+	b.location, err = time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid business time zone %q: %w", tz, err)
+	}
+
+	openStr, closeStr, ok := strings.Cut(hours, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid business hours %q, expected HH:MM-HH:MM", hours)
+	}
+	if b.open, err = parseClock(openStr); err != nil {
+		return nil, err
+	}
+	if b.close, err = parseClock(closeStr); err != nil {
+		return nil, err
+	}
+	if b.open >= b.close {
+		return nil, fmt.Errorf("invalid business hours %q, opening must be before closing", hours)
+	}
+
+	for _, part := range strings.Split(days, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, ok := weekdayNames[strings.ToLower(first)]
+		if !ok {
+			return nil, fmt.Errorf("invalid business day %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdayNames[strings.ToLower(last)]; !ok {
+				return nil, fmt.Errorf("invalid business day %q", last)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			b.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+
+	return &b, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether t falls inside business hours.
+func (b *businessHours) contains(t time.Time) bool {
+	t = t.In(b.location)
+	if !b.days[t.Weekday()] {
+		return false
+	}
+	offset := clockOffset(t)
+	return offset >= b.open && offset < b.close
+}
+
+// nextSlot returns the earliest time at or after t that falls inside
+// business hours, used as the suggestion when a due date is rejected.
+func (b *businessHours) nextSlot(t time.Time) time.Time {
+	t = t.In(b.location)
+	if b.contains(t) {
+		return t
+	}
+
+	day := 0
+	if clockOffset(t) >= b.open {
+		day = 1
+	}
+	for ; day <= 7; day++ {
+		// time.Date normalizes the day and nanosecond overflow on the wall
+		// clock, so DST transitions don't shift the opening time.
+		slot := time.Date(t.Year(), t.Month(), t.Day()+day, 0, 0, 0, int(b.open), b.location)
+		if b.days[slot.Weekday()] {
+			return slot
+		}
+	}
+	return t
+}
+
+// clockOffset returns the wall clock time of day of t as an offset from
+// midnight.
+func clockOffset(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+}
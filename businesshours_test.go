@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusinessHoursSuggestsNextSlotForWeekend(t *testing.T) {
+	hours, err := parseBusinessHours("09:00-17:00", "Mon-Fri", "UTC")
+	if err != nil {
+		t.Fatalf("Failed to parse business hours: %v", err)
+	}
+
+	// Saturday afternoon
+	due := time.Date(2025, time.March, 15, 14, 30, 0, 0, time.UTC)
+	if hours.contains(due) {
+		t.Fatalf("Expected %v to be outside business hours", due)
+	}
+
+	want := time.Date(2025, time.March, 17, 9, 0, 0, 0, time.UTC)
+	if got := hours.nextSlot(due); !got.Equal(want) {
+		t.Errorf("Expected suggestion %v, got %v", want, got)
+	}
+}
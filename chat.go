@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Webhook formats. json webhooks get the webhookPayload; slack and discord
+// ones get a message for the incoming webhooks of those apps to post in a
+// channel.
+const (
+	jsonWebhookFormat    = "json"
+	slackWebhookFormat   = "slack"
+	discordWebhookFormat = "discord"
+)
+
+var webhookFormats = []string{jsonWebhookFormat, slackWebhookFormat, discordWebhookFormat}
+
+// chatWebhookEvents are what chat webhooks subscribe to without events.
+var chatWebhookEvents = []string{"created", "completed"}
+
+// chatTitles head the chat message of each event.
+var chatTitles = map[string]string{
+	"created":   "New todo",
+	"updated":   "Todo updated",
+	"deleted":   "Todo deleted",
+	"completed": "Todo completed",
+	"reminder":  "Reminder",
+}
+
+// discordColors mark the embed of each event, green for good news.
+var discordColors = map[string]int{
+	"created":   0x3498db,
+	"updated":   0x95a5a6,
+	"deleted":   0xe74c3c,
+	"completed": 0x2ecc71,
+	"reminder":  0xf1c40f,
+}
+
+const (
+	// chatDateLayout is how due dates are shown in chat messages.
+	chatDateLayout = "Mon, 02 Jan 2006 15:04 MST"
+	// maxDiscordTitleLength and maxChatDescriptionLength keep messages
+	// within what Slack and Discord accept.
+	maxDiscordTitleLength    = 256
+	maxChatDescriptionLength = 2000
+)
+
+// slackEscaper escapes the characters Slack's mrkdwn gives a meaning to.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   time.Time      `json:"timestamp"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// webhookBody is what is POSTed to a webhook of format about an event: the
+// payload itself for json webhooks, and a chat message about it for others.
+func webhookBody(format string, payload webhookPayload) ([]byte, error) {
+	if format != slackWebhookFormat && format != discordWebhookFormat {
+		return json.Marshal(payload)
+	}
+	todo := payload.Todo
+	title := chatTitles[payload.Event]
+	description := truncate(todo.Description, maxChatDescriptionLength)
+
+	// Details are the same in both apps, bar the formatting.
+	type detail struct{ name, value string }
+	var details []detail
+	if todo.DueDate != nil {
+		details = append(details, detail{"Due", todo.DueDate.UTC().Format(chatDateLayout)})
+	}
+	details = append(details, detail{"Priority", todo.Priority})
+	if len(todo.Tags) > 0 {
+		details = append(details, detail{"Tags", strings.Join(todo.Tags, ", ")})
+	}
+
+	switch format {
+	case slackWebhookFormat:
+		var text strings.Builder
+		text.WriteString("*" + title + ":* " + slackEscaper.Replace(todo.Task))
+		if description != "" {
+			text.WriteString("\n>" + strings.ReplaceAll(slackEscaper.Replace(description), "\n", "\n>"))
+		}
+		var parts []string
+		for _, d := range details {
+			parts = append(parts, d.name+": "+slackEscaper.Replace(d.value))
+		}
+		text.WriteString("\n" + strings.Join(parts, " · "))
+		return json.Marshal(slackMessage{Text: text.String()})
+	default:
+		embed := discordEmbed{
+			Title:       truncate(title+": "+todo.Task, maxDiscordTitleLength),
+			Description: description,
+			Color:       discordColors[payload.Event],
+			Timestamp:   payload.CreatedAt,
+		}
+		for _, d := range details {
+			embed.Fields = append(embed.Fields, discordField{Name: d.name, Value: d.value, Inline: true})
+		}
+		return json.Marshal(discordMessage{Embeds: []discordEmbed{embed}})
+	}
+}
+
+// truncate cuts s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookBody(t *testing.T) {
+	due := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+	payload := webhookPayload{
+		ID:        "1",
+		Event:     "completed",
+		CreatedAt: due,
+		Todo:      Todo{ID: 7, Task: "Fix <b> & ship", Description: "Line one\nLine two", DueDate: &due, Priority: "high", Tags: []string{"work", "urgent"}},
+	}
+
+	body, err := webhookBody(slackWebhookFormat, payload)
+	if err != nil {
+		t.Fatalf("Failed to format for Slack: %v", err)
+	}
+	var slack slackMessage
+	json.Unmarshal(body, &slack)
+	want := "*Todo completed:* Fix &lt;b&gt; &amp; ship\n>Line one\n>Line two\nDue: Wed, 02 Jan 2030 15:04 UTC · Priority: high · Tags: work, urgent"
+	if slack.Text != want {
+		t.Errorf("Expected Slack text %q, got %q", want, slack.Text)
+	}
+
+	body, err = webhookBody(discordWebhookFormat, payload)
+	if err != nil {
+		t.Fatalf("Failed to format for Discord: %v", err)
+	}
+	var discord discordMessage
+	json.Unmarshal(body, &discord)
+	if len(discord.Embeds) != 1 {
+		t.Fatalf("Expected one embed, got %s", body)
+	}
+	embed := discord.Embeds[0]
+	if embed.Title != "Todo completed: Fix <b> & ship" || embed.Description != payload.Todo.Description || embed.Color != discordColors["completed"] || len(embed.Fields) != 3 || embed.Fields[1].Value != "high" {
+		t.Errorf("Expected the todo in the embed, got %+v", embed)
+	}
+
+	body, _ = webhookBody(jsonWebhookFormat, payload)
+	var plain webhookPayload
+	if err := json.Unmarshal(body, &plain); err != nil || plain.Todo.ID != 7 || plain.Event != "completed" {
+		t.Errorf("Expected the payload itself for json webhooks, got %s", body)
+	}
+}
+
+func TestChatWebhookRouting(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearWebhooks(t)
+	router := setupRouter()
+	ctx := context.Background()
+	events := publishedEvents(t)
+
+	home := createList(t, router, "Home")
+	work := createList(t, router, "Work")
+	slack := createWebhook(t, router, `{"url":"https://hooks.slack.com/services/T/B/x","format":"slack","list_id":`+strconv.Itoa(home.ID)+`}`)
+	discord := createWebhook(t, router, `{"url":"https://discord.com/api/webhooks/1/x","format":"discord"}`)
+	if strings.Join(slack.Events, ",") != "created,completed" || slack.ListID == nil || *slack.ListID != home.ID {
+		t.Errorf("Expected a Slack webhook of the home list's new and completed todos, got %+v", slack)
+	}
+
+	for _, list := range []List{home, work} {
+		req := httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task":"Tidy up","list_id":`+strconv.Itoa(list.ID)+`}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if err := enqueueWebhookDeliveries(ctx, strconv.Itoa(list.ID), <-events); err != nil {
+			t.Fatalf("Failed to queue deliveries: %v", err)
+		}
+	}
+
+	if deliveries := webhookDeliveries(t, router, slack); len(deliveries) != 1 || !strings.Contains(string(deliveries[0].Payload), `"text":"*New todo:* Tidy up`) {
+		t.Errorf("Expected a Slack message of the home todo only, got %+v", deliveries)
+	}
+	if deliveries := webhookDeliveries(t, router, discord); len(deliveries) != 2 || !strings.Contains(string(deliveries[0].Payload), `"embeds"`) {
+		t.Errorf("Expected Discord messages of both todos, got %+v", deliveries)
+	}
+
+	// Deleting the list deletes the webhook routed to it.
+	req := httptest.NewRequest("DELETE", "/lists/"+strconv.Itoa(home.ID), nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest("GET", "/webhooks/"+strconv.Itoa(slack.ID), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the home list's webhook gone with it, got %d", rr.Code)
+	}
+}
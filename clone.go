@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// cloneOptions say what POST /todos/{id}/clone copies besides the todo.
+type cloneOptions struct {
+	subtasks bool
+	tags     bool
+}
+
+// parseCloneOptions reads ?subtasks=, false by default, and ?tags=, true
+// by default.
+func parseCloneOptions(r *http.Request) (cloneOptions, error) {
+	opts := cloneOptions{tags: true}
+	query := r.URL.Query()
+	if v := query.Get("subtasks"); v != "" {
+		var err error
+		if opts.subtasks, err = strconv.ParseBool(v); err != nil {
+			return opts, errors.New("Invalid subtasks! subtasks must be true or false")
+		}
+	}
+	if v := query.Get("tags"); v != "" {
+		var err error
+		if opts.tags, err = strconv.ParseBool(v); err != nil {
+			return opts, errors.New("Invalid tags! tags must be true or false")
+		}
+	}
+	return opts, nil
+}
+
+// cloneTodo stores an open copy of todo for the caller under parentID and
+// returns it, with copies of the subtasks the caller can see when opts ask
+// for them. created collects every todo stored.
+func cloneTodo(ctx context.Context, tx *sql.Tx, caller principal, todo Todo, parentID *int, opts cloneOptions, created *[]Todo) (Todo, error) {
+	clone := Todo{
+		Task:        todo.Task,
+		Description: todo.Description,
+		DueDate:     todo.DueDate,
+		RemindAt:    todo.RemindAt,
+		Priority:    todo.Priority,
+		ListID:      todo.ListID,
+		ParentID:    parentID,
+		Tags:        []string{},
+	}
+	if opts.tags {
+		clone.Tags = todo.Tags
+	}
+	errs, err := checkTodoRefs(ctx, tx, caller, clone)
+	if err != nil {
+		return clone, err
+	}
+	if errs != nil {
+		return clone, errs
+	}
+	if clone.ID, err = insertTodo(ctx, tx, caller, clone); err != nil {
+		return clone, err
+	}
+	if err = loadTimestamps(ctx, tx, &clone); err != nil {
+		return clone, err
+	}
+	*created = append(*created, clone)
+	if !opts.subtasks {
+		return clone, nil
+	}
+
+	scope, args := caller.todoScope("")
+	rows, err := tx.QueryContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE parent_id = ? AND "+scope+" ORDER BY position, id", append([]any{todo.ID}, args...)...)
+	if err != nil {
+		return clone, err
+	}
+	var subtasks []Todo
+	for rows.Next() {
+		subtask, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return clone, err
+		}
+		subtasks = append(subtasks, subtask)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return clone, err
+	}
+	if err = loadTags(ctx, tx, subtasks); err != nil {
+		return clone, err
+	}
+
+	clone.Subtasks = []Todo{}
+	for _, subtask := range subtasks {
+		subtask, err = cloneTodo(ctx, tx, caller, subtask, &clone.ID, opts, created)
+		if err != nil {
+			return clone, err
+		}
+		clone.Subtasks = append(clone.Subtasks, subtask)
+	}
+	return clone, nil
+}
+
+// CloneHandler copies a todo the caller can see into a new, open todo of
+// theirs next to it, for repeating work. Its tags are copied unless
+// ?tags=false, and ?subtasks=true copies its subtasks too, all the way
+// down, listing the copies in subtasks.
+func CloneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+	opts, err := parseCloneOptions(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	var clone Todo
+	var created []Todo
+	todo, err := todoRepo.Get(ctx, caller, id)
+	if err == nil {
+		err = withTx(ctx, db, func(tx *sql.Tx) error {
+			var err error
+			clone, err = cloneTodo(ctx, tx, caller, todo, todo.ParentID, opts, &created)
+			return err
+		})
+	}
+	var errs validationErrors
+	if errors.As(err, &errs) {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error cloning todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, todo := range created {
+		todoEvents.publish(todoEvent{Type: "created", Todo: todo, owner: caller})
+	}
+	slog.InfoContext(ctx, "Cloned todo", "ID", id, "clone", clone.ID, "created", len(created))
+
+	var body bytes.Buffer
+	if err = json.NewEncoder(&body).Encode(clone); err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, r, clone.ID, body.Bytes())
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	carol := seedUser(t, "carol", editorRole)
+
+	rr := requestAs(router, alice, "POST", "/lists", `{"name": "Chores"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	listID := strconv.Itoa(list.ID)
+	requestAs(router, alice, "PUT", "/lists/"+listID+"/members/bob", `{"permission": "read"}`)
+
+	create := func(body string) Todo {
+		t.Helper()
+		rr := requestAs(router, alice, "POST", "/todos", body)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 creating a todo, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var todo Todo
+		json.Unmarshal(rr.Body.Bytes(), &todo)
+		return todo
+	}
+	week := create(`{"task": "Weekly clean", "description": "Every room", "done": true, "priority": "high", "tags": ["weekly"], "list_id": ` + listID + `}`)
+	kitchen := create(`{"task": "Kitchen", "tags": ["wet"], "parent_id": ` + strconv.Itoa(week.ID) + `}`)
+	bath := create(`{"task": "Bathroom", "parent_id": ` + strconv.Itoa(week.ID) + `}`)
+	create(`{"task": "Mirror", "parent_id": ` + strconv.Itoa(bath.ID) + `}`)
+	path := "/todos/" + strconv.Itoa(week.ID)
+
+	rr = requestAs(router, alice, "POST", path+"/clone", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 cloning, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var clone Todo
+	json.Unmarshal(rr.Body.Bytes(), &clone)
+	if clone.ID == week.ID || clone.Done || clone.Task != week.Task || clone.Description != week.Description ||
+		clone.Priority != "high" || !slices.Equal(clone.Tags, []string{"weekly"}) || clone.ListID == nil || *clone.ListID != list.ID {
+		t.Errorf("Expected an open copy of the todo, got %+v", clone)
+	}
+	if location := rr.Header().Get("Location"); location != "/todos/"+strconv.Itoa(clone.ID) {
+		t.Errorf("Expected the Location of the copy, got %q", location)
+	}
+	if clone.Subtasks != nil {
+		t.Errorf("Expected no subtasks copied by default, got %+v", clone.Subtasks)
+	}
+
+	rr = requestAs(router, alice, "POST", path+"/clone?subtasks=true&tags=false", "")
+	json.Unmarshal(rr.Body.Bytes(), &clone)
+	if len(clone.Tags) != 0 || len(clone.Subtasks) != 2 {
+		t.Fatalf("Expected an untagged copy with both subtasks, got %+v", clone)
+	}
+	if sub := clone.Subtasks[0]; sub.Task != "Kitchen" || len(sub.Tags) != 0 || sub.ParentID == nil || *sub.ParentID != clone.ID {
+		t.Errorf("Expected a copy of the first subtask under the copy, got %+v", sub)
+	}
+	if sub := clone.Subtasks[1]; sub.Task != "Bathroom" || len(sub.Subtasks) != 1 || sub.Subtasks[0].Task != "Mirror" {
+		t.Errorf("Expected the subtasks of subtasks copied too, got %+v", sub)
+	}
+	if todos := getTodosAs(t, router, alice); len(todos) != 9 {
+		t.Errorf("Expected 4 todos and 5 copies, got %d", len(todos))
+	}
+
+	rr = requestAs(router, alice, "POST", "/todos/"+strconv.Itoa(kitchen.ID)+"/clone", "")
+	json.Unmarshal(rr.Body.Bytes(), &clone)
+	if clone.ParentID == nil || *clone.ParentID != week.ID {
+		t.Errorf("Expected the copy of a subtask next to it, got %+v", clone)
+	}
+
+	if rr = requestAs(router, carol, "POST", path+"/clone", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 cloning a todo carol can't see, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "POST", path+"/clone", ""); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 cloning into a list shared read-only, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "POST", path+"/clone?subtasks=maybe", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid subtasks, got %d", rr.Code)
+	}
+}
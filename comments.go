@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxCommentLength keeps comments to a discussion, like descriptions.
+const maxCommentLength = 10000
+
+// commentCountColumn selects the number of comments on the todos row of a
+// query.
+const commentCountColumn = "(SELECT COUNT(*) FROM comments WHERE comments.todo_id = todos.id)"
+
+// Comment is a remark on a todo by someone who can see it.
+type Comment struct {
+	ID     int `json:"id"`
+	TodoID int `json:"todo_id"`
+	// Author is the username of whoever wrote the comment. Only they can
+	// change it, and they or an admin delete it.
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	errCommentNotFound = errors.New("comment not found")
+	errNotAuthor       = errors.New("Only the author of the comment can do this")
+)
+
+// validateComment normalizes a comment received from a client in place and
+// checks it's fit to be stored.
+func validateComment(comment *Comment) validationErrors {
+	var errs validationErrors
+	errs.requireText("body", &comment.Body, maxCommentLength)
+	return errs
+}
+
+// commentVars parses the {id} and {comment_id} route variables, answering
+// 400 and returning false when either isn't a number. Without a
+// {comment_id}, the comment ID is 0.
+func commentVars(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	todoID, err := strconv.Atoi(vars["id"])
+	commentID := 0
+	if v, ok := vars["comment_id"]; ok && err == nil {
+		commentID, err = strconv.Atoi(v)
+	}
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return todoID, commentID, true
+}
+
+// findComment returns the comment with id on the todo with todoID, or
+// errTodoNotFound when the caller can't see the todo.
+func findComment(ctx context.Context, caller principal, todoID, id int) (Comment, error) {
+	comment := Comment{ID: id, TodoID: todoID}
+	if _, err := todoRepo.Get(ctx, caller, todoID); err != nil {
+		return comment, err
+	}
+	err := db.QueryRowContext(ctx, "SELECT author, body, created_at, updated_at FROM comments WHERE id = ? AND todo_id = ?", id, todoID).
+		Scan(&comment.Author, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return comment, errCommentNotFound
+	}
+	return comment, err
+}
+
+// writeCommentError replies to the errors of findComment and the checks
+// made before changing a comment.
+func writeCommentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errTodoNotFound):
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+	case errors.Is(err, errCommentNotFound):
+		writeErrorCode(w, r, codeCommentNotFound, "Comment not found", http.StatusNotFound)
+	case errors.Is(err, errNotAuthor):
+		writeErrorCode(w, r, codeNotCommentAuthor, err.Error(), http.StatusForbidden)
+	default:
+		slog.ErrorContext(r.Context(), "Error querying comment", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ListCommentsHandler lists the comments on a todo, oldest first.
+func ListCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	todoID, _, ok := commentVars(w, r)
+	if !ok {
+		return
+	}
+	if _, err := todoRepo.Get(ctx, principalFrom(ctx), todoID); err != nil {
+		writeCommentError(w, r, err)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, author, body, created_at, updated_at FROM comments WHERE todo_id = ? ORDER BY created_at, id", todoID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error querying comments", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		comment := Comment{TodoID: todoID}
+		if err = rows.Scan(&comment.ID, &comment.Author, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt); err != nil {
+			slog.ErrorContext(ctx, "Error scanning comment", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		comments = append(comments, comment)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "Error iterating comments", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+func ReadCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	todoID, id, ok := commentVars(w, r)
+	if !ok {
+		return
+	}
+	comment, err := findComment(ctx, principalFrom(ctx), todoID, id)
+	if err != nil {
+		writeCommentError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// CreateCommentHandler comments on a todo, given {"body": "..."}. Anyone
+// who can see the todo can comment on it, including read-only members of
+// its list.
+func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	todoID, _, ok := commentVars(w, r)
+	if !ok {
+		return
+	}
+	var comment Comment
+	if err := decodeBody(r, &comment); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if errs := validateComment(&comment); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	if _, err := todoRepo.Get(ctx, caller, todoID); err != nil {
+		writeCommentError(w, r, err)
+		return
+	}
+	comment.TodoID, comment.Author = todoID, caller.owner
+	comment.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	comment.UpdatedAt = comment.CreatedAt
+
+	var err error
+	comment.ID, err = dbDialect.insertID(ctx, db, "INSERT INTO comments (todo_id, author, user_id, body, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		todoID, comment.Author, caller.userIDValue(), comment.Body, comment.CreatedAt, comment.UpdatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting comment", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Added new comment", "ID", comment.ID, "todo", todoID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiBase(r.Context())+"/todos/"+strconv.Itoa(todoID)+"/comments/"+strconv.Itoa(comment.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// UpdateCommentHandler changes the body of the caller's comment.
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	todoID, id, ok := commentVars(w, r)
+	if !ok {
+		return
+	}
+	var data Comment
+	if err := decodeBody(r, &data); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if errs := validateComment(&data); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	comment, err := findComment(ctx, caller, todoID, id)
+	if err == nil && comment.Author != caller.owner {
+		err = errNotAuthor
+	}
+	if err != nil {
+		writeCommentError(w, r, err)
+		return
+	}
+	comment.Body = data.Body
+	comment.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+
+	if _, err = db.ExecContext(ctx, "UPDATE comments SET body = ?, updated_at = ? WHERE id = ?", comment.Body, comment.UpdatedAt, id); err != nil {
+		slog.ErrorContext(ctx, "Error updating comment", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Updated comment", "ID", id, "todo", todoID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteCommentHandler deletes a comment. Besides its author, admins can
+// delete any comment.
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	todoID, id, ok := commentVars(w, r)
+	if !ok {
+		return
+	}
+
+	caller := principalFrom(ctx)
+	comment, err := findComment(ctx, caller, todoID, id)
+	if err == nil && comment.Author != caller.owner && !caller.isAdmin() {
+		err = errNotAuthor
+	}
+	if err != nil {
+		writeCommentError(w, r, err)
+		return
+	}
+
+	if _, err = db.ExecContext(ctx, "DELETE FROM comments WHERE id = ?", id); err != nil {
+		slog.ErrorContext(ctx, "Error deleting comment", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Deleted comment", "ID", id, "todo", todoID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestComments(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	carol := seedUser(t, "carol", editorRole)
+	admin := seedUser(t, "root", adminRole)
+
+	rr := requestAs(router, alice, "POST", "/lists", `{"name": "Trip"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr = requestAs(router, alice, "PUT", "/lists/"+strconv.Itoa(list.ID)+"/members/bob", `{"permission": "read"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 sharing the list, got %d", rr.Code)
+	}
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Book flights", "list_id": `+strconv.Itoa(list.ID)+`, "comment_count": 5}`)
+	var todo Todo
+	json.Unmarshal(rr.Body.Bytes(), &todo)
+	if todo.CommentCount != 0 {
+		t.Errorf("Expected comment_count to be ignored on create, got %d", todo.CommentCount)
+	}
+	commentsPath := "/todos/" + strconv.Itoa(todo.ID) + "/comments"
+
+	if rr = requestAs(router, bob, "POST", commentsPath, `{"body": "  "}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an empty comment, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "POST", commentsPath, `{"body": "`+strings.Repeat("a", maxCommentLength+1)+`"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a long comment, got %d", rr.Code)
+	}
+	if rr = requestAs(router, carol, "POST", commentsPath, `{"body": "Can I come?"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 commenting on a todo carol can't see, got %d", rr.Code)
+	}
+
+	rr = requestAs(router, bob, "POST", commentsPath, `{"body": "Window seat please"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 commenting on a shared todo, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var comment Comment
+	json.Unmarshal(rr.Body.Bytes(), &comment)
+	if comment.Author != "bob" || comment.TodoID != todo.ID || comment.Body != "Window seat please" {
+		t.Errorf("Unexpected comment %+v", comment)
+	}
+	commentPath := commentsPath + "/" + strconv.Itoa(comment.ID)
+	if location := rr.Header().Get("Location"); location != apiPrefix+commentPath {
+		t.Errorf("Expected Location %s, got %q", apiPrefix+commentPath, location)
+	}
+	requestAs(router, alice, "POST", commentsPath, `{"body": "Booked!"}`)
+
+	rr = requestAs(router, alice, "GET", commentsPath, "")
+	var comments []Comment
+	json.Unmarshal(rr.Body.Bytes(), &comments)
+	if len(comments) != 2 || comments[0].ID != comment.ID || comments[1].Author != "alice" {
+		t.Errorf("Expected both comments, oldest first, got %+v", comments)
+	}
+	if rr = requestAs(router, carol, "GET", commentsPath, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 listing the comments of a todo carol can't see, got %d", rr.Code)
+	}
+	if rr = requestAs(router, carol, "GET", commentPath, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 reading a comment on a todo carol can't see, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "GET", commentsPath+"/999999", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown comment, got %d", rr.Code)
+	}
+
+	rr = requestAs(router, alice, "GET", "/todos/"+strconv.Itoa(todo.ID), "")
+	json.Unmarshal(rr.Body.Bytes(), &todo)
+	if todo.CommentCount != 2 {
+		t.Errorf("Expected a comment_count of 2, got %d", todo.CommentCount)
+	}
+	if todos := getTodosAs(t, router, bob); len(todos) != 1 || todos[0].CommentCount != 2 {
+		t.Errorf("Expected the comment count in the list of todos, got %+v", todos)
+	}
+
+	if rr = requestAs(router, alice, "PUT", commentPath, `{"body": "Aisle seat"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 changing someone else's comment, got %d", rr.Code)
+	}
+	rr = requestAs(router, bob, "PUT", commentPath, `{"body": "Aisle seat, actually"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 changing a comment, got %d", rr.Code)
+	}
+	json.Unmarshal(rr.Body.Bytes(), &comment)
+	if comment.Body != "Aisle seat, actually" || comment.Author != "bob" {
+		t.Errorf("Unexpected updated comment %+v", comment)
+	}
+
+	if rr = requestAs(router, alice, "DELETE", commentPath, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 deleting someone else's comment, got %d", rr.Code)
+	}
+	if rr = requestAs(router, admin, "DELETE", commentPath, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting a comment as an admin, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "GET", commentPath, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted comment, got %d", rr.Code)
+	}
+
+	requestAs(router, alice, "DELETE", "/todos/"+strconv.Itoa(todo.ID), "")
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM comments").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected comments to be deleted with their todo, got %d", count)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// minCompressSize is the smallest body worth compressing. Below it the
+// framing costs more than it saves.
+const minCompressSize = 1024
+
+// compressMiddleware compresses responses with gzip or deflate, whichever
+// the client's Accept-Encoding prefers. The body is buffered until it
+// reaches minCompressSize, so small responses and content that is already
+// encoded are sent as is.
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer gw.Close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// encodings are the content codings compressMiddleware can produce, most
+// preferred first for when a client weighs them the same.
+var encodings = []string{"gzip", "deflate"}
+
+// negotiateEncoding picks the coding of encodings with the highest q-value
+// in an Accept-Encoding header, or "" when the client accepts none. A "*"
+// stands for every coding not listed.
+func negotiateEncoding(header string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(strings.TrimSpace(name), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if coding == "*" {
+			wildcard = q
+		} else if coding != "" {
+			weights[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	zw       compressor
+}
+
+// compressor is what gzip.Writer and zlib.Writer have in common.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func (gw *compressResponseWriter) WriteHeader(status int) {
+	if !gw.decided {
+		gw.status = status
+	}
+}
+
+func (gw *compressResponseWriter) Write(p []byte) (int, error) {
+	if gw.decided {
+		if gw.zw != nil {
+			return gw.zw.Write(p)
+		}
+		return gw.ResponseWriter.Write(p)
+	}
+
+	gw.buf = append(gw.buf, p...)
+	if len(gw.buf) >= minCompressSize {
+		if err := gw.decide(gw.compressible()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close flushes any buffered body and finishes the compressed stream.
+func (gw *compressResponseWriter) Close() error {
+	if !gw.decided {
+		if err := gw.decide(false); err != nil {
+			return err
+		}
+	}
+	if gw.zw != nil {
+		return gw.zw.Close()
+	}
+	return nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (gw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// FlushError sends what has been written so far, for streamed responses,
+// deciding on compression early if need be.
+func (gw *compressResponseWriter) FlushError() error {
+	if !gw.decided {
+		if err := gw.decide(gw.compressible()); err != nil {
+			return err
+		}
+	}
+	if gw.zw != nil {
+		if err := gw.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Hijack hands the connection over, leaving nothing for Close to write.
+func (gw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(gw.ResponseWriter).Hijack()
+	if err == nil {
+		gw.decided = true
+	}
+	return conn, rw, err
+}
+
+// compressible reports whether the handler's response should be compressed.
+func (gw *compressResponseWriter) compressible() bool {
+	h := gw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(gw.buf)
+	}
+	// Event streams are sent in small pieces as they happen, which
+	// compression would only hold up.
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return false
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/x-gzip"} {
+		if strings.HasPrefix(contentType, prefix) && contentType != "image/svg+xml" {
+			return false
+		}
+	}
+	return true
+}
+
+// decide sends the headers, choosing between a compressed and an identity
+// body, and writes out whatever has been buffered so far.
+func (gw *compressResponseWriter) decide(compress bool) error {
+	gw.decided = true
+	if compress {
+		gw.Header().Set("Content-Encoding", gw.encoding)
+		gw.Header().Del("Content-Length")
+		// The compressed body isn't the one a strong ETag vouches for, so
+		// the tag only promises an equivalent one. If-None-Match still
+		// matches it, since that comparison is weak.
+		if etag := gw.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			gw.Header().Set("ETag", "W/"+etag)
+		}
+		// HTTP's deflate is the zlib format, not a raw deflate stream.
+		if gw.encoding == "deflate" {
+			gw.zw = zlib.NewWriter(gw.ResponseWriter)
+		} else {
+			gw.zw = gzip.NewWriter(gw.ResponseWriter)
+		}
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	if len(gw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.zw != nil {
+		_, err = gw.zw.Write(gw.buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(gw.buf)
+	}
+	gw.buf = nil
+	return err
+}
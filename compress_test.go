@@ -0,0 +1,101 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"task":"compress me"}`, 100)
+	handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/small" {
+			io.WriteString(w, `{"task":"tiny"}`)
+			return
+		}
+		io.WriteString(w, large)
+	}))
+
+	req := httptest.NewRequest("GET", "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if enc := rr.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", enc)
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	if string(body) != large {
+		t.Errorf("Decompressed body doesn't match the original")
+	}
+
+	req = httptest.NewRequest("GET", "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, deflate")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if enc := rr.Header().Get("Content-Encoding"); enc != "deflate" {
+		t.Fatalf("Expected Content-Encoding deflate, got %q", enc)
+	}
+	zr2, err := zlib.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("Failed to open deflate body: %v", err)
+	}
+	if body, err = io.ReadAll(zr2); err != nil || string(body) != large {
+		t.Errorf("Deflated body doesn't match the original: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/small", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if enc := rr.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Expected small response to be uncompressed, got %q", enc)
+	}
+	if rr.Body.String() != `{"task":"tiny"}` {
+		t.Errorf("Unexpected small body %q", rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/large", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if enc := rr.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Expected no compression without Accept-Encoding, got %q", enc)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"identity":                  "",
+		"gzip":                      "gzip",
+		"deflate":                   "deflate",
+		"gzip, deflate, br":         "gzip",
+		"deflate, gzip":             "gzip",
+		"gzip;q=0.5, deflate;q=0.8": "deflate",
+		"gzip;q=0, deflate;q=0":     "",
+		"GZIP; Q=0.1":               "gzip",
+		"*":                         "gzip",
+		"*;q=0.3, gzip;q=0":         "deflate",
+		"br, *;q=0":                 "",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
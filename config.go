@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type optionKind int
+
+const (
+	stringOption optionKind = iota
+	boolOption
+	durationOption
+	intOption
+)
+
+// option is a configuration setting. It is named after its environment
+// variable, and can also be set in the config file, under the lower-cased
+// name (db_host) or nested by its underscore-separated parts (db: {host:}),
+// and with a flag (-db-host).
+type option struct {
+	name    string
+	def     string
+	kind    optionKind
+	choices []string
+	// secret options are redacted from the configuration summary.
+	secret bool
+	usage  string
+}
+
+// options lists every setting of the server. The OTEL_* variables of the
+// OpenTelemetry SDK are read by the SDK itself and stay environment only.
+var options = []option{
+	{name: "PORT", def: "5555", kind: intOption, usage: "port to listen on"},
+	{name: "TLS_CERT_FILE", usage: "certificate to serve HTTPS with, PEM encoded"},
+	{name: "TLS_KEY_FILE", usage: "private key of TLS_CERT_FILE, PEM encoded"},
+	{name: "TLS_AUTOCERT_DOMAINS", usage: "comma separated domains to get Let's Encrypt certificates for"},
+	{name: "TLS_AUTOCERT_EMAIL", usage: "contact address of the Let's Encrypt account"},
+	{name: "TLS_AUTOCERT_CACHE", def: "autocert-cache", usage: "directory to keep Let's Encrypt certificates in"},
+	{name: "HTTP_REDIRECT_PORT", kind: intOption, usage: "plain HTTP port redirecting to HTTPS, 80 for Let's Encrypt HTTP-01 challenges"},
+	{name: "GRPC_PORT", kind: intOption, usage: "port to serve the gRPC TodoService on, which is off without one"},
+	{name: "API_PREFIX", usage: "path prefix to serve the API versions under, e.g. /api"},
+	{name: "AUTH_MODE", def: "jwt", choices: []string{"jwt", "proxy"}, usage: "jwt to authenticate users, proxy to trust the X-Owner header"},
+	{name: "JWT_SECRET", secret: true, usage: "key signing access tokens, at least 32 bytes"},
+	{name: "JWT_TTL", def: "24h", kind: durationOption, usage: "lifetime of access tokens"},
+	{name: "OIDC_ISSUER_URL", usage: "OpenID Connect provider to log in with"},
+	{name: "OIDC_CLIENT_ID", usage: "OpenID Connect client ID"},
+	{name: "OIDC_CLIENT_SECRET", secret: true, usage: "OpenID Connect client secret"},
+	{name: "OIDC_REDIRECT_URL", usage: "URL of /auth/oidc/callback as the provider redirects to it"},
+	{name: "ADMIN_API_KEY", secret: true, usage: "key of the admin endpoints, which are disabled without one"},
+	{name: "DB_DRIVER", def: "mysql", choices: []string{"mysql", "postgres", "sqlite", "memory"}, usage: "database to store todos in"},
+	{name: "DB_HOST", usage: "database host"},
+	{name: "DB_PORT", usage: "database port, 5432 by default with postgres"},
+	{name: "DB_USER", usage: "database user"},
+	{name: "DB_PASS", secret: true, usage: "database password"},
+	{name: "DB_NAME", usage: "database name"},
+	{name: "DB_PATH", def: "todo.db", usage: "SQLite database file"},
+	{name: "DB_TLS", choices: []string{"false", "true", "skip-verify", "preferred"}, usage: "TLS to the database"},
+	{name: "DB_CONNECT_TIMEOUT", kind: durationOption, usage: "database dial timeout"},
+	{name: "DB_READ_TIMEOUT", kind: durationOption, usage: "database read timeout, MySQL only"},
+	{name: "DB_WRITE_TIMEOUT", kind: durationOption, usage: "database write timeout, MySQL only"},
+	{name: "DB_CONNECT_RETRIES", def: "5", kind: intOption, usage: "times to retry connecting to the database on startup"},
+	{name: "DB_CONNECT_BACKOFF", def: "1s", kind: durationOption, usage: "wait before the first retry, doubled for each one after it up to 30s"},
+	{name: "DB_MAX_OPEN_CONNS", def: "25", kind: intOption, usage: "most connections open to the database, 0 for no limit"},
+	{name: "DB_MAX_IDLE_CONNS", def: "25", kind: intOption, usage: "most idle connections kept open for reuse"},
+	{name: "DB_CONN_MAX_LIFETIME", def: "5m", kind: durationOption, usage: "time after which connections are replaced, 0 to keep them"},
+	{name: "DB_QUERY_TIMEOUT", def: "10s", kind: durationOption, usage: "time a single query may take, 0 for no limit"},
+	{name: "AUTO_MIGRATE", def: "true", kind: boolOption, usage: "apply pending migrations at startup"},
+	{name: "CORS_ALLOWED_ORIGINS", usage: "comma separated origins browsers may call the API from, * for any"},
+	{name: "CORS_ALLOWED_METHODS", def: "GET, HEAD, POST, PUT, PATCH, DELETE", usage: "methods allowed in cross-origin requests"},
+	{name: "CORS_ALLOWED_HEADERS", def: "Authorization, Content-Type, Idempotency-Key, If-Match, If-None-Match, X-API-Key, X-Request-ID", usage: "request headers allowed in cross-origin requests"},
+	{name: "CORS_EXPOSED_HEADERS", def: "Content-Disposition, Deprecation, ETag, Link, Location, Warning, X-Next-Cursor, X-Request-ID, X-Total-Count", usage: "response headers cross-origin callers can read"},
+	{name: "CORS_MAX_AGE", def: "10m", kind: durationOption, usage: "how long browsers may cache preflight results"},
+	{name: "CORS_ALLOW_CREDENTIALS", def: "false", kind: boolOption, usage: "let browsers send cookies cross-origin"},
+	{name: "LOG_FORMAT", def: "text", choices: []string{"text", "json"}, usage: "log format"},
+	{name: "LOG_LEVEL", def: "info", choices: []string{"debug", "info", "warn", "warning", "error"}, usage: "lowest level logged"},
+	{name: "ERROR_FORMAT", def: "json", choices: []string{"json", "problem+json"}, usage: "error body format when the client doesn't ask for one"},
+	{name: "EVENT_COALESCE_WINDOW", kind: durationOption, usage: "window to merge change events of a todo in"},
+	{name: "PUT_UPSERT", def: "false", kind: boolOption, usage: "create todos on PUT to unknown IDs"},
+	{name: "REQUIRE_IF_MATCH", def: "true", kind: boolOption, usage: "reject PUT and PATCH of todos without If-Match or a version"},
+	{name: "UNDO_WINDOW", def: "15m", kind: durationOption, usage: "how long after a change to a todo it can be undone"},
+	{name: "REMINDER_SINKS", def: "log, webhook", usage: "where due reminders are sent: log, webhook, email"},
+	{name: "SMTP_HOST", usage: "SMTP server to email notifications through, which are off without one"},
+	{name: "SMTP_PORT", def: "587", kind: intOption, usage: "SMTP server port"},
+	{name: "SMTP_USERNAME", usage: "SMTP user, to log in with"},
+	{name: "SMTP_PASSWORD", secret: true, usage: "SMTP password"},
+	{name: "SMTP_FROM", usage: "sender address of notification emails"},
+	{name: "EMAIL_EVENTS", def: "created, due_soon, overdue", usage: "what users are emailed about: created, due_soon, overdue"},
+	{name: "EMAIL_DUE_SOON", def: "24h", kind: durationOption, usage: "how long before their due date todos are emailed about as due soon"},
+	{name: "EMAIL_TEMPLATES", usage: "file of text/template definitions replacing the built-in email templates"},
+	{name: "READ_ONLY", def: "false", kind: boolOption, usage: "start in read-only maintenance mode"},
+	{name: "SHUTDOWN_TIMEOUT", def: "30s", kind: durationOption, usage: "time to let requests finish on shutdown"},
+	{name: "READ_TIMEOUT", def: "30s", kind: durationOption, usage: "time to read a whole request, 0 for no limit"},
+	{name: "READ_HEADER_TIMEOUT", def: "10s", kind: durationOption, usage: "time to read the request headers, 0 for no limit"},
+	{name: "WRITE_TIMEOUT", def: "60s", kind: durationOption, usage: "time to write a response, 0 for no limit"},
+	{name: "IDLE_TIMEOUT", def: "120s", kind: durationOption, usage: "time keep-alive connections stay open idle, 0 for no limit"},
+	{name: "MAX_BODY_BYTES", def: "1048576", kind: intOption, usage: "largest request body accepted"},
+	{name: "MAX_IMPORT_BYTES", def: "10485760", kind: intOption, usage: "largest import accepted"},
+	{name: "MAX_TASK_LENGTH", def: "255", kind: intOption, usage: "longest task accepted, in characters, at most 255"},
+	{name: "MAX_BATCH_SIZE", def: "100", kind: intOption, usage: "most todos a batch request may create or change"},
+	{name: "WEBHOOK_ALLOW_PRIVATE", def: "false", kind: boolOption, usage: "let webhooks deliver to loopback, private and link-local addresses"},
+	{name: "ENFORCE_BUSINESS_HOURS", def: "false", kind: boolOption, usage: "only accept due dates within business hours"},
+	{name: "BUSINESS_HOURS", def: "09:00-17:00", usage: "opening and closing time"},
+	{name: "BUSINESS_DAYS", def: "Mon-Fri", usage: "day range or comma separated list"},
+	{name: "BUSINESS_TZ", def: "UTC", usage: "time zone of the business hours"},
+}
+
+func findOption(name string) (option, bool) {
+	i := slices.IndexFunc(options, func(o option) bool { return o.name == name })
+	if i < 0 {
+		return option{}, false
+	}
+	return options[i], true
+}
+
+// config holds the settings given in the config file and with flags. The
+// environment is read when a setting is looked up, so it applies to
+// settings the flags don't override.
+type config struct {
+	path  string
+	file  map[string]string
+	flags map[string]string
+}
+
+// conf is the configuration of the server. Until loadConfig replaces it,
+// settings come from the environment and the defaults.
+var conf = &config{}
+
+// get returns the value of the named setting: its flag if it was given,
+// else its environment variable, else its value in the config file, else
+// its default.
+func (c *config) get(name string) string {
+	v, _ := c.lookup(name)
+	return v
+}
+
+// getOr is get with a fallback for settings without a default.
+func (c *config) getOr(name, fallback string) string {
+	if v := c.get(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// lookup returns the value of the named setting and where it came from.
+func (c *config) lookup(name string) (string, string) {
+	if v, ok := c.flags[name]; ok {
+		return v, "flag"
+	}
+	if v := os.Getenv(name); v != "" {
+		return v, "env"
+	}
+	if v, ok := c.file[name]; ok {
+		return v, "file"
+	}
+	o, _ := findOption(name)
+	return o.def, "default"
+}
+
+// loadConfig reads the flags in args and the config file they or
+// CONFIG_FILE point at, and validates the resulting settings. It returns
+// the arguments left after the flags, such as the migrate command.
+func loadConfig(args []string) (*config, []string, error) {
+	fs := flag.NewFlagSet("todo-api", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	for _, o := range options {
+		usage := o.usage
+		if o.def != "" {
+			usage += fmt.Sprintf(" (default %q)", o.def)
+		}
+		fs.String(flagName(o.name), "", usage+" ($"+o.name+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	c := &config{path: *path, file: map[string]string{}, flags: map[string]string{}}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			c.flags[strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))] = f.Value.String()
+		}
+	})
+	if c.path != "" {
+		if err := c.readFile(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, fs.Args(), nil
+}
+
+func flagName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// readFile loads the settings of the YAML config file.
+func (c *config) readFile() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", c.path, err)
+	}
+	return c.flatten("", doc)
+}
+
+// flatten stores the values of doc under the names of their options,
+// joining the keys of nested mappings with underscores.
+func (c *config) flatten(prefix string, doc map[string]any) error {
+	for key, value := range doc {
+		name := strings.ToUpper(prefix + key)
+		if nested, ok := value.(map[string]any); ok {
+			if err := c.flatten(name+"_", nested); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := findOption(name); !ok {
+			return fmt.Errorf("unknown setting %q in config file %s", strings.ToLower(name), c.path)
+		}
+		if value != nil {
+			c.file[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// validate checks that every setting parses as its kind and is one of its
+// choices, if it has any.
+func (c *config) validate() error {
+	var errs []error
+	for _, o := range options {
+		v, source := c.lookup(o.name)
+		if v == "" {
+			continue
+		}
+		var err error
+		switch o.kind {
+		case boolOption:
+			_, err = strconv.ParseBool(v)
+		case durationOption:
+			_, err = time.ParseDuration(v)
+		case intOption:
+			_, err = strconv.Atoi(v)
+		}
+		if err == nil && o.choices != nil && !slices.Contains(o.choices, v) {
+			err = fmt.Errorf("expected one of %s", strings.Join(o.choices, ", "))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q from %s: %w", o.name, v, source, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logSummary logs the effective value of every setting that has one, with
+// secrets redacted.
+func (c *config) logSummary() {
+	attrs := []any{}
+	if c.path != "" {
+		attrs = append(attrs, "config_file", c.path)
+	}
+	for _, o := range options {
+		v, source := c.lookup(o.name)
+		if v == "" {
+			continue
+		}
+		if o.secret {
+			v = "<redacted>"
+		}
+		attrs = append(attrs, slog.Group(o.name, "value", v, "source", source))
+	}
+	slog.Info("Effective configuration", attrs...)
+}
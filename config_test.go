@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+port: 8080
+log_level: debug
+db:
+  host: file-host
+  user: file-user
+  pass: hunter2
+`)
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("DB_USER", "env-user")
+
+	c, args, err := loadConfig([]string{"-config", path, "-db-user", "flag-user", "migrate", "status"})
+	if err != nil {
+		t.Fatalf("Loading config failed: %v", err)
+	}
+	if strings.Join(args, " ") != "migrate status" {
+		t.Errorf("Expected the arguments after the flags, got %v", args)
+	}
+
+	for name, want := range map[string]string{
+		"PORT":         "8080",
+		"LOG_LEVEL":    "debug",
+		"DB_HOST":      "env-host",
+		"DB_USER":      "flag-user",
+		"DB_PASS":      "hunter2",
+		"AUTH_MODE":    "jwt",
+		"DB_NAME":      "",
+		"AUTO_MIGRATE": "true",
+	} {
+		if got := c.get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	c.logSummary()
+	summary := buf.String()
+	if strings.Contains(summary, "hunter2") {
+		t.Errorf("Expected secrets to be redacted, got %s", summary)
+	}
+	for _, want := range []string{"DB_USER.value=flag-user DB_USER.source=flag", "DB_HOST.source=env", "PORT.source=file", "AUTH_MODE.source=default"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Expected %q in the summary, got %s", want, summary)
+		}
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	t.Setenv("SHUTDOWN_TIMEOUT", "soon")
+	path := writeConfigFile(t, "auth_mode: ldap\nport: http\n")
+
+	_, _, err := loadConfig([]string{"-config", path})
+	if err == nil {
+		t.Fatal("Expected invalid settings to be rejected")
+	}
+	for _, want := range []string{"SHUTDOWN_TIMEOUT", "AUTH_MODE", "PORT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %s in the error, got %v", want, err)
+		}
+	}
+
+	path = writeConfigFile(t, "db:\n  hots: localhost\n")
+	if _, _, err := loadConfig([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), "db_hots") {
+		t.Errorf("Expected an unknown setting to be rejected, got %v", err)
+	}
+}
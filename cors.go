@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy says which browser origins may call the API, set from the
+// CORS_* settings. Without allowed origins, no CORS headers are sent and
+// browsers only allow same-origin requests.
+type corsPolicy struct {
+	origins          []string
+	methods          string
+	headers          string
+	exposedHeaders   string
+	maxAge           time.Duration
+	allowCredentials bool
+}
+
+var cors corsPolicy
+
+// loadCORSPolicy reads the CORS_* settings.
+func loadCORSPolicy() (corsPolicy, error) {
+	policy := corsPolicy{
+		origins:        splitList(conf.get("CORS_ALLOWED_ORIGINS")),
+		methods:        strings.Join(splitList(conf.get("CORS_ALLOWED_METHODS")), ", "),
+		headers:        strings.Join(splitList(conf.get("CORS_ALLOWED_HEADERS")), ", "),
+		exposedHeaders: strings.Join(splitList(conf.get("CORS_EXPOSED_HEADERS")), ", "),
+	}
+	policy.maxAge, _ = time.ParseDuration(conf.get("CORS_MAX_AGE"))
+	policy.allowCredentials, _ = strconv.ParseBool(conf.get("CORS_ALLOW_CREDENTIALS"))
+	if policy.allowCredentials && slices.Contains(policy.origins, "*") {
+		return corsPolicy{}, errors.New("CORS_ALLOW_CREDENTIALS can't be used with any origin allowed, list the origins instead")
+	}
+	return policy, nil
+}
+
+// allows reports whether origin may call the API.
+func (p corsPolicy) allows(origin string) bool {
+	return slices.Contains(p.origins, "*") || slices.Contains(p.origins, origin)
+}
+
+// corsMiddleware adds the CORS headers for allowed origins and answers
+// their preflight requests. It wraps the whole handler rather than being
+// registered with router.Use, since preflights are OPTIONS requests no
+// route matches, and they carry no credentials to authenticate.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(cors.origins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !cors.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		if slices.Contains(cors.origins, "*") {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cors.allowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", cors.methods)
+			h.Set("Access-Control-Allow-Headers", cors.headers)
+			if cors.maxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.maxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if cors.exposedHeaders != "" {
+			h.Set("Access-Control-Expose-Headers", cors.exposedHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	enableJWTAuth(t)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	policy, err := loadCORSPolicy()
+	if err != nil {
+		t.Fatalf("Loading the CORS policy failed: %v", err)
+	}
+	saved := cors
+	cors = policy
+	t.Cleanup(func() { cors = saved })
+	router := corsMiddleware(setupRouter())
+
+	req := httptest.NewRequest("OPTIONS", "/todos/1", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected the preflight to get 204 without credentials, got %d", rr.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := rr.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/todos", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the actual request to still need credentials, got %d", rr.Code)
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || rr.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("Expected CORS headers on the response, got %v", rr.Header())
+	}
+
+	req = httptest.NewRequest("GET", "/todos", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS headers for another origin, got %v", rr.Header())
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	if _, err := loadCORSPolicy(); err == nil {
+		t.Error("Expected credentials with any origin to be rejected")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// dialect is a SQL database the API can run on, named after its DB_DRIVER
+// value. Queries are written with ? placeholders in SQL every database
+// understands; the few statements that can't be are built by the methods
+// below.
+type dialect string
+
+const (
+	mysqlDialect    dialect = "mysql"
+	postgresDialect dialect = "postgres"
+	sqliteDialect   dialect = "sqlite"
+)
+
+// dbDialect is the dialect of db. It is set from DB_DRIVER.
+var dbDialect = mysqlDialect
+
+func parseDialect(driver string) (dialect, error) {
+	switch d := dialect(driver); d {
+	case "":
+		return mysqlDialect, nil
+	case mysqlDialect, postgresDialect, sqliteDialect:
+		return d, nil
+	}
+	return "", fmt.Errorf("unsupported DB_DRIVER %q, expected mysql, postgres, sqlite or memory", driver)
+}
+
+// open connects to the database at dsn. Queries run with queryTimeout, and
+// Postgres connections rewrite the ? placeholders into its own $1, $2...
+func (d dialect) open(dsn string) (*sql.DB, error) {
+	var connector driver.Connector
+	var err error
+	switch d {
+	case postgresDialect:
+		var pqConnector *pq.Connector
+		pqConnector, err = pq.NewConnector(dsn)
+		connector = rebindConnector{pqConnector}
+	case sqliteDialect:
+		connector = dsnConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{}}
+	default:
+		connector, err = mysql.MySQLDriver{}.OpenConnector(dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return otelsql.OpenDB(timeoutConnector{connector}, tracedDBOptions(d)...), nil
+}
+
+// insertID runs an INSERT into a table with an id column and returns the id
+// of the new row.
+func (d dialect) insertID(ctx context.Context, q dbtx, query string, args ...any) (int, error) {
+	if d == postgresDialect {
+		var id int
+		err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// syncIDSequence makes sure rows inserted without an id keep getting fresh
+// ones after a row was inserted into table with an explicit id. MySQL and
+// SQLite take care of that on their own.
+func (d dialect) syncIDSequence(ctx context.Context, q dbtx, table string) error {
+	if d != postgresDialect {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, "SELECT setval(pg_get_serial_sequence('"+table+"', 'id'), (SELECT MAX(id) FROM "+table+"))")
+	return err
+}
+
+// ignoreDuplicates turns an "INSERT INTO ..." statement into one that
+// silently skips rows that would violate a unique key.
+func (d dialect) ignoreDuplicates(insert string) string {
+	insert = strings.TrimSpace(insert)
+	switch d {
+	case postgresDialect:
+		return insert + " ON CONFLICT DO NOTHING"
+	case sqliteDialect:
+		return "INSERT OR IGNORE" + strings.TrimPrefix(insert, "INSERT")
+	}
+	return "INSERT IGNORE" + strings.TrimPrefix(insert, "INSERT")
+}
+
+// groupConcat aggregates column into one string, in order and joined by
+// separator.
+func (d dialect) groupConcat(column, separator string) string {
+	if d == mysqlDialect {
+		return "GROUP_CONCAT(" + column + " ORDER BY " + column + " SEPARATOR '" + separator + "')"
+	}
+	return "STRING_AGG(" + column + ", '" + separator + "' ORDER BY " + column + ")"
+}
+
+// forUpdate is appended to a SELECT to lock the rows it reads until the
+// transaction ends. SQLite has no row locks; its transactions are started
+// with _txlock=immediate instead, which serializes them.
+func (d dialect) forUpdate() string {
+	if d == sqliteDialect {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// like is the operator matching a LIKE pattern regardless of case, as
+// MySQL's and SQLite's LIKE do.
+func (d dialect) like() string {
+	if d == postgresDialect {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// sortExpression returns what to ORDER BY to sort on column. SQLite keeps
+// priorities as plain text, so they are ranked explicitly.
+func (d dialect) sortExpression(column string) string {
+	if d == sqliteDialect && column == "priority" {
+		return "CASE priority WHEN 'low' THEN 0 WHEN 'medium' THEN 1 WHEN 'high' THEN 2 ELSE 3 END"
+	}
+	return column
+}
+
+// timestamp returns t as a query argument that compares equal to the same
+// time read from a column defaulting to CURRENT_TIMESTAMP. SQLite keeps
+// those as text without a zone, unlike the driver's own formatting of t.
+func (d dialect) timestamp(t time.Time) any {
+	if d == sqliteDialect {
+		return t.UTC().Format(time.DateTime)
+	}
+	return t
+}
+
+// isDuplicateKey reports whether err is a unique key violation.
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestIgnoreDuplicates(t *testing.T) {
+	insert := `
+INSERT INTO tags (name) VALUES (?)`
+	tests := map[dialect]string{
+		mysqlDialect:    "INSERT IGNORE INTO tags (name) VALUES (?)",
+		postgresDialect: "INSERT INTO tags (name) VALUES (?) ON CONFLICT DO NOTHING",
+		sqliteDialect:   "INSERT OR IGNORE INTO tags (name) VALUES (?)",
+	}
+
+	for d, want := range tests {
+		if got := d.ignoreDuplicates(insert); got != want {
+			t.Errorf("%s: got %q, want %q", d, got, want)
+		}
+	}
+}
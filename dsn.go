@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// buildDSN assembles the MySQL connection string from the configuration.
+//
+//	DB_USER, DB_PASS, DB_HOST, DB_PORT, DB_NAME  credentials and address
+//	DB_CONNECT_TIMEOUT                           dial timeout, e.g. "5s"
+//	DB_READ_TIMEOUT, DB_WRITE_TIMEOUT            I/O timeouts, e.g. "30s"
+//	DB_TLS                                       "true", "skip-verify" or "preferred"
+//
+// Unset timeouts and TLS keep the driver defaults.
+func buildDSN() (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = conf.get("DB_USER")
+	cfg.Passwd = conf.get("DB_PASS")
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(conf.get("DB_HOST"), conf.get("DB_PORT"))
+	cfg.DBName = conf.get("DB_NAME")
+	cfg.ParseTime = true
+	cfg.TLSConfig = conf.get("DB_TLS")
+
+	for _, timeout := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"DB_CONNECT_TIMEOUT", &cfg.Timeout},
+		{"DB_READ_TIMEOUT", &cfg.ReadTimeout},
+		{"DB_WRITE_TIMEOUT", &cfg.WriteTimeout},
+	} {
+		v := conf.get(timeout.env)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", timeout.env, err)
+		}
+		*timeout.dst = d
+	}
+
+	dsn := cfg.FormatDSN()
+	// Parsing it back runs the driver's own checks, e.g. on the tls value.
+	if _, err := mysql.ParseDSN(dsn); err != nil {
+		return "", fmt.Errorf("invalid database configuration: %w", err)
+	}
+	return dsn, nil
+}
+
+// postgresSSLModes maps DB_TLS onto Postgres' sslmode.
+var postgresSSLModes = map[string]string{
+	"false":       "disable",
+	"true":        "verify-full",
+	"skip-verify": "require",
+	"preferred":   "prefer",
+}
+
+// buildPostgresDSN assembles the Postgres connection URL from the same
+// settings as buildDSN. DB_PORT defaults to 5432, and DB_CONNECT_TIMEOUT
+// is rounded up to whole seconds. The read and write timeouts have no
+// Postgres equivalent and are rejected.
+func buildPostgresDSN() (string, error) {
+	for _, env := range []string{"DB_READ_TIMEOUT", "DB_WRITE_TIMEOUT"} {
+		if conf.get(env) != "" {
+			return "", fmt.Errorf("%s is not supported with postgres", env)
+		}
+	}
+
+	query := url.Values{}
+	// Timestamps come back in UTC, as they do from MySQL.
+	query.Set("timezone", "UTC")
+	if v := conf.get("DB_TLS"); v != "" {
+		mode, ok := postgresSSLModes[v]
+		if !ok {
+			return "", fmt.Errorf("invalid DB_TLS %q", v)
+		}
+		query.Set("sslmode", mode)
+	}
+	if v := conf.get("DB_CONNECT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid DB_CONNECT_TIMEOUT: %w", err)
+		}
+		seconds := int((d + time.Second - 1) / time.Second)
+		query.Set("connect_timeout", strconv.Itoa(seconds))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(conf.get("DB_USER"), conf.get("DB_PASS")),
+		Host:     net.JoinHostPort(conf.get("DB_HOST"), conf.getOr("DB_PORT", "5432")),
+		Path:     "/" + conf.get("DB_NAME"),
+		RawQuery: query.Encode(),
+	}
+	return dsn.String(), nil
+}
+
+// buildSQLiteDSN returns the SQLite connection string for the database file
+// at DB_PATH, default todo.db, which is created when it doesn't exist.
+// Foreign keys are enforced, and transactions take the write lock up front
+// so concurrent ones wait for each other instead of failing.
+func buildSQLiteDSN() string {
+	params := url.Values{}
+	params.Set("_fk", "true")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_txlock", "immediate")
+	return conf.get("DB_PATH") + "?" + params.Encode()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateHandlerDueDate(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	body := strings.NewReader(`{"task":"File taxes","due_date":"2031-04-15T17:00:00+02:00"}`)
+	req := httptest.NewRequest("POST", "/todos", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", status, rr.Body.String())
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	want := time.Date(2031, time.April, 15, 15, 0, 0, 0, time.UTC)
+	if todo.DueDate == nil || !todo.DueDate.Equal(want) {
+		t.Errorf("Expected due date %v, got %v", want, todo.DueDate)
+	}
+
+	var stored time.Time
+	if err := db.QueryRow("SELECT due_date FROM todos WHERE id = ?", todo.ID).Scan(&stored); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if !stored.Equal(want) {
+		t.Errorf("Expected stored due date %v, got %v", want, stored)
+	}
+}
+
+func TestListHandlerDueDateFilters(t *testing.T) {
+	clearTodos(t)
+
+	now := time.Now().UTC()
+	seed := func(task string, done bool, due *time.Time) {
+		t.Helper()
+		if _, err := db.Exec("INSERT INTO todos (task, done, due_date) VALUES (?, ?, ?)", task, done, due); err != nil {
+			t.Fatalf("Failed to seed todo: %v", err)
+		}
+	}
+	past := now.Add(-48 * time.Hour)
+	future := now.Add(48 * time.Hour)
+	seed("late", false, &past)
+	seed("late but done", true, &past)
+	seed("upcoming", false, &future)
+	seed("someday", false, nil)
+
+	router := setupRouter()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"?overdue=true", "late"},
+		{"?overdue=false", "late but done,upcoming,someday"},
+		{"?due_after=" + now.Format(time.RFC3339), "upcoming"},
+		{"?due_before=" + now.Format(time.RFC3339), "late,late but done"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/todos"+tt.query, nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.query, status)
+		}
+
+		var todos []Todo
+		if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", tt.query, err)
+		}
+		var got []string
+		for _, todo := range todos {
+			got = append(got, todo.Task)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%s: expected %s, got %v", tt.query, tt.want, got)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/todos?due_before=tomorrow", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid due_before, got %d", status)
+	}
+}
+
+func TestCreateHandlerEnforcesBusinessHours(t *testing.T) {
+	hours, err := parseBusinessHours("09:00-17:00", "Mon-Fri", "UTC")
+	if err != nil {
+		t.Fatalf("Failed to parse business hours: %v", err)
+	}
+	enforcedBusinessHours = hours
+	t.Cleanup(func() { enforcedBusinessHours = nil })
+
+	router := setupRouter()
+
+	// Saturday afternoon
+	body := strings.NewReader(`{"task":"Team sync","due_date":"2031-03-15T14:30:00Z"}`)
+	req := httptest.NewRequest("POST", "/todos", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d", status)
+	}
+
+	var result struct {
+		Errors []fieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Field != "due_date" {
+		t.Fatalf("Expected a due_date error, got %+v", result.Errors)
+	}
+	if got := result.Errors[0].Suggestion; got != "2031-03-17T09:00:00Z" {
+		t.Errorf("Expected suggestion 2031-03-17T09:00:00Z, got %q", got)
+	}
+}
+
+func TestDueDateInThePast(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := send("POST", "/v1/todos", `{"task":"Too late","due_date":"2020-01-01T00:00:00Z"}`)
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), `"field":"due_date"`) {
+		t.Fatalf("Expected a due_date error, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = send("POST", "/v1/todos", `{"task":"Done already","done":true,"due_date":"2020-01-01T00:00:00Z"}`); rr.Code != http.StatusCreated {
+		t.Errorf("Expected done todos to keep past due dates, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Todos that became overdue can still be changed without moving their
+	// due date, but not moved into the past.
+	id := strconv.Itoa(seedTodo(t, "Overdue", false))
+	if _, err := db.Exec("UPDATE todos SET due_date = ? WHERE id = ?", time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), id); err != nil {
+		t.Fatalf("Failed to set due date: %v", err)
+	}
+	if rr = send("PUT", "/v1/todos/"+id, `{"id":`+id+`,"task":"Still overdue","due_date":"2020-01-01T00:00:00Z","version":1}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected an unchanged past due date to be kept, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = send("PATCH", "/v1/todos/"+id, `{"due_date":"2020-06-01T00:00:00Z","version":2}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for moving the due date into the past, got %d", rr.Code)
+	}
+	if rr = send("PATCH", "/v1/todos/"+id, `{"due_date":"2031-06-01T00:00:00Z","version":2}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a future due date, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// emailMaxAttempts is how many times an email is sent before it is
+	// given up on.
+	emailMaxAttempts = 6
+	// emailBatchSize is how many due emails are sent per poll.
+	emailBatchSize = 10
+	// emailClaimTimeout is how long an email being sent is held back from
+	// other pollers, in case its sender dies halfway.
+	emailClaimTimeout = time.Minute
+	// maxEmailErrorLength caps the error kept for a failed email.
+	maxEmailErrorLength = 1000
+	// maxEmailLength is the longest email address users can set.
+	maxEmailLength = 255
+	// overdueWindow is how long after its due date a todo is still worth an
+	// overdue email, so turning emails on doesn't flood users with old ones.
+	overdueWindow = 24 * time.Hour
+)
+
+var (
+	// emailRetryDelay is the wait after the first failed send of an email,
+	// doubling with every further one.
+	emailRetryDelay = time.Minute
+	// emailPollInterval is how often emails are scheduled and sent.
+	emailPollInterval = 10 * time.Second
+	// smtpTimeout bounds a whole SMTP conversation.
+	smtpTimeout = 30 * time.Second
+
+	// emailSettings is set from the SMTP_* and EMAIL_* options. Emails are
+	// off while its host is empty.
+	emailSettings emailConfig
+	// sendEmail hands a message to the SMTP server.
+	sendEmail = sendSMTP
+)
+
+//go:embed email.tmpl
+var defaultEmailTemplates string
+
+// emailKinds are the notifications emailed, in the order of EMAIL_EVENTS.
+// Reminders are emailed by the email reminder sink instead.
+var emailKinds = []string{"created", "due_soon", "overdue"}
+
+type emailConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     *mail.Address
+	// events are the emailKinds sent.
+	events map[string]bool
+	// dueSoon is how long before its due date a todo is due soon.
+	dueSoon   time.Duration
+	templates *template.Template
+}
+
+// loadEmailConfig reads the SMTP_* and EMAIL_* options, returning a config
+// with an empty host when SMTP_HOST isn't set.
+func loadEmailConfig() (emailConfig, error) {
+	c := emailConfig{host: conf.get("SMTP_HOST")}
+	if c.host == "" {
+		return c, nil
+	}
+	c.port, _ = strconv.Atoi(conf.get("SMTP_PORT"))
+	c.username = conf.get("SMTP_USERNAME")
+	c.password = conf.get("SMTP_PASSWORD")
+	c.dueSoon, _ = time.ParseDuration(conf.get("EMAIL_DUE_SOON"))
+
+	var err error
+	if c.from, err = mail.ParseAddress(conf.get("SMTP_FROM")); err != nil {
+		return c, fmt.Errorf("SMTP_FROM: %w", err)
+	}
+	c.events = map[string]bool{}
+	for _, kind := range splitList(conf.get("EMAIL_EVENTS")) {
+		if !slices.Contains(emailKinds, kind) {
+			return c, fmt.Errorf("unknown email event %q, expected some of %s", kind, strings.Join(emailKinds, ", "))
+		}
+		c.events[kind] = true
+	}
+	if c.templates, err = parseEmailTemplates(conf.get("EMAIL_TEMPLATES")); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// parseEmailTemplates parses the built-in email templates, then the file at
+// path if any, whose definitions replace the built-in ones of the same name.
+func parseEmailTemplates(path string) (*template.Template, error) {
+	t := template.Must(template.New("email").Parse(defaultEmailTemplates))
+	if path == "" {
+		return t, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("EMAIL_TEMPLATES: %w", err)
+	}
+	if _, err = t.New(path).Parse(string(data)); err != nil {
+		return nil, fmt.Errorf("EMAIL_TEMPLATES: %w", err)
+	}
+	return t, nil
+}
+
+// emailData is what email templates are executed with.
+type emailData struct {
+	User string
+	Todo Todo
+}
+
+// composeEmail renders the kind of email about todo for user, as a message
+// ready to send to the address to.
+func composeEmail(kind string, to *mail.Address, user string, todo Todo) ([]byte, error) {
+	data := emailData{User: user, Todo: todo}
+	var subject, body bytes.Buffer
+	if err := emailSettings.templates.ExecuteTemplate(&subject, kind+".subject", data); err != nil {
+		return nil, err
+	}
+	if err := emailSettings.templates.ExecuteTemplate(&body, kind+".body", data); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", emailSettings.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	// Headers can't span lines, so a subject template's line breaks are
+	// folded into spaces.
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject.String()), " ")))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write(body.Bytes())
+	qp.Close()
+	return msg.Bytes(), nil
+}
+
+// sendSMTP sends msg to the address to through the SMTP server, upgrading
+// the connection with STARTTLS when the server offers it and logging in
+// when SMTP_USERNAME is set.
+func sendSMTP(ctx context.Context, to string, msg []byte) error {
+	dialer := net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(emailSettings.host, strconv.Itoa(emailSettings.port)))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	c, err := smtp.NewClient(conn, emailSettings.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: emailSettings.host}); err != nil {
+			return err
+		}
+	}
+	if emailSettings.username != "" {
+		if err = c.Auth(smtp.PlainAuth("", emailSettings.username, emailSettings.password, emailSettings.host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(emailSettings.from.Address); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+	data, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = data.Write(msg); err != nil {
+		return err
+	}
+	if err = data.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// runEmailNotifications emails users about their todos until ctx is done:
+// those assigned to them, queued by queueAssignedEmail, and those coming or
+// past due.
+func runEmailNotifications(ctx context.Context) {
+	ticker := time.NewTicker(emailPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := scheduleDueEmails(ctx); err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Error scheduling emails", "error", err)
+			}
+			continue
+		}
+		for {
+			sent, err := sendDueEmails(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Error sending emails", "error", err)
+			}
+			if err != nil || sent < emailBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// queueAssignedEmail queues the created email, telling of a todo added
+// for someone, when the caller assigned todo to someone else. Todos get
+// their assignee after they are created, so this is when it goes out.
+func queueAssignedEmail(ctx context.Context, caller principal, todo Todo) {
+	if emailSettings.host == "" || !emailSettings.events["created"] || todo.AssigneeID == nil || *todo.AssigneeID == caller.userID {
+		return
+	}
+	if err := enqueueEmail(ctx, "created", todo.ID, "NULL"); err != nil {
+		slog.ErrorContext(ctx, "Error queueing email", "error", err, "ID", todo.ID)
+	}
+}
+
+// enqueueEmail queues the kind of email about a todo for its assignee, or
+// its user while it has none, unless they have no email address or turned
+// emails off. at is the column of todos the email is about, which keeps it
+// from being queued twice.
+func enqueueEmail(ctx context.Context, kind string, todoID int, at string) error {
+	now := time.Now().UTC()
+	_, err := db.ExecContext(ctx, dbDialect.ignoreDuplicates(`
+INSERT INTO email_notifications (user_id, todo_id, kind, due_date, status, created_at, next_attempt_at)
+SELECT u.id, todos.id, ?, `+at+`, 'pending', ?, ?
+FROM todos JOIN users u ON u.id = COALESCE(todos.assignee_id, todos.user_id)
+WHERE todos.id = ? AND u.email IS NOT NULL AND u.email_notifications = TRUE`),
+		kind, now, now, todoID)
+	return err
+}
+
+// scheduleDueEmails queues the due soon and overdue emails of open todos
+// not emailed about at their current due date yet. Moving a todo's due
+// date schedules them again.
+func scheduleDueEmails(ctx context.Context) error {
+	now := time.Now().UTC()
+	windows := map[string][2]time.Time{
+		"due_soon": {now, now.Add(emailSettings.dueSoon)},
+		"overdue":  {now.Add(-overdueWindow), now},
+	}
+	for _, kind := range emailKinds {
+		window, ok := windows[kind]
+		if !ok || !emailSettings.events[kind] {
+			continue
+		}
+		_, err := db.ExecContext(ctx, dbDialect.ignoreDuplicates(`
+INSERT INTO email_notifications (user_id, todo_id, kind, due_date, status, created_at, next_attempt_at)
+SELECT u.id, todos.id, ?, todos.due_date, 'pending', ?, ?
+FROM todos JOIN users u ON u.id = COALESCE(todos.assignee_id, todos.user_id)
+WHERE todos.due_date > ? AND todos.due_date <= ? AND todos.done = FALSE
+  AND u.email IS NOT NULL AND u.email_notifications = TRUE
+  AND NOT EXISTS (SELECT 1 FROM email_notifications n WHERE n.todo_id = todos.id AND n.kind = ? AND n.due_date = todos.due_date)`),
+			kind, now, now, window[0], window[1], kind)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDueEmails makes the next attempt of up to emailBatchSize due emails
+// and records the outcome, retrying failures with exponential backoff.
+// Emails that don't apply anymore, because the user turned them off or the
+// todo is done, are skipped. It returns how many were due.
+func sendDueEmails(ctx context.Context) (int, error) {
+	type dueEmail struct {
+		id, userID, todoID, attempts int
+		kind                         string
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT id, user_id, todo_id, kind, attempts
+FROM email_notifications
+WHERE status = 'pending' AND next_attempt_at <= ?
+ORDER BY next_attempt_at, id
+LIMIT ?`, time.Now().UTC(), emailBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var due []dueEmail
+	for rows.Next() {
+		var d dueEmail
+		if err = rows.Scan(&d.id, &d.userID, &d.todoID, &d.kind, &d.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range due {
+		// Claiming by attempt count keeps other pollers from sending it too.
+		now := time.Now().UTC()
+		result, err := db.ExecContext(ctx, "UPDATE email_notifications SET attempts = attempts + 1, last_attempt_at = ?, next_attempt_at = ? WHERE id = ? AND attempts = ?",
+			now, now.Add(emailClaimTimeout), d.id, d.attempts)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		d.attempts++
+
+		var username string
+		var email sql.NullString
+		var enabled bool
+		err = db.QueryRowContext(ctx, "SELECT username, email, email_notifications FROM users WHERE id = ?", d.userID).Scan(&username, &email, &enabled)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted since, which deletes the email too.
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		todo, err := scanTodo(db.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = ?", d.todoID))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if !email.Valid || !enabled || (todo.Done && d.kind != "created") {
+			if _, err = db.ExecContext(ctx, "UPDATE email_notifications SET status = 'skipped', next_attempt_at = NULL WHERE id = ?", d.id); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		todos := []Todo{todo}
+		if err = loadTags(ctx, db, todos); err != nil {
+			return 0, err
+		}
+
+		to := &mail.Address{Name: username, Address: email.String}
+		msg, sendErr := composeEmail(d.kind, to, username, todos[0])
+		if sendErr == nil {
+			sendErr = sendEmail(ctx, to.Address, msg)
+		}
+		if err = recordEmailAttempt(ctx, d.id, d.attempts, sendErr); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// recordEmailAttempt marks an email sent, or schedules its next attempt
+// after a failure until emailMaxAttempts is reached.
+func recordEmailAttempt(ctx context.Context, id, attempts int, sendErr error) error {
+	if sendErr == nil {
+		_, err := db.ExecContext(ctx, "UPDATE email_notifications SET status = 'sent', error = NULL, next_attempt_at = NULL WHERE id = ?", id)
+		return err
+	}
+
+	message := sendErr.Error()
+	if len(message) > maxEmailErrorLength {
+		message = message[:maxEmailErrorLength]
+	}
+	if attempts >= emailMaxAttempts {
+		slog.Warn("Gave up on email", "ID", id, "attempts", attempts, "error", message)
+		_, err := db.ExecContext(ctx, "UPDATE email_notifications SET status = 'failed', error = ?, next_attempt_at = NULL WHERE id = ?", message, id)
+		return err
+	}
+	next := time.Now().UTC().Add(emailRetryDelay << (attempts - 1))
+	_, err := db.ExecContext(ctx, "UPDATE email_notifications SET error = ?, next_attempt_at = ? WHERE id = ?", message, next, id)
+	return err
+}
+
+// emailReminderSink emails reminders to the todo's assignee or user,
+// through the same queue as the other emails.
+type emailReminderSink struct{}
+
+func (emailReminderSink) notify(ctx context.Context, r reminder) error {
+	return enqueueEmail(ctx, "reminder", r.todo.ID, "todos.remind_at")
+}
+
+// notificationSettings are a user's choices of how they are notified.
+type notificationSettings struct {
+	Email              string `json:"email"`
+	EmailNotifications bool   `json:"email_notifications"`
+}
+
+// ReadNotificationSettingsHandler serves the caller's notification settings.
+func ReadNotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUser(w, r) {
+		return
+	}
+	var settings notificationSettings
+	var email sql.NullString
+	err := db.QueryRowContext(r.Context(), "SELECT email, email_notifications FROM users WHERE id = ?", principalFrom(r.Context()).userID).Scan(&email, &settings.EmailNotifications)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeErrorCode(w, r, codeUserNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error looking up user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	settings.Email = email.String
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateNotificationSettingsHandler replaces the caller's notification
+// settings. An empty email removes their address, and leaving out
+// email_notifications turns emails on.
+func UpdateNotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireUser(w, r) {
+		return
+	}
+	settings := notificationSettings{EmailNotifications: true}
+	if err := decodeBody(r, &settings); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	settings.Email = strings.TrimSpace(settings.Email)
+	var email any
+	if settings.Email != "" {
+		var errs validationErrors
+		if addr, err := mail.ParseAddress(settings.Email); err != nil || addr.Address != settings.Email {
+			errs.add("email", "must be an email address like name@example.com")
+		} else if len(settings.Email) > maxEmailLength {
+			errs.add("email", "must be at most %d characters", maxEmailLength)
+		}
+		if errs != nil {
+			writeValidationErrors(w, r, errs)
+			return
+		}
+		email = settings.Email
+	}
+
+	userID := principalFrom(r.Context()).userID
+	// MySQL counts unchanged rows as unaffected, so the user is looked up
+	// instead of going by the rows the update affected.
+	err := db.QueryRowContext(r.Context(), "SELECT id FROM users WHERE id = ?", userID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeErrorCode(w, r, codeUserNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error looking up user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if _, err = db.ExecContext(r.Context(), "UPDATE users SET email = ?, email_notifications = ? WHERE id = ?", email, settings.EmailNotifications, userID); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating notification settings", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func clearEmails(t *testing.T) {
+	t.Helper()
+	if _, err := db.Exec("DELETE FROM email_notifications"); err != nil {
+		t.Fatalf("Failed to clear emails: %v", err)
+	}
+}
+
+// sentEmails keeps the emails sendEmail is given.
+type sentEmails struct {
+	mu       sync.Mutex
+	to       []string
+	subjects []string
+	messages []string
+	err      error
+}
+
+func (s *sentEmails) send(ctx context.Context, to string, msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parsed, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	if err != nil {
+		return err
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	s.to = append(s.to, to)
+	s.subjects = append(s.subjects, subject)
+	s.messages = append(s.messages, string(msg))
+	return s.err
+}
+
+// useEmail turns emails on with the built-in templates for the rest of the
+// test, keeping what would be sent instead of sending it.
+func useEmail(t *testing.T) *sentEmails {
+	t.Helper()
+	sent := &sentEmails{}
+	savedSettings, savedSend := emailSettings, sendEmail
+	emailSettings = emailConfig{
+		host:      "smtp.example.com",
+		port:      587,
+		from:      &mail.Address{Name: "Todos", Address: "todos@example.com"},
+		events:    map[string]bool{"created": true, "due_soon": true, "overdue": true},
+		dueSoon:   24 * time.Hour,
+		templates: emailTemplates(t, ""),
+	}
+	sendEmail = sent.send
+	t.Cleanup(func() { emailSettings, sendEmail = savedSettings, savedSend })
+	return sent
+}
+
+func emailTemplates(t *testing.T, path string) *template.Template {
+	t.Helper()
+	templates, err := parseEmailTemplates(path)
+	if err != nil {
+		t.Fatalf("Failed to parse email templates: %v", err)
+	}
+	return templates
+}
+
+// seedEmailUser stores a user with an email address, and notifications on.
+func seedEmailUser(t *testing.T, username string) User {
+	t.Helper()
+	user := seedUser(t, username, editorRole)
+	if _, err := db.Exec("UPDATE users SET email = ? WHERE id = ?", username+"@example.com", user.ID); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+	return user
+}
+
+// seedUserTodo stores an open todo of user, due at due unless that's zero.
+func seedUserTodo(t *testing.T, user User, task string, due time.Time) int {
+	t.Helper()
+	var dueDate any
+	if !due.IsZero() {
+		dueDate = due.UTC().Truncate(time.Second)
+	}
+	id, err := dbDialect.insertID(context.Background(), db, "INSERT INTO todos (task, done, due_date, owner, user_id) VALUES (?, FALSE, ?, ?, ?)", task, dueDate, user.Username, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to seed todo: %v", err)
+	}
+	return id
+}
+
+// runEmailPoll does what one tick of runEmailNotifications does.
+func runEmailPoll(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	if err := scheduleDueEmails(ctx); err != nil {
+		t.Fatalf("Failed to schedule emails: %v", err)
+	}
+	if _, err := sendDueEmails(ctx); err != nil {
+		t.Fatalf("Failed to send emails: %v", err)
+	}
+}
+
+func emailStatus(t *testing.T, todoID int) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow("SELECT status FROM email_notifications WHERE todo_id = ?", todoID).Scan(&status); err != nil {
+		t.Fatalf("Failed to look up email: %v", err)
+	}
+	return status
+}
+
+func TestScheduleDueEmails(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	clearEmails(t)
+	sent := useEmail(t)
+
+	alice := seedEmailUser(t, "alice")
+	quiet := seedEmailUser(t, "quiet")
+	db.Exec("UPDATE users SET email_notifications = FALSE WHERE id = ?", quiet.ID)
+	noEmail := seedUser(t, "noemail", editorRole)
+	now := time.Now()
+
+	seedUserTodo(t, alice, "Soon", now.Add(time.Hour))
+	seedUserTodo(t, alice, "Late", now.Add(-time.Hour))
+	seedUserTodo(t, alice, "Long overdue", now.Add(-72*time.Hour))
+	seedUserTodo(t, alice, "Later", now.Add(72*time.Hour))
+	seedUserTodo(t, alice, "Undated", time.Time{})
+	db.Exec("UPDATE todos SET done = TRUE WHERE id = ?", seedUserTodo(t, alice, "Done", now.Add(time.Hour)))
+	seedUserTodo(t, quiet, "Opted out", now.Add(time.Hour))
+	seedUserTodo(t, noEmail, "Nowhere to send", now.Add(time.Hour))
+
+	runEmailPoll(t)
+	runEmailPoll(t)
+	want := []string{"Due soon: Soon", "Overdue: Late"}
+	if strings.Join(sent.subjects, "|") != strings.Join(want, "|") {
+		t.Fatalf("Expected emails %q, got %q", want, sent.subjects)
+	}
+	if sent.to[0] != "alice@example.com" {
+		t.Errorf("Expected the email sent to alice, got %q", sent.to[0])
+	}
+	msg := sent.messages[0]
+	for _, want := range []string{"To: \"alice\" <alice@example.com>\r\n", "From: \"Todos\" <todos@example.com>\r\n", "Hi alice,", "due soon", "Priority: medium"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected %q in the email, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSendDueEmailsSkipsOptedOut(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	clearEmails(t)
+	sent := useEmail(t)
+
+	alice := seedEmailUser(t, "alice")
+	id := seedUserTodo(t, alice, "Soon", time.Now().Add(time.Hour))
+	if err := scheduleDueEmails(context.Background()); err != nil {
+		t.Fatalf("Failed to schedule emails: %v", err)
+	}
+	db.Exec("UPDATE users SET email_notifications = FALSE WHERE id = ?", alice.ID)
+	runEmailPoll(t)
+
+	if len(sent.subjects) != 0 {
+		t.Errorf("Expected no email after opting out, got %q", sent.subjects)
+	}
+	if status := emailStatus(t, id); status != "skipped" {
+		t.Errorf("Expected the email skipped, got %q", status)
+	}
+}
+
+func TestSendDueEmailsRetries(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	clearEmails(t)
+	sent := useEmail(t)
+	sent.err = errors.New("mailbox unavailable")
+	saved := emailRetryDelay
+	emailRetryDelay = 0
+	t.Cleanup(func() { emailRetryDelay = saved })
+
+	id := seedUserTodo(t, seedEmailUser(t, "alice"), "Late", time.Now().Add(-time.Hour))
+	for range emailMaxAttempts + 1 {
+		runEmailPoll(t)
+	}
+	if len(sent.subjects) != emailMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", emailMaxAttempts, len(sent.subjects))
+	}
+	if status := emailStatus(t, id); status != "failed" {
+		t.Errorf("Expected the email given up on, got %q", status)
+	}
+}
+
+func TestQueueAssignedEmails(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	clearEmails(t)
+	enableJWTAuth(t)
+	sent := useEmail(t)
+	router := setupRouter()
+	alice := seedEmailUser(t, "alice")
+	seedEmailUser(t, "bob")
+
+	rr := requestAs(router, alice, "POST", "/lists", `{"name": "Chores"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	requestAs(router, alice, "PUT", "/lists/"+strconv.Itoa(list.ID)+"/members/bob", `{"permission": "write"}`)
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Welcome aboard", "list_id": `+strconv.Itoa(list.ID)+`}`)
+	var todo Todo
+	json.Unmarshal(rr.Body.Bytes(), &todo)
+	path := "/todos/" + strconv.Itoa(todo.ID) + "/assignee"
+
+	queued := func() int {
+		t.Helper()
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM email_notifications WHERE kind = 'created'").Scan(&count); err != nil {
+			t.Fatalf("Failed to count emails: %v", err)
+		}
+		return count
+	}
+	if n := queued(); n != 0 {
+		t.Errorf("Expected no email for creating a todo, got %d", n)
+	}
+	if rr = requestAs(router, alice, "PUT", path, `{"username": "alice"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 assigning, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if n := queued(); n != 0 {
+		t.Errorf("Expected no email for assigning a todo to yourself, got %d", n)
+	}
+	requestAs(router, alice, "PUT", path, `{"username": "bob"}`)
+	requestAs(router, alice, "PUT", path, `{"username": "bob"}`)
+	if n := queued(); n != 1 {
+		t.Fatalf("Expected one email for assigning the todo to bob, got %d", n)
+	}
+
+	if _, err := sendDueEmails(context.Background()); err != nil {
+		t.Fatalf("Failed to send emails: %v", err)
+	}
+	if len(sent.to) != 1 || sent.to[0] != "bob@example.com" || sent.subjects[0] != "Assigned to you: Welcome aboard" {
+		t.Errorf("Expected an email to bob, got %q to %q", sent.subjects, sent.to)
+	}
+}
+
+func TestEmailReminderSink(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	clearReminders(t)
+	clearEmails(t)
+	sent := useEmail(t)
+	useReminderSink(t, emailReminderSink{})
+
+	id := seedUserTodo(t, seedEmailUser(t, "alice"), "Water the plants", time.Time{})
+	db.Exec("UPDATE todos SET remind_at = ? WHERE id = ?", time.Now().Add(-time.Minute).UTC(), id)
+	runReminderPoll(t)
+	if _, err := sendDueEmails(context.Background()); err != nil {
+		t.Fatalf("Failed to send emails: %v", err)
+	}
+	if len(sent.subjects) != 1 || sent.subjects[0] != "Reminder: Water the plants" {
+		t.Errorf("Expected a reminder email, got %q", sent.subjects)
+	}
+}
+
+func TestEmailTemplatesOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "email.tmpl")
+	os.WriteFile(path, []byte(`{{define "overdue.subject"}}Hurry up with
+ {{.Todo.Task}}, {{.User}}{{end}}`), 0o600)
+	useEmail(t)
+	emailSettings.templates = emailTemplates(t, path)
+
+	msg, err := composeEmail("overdue", &mail.Address{Address: "bob@example.com"}, "bob", Todo{Task: "Süßes backen", Priority: "low"})
+	if err != nil {
+		t.Fatalf("Failed to compose email: %v", err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	if err != nil {
+		t.Fatalf("Failed to parse email: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Hurry up with Süßes backen, bob" {
+		t.Errorf("Expected the overridden subject, got %q", subject)
+	}
+	if !strings.Contains(string(msg), "past its due date") {
+		t.Errorf("Expected the built-in body kept, got:\n%s", msg)
+	}
+
+	if _, err := parseEmailTemplates(filepath.Join(t.TempDir(), "missing.tmpl")); err == nil {
+		t.Errorf("Expected a missing template file rejected")
+	}
+}
+
+func TestSendSMTP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		var lines []string
+		text.PrintfLine("220 localhost ready")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				text.PrintfLine("250 localhost")
+			case line == "DATA":
+				text.PrintfLine("354 go ahead")
+				data, _ := text.ReadDotLines()
+				lines = append(lines, data...)
+				text.PrintfLine("250 queued")
+			case line == "QUIT":
+				text.PrintfLine("221 bye")
+				received <- lines
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	useEmail(t)
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	emailSettings.host = host
+	emailSettings.port, _ = strconv.Atoi(port)
+	if err := sendSMTP(context.Background(), "bob@example.com", []byte("Subject: Hi\r\n\r\nHello\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	lines := strings.Join(<-received, "\n")
+	for _, want := range []string{"MAIL FROM:<todos@example.com>", "RCPT TO:<bob@example.com>", "Subject: Hi", "Hello"} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("Expected %q sent, got:\n%s", want, lines)
+		}
+	}
+}
+
+func TestNotificationSettings(t *testing.T) {
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	token, _ := issueToken(seedUser(t, "alice", editorRole), time.Now())
+
+	request := func(method, body string) (int, notificationSettings) {
+		req := httptest.NewRequest(method, "/users/me/notifications", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var settings notificationSettings
+		json.Unmarshal(rr.Body.Bytes(), &settings)
+		return rr.Code, settings
+	}
+
+	if status, settings := request("GET", ""); status != http.StatusOK || settings != (notificationSettings{EmailNotifications: true}) {
+		t.Errorf("Expected no email with notifications on, got %d %+v", status, settings)
+	}
+	if status, _ := request("PUT", `{"email":"Alice <alice@example.com>"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a named address, got %d", status)
+	}
+	if status, _ := request("PUT", `{"email":" alice@example.com ","email_notifications":false}`); status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+	want := notificationSettings{Email: "alice@example.com", EmailNotifications: false}
+	if status, settings := request("GET", ""); status != http.StatusOK || settings != want {
+		t.Errorf("Expected %+v, got %d %+v", want, status, settings)
+	}
+	if status, settings := request("PUT", `{"email":""}`); status != http.StatusOK || settings != (notificationSettings{EmailNotifications: true}) {
+		t.Errorf("Expected the email cleared, got %d %+v", status, settings)
+	}
+
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemDetails is an RFC 7807 error body.
+type problemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is the machine-readable error code, as in the JSON error body.
+	Code string `json:"code,omitempty"`
+	// RequestID is the X-Request-ID of the failed request, to quote when
+	// reporting it.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// validationProblem is the problemDetails of a validation failure, with
+// the invalid fields in an errors extension member.
+type validationProblem struct {
+	problemDetails
+	Errors validationErrors `json:"errors"`
+}
+
+// alwaysProblemJSON makes every error use problem+json regardless of the
+// Accept header. It is set from ERROR_FORMAT=problem+json.
+var alwaysProblemJSON bool
+
+// errorResponse is the JSON body of every error response: a machine-readable
+// code clients can branch on, a message for humans and the request ID to
+// quote when reporting it. Validation failures also list the invalid fields.
+type errorResponse struct {
+	Error  errorBody        `json:"error"`
+	Errors validationErrors `json:"errors,omitempty"`
+}
+
+type errorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error codes more specific than the status code, for errors clients are
+// likely to handle differently from others with the same status.
+const (
+	codeInvalidID            = "invalid_id"
+	codeUnknownField         = "unknown_field"
+	codeIDMismatch           = "id_mismatch"
+	codeVersionConflict      = "version_conflict"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codeTodoNotFound         = "todo_not_found"
+	codeListNotFound         = "list_not_found"
+	codeMemberNotFound       = "member_not_found"
+	codeUserNotFound         = "user_not_found"
+	codeAPIKeyNotFound       = "api_key_not_found"
+	codeWebhookNotFound      = "webhook_not_found"
+	codeCommentNotFound      = "comment_not_found"
+	codeTemplateNotFound     = "template_not_found"
+	codeRouteNotFound        = "route_not_found"
+	codeMissingAuth          = "missing_credentials"
+	codeInvalidToken         = "invalid_token"
+	codeBadCredentials       = "invalid_credentials"
+	codeInvalidAdminKey      = "invalid_admin_key"
+	codeReadOnlyRole         = "read_only_role"
+	codeAdminRequired        = "admin_required"
+	codeUserRequired         = "user_required"
+	codeNotListOwner         = "not_list_owner"
+	codeNotCommentAuthor     = "not_comment_author"
+	codeUsernameTaken        = "username_taken"
+	codeIdempotencyInUse     = "idempotency_key_in_use"
+	codeIdempotencyReused    = "idempotency_key_reused"
+	codeNothingToUndo        = "nothing_to_undo"
+	codeTodoNotDone          = "todo_not_done"
+	codeReadOnlyMode         = "read_only_mode"
+	codeValidationFailed     = "validation_failed"
+	codeAdminAPIDisabled     = "admin_api_disabled"
+)
+
+// statusCode is the error code of errors without a more specific one,
+// derived from the status text, such as "not_found" or "bad_request".
+func statusCode(status int) string {
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// writeError replies to the request with the given error message and status
+// code, using the generic error code of the status.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	writeErrorCode(w, r, statusCode(status), message, status)
+}
+
+// writeErrorCode replies to the request with the given error code, message
+// and status code. The body is an errorResponse unless the client asks for
+// problem+json or the server is configured to always use it.
+func writeErrorCode(w http.ResponseWriter, r *http.Request, code, message string, status int) {
+	writeErrorFields(w, r, code, message, status, nil)
+}
+
+// writeErrorFields is writeErrorCode listing the invalid fields of a
+// validation failure, when errs isn't nil.
+func writeErrorFields(w http.ResponseWriter, r *http.Request, code, message string, status int, errs validationErrors) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !alwaysProblemJSON && !strings.Contains(r.Header.Get("Accept"), problemContentType) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(errorResponse{Error: errorBody{Code: code, Message: message, RequestID: requestID(r.Context())}, Errors: errs})
+		return
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	problem := problemDetails{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    message,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: requestID(r.Context()),
+	}
+	if errs == nil {
+		json.NewEncoder(w).Encode(problem)
+		return
+	}
+	json.NewEncoder(w).Encode(validationProblem{problem, errs})
+}
+
+// NotFoundHandler answers requests for paths no route matches.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeErrorCode(w, r, codeRouteNotFound, "No such endpoint", http.StatusNotFound)
+}
+
+// MethodNotAllowedHandler answers requests for a route with a method it
+// doesn't support.
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+}
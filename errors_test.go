@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotFoundAsProblemJSON(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/999999", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", status)
+	}
+
+	contentType := rr.Header().Get("Content-Type")
+	if contentType != "application/problem+json" {
+		t.Errorf("Expected Content-Type application/problem+json, got %s", contentType)
+	}
+
+	var problem problemDetails
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	want := problemDetails{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "Todo not found",
+		Instance: "/todos/999999",
+		Code:     codeTodoNotFound,
+	}
+	if problem != want {
+		t.Errorf("Expected %+v, got %+v", want, problem)
+	}
+}
+
+func TestValidationErrorsAsProblemJSON(t *testing.T) {
+	router := setupRouter()
+
+	for name, setup := range map[string]func(*testing.T, *http.Request){
+		"Accept": func(_ *testing.T, req *http.Request) { req.Header.Set("Accept", problemContentType) },
+		"ERROR_FORMAT": func(t *testing.T, _ *http.Request) {
+			alwaysProblemJSON = true
+			t.Cleanup(func() { alwaysProblemJSON = false })
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task": ""}`))
+			setup(t, req)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get("Content-Type") != problemContentType {
+				t.Fatalf("Expected a 422 problem, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+			}
+			var problem validationProblem
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if problem.Status != http.StatusUnprocessableEntity || problem.Code != codeValidationFailed || len(problem.Errors) != 1 || problem.Errors[0].Field != "task" {
+				t.Errorf("Expected the invalid task in the problem's errors, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	router := requestIDMiddleware(setupRouter())
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", "/todos/abc", http.StatusBadRequest, codeInvalidID},
+		{"GET", "/todos/999999", http.StatusNotFound, codeTodoNotFound},
+		{"GET", "/no-such-route", http.StatusNotFound, codeRouteNotFound},
+		{"PATCH", "/todos", http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set(requestIDHeader, "abc123")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, rr.Code)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("%s %s: expected Content-Type application/json, got %s", tt.method, tt.path, contentType)
+		}
+		var body errorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: failed to parse response %q: %v", tt.method, tt.path, rr.Body.String(), err)
+		}
+		if body.Error.Code != tt.code || body.Error.Message == "" || body.Error.RequestID != "abc123" {
+			t.Errorf("%s %s: expected code %s with a message and the request ID, got %+v", tt.method, tt.path, tt.code, body.Error)
+		}
+	}
+}
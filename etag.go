@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// encodeWithETag encodes v as JSON and derives a strong ETag from the
+// encoded bytes, so any change to a returned field changes the tag. Header
+// values sent along with the body, like a page's total, go in headers so
+// they change it too.
+func encodeWithETag(v any, headers ...string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, "", err
+	}
+	hash := sha256.New()
+	hash.Write(buf.Bytes())
+	for _, h := range headers {
+		hash.Write([]byte{0})
+		hash.Write([]byte(h))
+	}
+	return buf.Bytes(), `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`, nil
+}
+
+// etagMatches reports whether the If-None-Match header of r matches etag.
+// Weak comparison is used, as RFC 9110 requires for If-None-Match.
+func etagMatches(r *http.Request, etag string) bool {
+	return etagListMatches(r.Header.Get("If-None-Match"), etag)
+}
+
+// etagListMatches reports whether a comma separated list of ETags, or "*",
+// contains etag, comparing them weakly.
+func etagListMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatch makes PUT and PATCH of existing todos fail without an
+// If-Match header or a version, so no client overwrites changes it hasn't
+// seen. It is set from REQUIRE_IF_MATCH, which clients that can't send
+// either may turn off.
+var requireIfMatch = true
+
+var (
+	errPreconditionFailed   = errors.New("The todo changed since the ETag in If-Match")
+	errPreconditionRequired = errors.New("If-Match or a version is required to change a todo")
+	errVersionConflict      = errors.New("The todo changed since the version in the body")
+)
+
+// checkPreconditions makes sure the todo a client is changing is still the
+// one it last read: the ETag of the stored todo must be in the If-Match
+// header of r, and its version must equal version unless that is 0. It is
+// called from an update's change function, with the stored todo, which has
+// no ID when the update creates it.
+//
+// If-Match is compared weakly, unlike RFC 9110 says, since gzipped responses
+// carry weak ETags and still come from the same todo.
+func checkPreconditions(r *http.Request, stored Todo, version int) error {
+	ifMatch := r.Header.Get("If-Match")
+	if stored.ID == 0 {
+		if ifMatch != "" {
+			return errPreconditionFailed
+		}
+		return nil
+	}
+	if ifMatch != "" {
+		_, etag, err := encodeWithETag(stored)
+		if err != nil {
+			return err
+		}
+		if !etagListMatches(ifMatch, etag) {
+			return errPreconditionFailed
+		}
+	}
+	if version != 0 && version != stored.Version {
+		return errVersionConflict
+	}
+	return nil
+}
+
+// checkUpdatePreconditions is checkPreconditions for PUT and PATCH of a
+// todo, which must send If-Match or a version while requireIfMatch is set.
+func checkUpdatePreconditions(r *http.Request, stored Todo, version int) error {
+	if stored.ID != 0 && requireIfMatch && r.Header.Get("If-Match") == "" && version == 0 {
+		return errPreconditionRequired
+	}
+	return checkPreconditions(r, stored, version)
+}
+
+// writePreconditionError replies to an error from checkPreconditions, and
+// reports whether err was one.
+func writePreconditionError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, errPreconditionFailed):
+		writeErrorCode(w, r, codePreconditionFailed, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, errPreconditionRequired):
+		writeErrorCode(w, r, codePreconditionRequired, err.Error(), http.StatusPreconditionRequired)
+	case errors.Is(err, errVersionConflict):
+		writeErrorCode(w, r, codeVersionConflict, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
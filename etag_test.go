@@ -0,0 +1,228 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadHandlerConditionalGet(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("Expected an ETag header")
+	}
+
+	req = httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id), nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", status)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", rr.Body.String())
+	}
+
+	if _, err := db.Exec("UPDATE todos SET done = TRUE WHERE id = ?", id); err != nil {
+		t.Fatalf("Failed to update todo: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id), nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status 200 after change, got %d", status)
+	}
+	if rr.Header().Get("ETag") == etag {
+		t.Errorf("Expected ETag to change after the todo changed")
+	}
+}
+
+func TestListHandlerConditionalGet(t *testing.T) {
+	clearTodos(t)
+	seedTodo(t, "first", false)
+	router := setupRouter()
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	etag := get("/todos?limit=1", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("Expected an ETag header")
+	}
+	rr := get("/todos?limit=1", etag)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected an empty 304, got %d: %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("Expected the 304 to carry X-Total-Count")
+	}
+
+	// A new todo past the page leaves it as is, but changes its total.
+	seedTodo(t, "second", false)
+	rr = get("/todos?limit=1", etag)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("Expected status 200 once the total changed, got %d", rr.Code)
+	}
+}
+
+func TestGzipWeakensETag(t *testing.T) {
+	clearTodos(t)
+	for i := range 20 {
+		seedTodo(t, "a task long enough to be worth compressing "+strconv.Itoa(i), false)
+	}
+	router := compressMiddleware(setupRouter())
+
+	req := httptest.NewRequest("GET", "/todos", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	etag := rr.Header().Get("ETag")
+	if rr.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected a weak ETag on a gzipped body, got %q", etag)
+	}
+
+	req = httptest.NewRequest("GET", "/todos", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected the weak ETag to match, got %d", rr.Code)
+	}
+}
+
+func TestConditionalUpdates(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "shared task", false)
+	path := "/todos/" + strconv.Itoa(id)
+	router := setupRouter()
+	send := func(method, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	etag := send("GET", "").Header().Get("ETag")
+	rr := send("PATCH", `{"done":true}`, "If-Match", etag)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with a current ETag, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if next := rr.Header().Get("ETag"); next == etag || next != send("GET", "").Header().Get("ETag") {
+		t.Errorf("Expected the response to carry the new ETag, got %q", next)
+	}
+
+	// A second client still holding the old ETag must not overwrite it.
+	rr = send("PATCH", `{"task":"stale"}`, "If-Match", etag)
+	if rr.Code != http.StatusPreconditionFailed || !strings.Contains(rr.Body.String(), codePreconditionFailed) {
+		t.Errorf("Expected 412 %s for a stale ETag, got %d", codePreconditionFailed, rr.Code)
+	}
+
+	rr = send("PUT", `{"id":`+strconv.Itoa(id)+`,"task":"stale","version":1}`)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), codeVersionConflict) {
+		t.Errorf("Expected 409 %s for a stale version, got %d", codeVersionConflict, rr.Code)
+	}
+	rr = send("PUT", `{"id":`+strconv.Itoa(id)+`,"task":"fresh","version":2}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"version":3`) {
+		t.Errorf("Expected the current version to be accepted and bumped, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = send("PATCH", `{"done":false}`, "If-Match", "*"); rr.Code != http.StatusOK {
+		t.Errorf("Expected If-Match: * to match an existing todo, got %d", rr.Code)
+	}
+
+	var task string
+	if err := db.QueryRow("SELECT task FROM todos WHERE id = ?", id).Scan(&task); err != nil || task != "fresh" {
+		t.Errorf("Expected only the fresh update stored, got %q: %v", task, err)
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "guarded", false)
+	path := "/todos/" + strconv.Itoa(id)
+	router := setupRouter()
+	putUpsert = true
+	t.Cleanup(func() { putUpsert = false })
+
+	req := httptest.NewRequest("PATCH", path, strings.NewReader(`{"done":true}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPreconditionRequired || !strings.Contains(rr.Body.String(), codePreconditionRequired) {
+		t.Errorf("Expected 428 %s without If-Match, got %d", codePreconditionRequired, rr.Code)
+	}
+
+	req = httptest.NewRequest("PATCH", path, strings.NewReader(`{"done":true,"version":1}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected a version to do instead, got %d", rr.Code)
+	}
+
+	// Creating with PUT needs no precondition, but can't match one.
+	newPath := "/todos/" + strconv.Itoa(id+100)
+	req = httptest.NewRequest("PUT", newPath, strings.NewReader(`{"id":`+strconv.Itoa(id+100)+`,"task":"new"}`))
+	req.Header.Set("If-Match", "*")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for If-Match on a missing todo, got %d", rr.Code)
+	}
+	req = httptest.NewRequest("PUT", newPath, strings.NewReader(`{"id":`+strconv.Itoa(id+100)+`,"task":"new"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"version":1`) {
+		t.Errorf("Expected the todo created at version 1, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	requireIfMatch = false
+	t.Cleanup(func() { requireIfMatch = true })
+	req = httptest.NewRequest("PATCH", path, strings.NewReader(`{"done":false}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected REQUIRE_IF_MATCH=false to allow changes without If-Match, got %d", rr.Code)
+	}
+}
+
+func TestVersionBumpsOnlyOnChange(t *testing.T) {
+	clearTodos(t)
+	open := seedTodo(t, "open", false)
+	done := seedTodo(t, "done", true)
+	router := setupRouter()
+
+	req := httptest.NewRequest("POST", "/todos/batch-update", strings.NewReader(`{"ids":[`+strconv.Itoa(open)+`,`+strconv.Itoa(done)+`],"done":true}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	for id, want := range map[int]int{open: 2, done: 1} {
+		var version int
+		if err := db.QueryRow("SELECT version FROM todos WHERE id = ?", id).Scan(&version); err != nil {
+			t.Fatalf("Failed to query version: %v", err)
+		}
+		if version != want {
+			t.Errorf("Expected todo %d at version %d, got %d", id, want, version)
+		}
+	}
+}
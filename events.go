@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// todoEvent describes a change to a todo.
+type todoEvent struct {
+	Type string `json:"type"` // "created", "updated" or "deleted"
+	Todo Todo   `json:"todo"`
+
+	// seq numbers the event, in the order events were published.
+	seq uint64
+	// owner owns the todo, which decides who gets to see the change.
+	owner principal
+	// completed is set on updates marking the todo done.
+	completed bool
+}
+
+// visibleTo reports whether caller may see the change, by the rules of
+// todoScope: changes to their own todos, to todos in lists they can see,
+// and for admins every change, whoever made it.
+func (e todoEvent) visibleTo(ctx context.Context, caller principal) bool {
+	if caller.owns(e.owner.owner, e.owner.userID) {
+		return true
+	}
+	if e.Todo.ListID == nil || db == nil {
+		return false
+	}
+	_, err := findList(ctx, db, caller, *e.Todo.ListID)
+	return err == nil
+}
+
+// eventBufferSize is how many events a subscriber may fall behind by before
+// it is dropped.
+const eventBufferSize = 64
+
+// eventHistorySize is how many of the latest events are kept for clients
+// catching up on what they missed.
+const eventHistorySize = 1000
+
+// eventBus fans the todo events published by the write paths out to every
+// subscriber, numbering them as it goes.
+type eventBus struct {
+	mu      sync.Mutex
+	subs    map[chan todoEvent]bool
+	lastSeq uint64
+	history []todoEvent // the latest events, oldest first
+}
+
+// newEventBus numbers events from the current time in microseconds, so the
+// IDs clients kept from before a restart are older than any new event.
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[chan todoEvent]bool), lastSeq: uint64(time.Now().UnixMicro())}
+}
+
+var todoEvents = newEventBus()
+
+// subscribe returns a channel receiving every event published from now on.
+// The channel is closed by unsubscribe, or when the subscriber falls
+// eventBufferSize events behind.
+func (b *eventBus) subscribe() chan todoEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.add()
+}
+
+// subscribeAfter is subscribe that also returns the retained events
+// published after the one numbered seq, oldest first, so none are missed
+// or repeated between the two.
+func (b *eventBus) subscribeAfter(seq uint64) (chan todoEvent, []todoEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i, _ := slices.BinarySearchFunc(b.history, seq+1, func(e todoEvent, seq uint64) int {
+		return cmp.Compare(e.seq, seq)
+	})
+	return b.add(), slices.Clone(b.history[i:])
+}
+
+func (b *eventBus) add() chan todoEvent {
+	ch := make(chan todoEvent, eventBufferSize)
+	b.subs[ch] = true
+	return ch
+}
+
+func (b *eventBus) unsubscribe(ch chan todoEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[ch] {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// publish numbers event and hands it to every subscriber without waiting on
+// any of them.
+func (b *eventBus) publish(event todoEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastSeq++
+	event.seq = b.lastSeq
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishAll publishes events in order.
+func (b *eventBus) publishAll(events []todoEvent) {
+	for _, event := range events {
+		b.publish(event)
+	}
+}
+
+// publishingRepository publishes an event on bus for every change made
+// through the TodoRepository it wraps.
+type publishingRepository struct {
+	TodoRepository
+	bus *eventBus
+}
+
+func (r publishingRepository) Create(ctx context.Context, caller principal, todo Todo) (Todo, error) {
+	todo, err := r.TodoRepository.Create(ctx, caller, todo)
+	if err == nil {
+		r.bus.publish(todoEvent{Type: "created", Todo: todo, owner: caller})
+	}
+	return todo, err
+}
+
+// Update looks up the owner first, while the caller can still see the todo;
+// upserted todos are the caller's.
+func (r publishingRepository) Update(ctx context.Context, caller principal, id int, change func(*Todo) error, opts UpdateOptions) (Todo, bool, error) {
+	owner, err := r.TodoRepository.Owner(ctx, caller, id)
+	if errors.Is(err, errTodoNotFound) {
+		owner = caller
+	} else if err != nil {
+		return Todo{}, false, err
+	}
+	var wasDone bool
+	todo, created, err := r.TodoRepository.Update(ctx, caller, id, func(todo *Todo) error {
+		wasDone = todo.Done
+		return change(todo)
+	}, opts)
+	if err == nil {
+		event := todoEvent{Type: "updated", Todo: todo, owner: owner, completed: !created && !wasDone && todo.Done}
+		if created {
+			event.Type = "created"
+		}
+		r.bus.publish(event)
+	}
+	return todo, created, err
+}
+
+// Delete loads the todo and its owner first, so the event can tell who may
+// see it.
+func (r publishingRepository) Delete(ctx context.Context, caller principal, id int) error {
+	todo, err := r.TodoRepository.Get(ctx, caller, id)
+	if err != nil {
+		return err
+	}
+	owner, err := r.TodoRepository.Owner(ctx, caller, id)
+	if err != nil {
+		return err
+	}
+	if err = r.TodoRepository.Delete(ctx, caller, id); err == nil {
+		r.bus.publish(todoEvent{Type: "deleted", Todo: todo, owner: owner})
+	}
+	return err
+}
+
+// eventCoalesceWindow is how long events for the same todo are held back so
+// a burst can be collapsed into one. It is set from EVENT_COALESCE_WINDOW;
+// zero disables coalescing.
+var eventCoalesceWindow time.Duration
+
+// coalesce forwards events from in, collapsing every burst of events for the
+// same todo that arrives within window of the first one into a single event
+// carrying the latest state. The output is closed once in is closed and any
+// held back events have been flushed.
+func coalesce(in <-chan todoEvent, window time.Duration) <-chan todoEvent {
+	out := make(chan todoEvent)
+
+	go func() {
+		defer close(out)
+
+		type held struct {
+			id       int
+			deadline time.Time
+		}
+		pending := make(map[int]todoEvent)
+		var queue []held // ordered by deadline, since the window is fixed
+
+		timer := time.NewTimer(window)
+		defer timer.Stop()
+
+		for {
+			var fire <-chan time.Time
+			if len(queue) > 0 {
+				timer.Reset(time.Until(queue[0].deadline))
+				fire = timer.C
+			} else {
+				timer.Stop()
+			}
+
+			select {
+			case event, ok := <-in:
+				if !ok {
+					for _, h := range queue {
+						out <- pending[h.id]
+					}
+					return
+				}
+				id := event.Todo.ID
+				if window <= 0 {
+					out <- event
+					continue
+				}
+				if prev, exists := pending[id]; exists {
+					pending[id] = mergeEvents(prev, event)
+					continue
+				}
+				pending[id] = event
+				queue = append(queue, held{id: id, deadline: time.Now().Add(window)})
+
+			case <-fire:
+				id := queue[0].id
+				queue = queue[1:]
+				out <- pending[id]
+				delete(pending, id)
+			}
+		}
+	}()
+
+	return out
+}
+
+// mergeEvents folds next into an event that is still being held back.
+func mergeEvents(prev, next todoEvent) todoEvent {
+	switch {
+	case next.Type == "deleted":
+	case prev.Type == "created":
+		// Clients haven't seen the todo yet, so it's still a creation.
+		next.Type = "created"
+	default:
+		next.Type = "updated"
+	}
+	return next
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoalesceCollapsesRapidUpdates(t *testing.T) {
+	in := make(chan todoEvent)
+	out := coalesce(in, 50*time.Millisecond)
+
+	for i, task := range []string{"first", "second", "third"} {
+		in <- todoEvent{Type: "updated", Todo: Todo{ID: 1, Task: task, Done: i == 2}}
+	}
+	in <- todoEvent{Type: "updated", Todo: Todo{ID: 2, Task: "other"}}
+
+	var events []todoEvent
+	timeout := time.After(time.Second)
+	for len(events) < 2 {
+		select {
+		case event := <-out:
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for coalesced events, got %v", events)
+		}
+	}
+
+	if events[0].Type != "updated" || events[0].Todo.ID != 1 {
+		t.Fatalf("Expected an updated event for todo 1, got %+v", events[0])
+	}
+	if events[0].Todo.Task != "third" || !events[0].Todo.Done {
+		t.Errorf("Expected the latest state of todo 1, got %+v", events[0].Todo)
+	}
+	if events[1].Todo.ID != 2 {
+		t.Errorf("Expected an event for todo 2, got %+v", events[1])
+	}
+
+	close(in)
+	if event, ok := <-out; ok {
+		t.Errorf("Expected no further events, got %+v", event)
+	}
+}
+
+func TestEventBusDropsSubscribersThatFallBehind(t *testing.T) {
+	bus := newEventBus()
+	slow := bus.subscribe()
+	fast := bus.subscribe()
+	defer bus.unsubscribe(fast)
+
+	for i := range eventBufferSize + 1 {
+		bus.publish(todoEvent{Type: "created", Todo: Todo{ID: i}})
+		<-fast
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != eventBufferSize {
+		t.Errorf("Expected the %d buffered events before the channel closed, got %d", eventBufferSize, received)
+	}
+	bus.unsubscribe(slow)
+}
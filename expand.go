@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxExpandDepth bounds how deep ?expand= paths can nest, so a single
+// request can't fan out into an unbounded number of queries.
+const maxExpandDepth = 3
+
+// expansion is a tree of nested resources, keyed by name.
+type expansion map[string]expansion
+
+// todoExpansions lists the nested resources of a todo that can be requested
+// with ?expand=, along with what can be expanded on each of them in turn.
+// Subtasks are todos themselves, so the tree refers back to itself and
+// maxExpandDepth is what bounds it.
+var todoExpansions = newTodoExpansions()
+
+func newTodoExpansions() expansion {
+	todo := expansion{
+		"tags": nil,
+	}
+	todo["subtasks"] = todo
+	return todo
+}
+
+// parseExpand parses a comma separated list of dotted paths, such as
+// "subtasks.tags", into the tree of requested expansions. Unknown paths and
+// paths nested deeper than maxExpandDepth are rejected.
+func parseExpand(param string) (expansion, error) {
+	requested := expansion{}
+	if param == "" {
+		return requested, nil
+	}
+
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		parts := strings.Split(path, ".")
+		if len(parts) > maxExpandDepth {
+			return nil, fmt.Errorf("Expand path %q is nested deeper than %d levels", path, maxExpandDepth)
+		}
+
+		allowed, node := todoExpansions, requested
+		for _, part := range parts {
+			if _, ok := allowed[part]; !ok {
+				return nil, fmt.Errorf("Unknown expand path %q", path)
+			}
+			if node[part] == nil {
+				node[part] = expansion{}
+			}
+			allowed, node = allowed[part], node[part]
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestReadHandlerExpand(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	router := setupRouter()
+
+	tests := []struct {
+		expand string
+		status int
+	}{
+		{"tags", http.StatusOK},
+		{"subtasks.tags", http.StatusOK},
+		{"subtasks.subtasks.subtasks.tags", http.StatusBadRequest},
+		{"owner", http.StatusBadRequest},
+		{"tags.colour", http.StatusBadRequest},
+		{"a.b.c.d", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id)+"?expand="+tt.expand, nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("expand=%s: expected status %d, got %d", tt.expand, tt.status, rr.Code)
+		}
+	}
+}
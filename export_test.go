@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExportCSVHandler(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "task, with comma", true)
+	if err := setTodoTags(context.Background(), db, id, []string{"work", "home"}); err != nil {
+		t.Fatalf("Failed to tag todo: %v", err)
+	}
+
+	router := setupRouter()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/todos.csv", nil),
+		httptest.NewRequest("GET", "/todos/export?format=csv", nil),
+		func() *http.Request {
+			req := httptest.NewRequest("GET", "/todos", nil)
+			req.Header.Set("Accept", "text/csv")
+			return req
+		}(),
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+			t.Errorf("Expected Content-Type text/csv, got %q", ct)
+		}
+		if cd := rr.Header().Get("Content-Disposition"); cd != "attachment; filename=todos.csv" {
+			t.Errorf("Unexpected Content-Disposition %q", cd)
+		}
+
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to parse CSV: %v", err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("Expected header and 1 row, got %d records", len(records))
+		}
+		row := make(map[string]string)
+		for i, column := range records[0] {
+			row[column] = records[1][i]
+		}
+		want := map[string]string{"task": "task, with comma", "done": "true", "due_date": "", "priority": "medium", "tags": "home;work"}
+		for column, value := range want {
+			if row[column] != value {
+				t.Errorf("Expected %s to be %q, got %q", column, value, row[column])
+			}
+		}
+		if row["created_at"] == "" {
+			t.Errorf("Expected created_at to be set")
+		}
+	}
+}
+
+func TestExportCSVEscapesFormulas(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+	tasks := []string{"=HYPERLINK(\"http://evil.example\")", "+1", "-2", "@SUM(A1)", "'quoted", "Plain"}
+	for _, task := range tasks {
+		seedTodo(t, task, false)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/todos/export?sort=id", nil))
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	want := []string{"'=HYPERLINK(\"http://evil.example\")", "'+1", "'-2", "'@SUM(A1)", "''quoted", "Plain"}
+	for i, task := range want {
+		if got := records[i+1][1]; got != task {
+			t.Errorf("Expected task %q, got %q", task, got)
+		}
+	}
+	for _, task := range tasks {
+		if got := csvUnescape(csvEscape(task)); got != task {
+			t.Errorf("Expected %q back, got %q", task, got)
+		}
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/export?format=xlsx", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", status)
+	}
+}
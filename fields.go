@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// fieldSet is the set of fields of a todo a client asked for, by name. A
+// nil fieldSet asks for all of them.
+type fieldSet map[string]bool
+
+// todoFields are the fields of a todo that ?fields= can select, by their
+// JSON names.
+var todoFields = jsonFieldNames(reflect.TypeFor[Todo]())
+
+// jsonAPITodoFields are the attributes and relationships of todos in
+// JSON:API documents, which fields[todos]= selects instead.
+var jsonAPITodoFields = newJSONAPITodoFields()
+
+func jsonFieldNames(t reflect.Type) fieldSet {
+	names := fieldSet{}
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func newJSONAPITodoFields() fieldSet {
+	fields := fieldSet{"list": true, "parent": true, "assignee": true, "subtasks": true, "comments": true}
+	for name := range todoFields {
+		fields[name] = true
+	}
+	for _, name := range todoRelationships {
+		if name != "subtasks" {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
+
+// parseTodoFields parses ?fields=id,task into the fields of each todo to
+// send, leaving out the others to save bandwidth. As the JSON:API spec has
+// it, JSON:API documents take fields[todos]= instead. Unknown fields are
+// rejected, and no fields at all means every field.
+func parseTodoFields(r *http.Request, jsonAPI bool) (fieldSet, error) {
+	param, allowed := r.URL.Query().Get("fields"), todoFields
+	if jsonAPI {
+		param, allowed = r.URL.Query().Get("fields[todos]"), jsonAPITodoFields
+	}
+	if param == "" {
+		return nil, nil
+	}
+
+	fields := fieldSet{}
+	for _, name := range strings.Split(param, ",") {
+		if !allowed[name] {
+			return nil, fmt.Errorf("Invalid field %q", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// selectTodoFields returns todos with only the selected fields, and their
+// expanded subtasks the same way when those are selected.
+func selectTodoFields(todos []Todo, fields fieldSet) ([]map[string]any, error) {
+	selected := make([]map[string]any, len(todos))
+	for i, todo := range todos {
+		values, err := todoFieldValues(todo)
+		if err != nil {
+			return nil, err
+		}
+		selected[i] = map[string]any{}
+		for name := range fields {
+			if value, ok := values[name]; ok {
+				selected[i][name] = value
+			}
+		}
+		if fields["subtasks"] && todo.Subtasks != nil {
+			if selected[i]["subtasks"], err = selectTodoFields(todo.Subtasks, fields); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return selected, nil
+}
+
+// todoFieldValues returns the fields of a todo as they are encoded, by
+// their JSON names.
+func todoFieldValues(todo Todo) (map[string]any, error) {
+	encoded, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	err = decoder.Decode(&values)
+	return values, err
+}
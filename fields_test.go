@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestSparseFieldsets(t *testing.T) {
+	clearTodos(t)
+	parent := seedTodo(t, "Parent", false)
+	sub := seedTodo(t, "Child", true)
+	if _, err := db.Exec("UPDATE todos SET parent_id = ? WHERE id = ?", parent, sub); err != nil {
+		t.Fatalf("Failed to nest todo: %v", err)
+	}
+	router := setupRouter()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	rr := get("/v1/todos?fields=id,task&sort=id")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var todos []map[string]any
+	json.Unmarshal(rr.Body.Bytes(), &todos)
+	if len(todos) != 2 || len(todos[0]) != 2 || todos[0]["id"] != float64(parent) || todos[0]["task"] != "Parent" {
+		t.Errorf("Expected only ids and tasks, got %s", rr.Body.String())
+	}
+
+	rr = get("/v1/todos/" + strconv.Itoa(parent) + "?fields=done,subtasks&expand=subtasks")
+	var todo map[string]any
+	json.Unmarshal(rr.Body.Bytes(), &todo)
+	subtasks, _ := todo["subtasks"].([]any)
+	if len(todo) != 2 || todo["done"] != false || len(subtasks) != 1 {
+		t.Fatalf("Expected done and subtasks, got %s", rr.Body.String())
+	}
+	if subtask := subtasks[0].(map[string]any); len(subtask) != 1 || subtask["done"] != true {
+		t.Errorf("Expected the subtask with the same fields, got %v", subtask)
+	}
+
+	rr = get("/v1/todos/" + strconv.Itoa(parent) + "?format=jsonapi&fields[todos]=task,parent")
+	var doc struct {
+		Data jsonAPIResource `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &doc)
+	if len(doc.Data.Attributes) != 1 || doc.Data.Attributes["task"] != "Parent" || len(doc.Data.Relationships) != 1 {
+		t.Errorf("Expected the task attribute and parent relationship only, got %s", rr.Body.String())
+	}
+
+	for _, path := range []string{
+		"/v1/todos?fields=id,owner",
+		"/v1/todos?fields=id,",
+		"/v1/todos?format=jsonapi&fields[todos]=list_id",
+		"/v1/todos/" + strconv.Itoa(parent) + "?fields=secret",
+	} {
+		if rr = get(path); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultFocusSize = 3
+	maxFocusSize     = 10
+)
+
+// FocusHandler returns the top ?n= undone todos, the short list to work on
+// next: highest priority first, then the earliest due, then the oldest.
+// Todos blocked on undone subtasks are left out. n is clamped to between 1
+// and maxFocusSize.
+func FocusHandler(w http.ResponseWriter, r *http.Request) {
+	n := defaultFocusSize
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil {
+			writeError(w, r, "Invalid n! n must be an integer", http.StatusBadRequest)
+			return
+		}
+		n = max(1, min(n, maxFocusSize))
+	}
+
+	scope, args := principalFrom(r.Context()).todoScope("")
+	todos, err := queryTodos(r.Context(), db,
+		`SELECT `+todoColumns+` FROM todos
+WHERE `+scope+` AND done = FALSE
+    AND NOT EXISTS (SELECT 1 FROM todos s WHERE s.parent_id = todos.id AND s.done = FALSE)
+ORDER BY `+dbDialect.sortExpression("priority")+` DESC, due_date IS NULL, due_date, id
+LIMIT ?`,
+		append(args, n)...,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying focus todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if todos == nil {
+		todos = []Todo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(todos)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding JSON", "error", err)
+		return
+	}
+}
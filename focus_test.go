@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFocusHandler(t *testing.T) {
+	clearTodos(t)
+	seedTodo(t, "finished task", true)
+	first := seedTodo(t, "first task", false)
+	second := seedTodo(t, "second task", false)
+	seedTodo(t, "third task", false)
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/focus?n=2", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 2 {
+		t.Fatalf("Expected 2 todos, got %d", len(todos))
+	}
+	if todos[0].ID != first || todos[1].ID != second {
+		t.Errorf("Expected todos %d and %d, got %+v", first, second, todos)
+	}
+
+	for i := 0; i < maxFocusSize; i++ {
+		seedTodo(t, "more work", false)
+	}
+
+	req = httptest.NewRequest("GET", "/todos/focus?n=500", nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != maxFocusSize {
+		t.Errorf("Expected n to be clamped to %d, got %d todos", maxFocusSize, len(todos))
+	}
+}
+
+func TestFocusHandlerOrdersByPriority(t *testing.T) {
+	clearTodos(t)
+	low := seedTodo(t, "low task", false)
+	medium := seedTodo(t, "medium task", false)
+	urgent := seedTodo(t, "urgent task", false)
+	for id, priority := range map[int]string{low: "low", urgent: "urgent"} {
+		if _, err := db.Exec("UPDATE todos SET priority = ? WHERE id = ?", priority, id); err != nil {
+			t.Fatalf("Failed to set priority: %v", err)
+		}
+	}
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/focus", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 3 || todos[0].ID != urgent || todos[1].ID != medium || todos[2].ID != low {
+		t.Errorf("Expected todos in priority order %d, %d, %d, got %+v", urgent, medium, low, todos)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultForecastWindow = 14
+	maxForecastWindow     = 365
+)
+
+type forecast struct {
+	Pending             int     `json:"pending"`
+	CompletedInWindow   int     `json:"completed_in_window"`
+	WindowDays          int     `json:"window_days"`
+	VelocityPerDay      float64 `json:"velocity_per_day"`
+	EstimatedCompletion string  `json:"estimated_completion"`
+}
+
+// ForecastHandler estimates when the pending todos will be cleared, based on
+// how many todos were completed per day over a trailing window
+// (?window=<days>, default 14).
+func ForecastHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	window := defaultForecastWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		var err error
+		window, err = strconv.Atoi(v)
+		if err != nil || window < 1 || window > maxForecastWindow {
+			writeError(w, r, "Invalid window! window must be between 1 and 365 days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	scope, args := principalFrom(ctx).todoScope("")
+	result := forecast{WindowDays: window}
+
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM todos WHERE "+scope+" AND done = FALSE", args...).Scan(&result.Pending)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting pending todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	since := now.AddDate(0, 0, -window)
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM todos WHERE "+scope+" AND completed_at >= ?", append(args, since)...).Scan(&result.CompletedInWindow)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting completed todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result.VelocityPerDay = float64(result.CompletedInWindow) / float64(window)
+
+	switch {
+	case result.Pending == 0:
+		result.EstimatedCompletion = now.Format(time.DateOnly)
+	case result.VelocityPerDay == 0:
+		result.EstimatedCompletion = "unknown"
+	default:
+		days := int(math.Ceil(float64(result.Pending) / result.VelocityPerDay))
+		result.EstimatedCompletion = now.AddDate(0, 0, days).Format(time.DateOnly)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		return
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestForecastHandler(t *testing.T) {
+	clearTodos(t)
+
+	// 7 todos completed over the last two weeks gives half a todo per day
+	now := time.Now().UTC()
+	for i := 0; i < 7; i++ {
+		_, err := db.Exec("INSERT INTO todos (task, done, completed_at) VALUES (?, TRUE, ?)",
+			"finished task", now.AddDate(0, 0, -2*i).Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to seed completed todo: %v", err)
+		}
+	}
+	// Completed too long ago to count towards the velocity
+	_, err := db.Exec("INSERT INTO todos (task, done, completed_at) VALUES (?, TRUE, ?)",
+		"ancient task", now.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("Failed to seed completed todo: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		seedTodo(t, "pending task", false)
+	}
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/forecast", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", status, rr.Body.String())
+	}
+
+	var got forecast
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if got.Pending != 3 {
+		t.Errorf("Expected 3 pending, got %d", got.Pending)
+	}
+	if got.CompletedInWindow != 7 {
+		t.Errorf("Expected 7 completed in window, got %d", got.CompletedInWindow)
+	}
+	if got.VelocityPerDay != 0.5 {
+		t.Errorf("Expected velocity 0.5, got %v", got.VelocityPerDay)
+	}
+	if want := now.AddDate(0, 0, 6).Format(time.DateOnly); got.EstimatedCompletion != want {
+		t.Errorf("Expected estimated completion %s, got %s", want, got.EstimatedCompletion)
+	}
+}
+
+func TestForecastHandlerZeroVelocity(t *testing.T) {
+	clearTodos(t)
+	seedTodo(t, "pending task", false)
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/forecast", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	var got forecast
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if got.EstimatedCompletion != "unknown" {
+		t.Errorf("Expected unknown estimate, got %s", got.EstimatedCompletion)
+	}
+}
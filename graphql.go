@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var graphqlSDL string
+
+// graphqlMaxDepth bounds how deeply a query may nest, since todos refer to
+// their parent and subtasks and lists back to their todos.
+const graphqlMaxDepth = 10
+
+var graphqlSchema = graphql.MustParseSchema(graphqlSDL, &graphqlResolver{},
+	graphql.UseStringDescriptions(),
+	graphql.MaxDepth(graphqlMaxDepth),
+)
+
+// graphqlRequest is the body of a POST to /graphql.
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+
+	// Extensions are sent by some clients, such as for persisted
+	// queries, and ignored.
+	Extensions map[string]any `json:"extensions"`
+}
+
+// GraphQLHandler runs a query or mutation of schema.graphql. Like any
+// GraphQL server it answers 200 with the errors in the body, each with the
+// code the REST API would use in extensions.
+func GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	resp := graphqlSchema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// graphqlError is an error a resolver reports to the client, carrying the
+// same code and field errors as the REST API's error body.
+type graphqlError struct {
+	code    string
+	message string
+	fields  validationErrors
+}
+
+func (e *graphqlError) Error() string { return e.message }
+
+func (e *graphqlError) Extensions() map[string]any {
+	ext := map[string]any{"code": e.code}
+	if e.fields != nil {
+		ext["errors"] = e.fields
+	}
+	return ext
+}
+
+func badRequest(msg string) error {
+	return &graphqlError{code: statusCode(http.StatusBadRequest), message: msg}
+}
+
+// resolverError turns an error of the repository into one for the client,
+// logging those the client shouldn't see.
+func resolverError(ctx context.Context, msg string, err error) error {
+	var errs validationErrors
+	switch {
+	case errors.As(err, &errs):
+		return validationError(errs)
+	case errors.Is(err, errTodoNotFound):
+		return &graphqlError{code: codeTodoNotFound, message: "Todo not found"}
+	case errors.Is(err, errListNotFound):
+		return &graphqlError{code: codeListNotFound, message: "List not found"}
+	}
+	slog.ErrorContext(ctx, msg, "error", err)
+	return &graphqlError{code: statusCode(http.StatusInternalServerError), message: "Internal server error"}
+}
+
+func validationError(errs validationErrors) error {
+	return &graphqlError{code: codeValidationFailed, message: "Invalid fields", fields: errs}
+}
+
+// graphqlWritable rejects mutations the way roleMiddleware and
+// readOnlyMiddleware reject writes, which /graphql skips since queries are
+// POSTed too.
+func graphqlWritable(ctx context.Context) error {
+	if principalFrom(ctx).role == viewerRole {
+		return &graphqlError{code: codeReadOnlyRole, message: "Viewers have read-only access"}
+	}
+	if readOnly.Load() {
+		return &graphqlError{code: codeReadOnlyMode, message: "Service is read-only for maintenance, try again later"}
+	}
+	return nil
+}
+
+// graphqlSQL rejects the fields that need a SQL database, like requireSQL.
+func graphqlSQL() error {
+	if db == nil {
+		return &graphqlError{code: statusCode(http.StatusNotImplemented), message: "Not supported with DB_DRIVER=memory"}
+	}
+	return nil
+}
+
+func parseGraphQLID(id graphql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil {
+		return 0, &graphqlError{code: codeInvalidID, message: "Invalid ID! ID must be an integer"}
+	}
+	return n, nil
+}
+
+func graphqlID(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+// todoFilterInput is the TodoFilter input of schema.graphql.
+type todoFilterInput struct {
+	Tag           *string
+	Done          *bool
+	Search        *string
+	Overdue       *bool
+	Priority      *string
+	ListID        *graphql.ID
+	Archived      *bool
+	DueBefore     *graphql.Time
+	DueAfter      *graphql.Time
+	CreatedBefore *graphql.Time
+	CreatedAfter  *graphql.Time
+	UpdatedBefore *graphql.Time
+	UpdatedAfter  *graphql.Time
+}
+
+// todosArgs are the arguments of the todos fields.
+type todosArgs struct {
+	Filter *todoFilterInput
+	Sort   *string
+	Limit  int32
+	Offset int32
+}
+
+// filter validates args like parseTodoFilter, parseLimit and parseOffset do
+// the query of a list request.
+func (args todosArgs) filter() (TodoFilter, error) {
+	var filter TodoFilter
+	if args.Limit < 1 || args.Limit > maxPageSize {
+		return filter, badRequest("Invalid limit! limit must be between 1 and " + strconv.Itoa(maxPageSize))
+	}
+	if args.Offset < 0 {
+		return filter, badRequest("Invalid offset! offset must not be negative")
+	}
+	filter.Limit = int(args.Limit)
+	filter.Offset = int(args.Offset)
+
+	var err error
+	if args.Sort != nil {
+		if filter.Sort, err = parseSortFields(*args.Sort); err != nil {
+			return filter, badRequest(err.Error())
+		}
+	}
+
+	archived := false
+	filter.Archived = &archived
+	in := args.Filter
+	if in == nil {
+		return filter, nil
+	}
+	if in.Archived != nil {
+		filter.Archived = in.Archived
+	}
+	filter.Done = in.Done
+	filter.Overdue = in.Overdue
+	if in.Tag != nil {
+		filter.Tag = *in.Tag
+	}
+	if in.Search != nil {
+		filter.Search = *in.Search
+	}
+	if in.Priority != nil {
+		filter.Priority = strings.ToLower(*in.Priority)
+	}
+	if in.ListID != nil {
+		id, err := parseGraphQLID(*in.ListID)
+		if err != nil {
+			return filter, err
+		}
+		filter.ListID = &id
+	}
+	bounds := []struct {
+		value  *graphql.Time
+		column string
+		before bool
+	}{
+		{in.DueBefore, "due_date", true},
+		{in.DueAfter, "due_date", false},
+		{in.CreatedBefore, "created_at", true},
+		{in.CreatedAfter, "created_at", false},
+		{in.UpdatedBefore, "updated_at", true},
+		{in.UpdatedAfter, "updated_at", false},
+	}
+	for _, bound := range bounds {
+		if bound.value != nil {
+			filter.Bounds = append(filter.Bounds, timeBound{column: bound.column, before: bound.before, at: bound.value.Time})
+		}
+	}
+	return filter, nil
+}
+
+// resolveTodos resolves a todos field, limited to the list listID when it
+// isn't nil.
+func resolveTodos(ctx context.Context, args todosArgs, listID *int) (*todoPageResolver, error) {
+	filter, err := args.filter()
+	if err != nil {
+		return nil, err
+	}
+	if listID != nil {
+		filter.ListID = listID
+	}
+	todos, total, err := todoRepo.List(ctx, principalFrom(ctx), filter)
+	if err != nil {
+		return nil, resolverError(ctx, "Error querying todos", err)
+	}
+	return &todoPageResolver{todos: todos, total: total}, nil
+}
+
+// todoInput is the TodoInput of schema.graphql.
+type todoInput struct {
+	Task        string
+	Description *string
+	Done        bool
+	DueDate     *graphql.Time
+	RemindAt    *graphql.Time
+	Priority    *string
+	Tags        *[]string
+	ListID      *graphql.ID
+	ParentID    *graphql.ID
+}
+
+func (in todoInput) todo() (Todo, error) {
+	todo := Todo{Task: in.Task, Done: in.Done}
+	if in.Description != nil {
+		todo.Description = *in.Description
+	}
+	if in.DueDate != nil {
+		todo.DueDate = &in.DueDate.Time
+	}
+	if in.RemindAt != nil {
+		todo.RemindAt = &in.RemindAt.Time
+	}
+	if in.Priority != nil {
+		todo.Priority = strings.ToLower(*in.Priority)
+	}
+	if in.Tags != nil {
+		todo.Tags = *in.Tags
+	}
+	var err error
+	if todo.ListID, err = parseOptionalID(in.ListID); err != nil {
+		return todo, err
+	}
+	todo.ParentID, err = parseOptionalID(in.ParentID)
+	return todo, err
+}
+
+func parseOptionalID(id *graphql.ID) (*int, error) {
+	if id == nil {
+		return nil, nil
+	}
+	n, err := parseGraphQLID(*id)
+	return &n, err
+}
+
+// todoPatchInput is the TodoPatch of schema.graphql. Nullable fields use
+// the Null types to tell an explicit null, which clears the field, from a
+// missing one.
+type todoPatchInput struct {
+	Task        *string
+	Description *string
+	Done        *bool
+	DueDate     graphql.NullTime
+	RemindAt    graphql.NullTime
+	Priority    *string
+	Tags        *[]string
+	ListID      graphql.NullID
+	ParentID    graphql.NullID
+}
+
+// patch converts the input to the todoPatch of a PATCH request.
+func (in todoPatchInput) patch() (todoPatch, error) {
+	p := todoPatch{Task: in.Task, Description: in.Description, Done: in.Done, Tags: in.Tags}
+	if in.Priority != nil {
+		priority := strings.ToLower(*in.Priority)
+		p.Priority = &priority
+	}
+	var err error
+	if p.DueDate, err = nullTimeJSON(in.DueDate); err != nil {
+		return p, err
+	}
+	if p.RemindAt, err = nullTimeJSON(in.RemindAt); err != nil {
+		return p, err
+	}
+	if p.ListID, err = nullIDJSON(in.ListID); err != nil {
+		return p, err
+	}
+	p.ParentID, err = nullIDJSON(in.ParentID)
+	return p, err
+}
+
+// nullTimeJSON is the raw todoPatch field for t, nil when it wasn't set.
+func nullTimeJSON(t graphql.NullTime) (json.RawMessage, error) {
+	if !t.Set {
+		return nil, nil
+	}
+	var v *time.Time
+	if t.Value != nil {
+		v = &t.Value.Time
+	}
+	return json.Marshal(v)
+}
+
+// nullIDJSON is the raw todoPatch field for id, nil when it wasn't set.
+func nullIDJSON(id graphql.NullID) (json.RawMessage, error) {
+	if !id.Set {
+		return nil, nil
+	}
+	n, err := parseOptionalID(id.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(n)
+}
+
+// graphqlResolver resolves the Query and Mutation types.
+type graphqlResolver struct{}
+
+func (*graphqlResolver) Todos(ctx context.Context, args todosArgs) (*todoPageResolver, error) {
+	return resolveTodos(ctx, args, nil)
+}
+
+func (*graphqlResolver) Todo(ctx context.Context, args struct{ ID graphql.ID }) (*todoResolver, error) {
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	todo, err := todoRepo.Get(ctx, principalFrom(ctx), id)
+	if errors.Is(err, errTodoNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, resolverError(ctx, "Error querying todo", err)
+	}
+	return &todoResolver{todo}, nil
+}
+
+func (*graphqlResolver) Lists(ctx context.Context) ([]*listResolver, error) {
+	if err := graphqlSQL(); err != nil {
+		return nil, err
+	}
+	lists, err := queryLists(ctx, principalFrom(ctx))
+	if err != nil {
+		return nil, resolverError(ctx, "Error querying lists", err)
+	}
+	resolvers := make([]*listResolver, len(lists))
+	for i, list := range lists {
+		resolvers[i] = &listResolver{list}
+	}
+	return resolvers, nil
+}
+
+func (*graphqlResolver) List(ctx context.Context, args struct{ ID graphql.ID }) (*listResolver, error) {
+	if err := graphqlSQL(); err != nil {
+		return nil, err
+	}
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return lookUpList(ctx, id)
+}
+
+func (*graphqlResolver) Tags(ctx context.Context) ([]*tagResolver, error) {
+	if err := graphqlSQL(); err != nil {
+		return nil, err
+	}
+	tags, err := queryTagCounts(ctx, principalFrom(ctx))
+	if err != nil {
+		return nil, resolverError(ctx, "Error querying tags", err)
+	}
+	resolvers := make([]*tagResolver, len(tags))
+	for i, tag := range tags {
+		resolvers[i] = &tagResolver{tag}
+	}
+	return resolvers, nil
+}
+
+func (*graphqlResolver) CreateTodo(ctx context.Context, args struct{ Input todoInput }) (*todoResolver, error) {
+	if err := graphqlWritable(ctx); err != nil {
+		return nil, err
+	}
+	todo, err := args.Input.todo()
+	if err != nil {
+		return nil, err
+	}
+	errs := validateTodo(&todo)
+	if errs = append(errs, checkDueDate(todo, nil)...); errs != nil {
+		return nil, validationError(errs)
+	}
+
+	todo, err = todoRepo.Create(ctx, principalFrom(ctx), todo)
+	if err != nil {
+		return nil, resolverError(ctx, "Error creating todo", err)
+	}
+	slog.InfoContext(ctx, "Created todo", "ID", todo.ID, "Data", todo)
+	return &todoResolver{todo}, nil
+}
+
+func (*graphqlResolver) UpdateTodo(ctx context.Context, args struct {
+	ID      graphql.ID
+	Input   todoPatchInput
+	Cascade bool
+}) (*todoResolver, error) {
+	if err := graphqlWritable(ctx); err != nil {
+		return nil, err
+	}
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := args.Input.patch()
+	if err != nil {
+		return nil, err
+	}
+
+	todo, _, err := todoRepo.Update(ctx, principalFrom(ctx), id, func(todo *Todo) error {
+		before := todo.DueDate
+		if err := patch.apply(todo); err != nil {
+			return err
+		}
+		errs := validateTodo(todo)
+		if errs = append(errs, checkDueDate(*todo, before)...); errs != nil {
+			return errs
+		}
+		return nil
+	}, UpdateOptions{Cascade: args.Cascade})
+	if err != nil {
+		return nil, resolverError(ctx, "Error updating todo", err)
+	}
+	slog.InfoContext(ctx, "Patched todo", "ID", id, "Data", todo)
+	return &todoResolver{todo}, nil
+}
+
+func (*graphqlResolver) DeleteTodo(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	if err := graphqlWritable(ctx); err != nil {
+		return "", err
+	}
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return "", err
+	}
+	if err = todoRepo.Delete(ctx, principalFrom(ctx), id); err != nil {
+		return "", resolverError(ctx, "Error deleting todo", err)
+	}
+	slog.InfoContext(ctx, "Deleted todo", "ID", id)
+	return args.ID, nil
+}
+
+// lookUpList resolves the caller's list id, or nil when it doesn't exist or
+// isn't visible to the caller.
+func lookUpList(ctx context.Context, id int) (*listResolver, error) {
+	list, err := findList(ctx, db, principalFrom(ctx), id)
+	if errors.Is(err, errListNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, resolverError(ctx, "Error querying list", err)
+	}
+	return &listResolver{list}, nil
+}
+
+type todoPageResolver struct {
+	todos []Todo
+	total int
+}
+
+func (p *todoPageResolver) Items() []*todoResolver {
+	resolvers := make([]*todoResolver, len(p.todos))
+	for i, todo := range p.todos {
+		resolvers[i] = &todoResolver{todo}
+	}
+	return resolvers
+}
+
+func (p *todoPageResolver) TotalCount() int32 { return int32(p.total) }
+
+type todoResolver struct {
+	todo Todo
+}
+
+func (t *todoResolver) ID() graphql.ID      { return graphqlID(t.todo.ID) }
+func (t *todoResolver) Task() string        { return t.todo.Task }
+func (t *todoResolver) Description() string { return t.todo.Description }
+func (t *todoResolver) Done() bool          { return t.todo.Done }
+
+func (t *todoResolver) DueDate() *graphql.Time {
+	if t.todo.DueDate == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t.todo.DueDate}
+}
+
+func (t *todoResolver) RemindAt() *graphql.Time {
+	if t.todo.RemindAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t.todo.RemindAt}
+}
+
+func (t *todoResolver) Priority() string { return strings.ToUpper(t.todo.Priority) }
+
+func (t *todoResolver) Tags() []string {
+	if t.todo.Tags == nil {
+		return []string{}
+	}
+	return t.todo.Tags
+}
+
+func (t *todoResolver) CreatedAt() graphql.Time { return graphql.Time{Time: t.todo.CreatedAt} }
+func (t *todoResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: t.todo.UpdatedAt} }
+
+func (t *todoResolver) AssigneeID() *graphql.ID {
+	if t.todo.AssigneeID == nil {
+		return nil
+	}
+	id := graphqlID(*t.todo.AssigneeID)
+	return &id
+}
+
+func (t *todoResolver) CommentCount() int32 { return int32(t.todo.CommentCount) }
+
+func (t *todoResolver) Position() int32 { return int32(t.todo.Position) }
+
+func (t *todoResolver) ArchivedAt() *graphql.Time {
+	if t.todo.ArchivedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t.todo.ArchivedAt}
+}
+
+func (t *todoResolver) List(ctx context.Context) (*listResolver, error) {
+	if t.todo.ListID == nil {
+		return nil, nil
+	}
+	if err := graphqlSQL(); err != nil {
+		return nil, err
+	}
+	return lookUpList(ctx, *t.todo.ListID)
+}
+
+func (t *todoResolver) Parent(ctx context.Context) (*todoResolver, error) {
+	if t.todo.ParentID == nil {
+		return nil, nil
+	}
+	return (&graphqlResolver{}).Todo(ctx, struct{ ID graphql.ID }{graphqlID(*t.todo.ParentID)})
+}
+
+func (t *todoResolver) Subtasks(ctx context.Context) ([]*todoResolver, error) {
+	todos, _, err := todoRepo.List(ctx, principalFrom(ctx), TodoFilter{ParentID: &t.todo.ID})
+	if err != nil {
+		return nil, resolverError(ctx, "Error querying subtasks", err)
+	}
+	return (&todoPageResolver{todos: todos}).Items(), nil
+}
+
+type listResolver struct {
+	list List
+}
+
+func (l *listResolver) ID() graphql.ID     { return graphqlID(l.list.ID) }
+func (l *listResolver) Name() string       { return l.list.Name }
+func (l *listResolver) Permission() string { return l.list.Permission }
+
+func (l *listResolver) Todos(ctx context.Context, args todosArgs) (*todoPageResolver, error) {
+	return resolveTodos(ctx, args, &l.list.ID)
+}
+
+type tagResolver struct {
+	tag tagCount
+}
+
+func (t *tagResolver) Name() string { return t.tag.Name }
+func (t *tagResolver) Count() int32 { return int32(t.tag.Count) }
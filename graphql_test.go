@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// execGraphQL runs query with variables, as the holder of token when it
+// isn't empty.
+func execGraphQL(t *testing.T, router http.Handler, token, query string, variables map[string]any) graphqlResponse {
+	t.Helper()
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp graphqlResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return resp
+}
+
+// errorCode is the code of the response's only error, or "" without one.
+func (resp graphqlResponse) errorCode(t *testing.T) string {
+	t.Helper()
+	switch len(resp.Errors) {
+	case 0:
+		return ""
+	case 1:
+		code, _ := resp.Errors[0].Extensions["code"].(string)
+		return code
+	}
+	t.Fatalf("Expected at most one error, got %v", resp.Errors)
+	return ""
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	router := setupRouter()
+	list := createList(t, router, "Chores")
+
+	const create = `mutation($input: TodoInput!) { createTodo(input: $input) { id task priority tags list { name } } }`
+	resp := execGraphQL(t, router, "", create, map[string]any{"input": map[string]any{
+		"task": " Clean house ", "priority": "HIGH", "tags": []string{"home"}, "listId": strconv.Itoa(list.ID),
+	}})
+	var created struct {
+		CreateTodo struct {
+			ID       string
+			Task     string
+			Priority string
+			Tags     []string
+			List     struct{ Name string }
+		}
+	}
+	if err := json.Unmarshal(resp.Data, &created); err != nil || resp.Errors != nil {
+		t.Fatalf("createTodo failed: %v %v", err, resp.Errors)
+	}
+	parent := created.CreateTodo
+	if parent.Task != "Clean house" || parent.Priority != "HIGH" || len(parent.Tags) != 1 || parent.List.Name != "Chores" {
+		t.Errorf("Expected the normalized todo in Chores, got %+v", parent)
+	}
+	resp = execGraphQL(t, router, "", create, map[string]any{"input": map[string]any{"task": "Vacuum", "parentId": parent.ID}})
+	if resp.Errors != nil {
+		t.Fatalf("createTodo failed: %v", resp.Errors)
+	}
+	seedTodo(t, "Already done", true)
+
+	resp = execGraphQL(t, router, "", `{
+  todos(filter: {done: false}, sort: "-task", limit: 1) { totalCount items { task subtasks { task parent { task } } } }
+  lists { name todos { totalCount } }
+  tags { name count }
+}`, nil)
+	var got struct {
+		Todos struct {
+			TotalCount int
+			Items      []struct {
+				Task     string
+				Subtasks []struct {
+					Task   string
+					Parent struct{ Task string }
+				}
+			}
+		}
+		Lists []struct {
+			Name  string
+			Todos struct{ TotalCount int }
+		}
+		Tags []tagCount
+	}
+	if err := json.Unmarshal(resp.Data, &got); err != nil || resp.Errors != nil {
+		t.Fatalf("Query failed: %v %v", err, resp.Errors)
+	}
+	if got.Todos.TotalCount != 2 || len(got.Todos.Items) != 1 || got.Todos.Items[0].Task != "Vacuum" {
+		t.Errorf("Expected Vacuum on a page of 2 open todos, got %+v", got.Todos)
+	}
+	resp = execGraphQL(t, router, "", `query($id: ID!) { todo(id: $id) { subtasks { task parent { task } } } }`, map[string]any{"id": parent.ID})
+	if !strings.Contains(string(resp.Data), `"subtasks":[{"task":"Vacuum","parent":{"task":"Clean house"}}]`) {
+		t.Errorf("Expected Vacuum below Clean house, got %s", resp.Data)
+	}
+	if len(got.Lists) != 1 || got.Lists[0].Todos.TotalCount != 1 {
+		t.Errorf("Expected Chores with one todo, got %+v", got.Lists)
+	}
+	if len(got.Tags) != 1 || got.Tags[0] != (tagCount{Name: "home", Count: 1}) {
+		t.Errorf("Expected the home tag once, got %+v", got.Tags)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+	id := seedTodo(t, "Write schema", false)
+	vars := map[string]any{"id": strconv.Itoa(id)}
+
+	due := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC).Format(time.RFC3339)
+	resp := execGraphQL(t, router, "", `mutation($id: ID!, $due: Time) { updateTodo(id: $id, input: {done: true, dueDate: $due}) { task done dueDate } }`,
+		map[string]any{"id": strconv.Itoa(id), "due": due})
+	if resp.Errors != nil || !strings.Contains(string(resp.Data), `"task":"Write schema","done":true,"dueDate":"`+due+`"`) {
+		t.Errorf("Expected only done and dueDate changed, got %s %v", resp.Data, resp.Errors)
+	}
+	resp = execGraphQL(t, router, "", `mutation($id: ID!) { updateTodo(id: $id, input: {dueDate: null}) { dueDate } }`, vars)
+	if !strings.Contains(string(resp.Data), `"dueDate":null`) {
+		t.Errorf("Expected null to clear dueDate, got %s", resp.Data)
+	}
+
+	resp = execGraphQL(t, router, "", `mutation($id: ID!) { updateTodo(id: $id, input: {task: " "}) { task } }`, vars)
+	if code := resp.errorCode(t); code != codeValidationFailed {
+		t.Fatalf("Expected %s for a blank task, got %q", codeValidationFailed, code)
+	}
+	if fields, _ := resp.Errors[0].Extensions["errors"].([]any); len(fields) != 1 {
+		t.Errorf("Expected the invalid field listed, got %v", resp.Errors[0].Extensions)
+	}
+
+	resp = execGraphQL(t, router, "", `mutation($id: ID!) { deleteTodo(id: $id) }`, vars)
+	if resp.Errors != nil || !strings.Contains(string(resp.Data), `"deleteTodo":"`+strconv.Itoa(id)+`"`) {
+		t.Fatalf("deleteTodo failed: %s %v", resp.Data, resp.Errors)
+	}
+	resp = execGraphQL(t, router, "", `query($id: ID!) { todo(id: $id) { task } }`, vars)
+	if resp.Errors != nil || string(resp.Data) != `{"todo":null}` {
+		t.Errorf("Expected a null todo after deleting, got %s %v", resp.Data, resp.Errors)
+	}
+	resp = execGraphQL(t, router, "", `mutation($id: ID!) { deleteTodo(id: $id) }`, vars)
+	if code := resp.errorCode(t); code != codeTodoNotFound {
+		t.Errorf("Expected %s deleting twice, got %q", codeTodoNotFound, code)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+
+	tests := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"invalid id", `{ todo(id: "abc") { id } }`, codeInvalidID},
+		{"limit too small", `{ todos(limit: 0) { totalCount } }`, "bad_request"},
+		{"limit too large", `{ todos(limit: 101) { totalCount } }`, "bad_request"},
+		{"unknown sort", `{ todos(sort: "color") { totalCount } }`, "bad_request"},
+		{"unknown list", `mutation { createTodo(input: {task: "Lost", listId: "999999"}) { id } }`, codeValidationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := execGraphQL(t, router, "", tt.query, nil).errorCode(t); code != tt.code {
+				t.Errorf("Expected %s, got %q", tt.code, code)
+			}
+		})
+	}
+
+	resp := execGraphQL(t, router, "", `{ todos { nope } }`, nil)
+	if len(resp.Errors) == 0 || resp.Data != nil {
+		t.Errorf("Expected a query of unknown fields rejected, got %s", resp.Data)
+	}
+
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader("{"))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed body, got %d", rr.Code)
+	}
+}
+
+func TestGraphQLAuthorization(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	editor := seedUser(t, "alice", editorRole)
+	viewer := seedUser(t, "bob", viewerRole)
+	token := func(user User) string {
+		token, _ := issueToken(user, time.Now())
+		return token
+	}
+	const create = `mutation { createTodo(input: {task: "Authorized"}) { id } }`
+
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"{ todos { totalCount } }"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without credentials, got %d", rr.Code)
+	}
+
+	if resp := execGraphQL(t, router, token(editor), create, nil); resp.Errors != nil {
+		t.Fatalf("createTodo failed: %v", resp.Errors)
+	}
+	resp := execGraphQL(t, router, token(viewer), `{ todos { totalCount } }`, nil)
+	if resp.Errors != nil || string(resp.Data) != `{"todos":{"totalCount":0}}` {
+		t.Errorf("Expected viewers to query only their own todos, got %s %v", resp.Data, resp.Errors)
+	}
+	if code := execGraphQL(t, router, token(viewer), create, nil).errorCode(t); code != codeReadOnlyRole {
+		t.Errorf("Expected %s for a viewer, got %q", codeReadOnlyRole, code)
+	}
+
+	readOnly.Store(true)
+	t.Cleanup(func() { readOnly.Store(false) })
+	if code := execGraphQL(t, router, token(editor), create, nil).errorCode(t); code != codeReadOnlyMode {
+		t.Errorf("Expected %s in read-only mode, got %q", codeReadOnlyMode, code)
+	}
+	if resp := execGraphQL(t, router, token(editor), `{ todos { totalCount } }`, nil); resp.Errors != nil {
+		t.Errorf("Expected queries in read-only mode, got %v", resp.Errors)
+	}
+}
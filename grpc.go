@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/eshulman2/todo-api/todopb"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative todopb/todo.proto
+
+// grpcTodoServer serves the todos of todoRepo over gRPC, for internal
+// services that prefer it to the REST API. It follows the REST handlers:
+// the same validation, scoping to the caller and errors, as gRPC statuses.
+type grpcTodoServer struct {
+	todopb.UnimplementedTodoServiceServer
+}
+
+// grpcListPageSize is how many todos ListTodos loads from todoRepo at a
+// time while streaming.
+var grpcListPageSize = 100
+
+// grpcReadMethods are the calls viewers may make and that stay available
+// in read-only mode.
+var grpcReadMethods = map[string]bool{
+	todopb.TodoService_ListTodos_FullMethodName: true,
+	todopb.TodoService_GetTodo_FullMethodName:   true,
+}
+
+// newGRPCServer returns a gRPC server for TodoService, serving TLS with
+// tlsConfig if it isn't nil. Calls are traced, logged and authenticated
+// like REST requests, and the services can be listed with server reflection.
+func newGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(grpcUnaryInterceptor),
+		grpc.ChainStreamInterceptor(grpcStreamInterceptor),
+		grpc.MaxRecvMsgSize(int(maxBodyBytes)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(grpccredentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	todopb.RegisterTodoServiceServer(server, grpcTodoServer{})
+	reflection.Register(server)
+	return server
+}
+
+// runGRPCServer serves server on listener until ctx is done, then lets
+// running calls finish for up to timeout before canceling them.
+func runGRPCServer(ctx context.Context, listener net.Listener, server *grpc.Server, timeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		slog.Warn("gRPC calls still running at shutdown timeout, canceling them")
+		server.Stop()
+	}
+	if err := <-serveErr; err != nil {
+		return err
+	}
+	slog.Info("gRPC server stopped")
+	return nil
+}
+
+func grpcUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	start := time.Now()
+	ctx, err = grpcAuthorize(ctx, info.FullMethod)
+	defer func() { logCall(ctx, info.FullMethod, start, err) }()
+	defer recoverCall(ctx, info.FullMethod, &err)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	ctx, err := grpcAuthorize(stream.Context(), info.FullMethod)
+	defer func() { logCall(ctx, info.FullMethod, start, err) }()
+	defer recoverCall(ctx, info.FullMethod, &err)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+// contextStream replaces the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcAuthorize does for a call what requestIDMiddleware,
+// identityMiddleware, roleMiddleware and readOnlyMiddleware do for a
+// request, reading the headers from the call's metadata. It returns the
+// context to serve the call with.
+func grpcAuthorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	id := header(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+
+	caller := principal{owner: header(ownerHeader), role: editorRole}
+	if jwtSecret != nil {
+		var err error
+		caller, err = authenticateCredentials(ctx, header(apiKeyHeader), header("Authorization"))
+		switch {
+		case errors.Is(err, errMissingCredentials), errors.Is(err, errInvalidToken), errors.Is(err, errInvalidAPIKey):
+			return ctx, status.Error(codes.Unauthenticated, err.Error())
+		case err != nil:
+			slog.ErrorContext(ctx, "Error authenticating call", "error", err)
+			return ctx, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+
+	if !grpcReadMethods[method] {
+		if caller.role == viewerRole {
+			return ctx, status.Error(codes.PermissionDenied, "Viewers have read-only access")
+		}
+		if readOnly.Load() {
+			return ctx, status.Error(codes.Unavailable, "Service is read-only for maintenance, try again later")
+		}
+	}
+	return context.WithValue(ctx, principalKey, caller), nil
+}
+
+// recoverCall turns a panicking call into an Internal status, like
+// recoverMiddleware does for requests.
+func recoverCall(ctx context.Context, method string, err *error) {
+	if p := recover(); p != nil {
+		slog.ErrorContext(ctx, "Panic serving call", "method", method, "error", p, "stack", string(debug.Stack()))
+		*err = status.Error(codes.Internal, "Internal server error")
+	}
+}
+
+// logCall logs one line per call, at error level for server errors, like
+// loggingMiddleware does for requests.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	}
+	slog.LogAttrs(ctx, level, "Call served",
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+	)
+}
+
+// ListTodos streams the matching todos a page at a time, so callers get
+// all of them without paging themselves.
+func (grpcTodoServer) ListTodos(req *todopb.ListTodosRequest, stream grpc.ServerStreamingServer[todopb.Todo]) error {
+	ctx := stream.Context()
+	filter, err := todoFilterFromProto(req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	filter.Limit = grpcListPageSize
+	// Keyset pages are cheaper and don't skip or repeat todos changing
+	// under the stream, but only come in id order.
+	keyset := filter.Sort == nil
+	if keyset {
+		filter.AfterID = new(int)
+	}
+
+	for {
+		todos, _, err := todoRepo.List(ctx, principalFrom(ctx), filter)
+		if err != nil {
+			return grpcError(ctx, "Error querying todos", err)
+		}
+		for _, todo := range todos {
+			if err := stream.Send(todoToProto(todo)); err != nil {
+				return err
+			}
+		}
+		if len(todos) < filter.Limit {
+			return nil
+		}
+		if keyset {
+			filter.AfterID = &todos[len(todos)-1].ID
+		} else {
+			filter.Offset += len(todos)
+		}
+	}
+}
+
+func (grpcTodoServer) GetTodo(ctx context.Context, req *todopb.GetTodoRequest) (*todopb.Todo, error) {
+	todo, err := todoRepo.Get(ctx, principalFrom(ctx), int(req.GetId()))
+	if err != nil {
+		return nil, grpcError(ctx, "Error querying todo", err)
+	}
+	return todoToProto(todo), nil
+}
+
+func (grpcTodoServer) CreateTodo(ctx context.Context, req *todopb.CreateTodoRequest) (*todopb.Todo, error) {
+	if req.GetTodo() == nil {
+		return nil, status.Error(codes.InvalidArgument, "todo is required")
+	}
+	data := todoFromProto(req.GetTodo())
+	errs := validateTodo(&data)
+	if errs = append(errs, checkDueDate(data, nil)...); errs != nil {
+		return nil, validationStatus(errs)
+	}
+
+	todo, err := todoRepo.Create(ctx, principalFrom(ctx), data)
+	if err != nil {
+		return nil, grpcError(ctx, "Error inserting todo", err)
+	}
+	slog.InfoContext(ctx, "Added new task", "ID", todo.ID, "Task", todo.Task, "Done", todo.Done)
+	return todoToProto(todo), nil
+}
+
+func (grpcTodoServer) UpdateTodo(ctx context.Context, req *todopb.UpdateTodoRequest) (*todopb.Todo, error) {
+	if req.GetTodo() == nil {
+		return nil, status.Error(codes.InvalidArgument, "todo is required")
+	}
+	data := todoFromProto(req.GetTodo())
+	if errs := validateTodo(&data); errs != nil {
+		return nil, validationStatus(errs)
+	}
+
+	opts := UpdateOptions{Upsert: putUpsert, Cascade: req.GetCascade()}
+	todo, _, err := todoRepo.Update(ctx, principalFrom(ctx), data.ID, func(todo *Todo) error {
+		if errs := checkDueDate(data, todo.DueDate); errs != nil {
+			return errs
+		}
+		keepStoredFields(&data, *todo)
+		*todo = data
+		return nil
+	}, opts)
+	if err != nil {
+		return nil, grpcError(ctx, "Error updating todo", err)
+	}
+	slog.InfoContext(ctx, "Updated todo", "ID", todo.ID, "Data", todo)
+	return todoToProto(todo), nil
+}
+
+func (grpcTodoServer) DeleteTodo(ctx context.Context, req *todopb.DeleteTodoRequest) (*emptypb.Empty, error) {
+	if err := todoRepo.Delete(ctx, principalFrom(ctx), int(req.GetId())); err != nil {
+		return nil, grpcError(ctx, "Error deleting todo", err)
+	}
+	slog.InfoContext(ctx, "Deleted item from todos", "ID", req.GetId())
+	return &emptypb.Empty{}, nil
+}
+
+// grpcError turns an error of todoRepo into a gRPC status. Unexpected
+// errors are logged with msg and hidden from the caller.
+func grpcError(ctx context.Context, msg string, err error) error {
+	var errs validationErrors
+	switch {
+	case errors.As(err, &errs):
+		return validationStatus(errs)
+	case errors.Is(err, errTodoNotFound):
+		return status.Error(codes.NotFound, "Todo not found")
+	}
+	slog.ErrorContext(ctx, msg, "error", err)
+	return status.Error(codes.Internal, "Internal server error")
+}
+
+// validationStatus is an InvalidArgument status listing the invalid fields
+// as BadRequest details.
+func validationStatus(errs validationErrors) error {
+	st := status.New(codes.InvalidArgument, errs.Error())
+	details := &errdetails.BadRequest{}
+	for _, e := range errs {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: e.Field, Description: e.Message})
+	}
+	if detailed, err := st.WithDetails(details); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// todoFilterFromProto validates the filters of req like parseTodoFilter
+// does the query of a list request.
+func todoFilterFromProto(req *todopb.ListTodosRequest) (TodoFilter, error) {
+	filter := TodoFilter{
+		Tag:     req.GetTag(),
+		Done:    req.Done,
+		Search:  req.GetQuery(),
+		Overdue: req.Overdue,
+	}
+	if req.ListId != nil {
+		id := int(req.GetListId())
+		filter.ListID = &id
+	}
+	if v := req.GetPriority(); v != "" {
+		if !validPriority(v) {
+			return filter, errors.New("Invalid priority! priority must be one of " + strings.Join(priorities, ", "))
+		}
+		filter.Priority = v
+	}
+	var err error
+	filter.Sort, err = parseSortFields(req.GetSort())
+	return filter, err
+}
+
+func todoToProto(todo Todo) *todopb.Todo {
+	msg := &todopb.Todo{
+		Id:        int64(todo.ID),
+		Task:      todo.Task,
+		Done:      todo.Done,
+		Priority:  todo.Priority,
+		Tags:      todo.Tags,
+		CreatedAt: timestamppb.New(todo.CreatedAt),
+		UpdatedAt: timestamppb.New(todo.UpdatedAt),
+	}
+	if todo.DueDate != nil {
+		msg.DueDate = timestamppb.New(*todo.DueDate)
+	}
+	if todo.ListID != nil {
+		id := int64(*todo.ListID)
+		msg.ListId = &id
+	}
+	if todo.ParentID != nil {
+		id := int64(*todo.ParentID)
+		msg.ParentId = &id
+	}
+	return msg
+}
+
+// todoFromProto returns the todo msg describes. Like in request bodies, its
+// timestamps are left to the repository.
+func todoFromProto(msg *todopb.Todo) Todo {
+	todo := Todo{
+		ID:       int(msg.GetId()),
+		Task:     msg.GetTask(),
+		Done:     msg.GetDone(),
+		Priority: msg.GetPriority(),
+		Tags:     msg.GetTags(),
+	}
+	if msg.DueDate != nil {
+		due := msg.GetDueDate().AsTime()
+		todo.DueDate = &due
+	}
+	if msg.ListId != nil {
+		id := int(msg.GetListId())
+		todo.ListID = &id
+	}
+	if msg.ParentId != nil {
+		id := int(msg.GetParentId())
+		todo.ParentID = &id
+	}
+	return todo
+}
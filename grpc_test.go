@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eshulman2/todo-api/todopb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCClient serves TodoService in memory for the rest of the test.
+func newGRPCClient(t *testing.T) todopb.TodoServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(nil)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return todopb.NewTodoServiceClient(conn)
+}
+
+// listAll collects the todos streamed by ListTodos.
+func listAll(t *testing.T, client todopb.TodoServiceClient, req *todopb.ListTodosRequest) []string {
+	t.Helper()
+	stream, err := client.ListTodos(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ListTodos failed: %v", err)
+	}
+	var tasks []string
+	for {
+		todo, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return tasks
+		}
+		if err != nil {
+			t.Fatalf("ListTodos failed: %v", err)
+		}
+		tasks = append(tasks, todo.GetTask())
+	}
+}
+
+func TestGRPCTodoService(t *testing.T) {
+	clearTodos(t)
+	client := newGRPCClient(t)
+	ctx := context.Background()
+
+	created, err := client.CreateTodo(ctx, &todopb.CreateTodoRequest{Todo: &todopb.Todo{Task: " Write proto ", Tags: []string{"work"}}})
+	if err != nil {
+		t.Fatalf("CreateTodo failed: %v", err)
+	}
+	if created.GetId() == 0 || created.GetTask() != "Write proto" || created.GetPriority() != defaultPriority {
+		t.Errorf("Expected a stored, normalized todo, got %v", created)
+	}
+
+	got, err := client.GetTodo(ctx, &todopb.GetTodoRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("GetTodo failed: %v", err)
+	}
+	if !proto.Equal(got, created) {
+		t.Errorf("Expected %v, got %v", created, got)
+	}
+
+	due := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	update := todoToProto(Todo{ID: int(created.GetId()), Task: "Serve proto", Done: true, Priority: "high", DueDate: &due})
+	updated, err := client.UpdateTodo(ctx, &todopb.UpdateTodoRequest{Todo: update})
+	if err != nil {
+		t.Fatalf("UpdateTodo failed: %v", err)
+	}
+	if updated.GetTask() != "Serve proto" || !updated.GetDone() || !updated.GetDueDate().AsTime().Equal(due) || len(updated.GetTags()) != 0 {
+		t.Errorf("Expected the todo replaced, got %v", updated)
+	}
+
+	if _, err := client.DeleteTodo(ctx, &todopb.DeleteTodoRequest{Id: created.GetId()}); err != nil {
+		t.Fatalf("DeleteTodo failed: %v", err)
+	}
+	_, err = client.GetTodo(ctx, &todopb.GetTodoRequest{Id: created.GetId()})
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("Expected NotFound after deleting, got %v", err)
+	}
+}
+
+func TestGRPCListTodosStreamsEveryPage(t *testing.T) {
+	clearTodos(t)
+	saved := grpcListPageSize
+	grpcListPageSize = 2
+	t.Cleanup(func() { grpcListPageSize = saved })
+	for _, task := range []string{"b", "d", "a", "e", "c"} {
+		seedTodo(t, task, false)
+	}
+	seedTodo(t, "done", true)
+	client := newGRPCClient(t)
+
+	tests := []struct {
+		name string
+		req  *todopb.ListTodosRequest
+		want []string
+	}{
+		{"id order", &todopb.ListTodosRequest{}, []string{"b", "d", "a", "e", "c", "done"}},
+		{"sorted", &todopb.ListTodosRequest{Sort: "-task"}, []string{"e", "done", "d", "c", "b", "a"}},
+		{"filtered", &todopb.ListTodosRequest{Done: proto.Bool(false), Sort: "task"}, []string{"a", "b", "c", "d", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := listAll(t, client, tt.req)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+
+	// Errors of a stream arrive with its first message.
+	stream, err := client.ListTodos(context.Background(), &todopb.ListTodosRequest{Sort: "color"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown sort field, got %v", err)
+	}
+}
+
+func TestGRPCValidationErrors(t *testing.T) {
+	clearTodos(t)
+	client := newGRPCClient(t)
+
+	_, err := client.CreateTodo(context.Background(), &todopb.CreateTodoRequest{Todo: &todopb.Todo{Task: " ", Priority: "someday"}})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+	var fields []string
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.GetFieldViolations() {
+				fields = append(fields, violation.GetField())
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "task" || fields[1] != "priority" {
+		t.Errorf("Expected violations of task and priority, got %v", fields)
+	}
+
+	_, err = client.UpdateTodo(context.Background(), &todopb.UpdateTodoRequest{})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without a todo, got %v", err)
+	}
+}
+
+func TestGRPCAuthorization(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	client := newGRPCClient(t)
+	editor := seedUser(t, "alice", editorRole)
+	viewer := seedUser(t, "bob", viewerRole)
+	withToken := func(user User) context.Context {
+		token, _ := issueToken(user, time.Now())
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+	newTodo := &todopb.CreateTodoRequest{Todo: &todopb.Todo{Task: "Authorized"}}
+
+	_, err := client.CreateTodo(context.Background(), newTodo)
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without credentials, got %v", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer not-a-token")
+	if _, err = client.CreateTodo(ctx, newTodo); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated with a bad token, got %v", err)
+	}
+
+	var header metadata.MD
+	created, err := client.CreateTodo(withToken(editor), newTodo, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("CreateTodo failed: %v", err)
+	}
+	if len(header.Get(requestIDHeader)) != 1 {
+		t.Errorf("Expected a request ID in the response header, got %v", header)
+	}
+	if _, err = client.GetTodo(withToken(viewer), &todopb.GetTodoRequest{Id: created.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected other users' todos to be hidden, got %v", err)
+	}
+
+	if _, err = client.CreateTodo(withToken(viewer), newTodo); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for a viewer, got %v", err)
+	}
+	if _, err = client.GetTodo(withToken(editor), &todopb.GetTodoRequest{Id: created.GetId()}); err != nil {
+		t.Errorf("Expected the owner to read their todo, got %v", err)
+	}
+
+	readOnly.Store(true)
+	t.Cleanup(func() { readOnly.Store(false) })
+	if _, err = client.DeleteTodo(withToken(editor), &todopb.DeleteTodoRequest{Id: created.GetId()}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable in read-only mode, got %v", err)
+	}
+	if _, err = client.GetTodo(withToken(editor), &todopb.GetTodoRequest{Id: created.GetId()}); err != nil {
+		t.Errorf("Expected reads in read-only mode, got %v", err)
+	}
+}
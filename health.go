@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds the database ping of /readyz, so a hung database
+// fails the probe instead of blocking it.
+const readyTimeout = 2 * time.Second
+
+// healthStatus is the body of the health endpoints.
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, status int, health healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
+
+// LiveHandler serves /healthz and /livez. It answers as long as the
+// process can serve requests, without looking at dependencies, so a
+// database outage doesn't get the server restarted.
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// ReadyHandler serves /readyz, answering 503 while the database can't be
+// reached so load balancers stop sending traffic.
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	health := healthStatus{Status: "ok", Checks: map[string]string{}}
+	if db == nil {
+		health.Checks["database"] = "memory"
+		writeHealth(w, http.StatusOK, health)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		slog.WarnContext(ctx, "Readiness check failed", "error", err)
+		health.Status, health.Checks["database"] = "unavailable", "unreachable"
+		writeHealth(w, http.StatusServiceUnavailable, health)
+		return
+	}
+	health.Checks["database"] = "ok"
+	writeHealth(w, http.StatusOK, health)
+}
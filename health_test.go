@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	enableJWTAuth(t)
+	router := setupRouter()
+
+	for _, path := range []string{"/healthz", "/livez", "/readyz"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("Expected status 200 for %s without credentials, got %d", path, status)
+		}
+		var health healthStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil || health.Status != "ok" {
+			t.Errorf("Expected an ok status for %s, got %s", path, rr.Body.String())
+		}
+	}
+}
+
+func TestReadyzFailsWithoutDatabase(t *testing.T) {
+	closed, err := sql.Open("mysql", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	closed.Close()
+	saved := db
+	db = closed
+	t.Cleanup(func() { db = saved })
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", status)
+	}
+	var health healthStatus
+	json.Unmarshal(rr.Body.Bytes(), &health)
+	if health.Status != "unavailable" || health.Checks["database"] != "unreachable" {
+		t.Errorf("Expected the database check to fail, got %+v", health)
+	}
+
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected /healthz to stay up without the database, got %d", status)
+	}
+}
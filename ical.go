@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const icsContentType = "text/calendar; charset=utf-8"
+
+// icsRoute names the iCalendar feed route, whose clients are asked for
+// HTTP Basic credentials since calendar apps can't send a bearer token.
+const icsRoute = "ics"
+
+// icsTimeLayout is the UTC DATE-TIME form of RFC 5545.
+const icsTimeLayout = "20060102T150405Z"
+
+// icsPriorities maps our priorities onto RFC 5545's, where 1 is the highest
+// and 9 the lowest.
+var icsPriorities = map[string]int{"urgent": 1, "high": 3, "medium": 5, "low": 9}
+
+// icsEscaper escapes TEXT values.
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// ICalendarHandler serves the todos with a due date matching the list
+// filters as an iCalendar feed of VTODOs, for calendar and reminder apps
+// to subscribe to. Done todos are included as completed.
+func ICalendarHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTodoFilter(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	where, args := todoConditions(principalFrom(r.Context()), filter)
+
+	// The rows are streamed to the client, which may read them slowly.
+	rows, err := db.QueryContext(withoutQueryTimeout(r.Context()), `
+SELECT `+todoColumns+`, completed_at,
+    COALESCE((SELECT `+dbDialect.groupConcat("t.name", csvTagSeparator)+`
+              FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id
+              WHERE tt.todo_id = todos.id), '')
+FROM todos
+WHERE `+where+` AND due_date IS NOT NULL
+ORDER BY `+orderBy(filter.Sort), args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", icsContentType)
+	w.Header().Set("Content-Disposition", "inline; filename=todos.ics")
+
+	out := bufio.NewWriter(w)
+	writeICSLine(out, "BEGIN:VCALENDAR")
+	writeICSLine(out, "VERSION:2.0")
+	writeICSLine(out, "PRODID:-//todo-api//todos//EN")
+	writeICSLine(out, "CALSCALE:GREGORIAN")
+	writeICSLine(out, "X-WR-CALNAME:Todos")
+
+	for rows.Next() {
+		var completedAt sql.NullTime
+		var tags string
+		todo, err := scanTodo(rows, &completedAt, &tags)
+		if err != nil {
+			// Headers are gone already, all we can do is cut the feed short.
+			slog.ErrorContext(r.Context(), "Error scanning todo", "error", err)
+			break
+		}
+		writeVTODO(out, todo, completedAt, tags)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "Error iterating todos", "error", err)
+	}
+
+	writeICSLine(out, "END:VCALENDAR")
+	if err = out.Flush(); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing iCalendar feed", "error", err)
+	}
+}
+
+// writeVTODO writes todo as a VTODO. Its UID stays the same across fetches
+// so subscribers update their copy instead of adding another.
+func writeVTODO(out *bufio.Writer, todo Todo, completedAt sql.NullTime, tags string) {
+	writeICSLine(out, "BEGIN:VTODO")
+	writeICSLine(out, "UID:"+icsUID(todo.ID))
+	writeICSLine(out, "DTSTAMP:"+icsTime(todo.UpdatedAt))
+	writeICSLine(out, "CREATED:"+icsTime(todo.CreatedAt))
+	writeICSLine(out, "LAST-MODIFIED:"+icsTime(todo.UpdatedAt))
+	writeICSLine(out, "SUMMARY:"+icsEscaper.Replace(todo.Task))
+	if todo.Description != "" {
+		writeICSLine(out, "DESCRIPTION:"+icsEscaper.Replace(todo.Description))
+	}
+	writeICSLine(out, "DUE:"+icsTime(*todo.DueDate))
+	if p, ok := icsPriorities[todo.Priority]; ok {
+		writeICSLine(out, "PRIORITY:"+strconv.Itoa(p))
+	}
+	if todo.Done {
+		writeICSLine(out, "STATUS:COMPLETED")
+		writeICSLine(out, "PERCENT-COMPLETE:100")
+		if completedAt.Valid {
+			writeICSLine(out, "COMPLETED:"+icsTime(completedAt.Time))
+		}
+	} else {
+		writeICSLine(out, "STATUS:NEEDS-ACTION")
+	}
+	if tags != "" {
+		categories := strings.Split(tags, csvTagSeparator)
+		for i, tag := range categories {
+			categories[i] = icsEscaper.Replace(tag)
+		}
+		writeICSLine(out, "CATEGORIES:"+strings.Join(categories, ","))
+	}
+	if todo.ParentID != nil {
+		writeICSLine(out, "RELATED-TO:"+icsUID(*todo.ParentID))
+	}
+	writeICSLine(out, "END:VTODO")
+}
+
+func icsUID(id int) string {
+	return "todo-" + strconv.Itoa(id) + "@todo-api"
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format(icsTimeLayout)
+}
+
+// writeICSLine writes a content line ending in CRLF, folded so no line is
+// longer than the 75 octets RFC 5545 allows. Folds never split a UTF-8
+// sequence.
+func writeICSLine(out *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		out.WriteString(line[:cut])
+		out.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the space.
+		limit = 74
+	}
+	out.WriteString(line)
+	out.WriteString("\r\n")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICalendarHandler(t *testing.T) {
+	clearTodos(t)
+	due := time.Date(2030, time.January, 2, 15, 4, 5, 0, time.UTC)
+	open := seedTodo(t, "Renew passport; bring photos, forms", false)
+	done := seedTodo(t, "Filed taxes", true)
+	seedTodo(t, "Someday", false)
+	long := seedTodo(t, strings.Repeat("é", 60), false)
+	for _, id := range []int{open, done, long} {
+		if _, err := db.Exec("UPDATE todos SET due_date = ?, priority = 'high', completed_at = CASE WHEN done THEN ? END WHERE id = ?", due, due, id); err != nil {
+			t.Fatalf("Failed to set due date: %v", err)
+		}
+	}
+	if err := setTodoTags(context.Background(), db, open, []string{"errands", "travel"}); err != nil {
+		t.Fatalf("Failed to tag todo: %v", err)
+	}
+
+	router := setupRouter()
+	req := httptest.NewRequest("GET", "/todos.ics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != icsContentType {
+		t.Errorf("Expected Content-Type %s, got %q", icsContentType, ct)
+	}
+
+	body := rr.Body.String()
+	lines := strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n")
+	if lines[0] != "BEGIN:VCALENDAR" || lines[len(lines)-1] != "END:VCALENDAR" {
+		t.Fatalf("Expected a VCALENDAR, got %q", body)
+	}
+	for _, line := range lines {
+		if len(line) > 75 {
+			t.Errorf("Expected lines of at most 75 octets, got %q", line)
+		}
+	}
+	if n := strings.Count(body, "BEGIN:VTODO"); n != 3 {
+		t.Errorf("Expected the 3 todos with a due date, got %d", n)
+	}
+	for _, want := range []string{
+		"UID:" + icsUID(open),
+		`SUMMARY:Renew passport\; bring photos\, forms`,
+		"DUE:20300102T150405Z",
+		"PRIORITY:3",
+		"STATUS:NEEDS-ACTION",
+		"CATEGORIES:errands,travel",
+		"STATUS:COMPLETED\r\nPERCENT-COMPLETE:100\r\nCOMPLETED:20300102T150405Z",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the feed to contain %q", want)
+		}
+	}
+	if unfolded := strings.ReplaceAll(body, "\r\n ", ""); !strings.Contains(unfolded, "SUMMARY:"+strings.Repeat("é", 60)+"\r\n") {
+		t.Errorf("Expected the long summary to unfold intact")
+	}
+	if strings.Contains(body, "Someday") {
+		t.Errorf("Expected todos without a due date left out")
+	}
+}
+
+func TestICalendarAsksForBasicAuth(t *testing.T) {
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos.ics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, got %d", rr.Code)
+	}
+	challenges := rr.Header().Values("WWW-Authenticate")
+	if len(challenges) != 2 || !strings.HasPrefix(challenges[1], "Basic ") {
+		t.Errorf("Expected a Basic challenge besides Bearer, got %v", challenges)
+	}
+
+	req = httptest.NewRequest("GET", "/todos.ics", nil)
+	req.SetBasicAuth("alice", "her-password")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected passwords other than API keys rejected, got %d", rr.Code)
+	}
+}
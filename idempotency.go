@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+
+	// idempotencyWindow is how long a key is remembered. A key reused after
+	// the window creates a new todo.
+	idempotencyWindow = 24 * time.Hour
+
+	maxIdempotencyKeyLength = 255
+)
+
+// errIdempotencyConflict is returned when a key is reused with a different
+// request body.
+var errIdempotencyConflict = errors.New("idempotency key was already used for a different request")
+
+// idempotentResponse is the stored outcome of a create request.
+type idempotentResponse struct {
+	todoID int
+	body   []byte
+}
+
+// requestHash fingerprints a create request so a reused key can be told
+// apart from a retry.
+func requestHash(todo Todo) string {
+	payload, _ := json.Marshal(todo)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// findIdempotentResponse returns the response saved for owner's key within
+// the idempotency window, or nil when the key hasn't been used yet.
+func findIdempotentResponse(ctx context.Context, owner, key, hash string) (*idempotentResponse, error) {
+	var savedHash string
+	var saved idempotentResponse
+	err := db.QueryRowContext(ctx,
+		"SELECT request_hash, todo_id, response_body FROM idempotency_keys WHERE owner = ? AND idempotency_key = ? AND created_at >= ?",
+		owner, key, time.Now().Add(-idempotencyWindow),
+	).Scan(&savedHash, &saved.todoID, &saved.body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if savedHash != hash {
+		return nil, errIdempotencyConflict
+	}
+	return &saved, nil
+}
+
+// saveIdempotentResponse remembers the response to owner's key, replacing
+// an expired entry for the same key.
+func saveIdempotentResponse(ctx context.Context, q dbtx, owner, key, hash string, saved idempotentResponse) error {
+	_, err := q.ExecContext(ctx,
+		"DELETE FROM idempotency_keys WHERE owner = ? AND idempotency_key = ? AND created_at < ?",
+		owner, key, time.Now().Add(-idempotencyWindow),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx,
+		"INSERT INTO idempotency_keys (owner, idempotency_key, request_hash, todo_id, response_body) VALUES (?, ?, ?, ?, ?)",
+		owner, key, hash, saved.todoID, saved.body,
+	)
+	return err
+}
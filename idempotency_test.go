@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateHandlerIdempotencyKey(t *testing.T) {
+	clearTodos(t)
+	if _, err := db.Exec("DELETE FROM idempotency_keys"); err != nil {
+		t.Fatalf("Failed to clear idempotency keys: %v", err)
+	}
+
+	router := setupRouter()
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/todos", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "retry-me")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := create(`{"task":"Buy milk"}`)
+	if status := first.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	retry := create(`{"task":"Buy milk"}`)
+	if status := retry.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201 on retry, got %d", status)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected the original response %q, got %q", first.Body.String(), retry.Body.String())
+	}
+	if retry.Header().Get("Location") != first.Header().Get("Location") {
+		t.Errorf("Expected the original Location, got %q", retry.Header().Get("Location"))
+	}
+	if count := countTodos(t); count != 1 {
+		t.Errorf("Expected 1 todo after retry, got %d", count)
+	}
+
+	conflict := create(`{"task":"Buy bread"}`)
+	if status := conflict.Code; status != http.StatusConflict {
+		t.Errorf("Expected status 409 for a different payload, got %d", status)
+	}
+}
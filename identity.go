@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	requestIDKey
+)
+
+// ownerHeader carries the identity of the caller with AUTH_MODE=proxy. It
+// must be set by the authenticating reverse proxy in front of the API,
+// which is trusted to strip it from client requests.
+const ownerHeader = "X-Owner"
+
+// principal is who a request acts on behalf of.
+type principal struct {
+	// owner is the X-Owner header, or the username with JWT auth. Lists
+	// and idempotency keys are scoped to it.
+	owner string
+	// userID is the authenticated user, or 0 without JWT auth.
+	userID int
+	// role is the user's role, which decides what they may do; callers
+	// without JWT auth are editors.
+	role string
+}
+
+// identityMiddleware stores the principal of the request in its context.
+// Every todo query is scoped to it.
+//
+// With JWT auth, it is the user the bearer token or API key was issued to,
+// and requests without valid credentials are rejected. Otherwise the owner
+// comes from ownerHeader, and requests without one share the default owner
+// "", which is also what todos created before ownership existed belong to.
+func identityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller := principal{owner: r.Header.Get(ownerHeader), role: editorRole}
+		if jwtSecret != nil {
+			var err error
+			caller, err = authenticate(r)
+			switch {
+			case errors.Is(err, errMissingCredentials):
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				if route := mux.CurrentRoute(r); route != nil && route.GetName() == icsRoute {
+					w.Header().Add("WWW-Authenticate", `Basic realm="todo-api", charset="UTF-8"`)
+				}
+				writeErrorCode(w, r, codeMissingAuth, err.Error(), http.StatusUnauthorized)
+				return
+			case errors.Is(err, errInvalidToken) || errors.Is(err, errInvalidAPIKey):
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeErrorCode(w, r, codeInvalidToken, err.Error(), http.StatusUnauthorized)
+				return
+			case err != nil:
+				slog.ErrorContext(r.Context(), "Error authenticating request", "error", err)
+				writeError(w, r, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey, caller)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// principalFrom returns the principal stored in ctx by identityMiddleware.
+func principalFrom(ctx context.Context) principal {
+	caller, _ := ctx.Value(principalKey).(principal)
+	return caller
+}
+
+// ownerFrom returns the owner of the principal stored in ctx.
+func ownerFrom(ctx context.Context) string {
+	return principalFrom(ctx).owner
+}
+
+// isAdmin reports whether p sees and changes everyone's todos.
+func (p principal) isAdmin() bool {
+	return p.role == adminRole
+}
+
+// todoScope returns the SQL condition restricting the todos table, referred
+// to as alias, to the ones p may see: their own, and with a user account,
+// the ones in lists they own or are a member of.
+func (p principal) todoScope(alias string) (string, []any) {
+	return p.scope(alias, "")
+}
+
+// todoWriteScope is todoScope without the todos in lists shared with p
+// read-only.
+func (p principal) todoWriteScope(alias string) (string, []any) {
+	return p.scope(alias, " AND permission = '"+writePermission+"'")
+}
+
+func (p principal) scope(alias, memberCondition string) (string, []any) {
+	switch {
+	case p.isAdmin():
+		return "TRUE", nil
+	case p.userID != 0:
+		return "(" + alias + "user_id = ? OR " +
+			alias + "list_id IN (SELECT id FROM lists WHERE user_id = ?) OR " +
+			alias + "list_id IN (SELECT list_id FROM list_members WHERE user_id = ?" + memberCondition + "))", []any{p.userID, p.userID, p.userID}
+	}
+	return alias + "owner = ?", []any{p.owner}
+}
+
+// owns reports whether p may see a todo of owner and userID kept outside
+// SQL, with the same rules as todoScope, and whether p owns a list of owner
+// and userID. Todos kept outside SQL aren't in lists.
+func (p principal) owns(owner string, userID int) bool {
+	switch {
+	case p.isAdmin():
+		return true
+	case p.userID != 0:
+		return userID == p.userID
+	}
+	return owner == p.owner
+}
+
+// requireUser answers 403 and returns false for callers that aren't a user
+// account, which is all of them with AUTH_MODE=proxy.
+func requireUser(w http.ResponseWriter, r *http.Request) bool {
+	if principalFrom(r.Context()).userID == 0 {
+		writeErrorCode(w, r, codeUserRequired, "This needs a user account", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// userIDValue is p's user ID for the user_id column, NULL without one.
+func (p principal) userIDValue() any {
+	if p.userID == 0 {
+		return nil
+	}
+	return p.userID
+}
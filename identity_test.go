@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func seedOwnedTodo(t *testing.T, owner, task string) int {
+	t.Helper()
+	result, err := db.Exec("INSERT INTO todos (owner, task, done) VALUES (?, ?, FALSE)", owner, task)
+	if err != nil {
+		t.Fatalf("Failed to seed todo: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+func TestOwnersAreIsolated(t *testing.T) {
+	clearTodos(t)
+	aliceID := seedOwnedTodo(t, "alice", "alice's task")
+	seedOwnedTodo(t, "bob", "bob's task")
+
+	router := setupRouter()
+	path := "/todos/" + strconv.Itoa(aliceID)
+
+	req := httptest.NewRequest("GET", "/todos", nil)
+	req.Header.Set("X-Owner", "bob")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 1 || todos[0].Task != "bob's task" {
+		t.Errorf("Expected bob to only see his own todo, got %+v", todos)
+	}
+
+	requests := []struct {
+		method string
+		body   string
+	}{
+		{"GET", ""},
+		{"PUT", fmt.Sprintf(`{"id": %d,"task":"hijacked","done":true}`, aliceID)},
+		{"DELETE", ""},
+	}
+	for _, tt := range requests {
+		req = httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+		req.Header.Set("X-Owner", "bob")
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("%s by another owner: expected status 404, got %d", tt.method, status)
+		}
+	}
+
+	req = httptest.NewRequest("GET", path, nil)
+	req.Header.Set("X-Owner", "alice")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if todo.Task != "alice's task" {
+		t.Errorf("Expected alice's todo to be untouched, got %+v", todo)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// importer converts an export from another todo app into our todos. It also
+// reports how many entries it deliberately left out.
+type importer func(body io.Reader) (todos []Todo, skipped int, err error)
+
+var importers = map[string]importer{
+	"trello":  importTrello,
+	"todoist": importTodoist,
+}
+
+type importSummary struct {
+	Format   string `json:"format"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+	Todos    []Todo `json:"todos"`
+}
+
+// trelloExport is the subset of a Trello board export we understand.
+type trelloExport struct {
+	Cards []struct {
+		Name        string     `json:"name"`
+		Closed      bool       `json:"closed"`
+		Due         *time.Time `json:"due"`
+		DueComplete bool       `json:"dueComplete"`
+		Labels      []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	} `json:"cards"`
+}
+
+func importTrello(body io.Reader) ([]Todo, int, error) {
+	var export trelloExport
+	if err := json.NewDecoder(body).Decode(&export); err != nil {
+		return nil, 0, err
+	}
+
+	todos := make([]Todo, 0, len(export.Cards))
+	skipped := 0
+	for _, card := range export.Cards {
+		// Archived cards are left behind, they aren't todos anymore.
+		if card.Closed {
+			skipped++
+			continue
+		}
+		tags := make([]string, 0, len(card.Labels))
+		for _, label := range card.Labels {
+			if label.Name != "" {
+				tags = append(tags, label.Name)
+			}
+		}
+		todos = append(todos, Todo{Task: card.Name, Done: card.DueComplete, DueDate: card.Due, Tags: tags})
+	}
+	return todos, skipped, nil
+}
+
+// todoistExport is the subset of a Todoist sync export we understand.
+type todoistExport struct {
+	Items []struct {
+		Content  string `json:"content"`
+		Checked  bool   `json:"checked"`
+		Priority int    `json:"priority"`
+		Due      *struct {
+			Date string `json:"date"`
+		} `json:"due"`
+		Labels []string `json:"labels"`
+	} `json:"items"`
+}
+
+// todoistPriorities maps Todoist's priorities, 1 (normal) to 4 (what its
+// apps call p1), onto ours. Anything else falls back to the default.
+var todoistPriorities = map[int]string{1: "low", 2: "medium", 3: "high", 4: "urgent"}
+
+// todoistDateLayouts are the shapes of a Todoist due date: a date and time
+// with a zone, a floating date and time, or a whole day. Floating ones are
+// read as UTC.
+var todoistDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", time.DateOnly}
+
+func parseTodoistDate(v string) (*time.Time, error) {
+	for _, layout := range todoistDateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized Todoist due date %q", v)
+}
+
+func importTodoist(body io.Reader) ([]Todo, int, error) {
+	var export todoistExport
+	if err := json.NewDecoder(body).Decode(&export); err != nil {
+		return nil, 0, err
+	}
+
+	todos := make([]Todo, 0, len(export.Items))
+	for _, item := range export.Items {
+		todo := Todo{Task: item.Content, Done: item.Checked, Priority: todoistPriorities[item.Priority], Tags: item.Labels}
+		if item.Due != nil && item.Due.Date != "" {
+			due, err := parseTodoistDate(item.Due.Date)
+			if err != nil {
+				return nil, 0, err
+			}
+			todo.DueDate = due
+		}
+		todos = append(todos, todo)
+	}
+	return todos, 0, nil
+}
+
+// ImportHandler imports todos from another app's JSON export in a single
+// transaction, of at most maxBatchSize entries. Entries that can't be mapped
+// to a valid todo are skipped and counted in the summary.
+func ImportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := principalFrom(ctx)
+	format := mux.Vars(r)["format"]
+	parse, ok := importers[format]
+	if !ok {
+		writeError(w, r, "Unsupported import format", http.StatusBadRequest)
+		return
+	}
+
+	todos, skipped, err := parse(r.Body)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if len(todos) > maxBatchSize {
+		var errs validationErrors
+		errs.add("items", "must contain at most %d entries", maxBatchSize)
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	summary := importSummary{Format: format, Skipped: skipped, Todos: []Todo{}}
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		for _, todo := range todos {
+			if errs := validateTodo(&todo); errs != nil {
+				summary.Skipped++
+				continue
+			}
+
+			todo.ID, err = insertTodo(ctx, tx, caller, todo)
+			if err != nil {
+				return err
+			}
+			if err = loadTimestamps(ctx, tx, &todo); err != nil {
+				return err
+			}
+			summary.Imported++
+			summary.Todos = append(summary.Todos, todo)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, todo := range summary.Todos {
+		todoEvents.publish(todoEvent{Type: "created", Todo: todo, owner: caller})
+	}
+	slog.InfoContext(ctx, "Imported todos", "format", format, "imported", summary.Imported, "skipped", summary.Skipped)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(summary)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		return
+	}
+}
+
+// csvImportColumns are the CSV columns an import reads, named as in an
+// export. Other columns, like id and created_at, are ignored so an export
+// can be imported as is.
+var csvImportColumns = []string{"task", "description", "done", "due_date", "priority", "list_id", "parent_id", "tags"}
+
+// csvImportForm is the multipart field holding the CSV file, and
+// csvMappingForm the optional field mapping our columns to the file's
+// header, as a JSON object like {"task": "Title"}.
+const (
+	csvImportForm  = "file"
+	csvMappingForm = "mapping"
+)
+
+// csvColumnIndexes finds each import column in header, under its mapped
+// name or else its own. Header names are matched ignoring case and
+// surrounding space. The task column is required.
+func csvColumnIndexes(header []string, mapping map[string]string) (map[string]int, error) {
+	for column := range mapping {
+		if !slices.Contains(csvImportColumns, column) {
+			return nil, fmt.Errorf("Unknown column %q in mapping, must be one of %s", column, strings.Join(csvImportColumns, ", "))
+		}
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	indexes := make(map[string]int)
+	for _, column := range csvImportColumns {
+		name, mapped := mapping[column]
+		if !mapped {
+			name = column
+		}
+		i := slices.IndexFunc(header, func(h string) bool {
+			return strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name))
+		})
+		switch {
+		case i >= 0:
+			indexes[column] = i
+		case mapped:
+			return nil, fmt.Errorf("Column %q mapped to %s is not in the header", name, column)
+		case column == "task":
+			return nil, errors.New("The header has no task column")
+		}
+	}
+	return indexes, nil
+}
+
+// parseCSVTodo reads a todo from a CSV record. Empty cells leave their
+// field unset, and cells that don't parse are reported like invalid fields.
+// Text escaped by an export is unescaped.
+func parseCSVTodo(record []string, indexes map[string]int) (Todo, validationErrors) {
+	var todo Todo
+	var errs validationErrors
+	cell := func(column string) string {
+		i, ok := indexes[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return csvUnescape(strings.TrimSpace(record[i]))
+	}
+	id := func(column string) *int {
+		v := cell(column)
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs.add(column, "must be an integer")
+			return nil
+		}
+		return &n
+	}
+
+	todo.Task = cell("task")
+	todo.Description = cell("description")
+	if v := cell("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			errs.add("done", "must be true or false")
+		}
+		todo.Done = done
+	}
+	if v := cell("due_date"); v != "" {
+		due, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			due, err = time.Parse(time.DateOnly, v)
+		}
+		if err != nil {
+			errs.add("due_date", "must be an RFC 3339 timestamp or a date")
+		} else {
+			todo.DueDate = &due
+		}
+	}
+	todo.Priority = strings.ToLower(cell("priority"))
+	todo.ListID = id("list_id")
+	todo.ParentID = id("parent_id")
+	if v := cell("tags"); v != "" {
+		todo.Tags = strings.Split(v, csvTagSeparator)
+	}
+	return todo, errs
+}
+
+// rowErrors points the errors of a todo at the CSV row it was read from.
+func rowErrors(row int, errs validationErrors) validationErrors {
+	for i := range errs {
+		errs[i].Row = row
+	}
+	return errs
+}
+
+// ImportCSVHandler imports todos from a CSV file uploaded as multipart form
+// data, in a single transaction. Nothing is imported when any row is
+// invalid; the errors name the row they were found on.
+func ImportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseMultipartForm(maxImportBytes); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var mapping map[string]string
+	if v := r.FormValue(csvMappingForm); v != "" {
+		if err := json.Unmarshal([]byte(v), &mapping); err != nil {
+			writeError(w, r, "Invalid mapping! mapping must be a JSON object of column names", http.StatusBadRequest)
+			return
+		}
+	}
+	file, _, err := r.FormFile(csvImportForm)
+	if err != nil {
+		writeError(w, r, "A CSV file is required in the file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	in := csv.NewReader(file)
+	in.FieldsPerRecord = -1
+	header, err := in.Read()
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("The CSV file is empty")
+		}
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	indexes, err := csvColumnIndexes(header, mapping)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var todos []Todo
+	var rows []int
+	var errs validationErrors
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		row, _ := in.FieldPos(0)
+		todo, parseErrs := parseCSVTodo(record, indexes)
+		errs = append(errs, rowErrors(row, append(parseErrs, validateTodo(&todo)...))...)
+		todos = append(todos, todo)
+		rows = append(rows, row)
+	}
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		for i := range todos {
+			refErrs, err := checkTodoRefs(ctx, tx, caller, todos[i])
+			if err != nil {
+				return err
+			}
+			errs = append(errs, rowErrors(rows[i], refErrs)...)
+		}
+		if errs != nil {
+			return errs
+		}
+
+		for i := range todos {
+			if todos[i].ID, err = insertTodo(ctx, tx, caller, todos[i]); err != nil {
+				return err
+			}
+			if err = loadTimestamps(ctx, tx, &todos[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, todo := range todos {
+		todoEvents.publish(todoEvent{Type: "created", Todo: todo, owner: caller})
+	}
+	slog.InfoContext(ctx, "Imported todos", "format", "csv", "imported", len(todos), "skipped", 0)
+
+	summary := importSummary{Format: "csv", Imported: len(todos), Todos: todos}
+	if summary.Todos == nil {
+		summary.Todos = []Todo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(summary); err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+	}
+}
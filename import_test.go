@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportTrello(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	body := strings.NewReader(`{
+		"name": "Groceries board",
+		"cards": [
+			{"name": "Buy milk", "closed": false, "due": "2025-03-14T10:00:00.000Z", "dueComplete": true, "labels": [{"name": "errands"}]},
+			{"name": "Old card", "closed": true, "dueComplete": false, "labels": []},
+			{"name": "   ", "closed": false, "dueComplete": false, "labels": []},
+			{"name": "Call plumber", "closed": false, "dueComplete": false, "labels": [{"name": "home"}, {"name": ""}]}
+		]
+	}`)
+	req := httptest.NewRequest("POST", "/todos/import/trello", body)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", status, rr.Body.String())
+	}
+
+	var summary importSummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if summary.Imported != 2 {
+		t.Errorf("Expected 2 imported, got %d", summary.Imported)
+	}
+	if summary.Skipped != 2 {
+		t.Errorf("Expected 2 skipped, got %d", summary.Skipped)
+	}
+	if len(summary.Todos) != 2 {
+		t.Fatalf("Expected 2 todos in summary, got %d", len(summary.Todos))
+	}
+
+	milk := summary.Todos[0]
+	if milk.Task != "Buy milk" || !milk.Done || !reflect.DeepEqual(milk.Tags, []string{"errands"}) {
+		t.Errorf("Unexpected mapping for first card: %+v", milk)
+	}
+	if milk.DueDate == nil || !milk.DueDate.Equal(time.Date(2025, time.March, 14, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the card's due date, got %v", milk.DueDate)
+	}
+	plumber := summary.Todos[1]
+	if plumber.Task != "Call plumber" || plumber.Done || !reflect.DeepEqual(plumber.Tags, []string{"home"}) {
+		t.Errorf("Unexpected mapping for last card: %+v", plumber)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM todos").Scan(&count); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 todos in database, got %d", count)
+	}
+}
+
+func TestImportPublishesEvents(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+	events := publishedEvents(t)
+
+	body := `{"items": [{"content": "Water plants", "checked": false, "priority": 1}, {"content": "Pay rent", "checked": false, "priority": 4}]}`
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/todos/import/todoist", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, task := range []string{"Water plants", "Pay rent"} {
+		select {
+		case event := <-events:
+			if event.Type != "created" || event.Todo.Task != task || event.Todo.ID == 0 {
+				t.Errorf("Expected a created event for %q, got %+v", task, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a created event for %q", task)
+		}
+	}
+}
+
+func TestImportBatchLimit(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+	saved := maxBatchSize
+	maxBatchSize = 1
+	t.Cleanup(func() { maxBatchSize = saved })
+
+	body := `{"items": [{"content": "Water plants", "checked": false, "priority": 1}, {"content": "Pay rent", "checked": false, "priority": 4}]}`
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/todos/import/todoist", strings.NewReader(body)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for more than MAX_BATCH_SIZE entries, got %d", rr.Code)
+	}
+}
+
+func TestImportUnknownFormat(t *testing.T) {
+	router := setupRouter()
+
+	req := httptest.NewRequest("POST", "/todos/import/asana", strings.NewReader(`{}`))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", status)
+	}
+}
+
+func TestParseTodoistDate(t *testing.T) {
+	tests := map[string]time.Time{
+		"2025-03-14":           time.Date(2025, time.March, 14, 0, 0, 0, 0, time.UTC),
+		"2025-03-14T10:30:00":  time.Date(2025, time.March, 14, 10, 30, 0, 0, time.UTC),
+		"2025-03-14T10:30:00Z": time.Date(2025, time.March, 14, 10, 30, 0, 0, time.UTC),
+	}
+	for v, want := range tests {
+		got, err := parseTodoistDate(v)
+		if err != nil {
+			t.Errorf("parseTodoistDate(%q) returned error: %v", v, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseTodoistDate(%q) = %v, want %v", v, got, want)
+		}
+	}
+
+	if _, err := parseTodoistDate("next tuesday"); err == nil {
+		t.Errorf("Expected an error for a natural language date")
+	}
+}
+
+// csvUpload builds a CSV import request of file, with mapping unless it is
+// empty.
+func csvUpload(t *testing.T, file, mapping string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if mapping != "" {
+		form.WriteField(csvMappingForm, mapping)
+	}
+	part, err := form.CreateFormFile(csvImportForm, "todos.csv")
+	if err != nil {
+		t.Fatalf("Failed to build upload: %v", err)
+	}
+	part.Write([]byte(file))
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/todos/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestImportCSV(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	router := setupRouter()
+	list := createList(t, router, "Chores")
+
+	file := "\ufeffTitle,Completed,Due,priority,list_id,tags,notes\n" +
+		"Buy milk,true,2025-03-14,HIGH," + strconv.Itoa(list.ID) + ",errands;home,ignored\n" +
+		"\"Call plumber, again\",,2025-03-15T09:00:00Z,,,,\n"
+	req := csvUpload(t, file, `{"task":"title","done":"Completed","due_date":"Due"}`)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var summary importSummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if summary.Format != "csv" || summary.Imported != 2 || len(summary.Todos) != 2 {
+		t.Fatalf("Expected 2 todos imported from CSV, got %+v", summary)
+	}
+	milk, plumber := summary.Todos[0], summary.Todos[1]
+	if milk.Task != "Buy milk" || !milk.Done || milk.Priority != "high" || milk.ListID == nil || *milk.ListID != list.ID || !reflect.DeepEqual(milk.Tags, []string{"errands", "home"}) {
+		t.Errorf("Unexpected mapping for first row: %+v", milk)
+	}
+	if milk.DueDate == nil || !milk.DueDate.Equal(time.Date(2025, time.March, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the row's due date, got %v", milk.DueDate)
+	}
+	if plumber.Task != "Call plumber, again" || plumber.Done || plumber.Priority != defaultPriority || plumber.ListID != nil {
+		t.Errorf("Unexpected mapping for second row: %+v", plumber)
+	}
+}
+
+func TestImportCSVRoundTrip(t *testing.T) {
+	clearTodos(t)
+	seedTodo(t, "Exported", true)
+	router := setupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/todos/export", nil))
+	export := rr.Body.String()
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, csvUpload(t, export, ""))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"imported":1`) {
+		t.Fatalf("Expected the export imported back, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestTagsSurviveCSVRoundTrip(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task": "Split", "tags": ["a;b"]}`)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a tag holding the separator, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task": "Tagged", "tags": ["a, b", "c"]}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/todos/export", nil))
+	export := rr.Body.String()
+
+	clearTodos(t)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, csvUpload(t, export, ""))
+	var summary importSummary
+	json.Unmarshal(rr.Body.Bytes(), &summary)
+	if len(summary.Todos) != 1 || !reflect.DeepEqual(summary.Todos[0].Tags, []string{"a, b", "c"}) {
+		t.Errorf("Expected the tags back as they were, got %s", rr.Body.String())
+	}
+}
+
+func TestImportCSVRejectsInvalidRows(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+
+	file := "task,done,due_date,priority,parent_id\n" +
+		"Fine,false,,,\n" +
+		",maybe,,,\n" +
+		"Late,,tomorrow,someday,999999\n"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, csvUpload(t, file, ""))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp errorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	var got []string
+	for _, e := range resp.Errors {
+		got = append(got, strconv.Itoa(e.Row)+":"+e.Field)
+	}
+	want := []string{"3:done", "3:task", "4:due_date", "4:priority"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected errors %v, got %v", want, got)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM todos").Scan(&count); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected nothing imported, got %d todos", count)
+	}
+
+	// Rows pointing at missing todos are only caught inside the transaction.
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, csvUpload(t, "task,parent_id\nOrphan,999999\n", ""))
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), `"row":2`) {
+		t.Errorf("Expected 422 for row 2, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestImportCSVBadUploads(t *testing.T) {
+	router := setupRouter()
+
+	tests := map[string]*http.Request{
+		"not multipart":   httptest.NewRequest("POST", "/todos/import", strings.NewReader("task\nA\n")),
+		"no task column":  csvUpload(t, "name\nA\n", ""),
+		"unknown mapping": csvUpload(t, "task\nA\n", `{"color":"task"}`),
+		"missing mapped":  csvUpload(t, "task\nA\n", `{"task":"Title"}`),
+		"bad mapping":     csvUpload(t, "task\nA\n", `["task"]`),
+		"empty file":      csvUpload(t, "", ""),
+		"malformed":       csvUpload(t, "task\n\"A\n", ""),
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
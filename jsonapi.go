@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// jsonAPIContentType is the media type of JSON:API documents, which
+// GET /todos and GET /todos/{id} answer with when clients ask for it.
+const jsonAPIContentType = "application/vnd.api+json"
+
+// wantsJSONAPI reports whether the client asked for a JSON:API document,
+// with ?format=jsonapi or the JSON:API media type in Accept. ?format=json
+// asks for plain JSON whatever the Accept header says.
+func wantsJSONAPI(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("format") {
+	case "":
+		return strings.Contains(r.Header.Get("Accept"), jsonAPIContentType), nil
+	case "json":
+		return false, nil
+	case "jsonapi":
+		return true, nil
+	}
+	return false, errors.New("Invalid format! format must be json or jsonapi")
+}
+
+// jsonAPIDocument is a JSON:API top-level document. Data is a single
+// resource or a list of them.
+type jsonAPIDocument struct {
+	Data     any               `json:"data"`
+	Included []jsonAPIResource `json:"included,omitempty"`
+	Links    map[string]string `json:"links,omitempty"`
+	Meta     map[string]any    `json:"meta,omitempty"`
+	JSONAPI  map[string]string `json:"jsonapi"`
+}
+
+// jsonAPIResource is a resource object: the fields of a todo, with the
+// todos, lists and users it refers to as relationships.
+type jsonAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]any                 `json:"attributes"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships"`
+	Links         map[string]string              `json:"links"`
+}
+
+// jsonAPIRelationship links to a related resource. Data identifies it, is
+// null when there is none, and is left out for to-many relationships that
+// weren't loaded.
+type jsonAPIRelationship struct {
+	Data  json.RawMessage   `json:"data,omitempty"`
+	Links map[string]string `json:"links,omitempty"`
+}
+
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// todoRelationships are the fields of a todo that JSON:API documents hold
+// as relationships rather than attributes.
+var todoRelationships = []string{"id", "list_id", "parent_id", "assignee_id", "subtasks"}
+
+// newTodoDocument builds the JSON:API document of todos, or of the only
+// one of them when single is true, with only the selected fields. Subtasks
+// loaded with ?expand=subtasks are included as resources of their own.
+// Links point at the API version of the request.
+func newTodoDocument(ctx context.Context, todos []Todo, single bool, fields fieldSet) (jsonAPIDocument, error) {
+	doc := jsonAPIDocument{JSONAPI: map[string]string{"version": "1.1"}}
+	resources := make([]jsonAPIResource, len(todos))
+	for i, todo := range todos {
+		var err error
+		if resources[i], err = todoResource(ctx, todo, fields); err != nil {
+			return doc, err
+		}
+		if doc.Included, err = includeSubtasks(ctx, doc.Included, todo.Subtasks, fields); err != nil {
+			return doc, err
+		}
+	}
+	if single {
+		doc.Data = resources[0]
+	} else {
+		doc.Data = resources
+	}
+	return doc, nil
+}
+
+// includeSubtasks appends the resources of subtasks, and of theirs in
+// turn, to included.
+func includeSubtasks(ctx context.Context, included []jsonAPIResource, subtasks []Todo, fields fieldSet) ([]jsonAPIResource, error) {
+	for _, subtask := range subtasks {
+		resource, err := todoResource(ctx, subtask, fields)
+		if err != nil {
+			return nil, err
+		}
+		if included, err = includeSubtasks(ctx, append(included, resource), subtask.Subtasks, fields); err != nil {
+			return nil, err
+		}
+	}
+	return included, nil
+}
+
+// todoResource turns a todo into a resource object, with only the selected
+// attributes and relationships.
+func todoResource(ctx context.Context, todo Todo, fields fieldSet) (jsonAPIResource, error) {
+	base := apiBase(ctx)
+	self := base + "/todos/" + strconv.Itoa(todo.ID)
+	resource := jsonAPIResource{
+		Type:  "todos",
+		ID:    strconv.Itoa(todo.ID),
+		Links: map[string]string{"self": self},
+	}
+
+	var err error
+	if resource.Attributes, err = todoFieldValues(todo); err != nil {
+		return resource, err
+	}
+	for _, field := range todoRelationships {
+		delete(resource.Attributes, field)
+	}
+
+	toOne := func(typ string, id *int, related string) (jsonAPIRelationship, error) {
+		if id == nil {
+			return jsonAPIRelationship{Data: json.RawMessage("null")}, nil
+		}
+		data, err := json.Marshal(jsonAPIIdentifier{Type: typ, ID: strconv.Itoa(*id)})
+		rel := jsonAPIRelationship{Data: data}
+		if related != "" {
+			rel.Links = map[string]string{"related": related + strconv.Itoa(*id)}
+		}
+		return rel, err
+	}
+	resource.Relationships = map[string]jsonAPIRelationship{
+		"subtasks": {Links: map[string]string{"related": self + "/subtasks"}},
+		"comments": {Links: map[string]string{"related": self + "/comments"}},
+	}
+	for _, one := range []struct {
+		name, typ string
+		id        *int
+		related   string
+	}{
+		{"list", "lists", todo.ListID, base + "/lists/"},
+		{"parent", "todos", todo.ParentID, base + "/todos/"},
+		{"assignee", "users", todo.AssigneeID, ""},
+	} {
+		if resource.Relationships[one.name], err = toOne(one.typ, one.id, one.related); err != nil {
+			return resource, err
+		}
+	}
+	if todo.Subtasks != nil {
+		ids := make([]jsonAPIIdentifier, len(todo.Subtasks))
+		for i, subtask := range todo.Subtasks {
+			ids[i] = jsonAPIIdentifier{Type: "todos", ID: strconv.Itoa(subtask.ID)}
+		}
+		subtasks := resource.Relationships["subtasks"]
+		if subtasks.Data, err = json.Marshal(ids); err != nil {
+			return resource, err
+		}
+		resource.Relationships["subtasks"] = subtasks
+	}
+
+	if fields != nil {
+		maps.DeleteFunc(resource.Attributes, func(name string, _ any) bool { return !fields[name] })
+		maps.DeleteFunc(resource.Relationships, func(name string, _ jsonAPIRelationship) bool { return !fields[name] })
+	}
+	return resource, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestJSONAPI(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+
+	rr := requestAs(router, alice, "POST", "/v1/lists", `{"name": "Chores"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	rr = requestAs(router, alice, "POST", "/v1/todos", `{"task": "Clean", "tags": ["home"], "list_id": `+strconv.Itoa(list.ID)+`}`)
+	var parent Todo
+	json.Unmarshal(rr.Body.Bytes(), &parent)
+	rr = requestAs(router, alice, "POST", "/v1/todos", `{"task": "Kitchen", "parent_id": `+strconv.Itoa(parent.ID)+`}`)
+	var sub Todo
+	json.Unmarshal(rr.Body.Bytes(), &sub)
+	parentID, subID := strconv.Itoa(parent.ID), strconv.Itoa(sub.ID)
+
+	type resource struct {
+		Type          string         `json:"type"`
+		ID            string         `json:"id"`
+		Attributes    map[string]any `json:"attributes"`
+		Relationships map[string]struct {
+			Data  json.RawMessage   `json:"data"`
+			Links map[string]string `json:"links"`
+		} `json:"relationships"`
+		Links map[string]string `json:"links"`
+	}
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		token, _ := issueToken(alice, time.Now())
+		req.Header.Set("Authorization", "Bearer "+token)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr = get("/v1/todos?limit=1", jsonAPIContentType)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != jsonAPIContentType {
+		t.Fatalf("Expected a JSON:API document, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var page struct {
+		Data  []resource        `json:"data"`
+		Links map[string]string `json:"links"`
+		Meta  map[string]int    `json:"meta"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if len(page.Data) != 1 || page.Meta["total"] != 2 || page.Links["self"] != "/v1/todos?limit=1" || page.Links["next"] != "/v1/todos?limit=1&offset=1" {
+		t.Fatalf("Expected the first page with its total and links, got %s", rr.Body.String())
+	}
+	todo := page.Data[0]
+	if todo.Type != "todos" || todo.ID != parentID || todo.Attributes["task"] != "Clean" || todo.Links["self"] != "/v1/todos/"+parentID {
+		t.Errorf("Expected the todo as a resource, got %+v", todo)
+	}
+	if _, ok := todo.Attributes["list_id"]; ok {
+		t.Errorf("Expected list_id as a relationship only, got %v", todo.Attributes)
+	}
+	listID := strconv.Itoa(list.ID)
+	if rel := todo.Relationships["list"]; string(rel.Data) != `{"type":"lists","id":"`+listID+`"}` || rel.Links["related"] != "/v1/lists/"+listID {
+		t.Errorf("Expected the list relationship, got %s %v", rel.Data, rel.Links)
+	}
+	if parent := todo.Relationships["parent"]; string(parent.Data) != "null" {
+		t.Errorf("Expected a null parent, got %s", parent.Data)
+	}
+	if subtasks := todo.Relationships["subtasks"]; subtasks.Data != nil || subtasks.Links["related"] != "/v1/todos/"+parentID+"/subtasks" {
+		t.Errorf("Expected a link to the subtasks only, got %s %v", subtasks.Data, subtasks.Links)
+	}
+
+	rr = get("/v1/todos/"+parentID+"?format=jsonapi&expand=subtasks", "")
+	var doc struct {
+		Data     resource   `json:"data"`
+		Included []resource `json:"included"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &doc)
+	if rr.Header().Get("Content-Type") != jsonAPIContentType || doc.Data.ID != parentID {
+		t.Fatalf("Expected the todo as a JSON:API document, got %s", rr.Body.String())
+	}
+	if data := string(doc.Data.Relationships["subtasks"].Data); data != `[{"type":"todos","id":"`+subID+`"}]` {
+		t.Errorf("Expected the subtasks identified, got %s", data)
+	}
+	if len(doc.Included) != 1 || doc.Included[0].ID != subID || string(doc.Included[0].Relationships["parent"].Data) != `{"type":"todos","id":"`+parentID+`"}` {
+		t.Errorf("Expected the subtask included, got %+v", doc.Included)
+	}
+
+	if rr = get("/v1/todos?format=json", jsonAPIContentType); rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected ?format=json to win over Accept, got %q", rr.Header().Get("Content-Type"))
+	}
+	if rr = get("/v1/todos/"+parentID, ""); rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected plain JSON by default, got %q", rr.Header().Get("Content-Type"))
+	}
+	if rr = get("/v1/todos?format=xml", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", rr.Code)
+	}
+}
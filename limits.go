@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Request body limits, set from MAX_BODY_BYTES and MAX_IMPORT_BYTES. Imports
+// carry a whole export of another app, so they get more room.
+var (
+	maxBodyBytes   int64 = 1 << 20
+	maxImportBytes int64 = 10 << 20
+)
+
+// importRoute and csvImportRoute name the import routes, to give them
+// maxImportBytes.
+const (
+	importRoute    = "import"
+	csvImportRoute = "import-csv"
+)
+
+const codeBodyTooLarge = "body_too_large"
+
+// bodyLimitMiddleware caps how much of a request body handlers can read,
+// so a giant payload can't exhaust memory. Bodies declaring a larger
+// Content-Length are rejected right away, others fail to decode once they
+// go over, which writeBodyError answers with 413 as well.
+func bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := maxBodyBytes
+		if route := mux.CurrentRoute(r); route != nil {
+			if name := route.GetName(); name == importRoute || name == csvImportRoute {
+				limit = maxImportBytes
+			}
+		}
+		if r.ContentLength > limit {
+			writeErrorCode(w, r, codeBodyTooLarge, fmt.Sprintf("Request body is larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errTrailingData is returned by decodeBody for bodies with more than one
+// JSON value.
+var errTrailingData = errors.New("Request body must hold a single JSON value")
+
+// unknownFieldError is returned by decodeBody for bodies with a field the
+// request doesn't have, which is most likely a typo.
+type unknownFieldError struct {
+	field string
+}
+
+func (e unknownFieldError) Error() string {
+	return fmt.Sprintf("Unknown field %s in request body", e.field)
+}
+
+// decodeBody decodes the JSON request body into v. Unlike a plain decode,
+// fields v doesn't have are rejected, so {"tsak": "x"} isn't taken for a
+// todo without a task, and so is anything after the JSON value.
+func decodeBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		// encoding/json has no error type for unknown fields.
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return unknownFieldError{field: field}
+		}
+		return err
+	}
+
+	_, err := decoder.Token()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	if !errors.Is(err, io.EOF) {
+		return errTrailingData
+	}
+	return nil
+}
+
+// writeBodyError replies to an error reading the request body: 413 if it
+// was over the limit, 422 for validationErrors, 400 otherwise.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeErrorCode(w, r, codeBodyTooLarge, fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var errs validationErrors
+	if errors.As(err, &errs) {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if errors.As(err, new(unknownFieldError)) {
+		writeErrorCode(w, r, codeUnknownField, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeError(w, r, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	clearTodos(t)
+	savedBody, savedImport := maxBodyBytes, maxImportBytes
+	maxBodyBytes, maxImportBytes = 64, 1024
+	t.Cleanup(func() { maxBodyBytes, maxImportBytes = savedBody, savedImport })
+	router := setupRouter()
+
+	large := `{"task": "` + strings.Repeat("x", 100) + `"}`
+	for _, declared := range []bool{true, false} {
+		req := httptest.NewRequest("POST", "/todos", strings.NewReader(large))
+		if !declared {
+			req.ContentLength = -1
+			req.Body = io.NopCloser(req.Body)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status 413 with declared length %v, got %d", declared, rr.Code)
+		}
+		var body errorResponse
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if body.Error.Code != codeBodyTooLarge {
+			t.Errorf("Expected code %s, got %q", codeBodyTooLarge, body.Error.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task": "Small"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected a small body to be accepted, got %d", rr.Code)
+	}
+
+	trello := `{"lists": [], "cards": [{"name": "` + strings.Repeat("x", 100) + `", "closed": false}]}`
+	req = httptest.NewRequest("POST", "/todos/import/trello", strings.NewReader(trello))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code == http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected imports to get the larger limit, got %d", rr.Code)
+	}
+}
+
+func TestStrictBodyDecoding(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+	id := seedTodo(t, "some task", false)
+
+	tests := []struct {
+		method, path, body string
+		code, message      string
+	}{
+		{"POST", "/v1/todos", `{"tsak": "x"}`, codeUnknownField, `Unknown field "tsak" in request body`},
+		{"PATCH", "/v1/todos/" + strconv.Itoa(id), `{"done": true, "owner": "mallory"}`, codeUnknownField, `Unknown field "owner" in request body`},
+		{"POST", "/v1/todos/batch", `[{"task": "a"}, {"task": "b", "colour": "red"}]`, codeUnknownField, `Unknown field "colour" in request body`},
+		{"POST", "/v1/todos", `{"task": "a"} {"task": "b"}`, "bad_request", errTrailingData.Error()},
+		{"POST", "/v1/todos", `{"task": "a"}]`, "bad_request", errTrailingData.Error()},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		var body errorResponse
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if rr.Code != http.StatusBadRequest || body.Error.Code != tt.code || body.Error.Message != tt.message {
+			t.Errorf("%s %s %s: expected 400 %s %q, got %d %s", tt.method, tt.path, tt.body, tt.code, tt.message, rr.Code, rr.Body.String())
+		}
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM todos").Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected no todos created from rejected bodies, got %d todos", count)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/todos", strings.NewReader("{\"task\": \"a\"}\n")))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected trailing whitespace to be fine, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConfiguredPayloadLimits(t *testing.T) {
+	clearTodos(t)
+	savedTask, savedBatch := maxTaskLength, maxBatchSize
+	maxTaskLength, maxBatchSize = 10, 2
+	t.Cleanup(func() { maxTaskLength, maxBatchSize = savedTask, savedBatch })
+	router := setupRouter()
+
+	tests := []struct {
+		path, body, field, message string
+	}{
+		{"/v1/todos", `{"task": "Far too long a task"}`, "task", "must be at most 10 characters"},
+		{"/v1/todos/batch", `[{"task": "a"}, {"task": "b"}, {"task": "c"}]`, "todos", "must contain at most 2 entries"},
+		{"/v1/todos/batch", `[]`, "todos", "must not be empty"},
+		{"/v1/todos/complete", `{"ids": [1, 2, 3]}`, "ids", "must contain at most 2 entries"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+		var body errorResponse
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if rr.Code != http.StatusUnprocessableEntity || len(body.Errors) != 1 || body.Errors[0].Field != tt.field || body.Errors[0].Message != tt.message {
+			t.Errorf("POST %s: expected 422 with %s %q, got %d %s", tt.path, tt.field, tt.message, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/todos/batch", strings.NewReader(`[{"task": "Short"}, {"task": "Shorter"}]`)))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected a batch within the limits to be created, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const maxListNameLength = 255
+
+// List groups todos. Each todo belongs to at most one list. Its owner can
+// share it with other users, as members who may read or also change its
+// todos.
+type List struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Permission is what the caller may do with the list: owner, write or
+	// read.
+	Permission string `json:"permission"`
+
+	// owner and userID, that of its owner's user account, are filled in
+	// by findList.
+	owner  string
+	userID int
+}
+
+// Permissions on a list. Only owners can rename, delete and share it.
+const (
+	readPermission  = "read"
+	writePermission = "write"
+	ownerPermission = "owner"
+)
+
+// errNotListOwner is returned for changes only the owner of a list can
+// make.
+var errNotListOwner = errors.New("Only the owner of the list can do this")
+
+// findList returns the list with id and the caller's permission on it, or
+// errListNotFound when it isn't shared with the caller. Admins own every
+// list. The row is locked when q is a transaction.
+func findList(ctx context.Context, q dbtx, caller principal, id int) (List, error) {
+	list := List{ID: id}
+	var userID sql.NullInt64
+	err := q.QueryRowContext(ctx, "SELECT name, owner, user_id FROM lists WHERE id = ?"+dbDialect.forUpdate(), id).Scan(&list.Name, &list.owner, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return list, errListNotFound
+	}
+	if err != nil {
+		return list, err
+	}
+	list.userID = int(userID.Int64)
+
+	switch {
+	case caller.owns(list.owner, list.userID):
+		list.Permission = ownerPermission
+	case caller.userID != 0:
+		err = q.QueryRowContext(ctx, "SELECT permission FROM list_members WHERE list_id = ? AND user_id = ?", id, caller.userID).Scan(&list.Permission)
+		if errors.Is(err, sql.ErrNoRows) {
+			return list, errListNotFound
+		}
+		if err != nil {
+			return list, err
+		}
+	default:
+		return list, errListNotFound
+	}
+	return list, nil
+}
+
+// findOwnList is findList for changes only the owner can make.
+func findOwnList(ctx context.Context, q dbtx, caller principal, id int) (List, error) {
+	list, err := findList(ctx, q, caller, id)
+	if err == nil && list.Permission != ownerPermission {
+		err = errNotListOwner
+	}
+	return list, err
+}
+
+// writeListError replies to the errors of findList and findOwnList.
+func writeListError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errListNotFound):
+		writeErrorCode(w, r, codeListNotFound, "List not found", http.StatusNotFound)
+	case errors.Is(err, errNotListOwner):
+		writeErrorCode(w, r, codeNotListOwner, err.Error(), http.StatusForbidden)
+	default:
+		slog.ErrorContext(r.Context(), "Error querying list", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// validateList normalizes a list received from a client in place and checks
+// it's fit to be stored.
+func validateList(list *List) validationErrors {
+	var errs validationErrors
+	errs.requireText("name", &list.Name, maxListNameLength)
+	return errs
+}
+
+// ListListsHandler lists the caller's lists and the ones shared with them.
+func ListListsHandler(w http.ResponseWriter, r *http.Request) {
+	lists, err := queryLists(r.Context(), principalFrom(r.Context()))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying lists", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+// queryLists returns the lists caller owns or is a member of, by id. Users
+// own the lists of their account, and without one, those of their owner.
+func queryLists(ctx context.Context, caller principal) ([]List, error) {
+	owned, owner := "l.owner = ?", any(caller.owner)
+	if caller.userID != 0 {
+		owned, owner = "l.user_id = ?", caller.userID
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT l.id, l.name, CASE WHEN `+owned+` THEN '`+ownerPermission+`' ELSE m.permission END
+FROM lists l
+LEFT JOIN list_members m ON m.list_id = l.id AND m.user_id = ?
+WHERE `+owned+` OR m.user_id IS NOT NULL
+ORDER BY l.id`, owner, caller.userID, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var list List
+		if err = rows.Scan(&list.ID, &list.Name, &list.Permission); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func ReadListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	list, err := findList(r.Context(), db, principalFrom(r.Context()), id)
+	if err != nil {
+		writeListError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func CreateListHandler(w http.ResponseWriter, r *http.Request) {
+	var list List
+	if err := decodeBody(r, &list); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if errs := validateList(&list); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	list.Permission = ownerPermission
+
+	var err error
+	caller := principalFrom(r.Context())
+	list.ID, err = dbDialect.insertID(r.Context(), db, "INSERT INTO lists (owner, user_id, name) VALUES (?, ?, ?)", caller.owner, caller.userIDValue(), list.Name)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error inserting list", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Added new list", "ID", list.ID, "Name", list.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiBase(r.Context())+"/lists/"+strconv.Itoa(list.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+// UpdateListHandler renames a list.
+func UpdateListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	var list List
+	if err = decodeBody(r, &list); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if errs := validateList(&list); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	list.ID, list.Permission = id, ownerPermission
+
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := findOwnList(ctx, tx, principalFrom(ctx), id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE lists SET name = ? WHERE id = ?", list.Name, id)
+		return err
+	})
+	if err != nil {
+		writeListError(w, r, err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Updated list", "ID", list.ID, "Name", list.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// DeleteListHandler deletes a list. Its todos are kept and no longer belong
+// to any list.
+func DeleteListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := findOwnList(ctx, tx, principalFrom(ctx), id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM lists WHERE id = ?", id)
+		return err
+	})
+	if err != nil {
+		writeListError(w, r, err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Deleted list", "ID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTodosHandler lists the todos of the {list_id} list, with everything
+// GET /todos supports.
+func ListTodosHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["list_id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	if _, err = findList(r.Context(), db, principalFrom(r.Context()), id); err != nil {
+		writeListError(w, r, err)
+		return
+	}
+
+	ListHandler(w, r)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func clearLists(t *testing.T) {
+	t.Helper()
+	if _, err := db.Exec("DELETE FROM lists"); err != nil {
+		t.Fatalf("Failed to clear lists: %v", err)
+	}
+}
+
+func createList(t *testing.T, router http.Handler, name string) List {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/lists", strings.NewReader(`{"name":"`+name+`"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a list, got %d", status)
+	}
+
+	var list List
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return list
+}
+
+func TestListsCRUD(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+
+	router := setupRouter()
+
+	list := createList(t, router, "Groceries")
+	path := "/lists/" + strconv.Itoa(list.ID)
+
+	req := httptest.NewRequest("PUT", path, strings.NewReader(`{"name":"Shopping"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200 renaming, got %d", status)
+	}
+
+	req = httptest.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var got List
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if got.Name != "Shopping" {
+		t.Errorf("Expected name Shopping, got %q", got.Name)
+	}
+
+	req = httptest.NewRequest("POST", "/lists", strings.NewReader(`{"name":"  "}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a blank name, got %d", status)
+	}
+
+	req = httptest.NewRequest("DELETE", path, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting, got %d", status)
+	}
+
+	req = httptest.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", status)
+	}
+}
+
+func TestListTodos(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+
+	router := setupRouter()
+
+	list := createList(t, router, "Groceries")
+	seedTodo(t, "unlisted", false)
+
+	body := `{"task":"Buy milk","list_id":` + strconv.Itoa(list.ID) + `}`
+	req := httptest.NewRequest("POST", "/todos", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	req = httptest.NewRequest("GET", "/lists/"+strconv.Itoa(list.ID)+"/todos", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 1 || todos[0].Task != "Buy milk" || todos[0].ListID == nil || *todos[0].ListID != list.ID {
+		t.Errorf("Expected only the listed todo, got %+v", todos)
+	}
+
+	req = httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task":"Lost","list_id":999999}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown list, got %d", status)
+	}
+
+	req = httptest.NewRequest("GET", "/lists/999999/todos", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown list, got %d", status)
+	}
+}
+
+func TestListsOfReregisteredUsername(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	admin := seedUser(t, "root", adminRole)
+
+	rr := requestAs(router, alice, "POST", "/lists", `{"name": "Diary"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	// Lists of the name without a user account, made with AUTH_MODE=proxy.
+	if _, err := db.Exec("INSERT INTO lists (owner, name) VALUES ('alice', 'Proxy')"); err != nil {
+		t.Fatalf("Failed to seed list: %v", err)
+	}
+	if rr = requestAs(router, admin, "DELETE", "/users/"+strconv.Itoa(alice.ID), ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting the user, got %d", rr.Code)
+	}
+
+	impostor := seedUser(t, "alice", editorRole)
+	rr = requestAs(router, impostor, "GET", "/lists", "")
+	var lists []List
+	json.Unmarshal(rr.Body.Bytes(), &lists)
+	if rr.Code != http.StatusOK || len(lists) != 0 {
+		t.Errorf("Expected a new user of the name to own no lists, got %d: %+v", rr.Code, lists)
+	}
+	if rr = requestAs(router, impostor, "GET", "/lists/"+strconv.Itoa(list.ID), ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for the deleted user's list, got %d", rr.Code)
+	}
+	if rr = requestAs(router, impostor, "POST", "/todos", `{"task": "Snoop", "list_id": `+strconv.Itoa(list.ID)+`}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 adding to the deleted user's list, got %d", rr.Code)
+	}
+}
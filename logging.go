@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// newLogHandler builds the slog handler selected by LOG_FORMAT (text or
+// json) and LOG_LEVEL (debug, info, warn or error). Unrecognized values fall
+// back to text and info, and are reported in the returned warnings so they
+// can be logged once the handler is installed.
+func newLogHandler(format, level string, w io.Writer) (slog.Handler, []string) {
+	var warnings []string
+
+	opts := &slog.HandlerOptions{}
+	switch strings.ToLower(level) {
+	case "debug":
+		opts.Level = slog.LevelDebug
+	case "", "info":
+		opts.Level = slog.LevelInfo
+	case "warn", "warning":
+		opts.Level = slog.LevelWarn
+	case "error":
+		opts.Level = slog.LevelError
+	default:
+		opts.Level = slog.LevelInfo
+		warnings = append(warnings, fmt.Sprintf("Unknown LOG_LEVEL %q, using info", level))
+	}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return requestIDHandler{slog.NewTextHandler(w, opts)}, warnings
+	case "json":
+		return requestIDHandler{slog.NewJSONHandler(w, opts)}, warnings
+	default:
+		warnings = append(warnings, fmt.Sprintf("Unknown LOG_FORMAT %q, using text", format))
+		return requestIDHandler{slog.NewTextHandler(w, opts)}, warnings
+	}
+}
+
+// requestIDHandler adds the ID of the request being served to every record
+// logged with its context.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// loggingMiddleware logs one line per request once it has been served.
+// It wraps the whole handler rather than being registered with router.Use,
+// so unmatched routes are logged too, and the size is what went out on the
+// wire after compression. Server errors are logged at error level, the rest
+// at info, so LOG_LEVEL=warn keeps only the server errors. The request ID
+// is added by the log handler, from the context.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "Request served",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("size", rec.size),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, warnings := newLogHandler("json", "warn", &buf)
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("dropped")
+	logger.Warn("kept", "ID", 1)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["msg"] != "kept" {
+		t.Errorf("Expected msg 'kept', got %v", entry["msg"])
+	}
+
+	_, warnings = newLogHandler("xml", "loud", &buf)
+	if len(warnings) != 2 {
+		t.Errorf("Expected 2 warnings for invalid values, got %v", warnings)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	handler, _ := newLogHandler("json", "info", &buf)
+	saved := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	router := requestIDMiddleware(loggingMiddleware(setupRouter()))
+	req := httptest.NewRequest("GET", "/no-such-route", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON log line, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"msg":         "Request served",
+		"method":      "GET",
+		"path":        "/no-such-route",
+		"status":      float64(http.StatusNotFound),
+		"size":        float64(rr.Body.Len()),
+		"remote_addr": req.RemoteAddr,
+		"request_id":  "abc123",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Errorf("Expected the latency to be logged, got %v", entry)
+	}
+}
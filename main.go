@@ -1,256 +1,1120 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Todo struct {
-	ID   int    `json:"id"`
-	Task string `json:"task"`
-	Done bool   `json:"done"`
+	ID          int        `json:"id"`
+	Task        string     `json:"task"`
+	Description string     `json:"description"`
+	Done        bool       `json:"done"`
+	DueDate     *time.Time `json:"due_date"`
+	RemindAt    *time.Time `json:"remind_at"`
+	Priority    string     `json:"priority"`
+	ListID      *int       `json:"list_id"`
+	ParentID    *int       `json:"parent_id"`
+	Tags        []string   `json:"tags"`
+
+	// AssigneeID is the user working on the todo. It is only changed with
+	// PUT /todos/{id}/assignee and ignored in other request bodies.
+	AssigneeID *int `json:"assignee_id"`
+
+	// CommentCount is how many comments there are under
+	// /todos/{id}/comments. It is ignored in request bodies.
+	CommentCount int `json:"comment_count"`
+
+	// ArchivedAt is when the done todo was archived, which leaves it out of
+	// lists unless they ask for ?archived=true. It is only changed with
+	// the archive endpoints and ignored in other request bodies.
+	ArchivedAt *time.Time `json:"archived_at"`
+
+	// Position orders todos with ?sort=position, for clients that let
+	// users arrange them by hand. New todos go last. It is only changed
+	// with POST /todos/reorder and ignored in other request bodies.
+	Position int `json:"position"`
+
+	// CreatedAt and UpdatedAt are maintained by the database and ignored
+	// in request bodies.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Version goes up with every change to the todo. Updates sending it
+	// fail with errVersionConflict when it isn't current anymore.
+	Version int `json:"version"`
+
+	// Subtasks is only filled in with ?expand=subtasks.
+	Subtasks []Todo `json:"subtasks,omitempty"`
+}
+
+// todoColumns are the todos columns scanTodo reads, in order, followed by
+// the todo's comment count.
+const todoColumns = "id, task, description, done, due_date, remind_at, priority, list_id, parent_id, assignee_id, archived_at, position, created_at, updated_at, version, " + commentCountColumn
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTodo reads the todoColumns of a row into a todo, followed by any
+// extra columns the query selected.
+func scanTodo(row rowScanner, extra ...any) (Todo, error) {
+	var todo Todo
+	var description sql.NullString
+	var dueDate, remindAt, archivedAt sql.NullTime
+	var listID, parentID, assigneeID sql.NullInt64
+	err := row.Scan(append([]any{
+		&todo.ID, &todo.Task, &description, &todo.Done, &dueDate, &remindAt, &todo.Priority, &listID, &parentID, &assigneeID, &archivedAt, &todo.Position, &todo.CreatedAt, &todo.UpdatedAt, &todo.Version, &todo.CommentCount,
+	}, extra...)...)
+	todo.Description = description.String
+	if dueDate.Valid {
+		todo.DueDate = &dueDate.Time
+	}
+	if remindAt.Valid {
+		todo.RemindAt = &remindAt.Time
+	}
+	if listID.Valid {
+		id := int(listID.Int64)
+		todo.ListID = &id
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		todo.ParentID = &id
+	}
+	if assigneeID.Valid {
+		id := int(assigneeID.Int64)
+		todo.AssigneeID = &id
+	}
+	if archivedAt.Valid {
+		todo.ArchivedAt = &archivedAt.Time
+	}
+	return todo, err
 }
 
 var db *sql.DB
 
+// putUpsert makes PUT /todos/{id} create the todo when it doesn't exist
+// instead of returning 404. It is set from PUT_UPSERT.
+var putUpsert bool
+
+// apiPrefix is the path prefix, such as "/api/v1", the API routes are served
+// under. It is set from API_PREFIX and is empty to serve them at the root.
+var apiPrefix string
+
+// ListHandler lists the todos matching parseTodoFilter, in id order unless
+// ?sort= says otherwise, one page of ?limit= todos at a time. Pages are
+// picked with ?offset=, and the response carries the total in X-Total-Count
+// and Link headers to the next and previous pages. Passing ?after_id= switches to keyset pagination:
+// todos with a greater id are returned, with a Link to the next page only.
+// ?cursor= does the same for pages sorted by id or created_at, handing out
+// the opaque cursor of the next page in X-Next-Cursor.
+// Like single todos, pages carry an ETag for conditional requests.
 func ListHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, task, done from todos")
+	if strings.Contains(r.Header.Get("Accept"), csvContentType) {
+		requireSQL(http.HandlerFunc(ExportCSVHandler)).ServeHTTP(w, r)
+		return
+	}
+	jsonAPI, err := wantsJSONAPI(r)
 	if err != nil {
-		slog.Error("Error querying todos", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := parseTodoFields(r, jsonAPI)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	var todos []Todo
+	filter, err := parseTodoFilter(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Limit = limit
+
+	// after_id and cursor switch from offset to keyset pagination, which
+	// stays cheap and stable however deep the client pages.
+	keyset := r.URL.Query().Has("after_id")
+	cursor := r.URL.Query().Has("cursor")
+	if keyset && r.URL.Query().Has("sort") {
+		writeError(w, r, "sort can't be combined with after_id, keyset pages are in id order", http.StatusBadRequest)
+		return
+	}
+	if cursor && (keyset || r.URL.Query().Has("offset")) {
+		writeError(w, r, "cursor can't be combined with after_id or offset", http.StatusBadRequest)
+		return
+	}
 
-	for rows.Next() {
-		var todo Todo
-		err = rows.Scan(&todo.ID, &todo.Task, &todo.Done)
+	if cursor {
+		for _, key := range filter.Sort {
+			if !cursorColumns[key.column] {
+				writeError(w, r, "Invalid sort! Cursor pages can only be sorted by id or created_at", http.StatusBadRequest)
+				return
+			}
+		}
+		// An empty cursor asks for the first page.
+		if v := r.URL.Query().Get("cursor"); v != "" {
+			after, err := parseCursor(v)
+			if err != nil {
+				writeError(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.After = &after
+		}
+		filter.Limit = limit + 1
+	} else if keyset {
+		afterID, err := strconv.Atoi(r.URL.Query().Get("after_id"))
 		if err != nil {
-			slog.Error("Error scanning rows", "error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, r, "Invalid after_id! after_id must be an integer", http.StatusBadRequest)
 			return
 		}
-		todos = append(todos, todo)
+		filter.AfterID = &afterID
+		// Fetch one extra todo to know whether there is a next page.
+		filter.Limit = limit + 1
+	} else if filter.Offset, err = parseOffset(r); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if err = rows.Err(); err != nil {
-		slog.Error("Error iterating rows", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	todos, total, err := todoRepo.List(r.Context(), principalFrom(r.Context()), filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if todos == nil {
+		todos = []Todo{}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(todos)
+	// The URLs of the next and previous pages, by rel.
+	pages := map[string]string{}
+	if cursor {
+		if len(todos) > limit {
+			todos = todos[:limit]
+			next := cursorOf(todos[limit-1]).String()
+			w.Header().Set("X-Next-Cursor", next)
+			pages["next"] = pageLink(r, map[string]string{"cursor": next})
+		}
+	} else if keyset {
+		if len(todos) > limit {
+			todos = todos[:limit]
+			next := strconv.Itoa(todos[limit-1].ID)
+			pages["next"] = pageLink(r, map[string]string{"after_id": next})
+		}
+	} else {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+		offset := filter.Offset
+		if offset+limit < total {
+			pages["next"] = pageLink(r, map[string]string{"offset": strconv.Itoa(offset + limit)})
+		}
+		if offset > 0 {
+			prev := max(offset-limit, 0)
+			pages["prev"] = pageLink(r, map[string]string{"offset": strconv.Itoa(prev)})
+		}
+	}
+	if len(pages) > 0 {
+		var links []string
+		for _, rel := range slices.Sorted(maps.Keys(pages)) {
+			links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pages[rel], rel))
+		}
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	var page any = todos
+	contentType := "application/json"
+	if fields != nil && !jsonAPI {
+		if page, err = selectTodoFields(todos, fields); err != nil {
+			slog.ErrorContext(r.Context(), "Error selecting fields", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if jsonAPI {
+		doc, err := newTodoDocument(r.Context(), todos, false, fields)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error building JSON:API document", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		doc.Links = pages
+		doc.Links["self"] = pageLink(r, nil)
+		if !cursor && !keyset {
+			doc.Meta = map[string]any{"total": total}
+		}
+		page, contentType = doc, jsonAPIContentType
+	}
+
+	body, etag, err := encodeWithETag(page, w.Header().Get("X-Total-Count"), w.Header().Get("Link"))
 	if err != nil {
-		slog.Error("Error encoding JSON", "error", err)
+		slog.ErrorContext(r.Context(), "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+
+	// Polling clients get a 304 until the page or its total changes.
+	w.Header().Set("ETag", etag)
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
 }
 
+// ReadHandler returns a single todo. It also answers HEAD requests, with the
+// same headers but no body, for clients checking whether a todo exists.
 func ReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
 		return
 	}
-	var todo Todo
-	row := db.QueryRow("SELECT id, task, done FROM todos WHERE id = ?", id)
 
-	err = row.Scan(&todo.ID, &todo.Task, &todo.Done)
+	exp, err := parseExpand(r.URL.Query().Get("expand"))
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonAPI, err := wantsJSONAPI(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := parseTodoFields(r, jsonAPI)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	todo, err := todoRepo.Get(ctx, caller, id)
 
-	if err == sql.ErrNoRows {
-		http.Error(w, "Todo not found", http.StatusNotFound)
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
 		return
 	}
 
 	if err != nil {
-		slog.Error("Error querying todo", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error querying todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(todo)
+	todos := []Todo{todo}
+	if err = expandSubtasks(ctx, caller, todos, exp); err != nil {
+		slog.ErrorContext(ctx, "Error loading subtasks", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var resource any = todos[0]
+	contentType := "application/json"
+	if fields != nil && !jsonAPI {
+		selected, err := selectTodoFields(todos, fields)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error selecting fields", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		resource = selected[0]
+	}
+	if jsonAPI {
+		if resource, err = newTodoDocument(ctx, todos, true, fields); err != nil {
+			slog.ErrorContext(ctx, "Error building JSON:API document", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		contentType = jsonAPIContentType
+	}
+
+	body, etag, err := encodeWithETag(resource)
 	if err != nil {
-		slog.Error("Error encoding JSON", "error", err)
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+
+	w.Header().Set("ETag", etag)
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Write(body)
 }
 
 func CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var data Todo
-	err := json.NewDecoder(r.Body).Decode(&data)
+	err := decodeBody(r, &data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, r, err)
 		return
 	}
 
-	if data.Task == "" {
-		http.Error(w, "Task is empty", http.StatusBadRequest)
+	errs := validateTodo(&data)
+	errs = append(errs, checkDueDate(data, nil)...)
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
 		return
 	}
 
-	result, err := db.Exec("INSERT INTO todos (task, done) VALUES (?, ?)", data.Task, data.Done)
+	owner := ownerFrom(ctx)
+	key := r.Header.Get(idempotencyHeader)
+	var hash string
+	if key != "" {
+		if sqlUnavailable(w, r) {
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		hash = requestHash(data)
+		saved, err := findIdempotentResponse(ctx, owner, key, hash)
+		if errors.Is(err, errIdempotencyConflict) {
+			writeErrorCode(w, r, codeIdempotencyReused, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error looking up idempotency key", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if saved != nil {
+			slog.InfoContext(ctx, "Replayed create for idempotency key", "ID", saved.todoID)
+			writeCreated(w, r, saved.todoID, saved.body)
+			return
+		}
+	}
+
+	newTask, err := todoRepo.Create(ctx, principalFrom(ctx), data)
+	if errors.As(err, &errs) {
+		writeValidationErrors(w, r, errs)
+		return
+	}
 	if err != nil {
-		slog.Error("Error inserting todo", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error inserting todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		slog.Error("Error getting last insert ID", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	var body bytes.Buffer
+	if err = json.NewEncoder(&body).Encode(newTask); err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	newTask := Todo{
-		ID:   int(id),
-		Task: data.Task,
-		Done: data.Done,
+	if key != "" {
+		err = saveIdempotentResponse(ctx, db, owner, key, hash, idempotentResponse{todoID: newTask.ID, body: body.Bytes()})
+		if err != nil {
+			// Without its key saved, a retry would create the todo again,
+			// so take it back.
+			if delErr := todoRepo.Delete(ctx, principalFrom(ctx), newTask.ID); delErr != nil {
+				slog.ErrorContext(ctx, "Error removing todo after failed idempotency save", "ID", newTask.ID, "error", delErr)
+			}
+		}
+		if isDuplicateKey(err) {
+			// A concurrent request with the same key won the race.
+			writeErrorCode(w, r, codeIdempotencyInUse, "A request with this Idempotency-Key is already being processed", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error saving idempotency key", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	slog.Info("Added new task", "ID", newTask.ID, "Task", newTask.Task, "Done", newTask.Done)
+	slog.InfoContext(ctx, "Added new task", "ID", newTask.ID, "Task", newTask.Task, "Done", newTask.Done)
 
+	writeCreated(w, r, newTask.ID, body.Bytes())
+}
+
+// writeCreated replies 201 with the encoded todo and its Location.
+func writeCreated(w http.ResponseWriter, r *http.Request, id int, body []byte) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", todoLocation(r.Context(), id))
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newTask)
+	w.Write(body)
+}
+
+// todoLocation returns the URL path of the todo with the given ID, in the
+// API version of the request.
+func todoLocation(ctx context.Context, id int) string {
+	return apiBase(ctx) + "/todos/" + strconv.Itoa(id)
+}
 
+// keepStoredFields copies the fields request bodies don't set from the
+// stored todo to data, which is about to replace it.
+func keepStoredFields(data *Todo, stored Todo) {
+	data.AssigneeID, data.CommentCount = stored.AssigneeID, stored.CommentCount
+	data.ArchivedAt, data.Position = stored.ArchivedAt, stored.Position
 }
 
+// UpdateHandler replaces a todo with the body. With putUpsert set it
+// creates the todo when it doesn't exist.
 func UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
 		return
 	}
 
 	var data Todo
-	err = json.NewDecoder(r.Body).Decode(&data)
+	err = decodeBody(r, &data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, r, err)
 		return
 	}
 
 	if id != data.ID {
-		http.Error(w, "Id in url doesn't match the id in the body", http.StatusConflict)
+		writeErrorCode(w, r, codeIDMismatch, "Id in url doesn't match the id in the body", http.StatusConflict)
 		return
 	}
 
-	result, err := db.Exec("UPDATE todos SET task = ?, done = ? WHERE id = ?", data.Task, data.Done, id)
-	if err != nil {
-		slog.Error("Error updating todo", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if errs := validateTodo(&data); errs != nil {
+		writeValidationErrors(w, r, errs)
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		slog.Error("Error getting rows affected", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	opts := UpdateOptions{Upsert: putUpsert, Cascade: cascadeRequested(r)}
+	todo, created, err := todoRepo.Update(r.Context(), principalFrom(r.Context()), id, func(todo *Todo) error {
+		if err := checkUpdatePreconditions(r, *todo, data.Version); err != nil {
+			return err
+		}
+		if errs := checkDueDate(data, todo.DueDate); errs != nil {
+			return errs
+		}
+		keepStoredFields(&data, *todo)
+		*todo = data
+		return nil
+	}, opts)
+	if writePreconditionError(w, r, err) {
 		return
 	}
-
-	if rowsAffected == 0 {
-		http.Error(w, "Todo not found", http.StatusNotFound)
+	var errs validationErrors
+	if errors.As(err, &errs) {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error updating todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	slog.Info("Updated todo", "ID", data.ID, "Data", data)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		w.Header().Set("Location", todoLocation(r.Context(), id))
+		slog.InfoContext(r.Context(), "Created todo with PUT", "ID", todo.ID, "Data", todo)
+	} else {
+		slog.InfoContext(r.Context(), "Updated todo", "ID", todo.ID, "Data", todo)
+	}
 
+	// The new ETag lets the client make its next change conditional too.
+	body, etag, err := encodeWithETag(todo)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(data)
+	w.WriteHeader(status)
+	w.Write(body)
 }
 
 func DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
 		return
 	}
 
-	result, err := db.Exec("DELETE FROM todos WHERE id = ?", id)
-	if err != nil {
-		slog.Error("Error deleting todo", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	err = todoRepo.Delete(r.Context(), principalFrom(r.Context()), id)
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
 		return
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		slog.Error("Error getting rows affected", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error deleting todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if rowsAffected == 0 {
-		http.Error(w, "Todo not found", http.StatusNotFound)
-		return
+	slog.InfoContext(r.Context(), "Deleted item from todos", "ID", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizePrefix turns "api/v1/" and similar into "/api/v1".
+func normalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
 	}
+	return "/" + prefix
+}
 
-	slog.Info("Deleted item from todos", "ID", id)
+// newRouter registers the API routes under apiPrefix, once for each of the
+// apiVersions. Operational endpoints such as /metrics, the health checks
+// and /admin always stay at the root.
+func newRouter() *mux.Router {
+	router := mux.NewRouter()
 
-	w.WriteHeader(http.StatusNoContent)
+	api := router
+	if apiPrefix != "" {
+		api = router.PathPrefix(apiPrefix).Subrouter()
+	}
+	registerAPIVersions(api)
+
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.HandleFunc("/healthz", LiveHandler).Methods("GET", "HEAD")
+	router.HandleFunc("/livez", LiveHandler).Methods("GET", "HEAD")
+	router.HandleFunc("/readyz", ReadyHandler).Methods("GET", "HEAD")
+	router.Handle("/admin/query-stats", requireAdminKey(http.HandlerFunc(QueryStatsHandler))).Methods("GET")
+	router.Handle("/admin/read-only", requireAdminKey(http.HandlerFunc(ReadOnlyHandler))).Methods("GET", "PUT")
+	router.HandleFunc("/openapi.json", OpenAPIHandler).Methods("GET")
+	router.HandleFunc("/docs", DocsHandler).Methods("GET")
+
+	router.Use(tracingMiddleware, metricsMiddleware, recoverMiddleware, bodyLimitMiddleware)
+	router.NotFoundHandler = notFoundHandler(router)
+	router.MethodNotAllowedHandler = http.HandlerFunc(MethodNotAllowedHandler)
+
+	return router
+}
+
+// v1Routes registers the routes of version 1 of the API on api.
+func v1Routes(api *mux.Router) {
+	api.Handle("/auth/register", requireSQL(http.HandlerFunc(RegisterHandler))).Methods("POST")
+	api.Handle("/auth/login", requireSQL(http.HandlerFunc(LoginHandler))).Methods("POST")
+	api.HandleFunc("/auth/oidc/login", OIDCLoginHandler).Methods("GET")
+	api.HandleFunc("/auth/oidc/callback", OIDCCallbackHandler).Methods("GET")
+
+	// Every other API route acts on behalf of the caller.
+	protected := api.NewRoute().Subrouter()
+	protected.HandleFunc("/todos", ListHandler).Methods("GET")
+	protected.Handle("/todos.csv", requireSQL(http.HandlerFunc(ExportCSVHandler))).Methods("GET")
+	protected.Handle("/todos/export", requireSQL(http.HandlerFunc(ExportHandler))).Methods("GET")
+	protected.Handle("/todos.ics", requireSQL(http.HandlerFunc(ICalendarHandler))).Methods("GET").Name(icsRoute)
+	protected.Handle("/todos/forecast", requireSQL(http.HandlerFunc(ForecastHandler))).Methods("GET")
+	protected.Handle("/todos/focus", requireSQL(http.HandlerFunc(FocusHandler))).Methods("GET")
+	protected.HandleFunc("/todos/ws", TodoEventsWSHandler).Methods("GET")
+	protected.HandleFunc("/todos/events", TodoEventsSSEHandler).Methods("GET")
+	protected.HandleFunc("/todos/{id}", ReadHandler).Methods("GET", "HEAD")
+	protected.HandleFunc("/todos", CreateHandler).Methods("POST")
+	protected.Handle("/todos/import", requireSQL(http.HandlerFunc(ImportCSVHandler))).Methods("POST").Name(csvImportRoute)
+	protected.Handle("/todos/import/{format}", requireSQL(http.HandlerFunc(ImportHandler))).Methods("POST").Name(importRoute)
+	protected.Handle("/todos/complete", requireSQL(http.HandlerFunc(CompleteHandler))).Methods("POST")
+	protected.Handle("/todos/archive", requireSQL(http.HandlerFunc(ArchiveDoneHandler))).Methods("POST")
+	protected.Handle("/todos/reorder", requireSQL(http.HandlerFunc(ReorderHandler))).Methods("POST")
+	protected.Handle("/todos/batch", requireSQL(http.HandlerFunc(BatchCreateHandler))).Methods("POST")
+	protected.Handle("/todos/batch-delete", requireSQL(http.HandlerFunc(BatchDeleteHandler))).Methods("POST")
+	protected.Handle("/todos/batch-update", requireSQL(http.HandlerFunc(BatchUpdateHandler))).Methods("POST")
+	protected.HandleFunc("/todos/{id}", UpdateHandler).Methods("PUT")
+	protected.HandleFunc("/todos/{id}", PatchHandler).Methods("PATCH")
+	protected.Handle("/todos", requireSQL(http.HandlerFunc(BulkDeleteHandler))).Methods("DELETE")
+	protected.HandleFunc("/todos/{id}", DeleteHandler).Methods("DELETE")
+	protected.Handle("/todos/{id}/tags/{tag}", requireSQL(http.HandlerFunc(TodoTagHandler))).Methods("PUT", "DELETE")
+	protected.Handle("/todos/{id}/assignee", requireSQL(http.HandlerFunc(AssignHandler))).Methods("PUT")
+	protected.Handle("/todos/{id}/assignee", requireSQL(http.HandlerFunc(UnassignHandler))).Methods("DELETE")
+	protected.HandleFunc("/todos/{id}/archive", ArchiveHandler).Methods("POST")
+	protected.HandleFunc("/todos/{id}/unarchive", UnarchiveHandler).Methods("POST")
+	protected.HandleFunc("/todos/{id}/subtasks", SubtasksHandler).Methods("GET")
+	protected.Handle("/todos/{id}/history", requireSQL(http.HandlerFunc(TodoHistoryHandler))).Methods("GET")
+	protected.Handle("/todos/{id}/undo", requireSQL(http.HandlerFunc(UndoHandler))).Methods("POST")
+	protected.Handle("/todos/{id}/clone", requireSQL(http.HandlerFunc(CloneHandler))).Methods("POST")
+	protected.Handle("/todos/{id}/comments", requireSQL(http.HandlerFunc(ListCommentsHandler))).Methods("GET")
+	protected.Handle("/todos/{id}/comments", requireSQL(http.HandlerFunc(CreateCommentHandler))).Methods("POST")
+	protected.Handle("/todos/{id}/comments/{comment_id}", requireSQL(http.HandlerFunc(ReadCommentHandler))).Methods("GET")
+	protected.Handle("/todos/{id}/comments/{comment_id}", requireSQL(http.HandlerFunc(UpdateCommentHandler))).Methods("PUT")
+	protected.Handle("/todos/{id}/comments/{comment_id}", requireSQL(http.HandlerFunc(DeleteCommentHandler))).Methods("DELETE")
+	protected.Handle("/tags", requireSQL(http.HandlerFunc(TagsHandler))).Methods("GET")
+	protected.Handle("/lists", requireSQL(http.HandlerFunc(ListListsHandler))).Methods("GET")
+	protected.Handle("/lists", requireSQL(http.HandlerFunc(CreateListHandler))).Methods("POST")
+	protected.Handle("/lists/{id}", requireSQL(http.HandlerFunc(ReadListHandler))).Methods("GET")
+	protected.Handle("/lists/{id}", requireSQL(http.HandlerFunc(UpdateListHandler))).Methods("PUT")
+	protected.Handle("/lists/{id}", requireSQL(http.HandlerFunc(DeleteListHandler))).Methods("DELETE")
+	protected.Handle("/lists/{list_id}/todos", requireSQL(http.HandlerFunc(ListTodosHandler))).Methods("GET")
+	protected.Handle("/lists/{id}/members", requireSQL(http.HandlerFunc(ListMembersHandler))).Methods("GET")
+	protected.Handle("/lists/{id}/members/{username}", requireSQL(http.HandlerFunc(PutMemberHandler))).Methods("PUT")
+	protected.Handle("/lists/{id}/members/{username}", requireSQL(http.HandlerFunc(DeleteMemberHandler))).Methods("DELETE")
+	protected.Handle("/webhooks", requireSQL(http.HandlerFunc(ListWebhooksHandler))).Methods("GET")
+	protected.Handle("/webhooks", requireSQL(http.HandlerFunc(CreateWebhookHandler))).Methods("POST")
+	protected.Handle("/webhooks/{id}", requireSQL(http.HandlerFunc(ReadWebhookHandler))).Methods("GET")
+	protected.Handle("/webhooks/{id}", requireSQL(http.HandlerFunc(UpdateWebhookHandler))).Methods("PUT")
+	protected.Handle("/webhooks/{id}", requireSQL(http.HandlerFunc(DeleteWebhookHandler))).Methods("DELETE")
+	protected.Handle("/webhooks/{id}/deliveries", requireSQL(http.HandlerFunc(ListWebhookDeliveriesHandler))).Methods("GET")
+	protected.Handle("/templates", requireSQL(http.HandlerFunc(ListTemplatesHandler))).Methods("GET")
+	protected.Handle("/templates", requireSQL(http.HandlerFunc(CreateTemplateHandler))).Methods("POST")
+	protected.Handle("/templates/{id}", requireSQL(http.HandlerFunc(ReadTemplateHandler))).Methods("GET")
+	protected.Handle("/templates/{id}", requireSQL(http.HandlerFunc(UpdateTemplateHandler))).Methods("PUT")
+	protected.Handle("/templates/{id}", requireSQL(http.HandlerFunc(DeleteTemplateHandler))).Methods("DELETE")
+	protected.Handle("/templates/{id}/instantiate", requireSQL(http.HandlerFunc(InstantiateTemplateHandler))).Methods("POST")
+	protected.Handle("/apikeys", requireSQL(http.HandlerFunc(ListAPIKeysHandler))).Methods("GET")
+	protected.Handle("/apikeys", requireSQL(http.HandlerFunc(CreateAPIKeyHandler))).Methods("POST")
+	protected.Handle("/apikeys/{id}", requireSQL(http.HandlerFunc(DeleteAPIKeyHandler))).Methods("DELETE")
+	protected.Handle("/stats", requireSQL(http.HandlerFunc(StatsHandler))).Methods("GET")
+	protected.Handle("/audit", requireSQL(requireAdmin(http.HandlerFunc(AuditHandler)))).Methods("GET")
+	protected.Handle("/users", requireSQL(requireAdmin(http.HandlerFunc(ListUsersHandler)))).Methods("GET")
+	protected.Handle("/users/me/notifications", requireSQL(http.HandlerFunc(ReadNotificationSettingsHandler))).Methods("GET")
+	protected.Handle("/users/me/notifications", requireSQL(http.HandlerFunc(UpdateNotificationSettingsHandler))).Methods("PUT")
+	protected.Handle("/users/{id}", requireSQL(requireAdmin(http.HandlerFunc(UpdateUserHandler)))).Methods("PATCH")
+	protected.Handle("/users/{id}", requireSQL(requireAdmin(http.HandlerFunc(DeleteUserHandler)))).Methods("DELETE")
+	protected.Use(identityMiddleware, roleMiddleware, readOnlyMiddleware)
+
+	// GraphQL queries are POSTed like its mutations, so the resolvers check
+	// roles and read-only mode themselves.
+	graph := api.NewRoute().Subrouter()
+	graph.HandleFunc("/graphql", GraphQLHandler).Methods("POST")
+	graph.Use(identityMiddleware)
 }
 
 func main() {
-	connectionStr := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASS"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
+	var args []string
 	var err error
-	db, err = sql.Open("mysql", connectionStr)
+	conf, args, err = loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		slog.Error("Failed to connect to DB", "error", err)
+		slog.Error("Invalid configuration", "error", err)
 		os.Exit(1)
 	}
-	defer db.Close()
 
-	if err = db.Ping(); err != nil {
-		slog.Error("Failed to ping DB", "error", err)
+	handler, warnings := newLogHandler(conf.get("LOG_FORMAT"), conf.get("LOG_LEVEL"), os.Stderr)
+	slog.SetDefault(slog.New(handler))
+	for _, warning := range warnings {
+		slog.Warn(warning)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := migrateCommand(args[1:]); err != nil {
+			slog.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	conf.logSummary()
+
+	enforcedBusinessHours, err = loadBusinessHours()
+	if err != nil {
+		slog.Error("Invalid business hours configuration", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("DB connected")
+	if enforcedBusinessHours != nil {
+		slog.Info("Enforcing business hours on due dates")
+	}
 
-	createTable := `
-CREATE TABLE IF NOT EXISTS todos (
-    id INT AUTO_INCREMENT PRIMARY KEY,
-    task VARCHAR(255) NOT NULL,
-    done BOOLEAN DEFAULT FALSE
-)
-`
-	_, err = db.Exec(createTable)
+	alwaysProblemJSON = conf.get("ERROR_FORMAT") == "problem+json"
+
+	if v := conf.get("EVENT_COALESCE_WINDOW"); v != "" {
+		eventCoalesceWindow, err = time.ParseDuration(v)
+		if err != nil {
+			slog.Error("Invalid EVENT_COALESCE_WINDOW", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	reminderSinks, err = parseReminderSinks(conf.get("REMINDER_SINKS"))
+	if err != nil {
+		slog.Error("Invalid REMINDER_SINKS", "error", err)
+		os.Exit(1)
+	}
+
+	emailSettings, err = loadEmailConfig()
+	if err != nil {
+		slog.Error("Invalid email configuration", "error", err)
+		os.Exit(1)
+	}
+	if emailSettings.host == "" && slices.Contains(reminderSinks, reminderSink(emailReminderSink{})) {
+		slog.Error("Invalid REMINDER_SINKS", "error", "the email sink needs SMTP_HOST")
+		os.Exit(1)
+	}
+
+	putUpsert, _ = strconv.ParseBool(conf.get("PUT_UPSERT"))
+	requireIfMatch, _ = strconv.ParseBool(conf.get("REQUIRE_IF_MATCH"))
+	allowPrivateWebhooks, _ = strconv.ParseBool(conf.get("WEBHOOK_ALLOW_PRIVATE"))
+	undoWindow, _ = time.ParseDuration(conf.get("UNDO_WINDOW"))
+
+	startReadOnly, _ := strconv.ParseBool(conf.get("READ_ONLY"))
+	readOnly.Store(startReadOnly)
+	slog.Info("Read-only mode", "enabled", startReadOnly)
+
+	adminAPIKey = conf.get("ADMIN_API_KEY")
+	if adminAPIKey == "" {
+		slog.Info("ADMIN_API_KEY not set, admin endpoints are disabled")
+	}
+
+	switch authMode := conf.get("AUTH_MODE"); authMode {
+	case "jwt":
+		if conf.get("DB_DRIVER") == "memory" {
+			slog.Error("AUTH_MODE=jwt needs a database for its users, use AUTH_MODE=proxy with DB_DRIVER=memory")
+			os.Exit(1)
+		}
+		jwtSecret = []byte(conf.get("JWT_SECRET"))
+		if len(jwtSecret) < minJWTSecretLength {
+			slog.Error("JWT_SECRET must be set to at least 32 bytes", "length", len(jwtSecret))
+			os.Exit(1)
+		}
+		if v := conf.get("JWT_TTL"); v != "" {
+			tokenTTL, err = time.ParseDuration(v)
+			if err != nil || tokenTTL <= 0 {
+				slog.Error("Invalid JWT_TTL", "value", v)
+				os.Exit(1)
+			}
+		}
+		if issuer := conf.get("OIDC_ISSUER_URL"); issuer != "" {
+			oidcLogin, err = newOIDCConfig(context.Background(), issuer, conf.get("OIDC_CLIENT_ID"), conf.get("OIDC_CLIENT_SECRET"), conf.get("OIDC_REDIRECT_URL"))
+			if err != nil {
+				slog.Error("Failed to set up OIDC login", "error", err)
+				os.Exit(1)
+			}
+			slog.Info("OIDC login enabled", "issuer", issuer)
+		}
+	case "proxy":
+		slog.Warn("Trusting the X-Owner header to identify callers, make sure a proxy sets it")
+	default:
+		slog.Error("Invalid AUTH_MODE, expected jwt or proxy", "value", authMode)
+		os.Exit(1)
+	}
+
+	cors, err = loadCORSPolicy()
 	if err != nil {
-		slog.Error("Failed creating table", "error", err)
+		slog.Error("Invalid CORS configuration", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("Table created or already exists")
+
+	apiPrefix = normalizePrefix(conf.get("API_PREFIX"))
+	if apiPrefix != "" {
+		slog.Info("Serving API under prefix", "prefix", apiPrefix)
+	}
+
+	if conf.get("DB_DRIVER") == "memory" {
+		todoRepo = publishingRepository{newMemoryTodoRepository(), todoEvents}
+		slog.Warn("Keeping todos in memory, they are lost on restart")
+	} else {
+		db, err = openDB()
+		if err != nil {
+			slog.Error("Failed to set up the database", "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		repo := newSQLTodoRepository(db)
+		// Deferred after db.Close, so it runs first.
+		defer repo.Close()
+		todoRepo = publishingRepository{repo, todoEvents}
+	}
+	registerStoreMetrics(todoRepo, db)
+
+	if v := conf.get("SHUTDOWN_TIMEOUT"); v != "" {
+		shutdownTimeout, err = time.ParseDuration(v)
+		if err != nil || shutdownTimeout <= 0 {
+			slog.Error("Invalid SHUTDOWN_TIMEOUT", "value", v)
+			os.Exit(1)
+		}
+	}
+	for name, dst := range map[string]*time.Duration{
+		"READ_TIMEOUT":        &serverTimeouts.read,
+		"READ_HEADER_TIMEOUT": &serverTimeouts.readHeader,
+		"WRITE_TIMEOUT":       &serverTimeouts.write,
+		"IDLE_TIMEOUT":        &serverTimeouts.idle,
+		"DB_QUERY_TIMEOUT":    &queryTimeout,
+	} {
+		*dst, _ = time.ParseDuration(conf.get(name))
+	}
+	for name, dst := range map[string]*int64{
+		"MAX_BODY_BYTES":   &maxBodyBytes,
+		"MAX_IMPORT_BYTES": &maxImportBytes,
+	} {
+		*dst, err = strconv.ParseInt(conf.get(name), 10, 64)
+		if err != nil || *dst <= 0 {
+			slog.Error("Invalid "+name, "value", conf.get(name))
+			os.Exit(1)
+		}
+	}
+	for name, dst := range map[string]*int{
+		"MAX_TASK_LENGTH": &maxTaskLength,
+		"MAX_BATCH_SIZE":  &maxBatchSize,
+	} {
+		*dst, err = strconv.Atoi(conf.get(name))
+		if err != nil || *dst <= 0 {
+			slog.Error("Invalid "+name, "value", conf.get(name))
+			os.Exit(1)
+		}
+	}
+	if maxTaskLength > taskColumnLength {
+		slog.Error(fmt.Sprintf("Invalid MAX_TASK_LENGTH, tasks are stored in at most %d characters", taskColumnLength), "value", maxTaskLength)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("Error flushing spans", "error", err)
+		}
+	}()
 
 	fmt.Println("starting server")
-	router := mux.NewRouter()
+	router := newRouter()
 
-	router.HandleFunc("/todos", ListHandler).Methods("GET")
-	router.HandleFunc("/todos/{id}", ReadHandler).Methods("GET")
-	router.HandleFunc("/todos", CreateHandler).Methods("POST")
-	router.HandleFunc("/todos/{id}", UpdateHandler).Methods("PUT")
-	router.HandleFunc("/todos/{id}", DeleteHandler).Methods("DELETE")
+	tlsConfig, redirectHandler, err := loadTLSConfig()
+	if err != nil {
+		slog.Error("Invalid TLS configuration", "error", err)
+		os.Exit(1)
+	}
+	redirectPort := conf.get("HTTP_REDIRECT_PORT")
+	if redirectPort != "" && tlsConfig == nil {
+		slog.Error("HTTP_REDIRECT_PORT needs TLS to redirect to")
+		os.Exit(1)
+	}
 
-	if err = http.ListenAndServe(":5555", router); err != nil {
+	listener, err := net.Listen("tcp", ":"+conf.get("PORT"))
+	if err != nil {
 		slog.Error("Server failed to start", "error", err)
 		os.Exit(1)
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if redirectPort != "" {
+		redirectListener, err := net.Listen("tcp", ":"+redirectPort)
+		if err != nil {
+			slog.Error("Server failed to start", "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			if err := runServer(ctx, redirectListener, redirectHandler, shutdownTimeout, nil); err != nil {
+				slog.Error("HTTP redirect server failed", "error", err)
+			}
+		}()
+		slog.Info("Redirecting plain HTTP to HTTPS", "port", redirectPort)
+	}
+	if db != nil {
+		go runWebhooks(ctx, todoEvents)
+		go runReminders(ctx)
+		if emailSettings.host != "" {
+			go runEmailNotifications(ctx)
+		}
+	}
+	var grpcStopped sync.WaitGroup
+	if grpcPort := conf.get("GRPC_PORT"); grpcPort != "" {
+		grpcListener, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			slog.Error("gRPC server failed to start", "error", err)
+			os.Exit(1)
+		}
+		grpcStopped.Add(1)
+		go func() {
+			defer grpcStopped.Done()
+			if err := runGRPCServer(ctx, grpcListener, newGRPCServer(tlsConfig), shutdownTimeout); err != nil {
+				slog.Error("gRPC server failed", "error", err)
+			}
+		}()
+		slog.Info("Serving gRPC", "port", grpcPort, "tls", tlsConfig != nil)
+	}
+	slog.Info("Listening", "port", conf.get("PORT"), "tls", tlsConfig != nil)
+	if err = runServer(ctx, listener, requestIDMiddleware(loggingMiddleware(corsMiddleware(compressMiddleware(router)))), shutdownTimeout, tlsConfig); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+	grpcStopped.Wait()
+}
+
+// openDB connects to the database configured by DB_DRIVER and the other
+// DB_* variables, and brings its schema up to date unless AUTO_MIGRATE is
+// false, in which case it must already be.
+func openDB() (*sql.DB, error) {
+	conn, err := connectDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if autoMigrate, err := strconv.ParseBool(conf.get("AUTO_MIGRATE")); err != nil || autoMigrate {
+		err = migrate(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("migrating schema: %w", err)
+		}
+		return conn, nil
+	}
+
+	pending, err := pendingMigrations(conn)
+	if err == nil && len(pending) > 0 {
+		err = fmt.Errorf("%d migrations are pending, run the migrate command first", len(pending))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connectDB connects to the database configured by DB_DRIVER and the other
+// DB_* variables.
+func connectDB() (*sql.DB, error) {
+	var err error
+	dbDialect, err = parseDialect(conf.get("DB_DRIVER"))
+	if err != nil {
+		return nil, err
+	}
+
+	var connectionStr string
+	switch dbDialect {
+	case postgresDialect:
+		connectionStr, err = buildPostgresDSN()
+	case sqliteDialect:
+		connectionStr = buildSQLiteDSN()
+	default:
+		connectionStr, err = buildDSN()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := loadDBPool()
+	if err != nil {
+		return nil, err
+	}
+	retries, err := strconv.Atoi(conf.get("DB_CONNECT_RETRIES"))
+	if err != nil || retries < 0 {
+		return nil, fmt.Errorf("invalid DB_CONNECT_RETRIES %q, expected a number of retries", conf.get("DB_CONNECT_RETRIES"))
+	}
+	backoff, err := time.ParseDuration(conf.get("DB_CONNECT_BACKOFF"))
+	if err != nil || backoff <= 0 {
+		return nil, fmt.Errorf("invalid DB_CONNECT_BACKOFF %q, expected a duration", conf.get("DB_CONNECT_BACKOFF"))
+	}
+
+	conn, err := dbDialect.open(connectionStr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting: %w", err)
+	}
+	pool.apply(conn)
+	// The database may still be starting, as when started alongside the
+	// server by docker compose or Kubernetes.
+	err = retryWithBackoff(retries, backoff, func() error {
+		err := conn.Ping()
+		if err != nil {
+			slog.Warn("Database isn't reachable yet", "error", err)
+		}
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("pinging: %w", err)
+	}
+	slog.Info("DB connected", "driver", dbDialect, "max_open_conns", pool.maxOpen, "max_idle_conns", pool.maxIdle, "conn_max_lifetime", pool.maxLifetime)
+	return conn, nil
+}
+
+// maxConnectBackoff caps the wait between attempts to connect to the
+// database.
+const maxConnectBackoff = 30 * time.Second
+
+// retryWithBackoff calls try until it succeeds, at most retries more times
+// after the first, and returns its last error. It waits backoff before the
+// first retry and twice as long before each one after it, up to
+// maxConnectBackoff. The waits are jittered by up to half, so instances
+// started together don't retry in lockstep.
+func retryWithBackoff(retries int, backoff time.Duration, try func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := try()
+		if err == nil || attempt == retries {
+			return err
+		}
+		wait := backoff/2 + rand.N(backoff/2+1)
+		slog.Info("Retrying", "attempt", attempt+2, "of", retries+1, "in", wait)
+		time.Sleep(wait)
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+}
+
+// dbPool holds the connection pool settings. Without limits, database/sql
+// opens a connection for every concurrent query, which can use up all the
+// connections a MySQL server allows under load.
+type dbPool struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+}
+
+// loadDBPool reads DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and
+// DB_CONN_MAX_LIFETIME.
+func loadDBPool() (dbPool, error) {
+	var pool dbPool
+	for name, dst := range map[string]*int{
+		"DB_MAX_OPEN_CONNS": &pool.maxOpen,
+		"DB_MAX_IDLE_CONNS": &pool.maxIdle,
+	} {
+		v, err := strconv.Atoi(conf.get(name))
+		if err != nil || v < 0 {
+			return pool, fmt.Errorf("invalid %s %q, expected a number of connections", name, conf.get(name))
+		}
+		*dst = v
+	}
+	lifetime, err := time.ParseDuration(conf.get("DB_CONN_MAX_LIFETIME"))
+	if err != nil || lifetime < 0 {
+		return pool, fmt.Errorf("invalid DB_CONN_MAX_LIFETIME %q, expected a duration", conf.get("DB_CONN_MAX_LIFETIME"))
+	}
+	pool.maxLifetime = lifetime
+	return pool, nil
+}
+
+// apply sets the pool limits of db. Idle connections are capped to the
+// open ones.
+func (p dbPool) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.maxOpen)
+	db.SetMaxIdleConns(p.maxIdle)
+	db.SetConnMaxLifetime(p.maxLifetime)
 }
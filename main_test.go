@@ -1,13 +1,13 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -32,8 +32,19 @@ func TestMain(m *testing.M) {
 
 func setupTestDB() {
 	var err error
-	// Connect to TEST database
-	db, err = sql.Open("mysql", "root:mypassword@tcp(127.0.0.1:3306)/todo_db_test")
+	// Connect to TEST database. TEST_DB_DRIVER=sqlite runs the tests on a
+	// fresh SQLite file instead, without a MySQL server.
+	if os.Getenv("TEST_DB_DRIVER") == "sqlite" {
+		dir, err := os.MkdirTemp("", "todo-test")
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Setenv("DB_PATH", filepath.Join(dir, "todo_test.db"))
+		dbDialect = sqliteDialect
+		db, err = dbDialect.open(buildSQLiteDSN())
+	} else {
+		db, err = dbDialect.open("root:mypassword@tcp(127.0.0.1:3306)/todo_db_test")
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -42,18 +53,12 @@ func setupTestDB() {
 		log.Fatal(err)
 	}
 
-	// Create table
-	createTable := `
-    CREATE TABLE IF NOT EXISTS todos (
-        id INT AUTO_INCREMENT PRIMARY KEY,
-        task VARCHAR(255) NOT NULL,
-        done BOOLEAN DEFAULT FALSE
-    )
-    `
-	_, err = db.Exec(createTable)
-	if err != nil {
+	// Apply schema migrations
+	if err = migrate(db); err != nil {
 		log.Fatal(err)
 	}
+
+	todoRepo = publishingRepository{newSQLTodoRepository(db), todoEvents}
 }
 
 func clearTodos(t *testing.T) {
@@ -75,13 +80,7 @@ func seedTodo(t *testing.T, task string, done bool) int {
 }
 
 func setupRouter() *mux.Router {
-	router := mux.NewRouter()
-	router.HandleFunc("/todos", ListHandler).Methods("GET")
-	router.HandleFunc("/todos/{id}", ReadHandler).Methods("GET")
-	router.HandleFunc("/todos", CreateHandler).Methods("POST")
-	router.HandleFunc("/todos/{id}", UpdateHandler).Methods("PUT")
-	router.HandleFunc("/todos/{id}", DeleteHandler).Methods("DELETE")
-	return router
+	return newRouter()
 }
 
 func TestListHandler(t *testing.T) {
@@ -125,6 +124,63 @@ func TestListHandler(t *testing.T) {
 
 }
 
+func TestListHandlerFilters(t *testing.T) {
+	clearTodos(t)
+
+	seedTodo(t, "buy groceries", false)
+	seedTodo(t, "groceries list", true)
+	seedTodo(t, "100% done", false)
+	dog := seedTodo(t, "walk the dog", false)
+	if _, err := db.Exec("UPDATE todos SET description = ? WHERE id = ?", "Take the long leash", dog); err != nil {
+		t.Fatalf("Failed to set description: %v", err)
+	}
+
+	router := setupRouter()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?done=true", []string{"groceries list"}},
+		{"?q=groceries", []string{"buy groceries", "groceries list"}},
+		{"?done=false&q=GROCERIES", []string{"buy groceries"}},
+		{"?q=%25", []string{"100% done"}},
+		{"?q=Leash", []string{"walk the dog"}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/todos"+tt.query, nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.query, status)
+		}
+
+		var todos []Todo
+		if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", tt.query, err)
+		}
+		var got []string
+		for _, todo := range todos {
+			got = append(got, todo.Task)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.want, got)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/todos?done=maybe", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid done, got %d", status)
+	}
+}
+
 func TestReadHandler(t *testing.T) {
 	clearTodos(t)
 	id := seedTodo(t, "some task", false)
@@ -197,7 +253,7 @@ func TestUpdateHandler(t *testing.T) {
 
 	router := setupRouter()
 
-	body := strings.NewReader(fmt.Sprintf(`{"id": %d,"task":"New task","done":false}`, id))
+	body := strings.NewReader(fmt.Sprintf(`{"id": %d,"task":"New task","done":false,"version":1}`, id))
 	req := httptest.NewRequest("PUT", "/todos/"+strconv.Itoa(id), body)
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
@@ -248,3 +304,243 @@ func TestDeleteHandler(t *testing.T) {
 		t.Errorf("Expected todo to be deleted, but it still exists")
 	}
 }
+
+func TestAPIPrefix(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	apiPrefix = normalizePrefix("api/v1/")
+	t.Cleanup(func() { apiPrefix = "" })
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/api/v1/todos/"+strconv.Itoa(id), nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status 200 under prefix, got %d", status)
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if todo.ID != id {
+		t.Errorf("Expected id %d, got %d", id, todo.ID)
+	}
+
+	req = httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id), nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status 404 without prefix, got %d", status)
+	}
+}
+
+func TestCreateHandlerTrimsTask(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	body := strings.NewReader(`{"task":"   ","done":false}`)
+	req := httptest.NewRequest("POST", "/todos", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a blank task, got %d", status)
+	}
+
+	body = strings.NewReader(`{"task":"  Padded task \n","done":false}`)
+	req = httptest.NewRequest("POST", "/todos", body)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	var created Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	var stored string
+	if err := db.QueryRow("SELECT task FROM todos WHERE id = ?", created.ID).Scan(&stored); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if stored != "Padded task" {
+		t.Errorf("Expected stored task 'Padded task', got %q", stored)
+	}
+}
+
+func TestTodoDescription(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+
+	body := strings.NewReader(`{"task":"Plan trip","description":"  Book the train\nand the hotel  "}`)
+	req := httptest.NewRequest("POST", "/todos", body)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", status, rr.Body.String())
+	}
+	var created Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if created.Description != "Book the train\nand the hotel" {
+		t.Errorf("Expected the trimmed description, got %q", created.Description)
+	}
+
+	path := "/todos/" + strconv.Itoa(created.ID)
+	req = httptest.NewRequest("PATCH", path, strings.NewReader(`{"done":true,"version":`+strconv.Itoa(created.Version)+`}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var patched Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &patched); err != nil || patched.Description != created.Description {
+		t.Errorf("Expected a PATCH without description to keep it, got %q", patched.Description)
+	}
+
+	req = httptest.NewRequest("PATCH", path, strings.NewReader(`{"description":"`+strings.Repeat("a", maxDescriptionLength+1)+`","version":`+strconv.Itoa(patched.Version)+`}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a long description, got %d", status)
+	}
+
+	req = httptest.NewRequest("PATCH", path, strings.NewReader(`{"description":"","version":`+strconv.Itoa(patched.Version)+`}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if err := json.Unmarshal(rr.Body.Bytes(), &patched); err != nil || patched.Description != "" {
+		t.Errorf("Expected the description cleared, got %q", patched.Description)
+	}
+}
+
+func TestUpdateHandlerRejectsBlankTask(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	router := setupRouter()
+
+	body := strings.NewReader(fmt.Sprintf(`{"id": %d,"task":"  ","done":false}`, id))
+	req := httptest.NewRequest("PUT", "/todos/"+strconv.Itoa(id), body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", status)
+	}
+}
+
+func TestUpdateHandlerUpsert(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	putUpsert = true
+	t.Cleanup(func() { putUpsert = false })
+
+	router := setupRouter()
+
+	newID := id + 100
+	body := strings.NewReader(fmt.Sprintf(`{"id": %d,"task":"Upserted task","done":true}`, newID))
+	req := httptest.NewRequest("PUT", "/todos/"+strconv.Itoa(newID), body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("Expected status 201 for a new id, got %d", status)
+	}
+
+	var task string
+	if err := db.QueryRow("SELECT task FROM todos WHERE id = ?", newID).Scan(&task); err != nil {
+		t.Fatalf("Expected upserted todo to exist: %v", err)
+	}
+
+	body = strings.NewReader(fmt.Sprintf(`{"id": %d,"task":"Changed task","done":false,"version":1}`, id))
+	req = httptest.NewRequest("PUT", "/todos/"+strconv.Itoa(id), body)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status 200 for an existing id, got %d", status)
+	}
+	if err := db.QueryRow("SELECT task FROM todos WHERE id = ?", id).Scan(&task); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if task != "Changed task" {
+		t.Errorf("Expected task 'Changed task', got %q", task)
+	}
+}
+
+func TestCreateHandlerLocation(t *testing.T) {
+	clearTodos(t)
+
+	apiPrefix = "/api/v1"
+	t.Cleanup(func() { apiPrefix = "" })
+
+	router := setupRouter()
+
+	body := strings.NewReader(`{"task":"New task","done":false}`)
+	req := httptest.NewRequest("POST", "/api/v1/todos", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	var created Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	want := "/api/v1/todos/" + strconv.Itoa(created.ID)
+	if location := rr.Header().Get("Location"); location != want {
+		t.Errorf("Expected Location %s, got %s", want, location)
+	}
+}
+
+func TestHeadTodo(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("HEAD", "/todos/"+strconv.Itoa(id), nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected no body, got %q", rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", contentType)
+	}
+	if rr.Header().Get("ETag") == "" {
+		t.Errorf("Expected an ETag header")
+	}
+
+	req = httptest.NewRequest("HEAD", "/todos/999999", nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ListMember is a user a list is shared with.
+type ListMember struct {
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+}
+
+var errUserNotFound = errors.New("user not found")
+
+// listMemberVars parses the {id} and {username} route variables, answering
+// 400 and returning false when the id isn't a number.
+func listMemberVars(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return 0, "", false
+	}
+	return id, strings.ToLower(vars["username"]), true
+}
+
+// ListMembersHandler lists who a list is shared with.
+func ListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+	if _, err = findList(ctx, db, principalFrom(ctx), id); err != nil {
+		writeListError(w, r, err)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT u.id, u.username, m.permission
+FROM list_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.list_id = ?
+ORDER BY u.username`, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error querying list members", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	members := []ListMember{}
+	for rows.Next() {
+		var member ListMember
+		if err = rows.Scan(&member.UserID, &member.Username, &member.Permission); err != nil {
+			slog.ErrorContext(ctx, "Error scanning list member", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "Error iterating list members", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// PutMemberHandler shares a list with the user named {username}, or changes
+// what they may do with it, given {"permission": "read"} or "write".
+func PutMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !requireUser(w, r) {
+		return
+	}
+	id, username, ok := listMemberVars(w, r)
+	if !ok {
+		return
+	}
+
+	var data ListMember
+	if err := decodeBody(r, &data); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if data.Permission != readPermission && data.Permission != writePermission {
+		var errs validationErrors
+		errs.add("permission", "must be %s or %s", readPermission, writePermission)
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	member := ListMember{Username: username, Permission: data.Permission}
+	created := false
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		list, err := findOwnList(ctx, tx, principalFrom(ctx), id)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", username).Scan(&member.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if list.userID == member.UserID {
+			var errs validationErrors
+			errs.add("username", "owns the list")
+			return errs
+		}
+
+		result, err := tx.ExecContext(ctx, "UPDATE list_members SET permission = ? WHERE list_id = ? AND user_id = ?", member.Permission, id, member.UserID)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil || updated > 0 {
+			return err
+		}
+		created = true
+		_, err = tx.ExecContext(ctx, "INSERT INTO list_members (list_id, user_id, permission) VALUES (?, ?, ?)", id, member.UserID, member.Permission)
+		return err
+	})
+	var errs validationErrors
+	switch {
+	case errors.As(err, &errs):
+		writeValidationErrors(w, r, errs)
+		return
+	case errors.Is(err, errUserNotFound):
+		writeErrorCode(w, r, codeUserNotFound, "User not found", http.StatusNotFound)
+		return
+	case err != nil:
+		writeListError(w, r, err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Shared list", "ID", id, "username", username, "permission", member.Permission)
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(member)
+}
+
+// DeleteMemberHandler stops sharing a list with the user named {username}.
+// Besides the owner, members can remove themselves.
+func DeleteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !requireUser(w, r) {
+		return
+	}
+	id, username, ok := listMemberVars(w, r)
+	if !ok {
+		return
+	}
+	caller := principalFrom(ctx)
+
+	var removed int64
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		find := findOwnList
+		if username == caller.owner {
+			find = findList
+		}
+		if _, err := find(ctx, tx, caller, id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM list_members WHERE list_id = ? AND user_id IN (SELECT id FROM users WHERE username = ?)", id, username)
+		if err != nil {
+			return err
+		}
+		removed, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		writeListError(w, r, err)
+		return
+	}
+	if removed == 0 {
+		writeErrorCode(w, r, codeMemberNotFound, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	slog.InfoContext(ctx, "Unshared list", "ID", id, "username", username)
+	w.WriteHeader(http.StatusNoContent)
+}
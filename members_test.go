@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestSharedLists(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	carol := seedUser(t, "carol", editorRole)
+
+	rr := requestAs(router, alice, "POST", "/lists", `{"name": "Groceries"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	listPath := "/lists/" + strconv.Itoa(list.ID)
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Buy milk", "list_id": `+strconv.Itoa(list.ID)+`}`)
+	var milk Todo
+	json.Unmarshal(rr.Body.Bytes(), &milk)
+	milkPath := "/todos/" + strconv.Itoa(milk.ID)
+
+	if rr = requestAs(router, bob, "PUT", listPath+"/members/bob", `{"permission": "write"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 sharing someone else's list, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "PUT", listPath+"/members/nobody", `{"permission": "read"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 sharing with an unknown user, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "PUT", listPath+"/members/bob", `{"permission": "admin"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown permission, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "PUT", listPath+"/members/Bob", `{"permission": "read"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 sharing the list, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if todos := getTodosAs(t, router, bob); len(todos) != 1 || todos[0].ID != milk.ID {
+		t.Errorf("Expected bob to see the shared todo, got %+v", todos)
+	}
+	if todos := getTodosAs(t, router, carol); len(todos) != 0 {
+		t.Errorf("Expected carol to see nothing, got %+v", todos)
+	}
+	rr = requestAs(router, bob, "GET", "/lists", "")
+	var lists []List
+	json.Unmarshal(rr.Body.Bytes(), &lists)
+	if len(lists) != 1 || lists[0].Permission != readPermission {
+		t.Errorf("Expected the list shared read-only with bob, got %+v", lists)
+	}
+	if rr = requestAs(router, bob, "PATCH", milkPath, `{"done": true, "version": `+strconv.Itoa(milk.Version)+`}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 changing a read-only todo, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "POST", "/todos", `{"task": "Buy eggs", "list_id": `+strconv.Itoa(list.ID)+`}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 adding to a read-only list, got %d", rr.Code)
+	}
+
+	if rr = requestAs(router, alice, "PUT", listPath+"/members/bob", `{"permission": "write"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 changing the permission, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "PATCH", milkPath, `{"done": true, "version": `+strconv.Itoa(milk.Version)+`}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 changing a shared todo, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "POST", "/todos", `{"task": "Buy eggs", "list_id": `+strconv.Itoa(list.ID)+`}`); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 adding to a shared list, got %d", rr.Code)
+	}
+	if todos := getTodosAs(t, router, alice); len(todos) != 2 {
+		t.Errorf("Expected alice to see bob's todo in her list, got %+v", todos)
+	}
+	if rr = requestAs(router, bob, "PUT", listPath, `{"name": "Mine now"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 renaming a shared list, got %d", rr.Code)
+	}
+
+	rr = requestAs(router, bob, "GET", listPath+"/members", "")
+	var members []ListMember
+	json.Unmarshal(rr.Body.Bytes(), &members)
+	if len(members) != 1 || members[0].UserID != bob.ID || members[0].Permission != writePermission {
+		t.Errorf("Expected bob as the only member, got %+v", members)
+	}
+
+	if rr = requestAs(router, bob, "DELETE", listPath+"/members/bob", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 leaving the list, got %d", rr.Code)
+	}
+	if todos := getTodosAs(t, router, bob); len(todos) != 1 || todos[0].Task != "Buy eggs" {
+		t.Errorf("Expected bob to only see his own todo after leaving, got %+v", todos)
+	}
+	if rr = requestAs(router, alice, "DELETE", listPath+"/members/bob", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 removing a member twice, got %d", rr.Code)
+	}
+}
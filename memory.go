@@ -0,0 +1,421 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryTodoRepository is a TodoRepository that keeps todos in memory, so
+// the API can run without a database. Everything is lost on restart.
+type memoryTodoRepository struct {
+	mu     sync.Mutex
+	lastID int
+	todos  map[int]*memoryTodo
+}
+
+// memoryTodo is a stored todo along with what the SQL schema keeps next to
+// it.
+type memoryTodo struct {
+	owner       string
+	userID      int
+	todo        Todo
+	completedAt *time.Time
+}
+
+func newMemoryTodoRepository() *memoryTodoRepository {
+	return &memoryTodoRepository{todos: make(map[int]*memoryTodo)}
+}
+
+func (m *memoryTodoRepository) Create(ctx context.Context, caller principal, todo Todo) (Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	todo.ID, todo.AssigneeID, todo.CommentCount, todo.ArchivedAt = 0, nil, 0, nil
+	if errs := m.checkRefs(caller, todo); errs != nil {
+		return todo, errs
+	}
+
+	m.lastID++
+	todo.ID, todo.Position = m.lastID, m.lastID
+	m.store(&memoryTodo{owner: caller.owner, userID: caller.userID}, &todo)
+	return todo, nil
+}
+
+func (m *memoryTodoRepository) Get(ctx context.Context, caller principal, id int) (Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.find(caller, id)
+	if !ok {
+		return Todo{}, errTodoNotFound
+	}
+	return copyTodo(stored.todo), nil
+}
+
+func (m *memoryTodoRepository) List(ctx context.Context, caller principal, filter TodoFilter) ([]Todo, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var matches []*memoryTodo
+	for _, stored := range m.todos {
+		if caller.owns(stored.owner, stored.userID) && filter.matches(stored.todo, now) {
+			matches = append(matches, stored)
+		}
+	}
+
+	total := len(matches)
+	if filter.After != nil {
+		total = 0
+		after := &memoryTodo{todo: Todo{ID: filter.After.ID, CreatedAt: filter.After.CreatedAt}}
+		matches = slices.DeleteFunc(matches, func(stored *memoryTodo) bool {
+			return compareTodos(stored, after, filter.Sort) <= 0
+		})
+	}
+	if filter.AfterID != nil {
+		total = 0
+		matches = slices.DeleteFunc(matches, func(stored *memoryTodo) bool {
+			return stored.todo.ID <= *filter.AfterID
+		})
+		filter.Sort = nil
+	}
+	slices.SortFunc(matches, func(a, b *memoryTodo) int {
+		return compareTodos(a, b, filter.Sort)
+	})
+
+	if filter.Limit > 0 {
+		start := min(filter.Offset, len(matches))
+		matches = matches[start:min(start+filter.Limit, len(matches))]
+	}
+
+	todos := make([]Todo, len(matches))
+	for i, stored := range matches {
+		todos[i] = copyTodo(stored.todo)
+	}
+	return todos, total, nil
+}
+
+func (m *memoryTodoRepository) Update(ctx context.Context, caller principal, id int, change func(*Todo) error, opts UpdateOptions) (Todo, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var todo Todo
+	stored, ok := m.find(caller, id)
+	created := !ok
+	if ok {
+		todo = copyTodo(stored.todo)
+	} else if _, taken := m.todos[id]; taken || !opts.Upsert {
+		// Someone else's todo must look like it doesn't exist.
+		return Todo{}, false, errTodoNotFound
+	}
+
+	if err := change(&todo); err != nil {
+		return todo, false, err
+	}
+	todo.ID = id
+	if errs := m.checkRefs(caller, todo); errs != nil {
+		return todo, false, errs
+	}
+
+	if created {
+		m.lastID = max(m.lastID, id)
+		todo.CreatedAt, todo.Position = time.Time{}, id
+		stored = &memoryTodo{owner: caller.owner, userID: caller.userID}
+	} else {
+		todo.CreatedAt = stored.todo.CreatedAt
+	}
+	m.store(stored, &todo)
+
+	if todo.Done && opts.Cascade {
+		for _, descendant := range m.descendants(id) {
+			if !descendant.todo.Done {
+				completedAt := todo.UpdatedAt
+				descendant.todo.Done = true
+				descendant.todo.UpdatedAt = completedAt
+				descendant.todo.Version++
+				descendant.completedAt = &completedAt
+			}
+		}
+	}
+	return todo, created, nil
+}
+
+func (m *memoryTodoRepository) Delete(ctx context.Context, caller principal, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.find(caller, id); !ok {
+		return errTodoNotFound
+	}
+	// Subtasks go with their parent, like the ON DELETE CASCADE in SQL.
+	for _, descendant := range m.descendants(id) {
+		delete(m.todos, descendant.todo.ID)
+	}
+	delete(m.todos, id)
+	return nil
+}
+
+func (m *memoryTodoRepository) Owner(ctx context.Context, caller principal, id int) (principal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.find(caller, id)
+	if !ok {
+		return principal{}, errTodoNotFound
+	}
+	return principal{owner: stored.owner, userID: stored.userID}, nil
+}
+
+// find returns the caller's todo with id.
+func (m *memoryTodoRepository) find(caller principal, id int) (*memoryTodo, bool) {
+	stored, ok := m.todos[id]
+	if !ok || !caller.owns(stored.owner, stored.userID) {
+		return nil, false
+	}
+	return stored, true
+}
+
+// store saves a copy of todo in place of stored, which has its owner and
+// earlier completion time, stamping it with the time it was written.
+func (m *memoryTodoRepository) store(stored *memoryTodo, todo *Todo) {
+	if todo.Priority == "" {
+		todo.Priority = defaultPriority
+	}
+	// Like the database's TIMESTAMP columns, keep whole UTC seconds.
+	now := time.Now().UTC().Truncate(time.Second)
+	if todo.CreatedAt.IsZero() {
+		todo.CreatedAt = now
+	}
+	todo.UpdatedAt = now
+	todo.Version = stored.todo.Version + 1
+	completedAt := stored.completedAt
+	if !todo.Done {
+		completedAt, todo.ArchivedAt = nil, nil
+	} else if completedAt == nil {
+		completedAt = &now
+	}
+
+	saved := copyTodo(*todo)
+	saved.Subtasks = nil
+	slices.Sort(saved.Tags)
+	saved.Tags = slices.Compact(saved.Tags)
+	m.todos[todo.ID] = &memoryTodo{owner: stored.owner, userID: stored.userID, todo: saved, completedAt: completedAt}
+}
+
+// checkRefs is checkTodoRefs for todos kept in memory. There are no lists
+// there, so any list_id is invalid.
+func (m *memoryTodoRepository) checkRefs(caller principal, todo Todo) validationErrors {
+	var errs validationErrors
+	if todo.ListID != nil {
+		errs.add("list_id", "no such list")
+	}
+	if todo.ParentID != nil {
+		parent, ok := m.find(caller, *todo.ParentID)
+		if !ok {
+			errs.add("parent_id", "no such todo")
+		}
+		for ok && todo.ID != 0 {
+			if parent.todo.ID == todo.ID {
+				errs.add("parent_id", "a todo can't be nested under itself or one of its subtasks")
+				break
+			}
+			if parent.todo.ParentID == nil {
+				break
+			}
+			parent, ok = m.todos[*parent.todo.ParentID]
+		}
+	}
+	return errs
+}
+
+// descendants returns the subtasks of the todo with id, their subtasks, and
+// so on.
+func (m *memoryTodoRepository) descendants(id int) []*memoryTodo {
+	var found []*memoryTodo
+	parents := []int{id}
+	for len(parents) > 0 {
+		var next []int
+		for _, stored := range m.todos {
+			if stored.todo.ParentID != nil && slices.Contains(parents, *stored.todo.ParentID) {
+				found = append(found, stored)
+				next = append(next, stored.todo.ID)
+			}
+		}
+		parents = next
+	}
+	return found
+}
+
+// matches reports whether todo passes the filter, the way todoConditions
+// selects it in SQL. Paging and sorting are left out.
+func (f TodoFilter) matches(todo Todo, now time.Time) bool {
+	if f.Tag != "" && !slices.Contains(todo.Tags, f.Tag) {
+		return false
+	}
+	if f.Done != nil && todo.Done != *f.Done {
+		return false
+	}
+	if f.Search != "" && !strings.Contains(strings.ToLower(todo.Task), strings.ToLower(f.Search)) &&
+		!strings.Contains(strings.ToLower(todo.Description), strings.ToLower(f.Search)) {
+		return false
+	}
+	if f.Overdue != nil {
+		overdue := !todo.Done && todo.DueDate != nil && todo.DueDate.Before(now)
+		if overdue != *f.Overdue {
+			return false
+		}
+	}
+	if f.ListID != nil && (todo.ListID == nil || *todo.ListID != *f.ListID) {
+		return false
+	}
+	if f.ParentID != nil && (todo.ParentID == nil || *todo.ParentID != *f.ParentID) {
+		return false
+	}
+	if f.AssigneeID != nil && *f.AssigneeID != 0 && (todo.AssigneeID == nil || *todo.AssigneeID != *f.AssigneeID) {
+		return false
+	}
+	if f.AssigneeID != nil && *f.AssigneeID == 0 && todo.AssigneeID != nil {
+		return false
+	}
+	if f.Archived != nil && (todo.ArchivedAt != nil) != *f.Archived {
+		return false
+	}
+	if f.Priority != "" && todo.Priority != f.Priority {
+		return false
+	}
+	for _, bound := range f.Bounds {
+		var at time.Time
+		switch bound.column {
+		case "due_date":
+			if todo.DueDate == nil {
+				return false
+			}
+			at = *todo.DueDate
+		case "created_at":
+			at = todo.CreatedAt
+		case "updated_at":
+			at = todo.UpdatedAt
+		}
+		if bound.before && !at.Before(bound.at) || !bound.before && !at.After(bound.at) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareTodos orders todos by keys the way orderBy does in SQL, with id
+// order when there are none. Missing values sort first, as NULLs do in
+// MySQL.
+func compareTodos(a, b *memoryTodo, keys []sortKey) int {
+	if len(keys) == 0 {
+		keys = []sortKey{{column: "id"}}
+	}
+	for _, key := range keys {
+		var c int
+		switch key.column {
+		case "id":
+			c = cmp.Compare(a.todo.ID, b.todo.ID)
+		case "task":
+			c = strings.Compare(strings.ToLower(a.todo.Task), strings.ToLower(b.todo.Task))
+		case "done":
+			c = compareBools(a.todo.Done, b.todo.Done)
+		case "completed_at":
+			c = compareTimes(a.completedAt, b.completedAt)
+		case "due_date":
+			c = compareTimes(a.todo.DueDate, b.todo.DueDate)
+		case "priority":
+			c = cmp.Compare(slices.Index(priorities, a.todo.Priority), slices.Index(priorities, b.todo.Priority))
+		case "created_at":
+			c = a.todo.CreatedAt.Compare(b.todo.CreatedAt)
+		case "updated_at":
+			c = a.todo.UpdatedAt.Compare(b.todo.UpdatedAt)
+		case "position":
+			c = cmp.Compare(a.todo.Position, b.todo.Position)
+		}
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.Compare(*b)
+}
+
+// copyTodo returns a copy of todo that shares no memory with it.
+func copyTodo(todo Todo) Todo {
+	if todo.DueDate != nil {
+		due := *todo.DueDate
+		todo.DueDate = &due
+	}
+	if todo.RemindAt != nil {
+		remind := *todo.RemindAt
+		todo.RemindAt = &remind
+	}
+	if todo.ListID != nil {
+		listID := *todo.ListID
+		todo.ListID = &listID
+	}
+	if todo.ParentID != nil {
+		parentID := *todo.ParentID
+		todo.ParentID = &parentID
+	}
+	if todo.AssigneeID != nil {
+		assigneeID := *todo.AssigneeID
+		todo.AssigneeID = &assigneeID
+	}
+	if todo.ArchivedAt != nil {
+		archivedAt := *todo.ArchivedAt
+		todo.ArchivedAt = &archivedAt
+	}
+	todo.Tags = append([]string{}, todo.Tags...)
+	todo.Subtasks = slices.Clone(todo.Subtasks)
+	return todo
+}
+
+// sqlUnavailable replies 501 and returns true when todos are kept in memory,
+// for the features that still need a SQL database.
+func sqlUnavailable(w http.ResponseWriter, r *http.Request) bool {
+	if db != nil {
+		return false
+	}
+	writeError(w, r, "Not supported with DB_DRIVER=memory", http.StatusNotImplemented)
+	return true
+}
+
+// requireSQL guards a route that needs the SQL database with sqlUnavailable.
+func requireSQL(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sqlUnavailable(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryTodoRepository(t *testing.T) {
+	repo := newMemoryTodoRepository()
+	ctx := context.Background()
+	alice, bob := principal{owner: "alice"}, principal{owner: "bob"}
+
+	milk, err := repo.Create(ctx, alice, Todo{Task: "Buy milk", Priority: "low", Tags: []string{"shop", "home"}})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	bread, _ := repo.Create(ctx, alice, Todo{Task: "Buy bread", Priority: "high"})
+	repo.Create(ctx, bob, Todo{Task: "Buy milk too"})
+	if milk.ID == 0 || bread.ID == milk.ID || milk.CreatedAt.IsZero() || bread.Position <= milk.Position {
+		t.Errorf("Expected distinct IDs, timestamps and positions, got %+v and %+v", milk, bread)
+	}
+
+	got, err := repo.Get(ctx, alice, milk.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Tags[0] != "home" || got.Tags[1] != "shop" {
+		t.Errorf("Expected tags in name order, got %v", got.Tags)
+	}
+	got.Tags[0] = "changed"
+	if again, _ := repo.Get(ctx, alice, milk.ID); again.Tags[0] != "home" {
+		t.Errorf("Expected the stored todo to be unaffected by changes to a copy")
+	}
+	if _, err = repo.Get(ctx, bob, milk.ID); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound for another owner, got %v", err)
+	}
+
+	todos, total, err := repo.List(ctx, alice, TodoFilter{Search: "BUY", Sort: []sortKey{{column: "priority", desc: true}, {column: "id"}}})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 2 || len(todos) != 2 || todos[0].ID != bread.ID {
+		t.Errorf("Expected alice's two todos, high priority first, got %d of %d", len(todos), total)
+	}
+	todos, _, _ = repo.List(ctx, alice, TodoFilter{Tag: "shop"})
+	if len(todos) != 1 || todos[0].ID != milk.ID {
+		t.Errorf("Expected only the tagged todo, got %+v", todos)
+	}
+	todos, total, _ = repo.List(ctx, alice, TodoFilter{AfterID: &milk.ID, Limit: 10})
+	if total != 0 || len(todos) != 1 || todos[0].ID != bread.ID {
+		t.Errorf("Expected the todo after the cursor, got %d of %d", len(todos), total)
+	}
+	todos, _, _ = repo.List(ctx, alice, TodoFilter{After: &todoCursor{CreatedAt: milk.CreatedAt.Add(time.Second), ID: milk.ID}, Sort: []sortKey{{column: "created_at", desc: true}, {column: "id"}}})
+	if len(todos) != 2 {
+		t.Errorf("Expected both todos after a newer cursor, newest first, got %+v", todos)
+	}
+	todos, _, _ = repo.List(ctx, alice, TodoFilter{After: &todoCursor{CreatedAt: milk.CreatedAt, ID: milk.ID}, Sort: []sortKey{{column: "created_at"}, {column: "id"}}})
+	if len(todos) != 1 || todos[0].ID != bread.ID {
+		t.Errorf("Expected only the todo after the cursor, got %+v", todos)
+	}
+
+	_, err = repo.Create(ctx, alice, Todo{Task: "In a list", ListID: &milk.ID})
+	var errs validationErrors
+	if !errors.As(err, &errs) {
+		t.Errorf("Expected validation errors for a list_id, got %v", err)
+	}
+
+	step, err := repo.Create(ctx, alice, Todo{Task: "Find wallet", ParentID: &bread.ID})
+	if err != nil {
+		t.Fatalf("Creating a subtask failed: %v", err)
+	}
+	_, _, err = repo.Update(ctx, alice, bread.ID, func(todo *Todo) error {
+		todo.ParentID = &step.ID
+		return nil
+	}, UpdateOptions{})
+	if !errors.As(err, &errs) {
+		t.Errorf("Expected validation errors for a cycle, got %v", err)
+	}
+
+	updated, created, err := repo.Update(ctx, alice, bread.ID, func(todo *Todo) error {
+		todo.Done = true
+		return nil
+	}, UpdateOptions{Cascade: true})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if created || !updated.Done || updated.Task != "Buy bread" || !updated.CreatedAt.Equal(bread.CreatedAt) {
+		t.Errorf("Expected the todo marked done and otherwise unchanged, got %+v", updated)
+	}
+	if sub, _ := repo.Get(ctx, alice, step.ID); !sub.Done {
+		t.Errorf("Expected the subtask to be completed along with its parent")
+	}
+	archivedAt, archived := time.Now(), true
+	repo.Update(ctx, alice, bread.ID, func(todo *Todo) error {
+		todo.ArchivedAt = &archivedAt
+		return nil
+	}, UpdateOptions{})
+	if todos, _, _ = repo.List(ctx, alice, TodoFilter{Archived: &archived}); len(todos) != 1 || todos[0].ID != bread.ID {
+		t.Errorf("Expected only the archived todo, got %+v", todos)
+	}
+
+	if _, _, err = repo.Update(ctx, alice, 100, func(*Todo) error { return nil }, UpdateOptions{}); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound without upsert, got %v", err)
+	}
+	_, created, err = repo.Update(ctx, alice, 100, func(todo *Todo) error {
+		todo.Task = "Upserted"
+		return nil
+	}, UpdateOptions{Upsert: true})
+	if err != nil || !created {
+		t.Errorf("Expected the upsert to create the todo, got created=%v, err=%v", created, err)
+	}
+	if next, _ := repo.Create(ctx, alice, Todo{Task: "Next"}); next.ID != 101 {
+		t.Errorf("Expected new IDs to continue after the upserted one, got %d", next.ID)
+	}
+	if _, _, err = repo.Update(ctx, bob, 100, func(*Todo) error { return nil }, UpdateOptions{Upsert: true}); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound upserting someone else's ID, got %v", err)
+	}
+
+	if err = repo.Delete(ctx, alice, bread.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err = repo.Get(ctx, alice, step.ID); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected the subtask to be deleted with its parent, got %v", err)
+	}
+	if err = repo.Delete(ctx, alice, bread.ID); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestRoutesWithMemoryRepository(t *testing.T) {
+	savedRepo, savedDB := todoRepo, db
+	todoRepo, db = newMemoryTodoRepository(), nil
+	t.Cleanup(func() { todoRepo, db = savedRepo, savedDB })
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("POST", "/todos", bytes.NewBufferString(`{"task": "Kept in memory"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", status, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/todos", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 1 || todos[0].Task != "Kept in memory" {
+		t.Errorf("Expected the created todo, got %+v", todos)
+	}
+
+	for _, path := range []string{"/lists", "/tags", "/todos.csv"} {
+		req = httptest.NewRequest("GET", path, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusNotImplemented {
+			t.Errorf("Expected status 501 for %s, got %d", path, status)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests by method, route and status.",
+	}, []string{"method", "path", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request duration in seconds by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+)
+
+// metricsMiddleware records request counts and durations, both for
+// Prometheus and for the in-process query stats. It is registered with
+// router.Use so it only sees matched routes, and labels them with the route
+// template rather than the raw path to keep IDs out of the labels.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		path := routeTemplate(r)
+
+		httpRequestsTotal.WithLabelValues(r.Method, path, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, path).Observe(duration.Seconds())
+		queryStats.record(r.Method+" "+path, duration, rec.status)
+	})
+}
+
+// routeTemplate returns the template of the matched route, such as
+// "/todos/{id}", falling back to the raw path.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+// todoCollector reports how many todos there are, done and not, counted
+// in the repository whenever Prometheus scrapes.
+type todoCollector struct {
+	repo TodoRepository
+	desc *prometheus.Desc
+}
+
+func newTodoCollector(repo TodoRepository) *todoCollector {
+	return &todoCollector{
+		repo: repo,
+		desc: prometheus.NewDesc("todos", "Number of todos by whether they are done.", []string{"done"}, nil),
+	}
+}
+
+func (c *todoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *todoCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	everyone := principal{role: adminRole}
+	for _, done := range []bool{false, true} {
+		_, total, err := c.repo.List(ctx, everyone, TodoFilter{Done: &done, Limit: 1})
+		if err != nil {
+			slog.Warn("Error counting todos for metrics", "error", err)
+			ch <- prometheus.NewInvalidMetric(c.desc, err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(total), strconv.FormatBool(done))
+	}
+}
+
+// registerStoreMetrics adds the todo counts, and the connection pool stats
+// of db when there is one, to /metrics.
+func registerStoreMetrics(repo TodoRepository, db *sql.DB) {
+	prometheus.MustRegister(newTodoCollector(repo))
+	if db != nil {
+		prometheus.MustRegister(collectors.NewDBStatsCollector(db, string(dbDialect)))
+	}
+}
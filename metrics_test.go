@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsUseRouteTemplate(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id), nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	body := rr.Body.String()
+	if !strings.Contains(body, `http_requests_total{method="GET",path="/todos/{id}",status="200"}`) {
+		t.Errorf("Expected request counter labelled with the route template, got:\n%s", body)
+	}
+	if strings.Contains(body, `path="/todos/`+strconv.Itoa(id)+`"`) {
+		t.Errorf("Expected raw path not to be used as a label")
+	}
+	if !strings.Contains(body, "http_request_duration_seconds_bucket") {
+		t.Errorf("Expected request duration histogram in output")
+	}
+}
+
+func TestTodoCollector(t *testing.T) {
+	repo := newMemoryTodoRepository()
+	ctx := context.Background()
+	alice, bob := principal{owner: "alice"}, principal{owner: "bob"}
+	repo.Create(ctx, alice, Todo{Task: "Open"})
+	repo.Create(ctx, bob, Todo{Task: "Also open"})
+	repo.Create(ctx, bob, Todo{Task: "Finished", Done: true})
+
+	expected := `
+# HELP todos Number of todos by whether they are done.
+# TYPE todos gauge
+todos{done="false"} 2
+todos{done="true"} 1
+`
+	if err := testutil.CollectAndCompare(newTodoCollector(repo), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
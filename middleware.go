@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+// statusRecorder wraps a ResponseWriter to remember the status code and
+// the number of body bytes written by the handler, and whether it has
+// started the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	size    int
+	started bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status, rec.started = status, true
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(p)
+	rec.size, rec.started = rec.size+n, true
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Hijack hands the connection over, as for a WebSocket upgrade, which
+// answers with 101 Switching Protocols itself.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil {
+		rec.status, rec.started = http.StatusSwitchingProtocols, true
+	}
+	return conn, rw, err
+}
+
+// recoverMiddleware turns a panicking handler into a 500 response instead of
+// a dropped connection, and logs the stack trace. A handler that panics
+// after starting its response can't be answered with a 500 anymore, so that
+// response is aborted instead of being sent incomplete.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newStatusRecorder(w)
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// The server uses this panic to abort a response on purpose.
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			slog.ErrorContext(r.Context(), "Panic serving request", "method", r.Method, "path", r.URL.Path, "error", err, "stack", string(debug.Stack()))
+			if rec.started {
+				panic(http.ErrAbortHandler)
+			}
+
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
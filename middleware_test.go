@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	router := setupRouter()
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var todo *Todo
+		_ = todo.Task
+	})
+
+	req := httptest.NewRequest("GET", "/panic", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", status)
+	}
+
+	var body errorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("Expected a JSON error body: %v", err)
+	}
+	if body.Error.Code != "internal_server_error" {
+		t.Errorf("Expected code internal_server_error in the body, got %q", body.Error.Code)
+	}
+}
+
+func TestRecoverMiddlewareLogsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	handler, _ := newLogHandler("json", "info", &buf)
+	saved := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	router := setupRouter()
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	req := httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set(requestIDHeader, "abc123")
+	rr := httptest.NewRecorder()
+	requestIDMiddleware(router).ServeHTTP(rr, req)
+
+	var body errorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("Expected a JSON error body: %v", err)
+	}
+	if body.Error.RequestID != "abc123" {
+		t.Errorf("Expected the request ID in the body, got %q", body.Error.RequestID)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["request_id"] != "abc123" || entry["error"] != "boom" {
+		t.Errorf("Expected the panic logged with the request ID, got %v", entry)
+	}
+	if stack, _ := entry["stack"].(string); !strings.Contains(stack, "TestRecoverMiddlewareLogsRequestID") {
+		t.Errorf("Expected the stack trace in the log, got %q", stack)
+	}
+}
+
+func TestRecoverMiddlewareAbortsStartedResponse(t *testing.T) {
+	router := setupRouter()
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("Expected the response to be aborted, got %v", err)
+		}
+	}()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+}
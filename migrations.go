@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the schema changes as SQL files named
+// NNNN_name.up.sql and NNNN_name.down.sql. A .postgres.sql or .sqlite.sql
+// file next to one replaces it on that database when the DDL can't be
+// written for all of them. MySQL files hold a single statement.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	up      migrationSQL
+	down    migrationSQL
+}
+
+// migrationSQL is the SQL of one direction of a migration, by dialect. The
+// "" entry is used on databases without their own.
+type migrationSQL map[dialect]string
+
+// statementFor returns the statement to run on d.
+func (m migrationSQL) statementFor(d dialect) string {
+	if statement, ok := m[d]; ok {
+		return statement
+	}
+	return m[""]
+}
+
+// migrations is the ordered list of schema changes. Add new ones as files
+// with the next version number; never edit or remove files that have
+// shipped.
+var migrations = func() []migration {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	loaded, err := loadMigrations(files)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}()
+
+// loadMigrations reads the migration files in fsys, and checks that the
+// versions count up from 1 and that each has both directions.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, name := range names {
+		parts := strings.Split(strings.TrimSuffix(name, ".sql"), ".")
+		versionStr, migrationName, ok := strings.Cut(parts[0], "_")
+		version, err := strconv.Atoi(versionStr)
+		if !ok || err != nil || version < 1 || len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("migration file %s isn't named NNNN_name.up|down[.dialect].sql", name)
+		}
+
+		var d dialect
+		if len(parts) == 3 {
+			d = dialect(parts[2])
+			if d != postgresDialect && d != sqliteDialect {
+				return nil, fmt.Errorf("migration file %s is for unknown database %q", name, d)
+			}
+		}
+
+		contents, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		statement := strings.TrimSuffix(strings.TrimSpace(string(contents)), ";")
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: migrationName, up: migrationSQL{}, down: migrationSQL{}}
+			byVersion[version] = m
+		}
+		if m.name != migrationName {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.name, migrationName)
+		}
+		switch parts[1] {
+		case "up":
+			m.up[d] = statement
+		case "down":
+			m.down[d] = statement
+		default:
+			return nil, fmt.Errorf("migration file %s is neither up nor down", name)
+		}
+	}
+
+	loaded := make([]migration, 0, len(byVersion))
+	for version := 1; version <= len(byVersion); version++ {
+		m, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("migration %d is missing", version)
+		}
+		if _, ok = m.up[""]; !ok {
+			return nil, fmt.Errorf("migration %d has no %04d_%s.up.sql", version, version, m.name)
+		}
+		if _, ok = m.down[""]; !ok {
+			return nil, fmt.Errorf("migration %d has no %04d_%s.down.sql", version, version, m.name)
+		}
+		loaded = append(loaded, *m)
+	}
+	return loaded, nil
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations,
+// creating the table on first use.
+func appliedMigrations(db *sql.DB) (map[int]bool, error) {
+	ctx := withoutQueryTimeout(context.Background())
+	_, err := db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("querying applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("scanning applied migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// pendingMigrations returns the migrations not applied to db yet.
+func pendingMigrations(db *sql.DB) ([]migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(slices.Clone(migrations), func(m migration) bool {
+		return applied[m.version]
+	}), nil
+}
+
+// migrationTx runs fn, which applies or rolls back a migration and updates
+// schema_migrations to match, in a single transaction, so a crash can't
+// leave a migration applied but unrecorded. MySQL commits every schema
+// change on its own, so there it runs outside a transaction: a migration
+// interrupted before its record is run again on the next start, and fails
+// if its changes were made, until they are undone or recorded by hand.
+func migrationTx(ctx context.Context, db *sql.DB, fn func(q dbtx) error) error {
+	if dbDialect == mysqlDialect {
+		return fn(db)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if dbDialect == sqliteDialect {
+		// Migrations rebuilding a table turn foreign keys off so that
+		// dropping the old one doesn't delete the rows referring to it, but
+		// that has no effect inside a transaction, so it's done before.
+		if _, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON"); err != nil {
+				// Keep the connection from being used without them.
+				conn.Raw(func(any) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+	return withTx(ctx, conn, func(tx *sql.Tx) error { return fn(tx) })
+}
+
+// migrate applies every migration whose version isn't recorded in
+// schema_migrations yet, in order. Migrations may take long on big tables,
+// so they have no queryTimeout.
+func migrate(db *sql.DB) error {
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := withoutQueryTimeout(context.Background())
+	for _, m := range pending {
+		err = migrationTx(ctx, db, func(q dbtx) error {
+			if _, err := q.ExecContext(ctx, m.up.statementFor(dbDialect)); err != nil {
+				return fmt.Errorf("applying migration %d (%s): %w", m.version, m.name, err)
+			}
+			if _, err := q.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", m.version); err != nil {
+				return fmt.Errorf("recording migration %d: %w", m.version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		slog.Info("Applied migration", "version", m.version, "name", m.name)
+	}
+
+	slog.Info("Schema up to date", "applied", len(pending), "version", migrations[len(migrations)-1].version)
+	return nil
+}
+
+// migrateDown rolls back the last steps applied migrations, newest first.
+func migrateDown(db *sql.DB, steps int) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := withoutQueryTimeout(context.Background())
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if !applied[m.version] {
+			continue
+		}
+		err = migrationTx(ctx, db, func(q dbtx) error {
+			if _, err := q.ExecContext(ctx, m.down.statementFor(dbDialect)); err != nil {
+				return fmt.Errorf("rolling back migration %d (%s): %w", m.version, m.name, err)
+			}
+			if _, err := q.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.version); err != nil {
+				return fmt.Errorf("unrecording migration %d: %w", m.version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		slog.Info("Rolled back migration", "version", m.version, "name", m.name)
+		steps--
+	}
+	return nil
+}
+
+// writeMigrationStatus lists every migration and whether it is applied.
+func writeMigrationStatus(db *sql.DB, w io.Writer) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		state := "pending"
+		if applied[m.version] {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%04d  %-7s  %s\n", m.version, state, m.name)
+	}
+	return nil
+}
+
+// migrateCommand runs "todo-api migrate [up | down [N] | status]" against
+// the configured database: up applies all pending migrations (the default),
+// down rolls back the last N (default 1), and status lists them.
+func migrateCommand(args []string) error {
+	if conf.get("DB_DRIVER") == "memory" {
+		return fmt.Errorf("DB_DRIVER=memory has no schema to migrate")
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	steps := 1
+	if command == "down" && len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations to roll back %q", args[1])
+		}
+		steps = n
+	}
+	if command != "up" && command != "down" && command != "status" {
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+
+	conn, err := connectDB()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch command {
+	case "down":
+		return migrateDown(conn, steps)
+	case "status":
+		return writeMigrationStatus(conn, os.Stdout)
+	}
+	return migrate(conn)
+}
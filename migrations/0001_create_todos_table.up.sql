@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS todos (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    task VARCHAR(255) NOT NULL,
+    done BOOLEAN DEFAULT FALSE
+);
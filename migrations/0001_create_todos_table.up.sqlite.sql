@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS todos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task VARCHAR(255) NOT NULL,
+    done BOOLEAN DEFAULT FALSE
+);
@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+CREATE INDEX idx_todos_owner ON todos (owner);
@@ -0,0 +1,9 @@
+CREATE TABLE idempotency_keys (
+    owner VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    todo_id INT NOT NULL,
+    response_body TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (owner, idempotency_key)
+);
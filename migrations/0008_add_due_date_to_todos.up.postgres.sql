@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN due_date TIMESTAMPTZ NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE todos DROP COLUMN priority;
+DROP TYPE todo_priority;
@@ -0,0 +1,3 @@
+-- An enum type sorts in the order of its values, like MySQL's.
+CREATE TYPE todo_priority AS ENUM ('low', 'medium', 'high', 'urgent');
+ALTER TABLE todos ADD COLUMN priority todo_priority NOT NULL DEFAULT 'medium';
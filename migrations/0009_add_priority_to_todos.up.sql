@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN priority ENUM('low', 'medium', 'high', 'urgent') NOT NULL DEFAULT 'medium';
@@ -0,0 +1,6 @@
+CREATE TABLE lists (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    name VARCHAR(255) NOT NULL,
+    INDEX idx_lists_owner (owner)
+);
@@ -0,0 +1,6 @@
+CREATE TABLE lists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    name VARCHAR(255) NOT NULL
+);
+CREATE INDEX idx_lists_owner ON lists (owner);
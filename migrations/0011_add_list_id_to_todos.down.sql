@@ -0,0 +1 @@
+ALTER TABLE todos DROP FOREIGN KEY fk_todos_list, DROP COLUMN list_id;
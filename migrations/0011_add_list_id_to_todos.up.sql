@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    ADD COLUMN list_id INT NULL,
+    ADD CONSTRAINT fk_todos_list FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE SET NULL;
@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN list_id INTEGER NULL REFERENCES lists(id) ON DELETE SET NULL;
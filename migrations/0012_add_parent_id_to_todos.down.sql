@@ -0,0 +1 @@
+ALTER TABLE todos DROP FOREIGN KEY fk_todos_parent, DROP COLUMN parent_id;
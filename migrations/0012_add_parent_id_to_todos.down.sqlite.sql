@@ -0,0 +1,18 @@
+-- SQLite can't drop a column with a foreign key, so the table is rebuilt
+-- without it. Foreign keys are off meanwhile so todo_tags keeps its rows.
+PRAGMA foreign_keys = OFF;
+CREATE TABLE todos_rebuilt (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task VARCHAR(255) NOT NULL,
+    done BOOLEAN DEFAULT FALSE,
+    completed_at TIMESTAMP NULL,
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    due_date DATETIME NULL,
+    priority VARCHAR(6) NOT NULL DEFAULT 'medium' CHECK (priority IN ('low', 'medium', 'high', 'urgent')),
+    list_id INTEGER NULL REFERENCES lists(id) ON DELETE SET NULL
+);
+INSERT INTO todos_rebuilt SELECT id, task, done, completed_at, owner, due_date, priority, list_id FROM todos;
+DROP TABLE todos;
+ALTER TABLE todos_rebuilt RENAME TO todos;
+CREATE INDEX idx_todos_owner ON todos (owner);
+PRAGMA foreign_keys = ON;
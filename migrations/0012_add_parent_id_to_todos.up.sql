@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    ADD COLUMN parent_id INT NULL,
+    ADD CONSTRAINT fk_todos_parent FOREIGN KEY (parent_id) REFERENCES todos(id) ON DELETE CASCADE;
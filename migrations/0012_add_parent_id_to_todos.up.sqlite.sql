@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN parent_id INTEGER NULL REFERENCES todos(id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+DROP TRIGGER todos_updated_at ON todos;
+DROP FUNCTION set_updated_at();
+ALTER TABLE todos DROP COLUMN created_at, DROP COLUMN updated_at;
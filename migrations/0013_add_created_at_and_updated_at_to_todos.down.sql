@@ -0,0 +1 @@
+ALTER TABLE todos DROP COLUMN created_at, DROP COLUMN updated_at;
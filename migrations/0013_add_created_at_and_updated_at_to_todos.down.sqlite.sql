@@ -0,0 +1,4 @@
+DROP TRIGGER todos_created_at;
+DROP TRIGGER todos_updated_at;
+ALTER TABLE todos DROP COLUMN created_at;
+ALTER TABLE todos DROP COLUMN updated_at;
@@ -0,0 +1,12 @@
+-- Postgres has no ON UPDATE, a trigger bumps updated_at instead.
+ALTER TABLE todos
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+CREATE FUNCTION set_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER todos_updated_at BEFORE UPDATE ON todos
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
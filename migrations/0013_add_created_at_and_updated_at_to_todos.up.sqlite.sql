@@ -0,0 +1,13 @@
+-- SQLite can't add a column defaulting to CURRENT_TIMESTAMP, so triggers
+-- fill in both timestamps instead.
+ALTER TABLE todos ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+ALTER TABLE todos ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE todos SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+CREATE TRIGGER todos_created_at AFTER INSERT ON todos WHEN NEW.created_at = '1970-01-01 00:00:00'
+BEGIN
+    UPDATE todos SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+CREATE TRIGGER todos_updated_at AFTER UPDATE ON todos WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE todos SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
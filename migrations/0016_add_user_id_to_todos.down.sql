@@ -0,0 +1 @@
+ALTER TABLE todos DROP FOREIGN KEY fk_todos_user, DROP COLUMN user_id;
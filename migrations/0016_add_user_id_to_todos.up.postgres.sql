@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    ADD COLUMN user_id INT NULL,
+    ADD CONSTRAINT fk_todos_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX idx_todos_user_id ON todos (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    ADD COLUMN user_id INT NULL,
+    ADD CONSTRAINT fk_todos_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+ALTER TABLE todos ADD COLUMN user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX idx_todos_user_id ON todos (user_id);
@@ -0,0 +1 @@
+UPDATE todos SET user_id = NULL;
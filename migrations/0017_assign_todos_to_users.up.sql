@@ -0,0 +1,3 @@
+-- Todos created through a proxy that named users like their accounts go to
+-- those accounts.
+UPDATE todos SET user_id = (SELECT id FROM users WHERE users.username = todos.owner) WHERE user_id IS NULL;
@@ -0,0 +1 @@
+UPDATE users SET role = 'editor' WHERE role = 'user';
@@ -0,0 +1,8 @@
+CREATE TABLE list_members (
+    list_id INT NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission VARCHAR(8) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (list_id, user_id)
+);
+CREATE INDEX idx_list_members_user_id ON list_members (user_id);
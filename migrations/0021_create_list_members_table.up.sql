@@ -0,0 +1,9 @@
+CREATE TABLE list_members (
+    list_id INT NOT NULL,
+    user_id INT NOT NULL,
+    permission VARCHAR(8) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (list_id, user_id),
+    FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL,
+    user_id INT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_webhooks_owner ON webhooks (owner);
@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN description TEXT;
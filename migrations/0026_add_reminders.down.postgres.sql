@@ -0,0 +1,3 @@
+DROP TABLE reminders;
+DROP INDEX idx_todos_remind_at;
+ALTER TABLE todos DROP COLUMN remind_at;
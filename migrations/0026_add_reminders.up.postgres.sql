@@ -0,0 +1,15 @@
+ALTER TABLE todos ADD COLUMN remind_at TIMESTAMPTZ NULL;
+CREATE INDEX idx_todos_remind_at ON todos (remind_at);
+CREATE TABLE reminders (
+    id SERIAL PRIMARY KEY,
+    todo_id INT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    remind_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMPTZ NULL,
+    next_attempt_at TIMESTAMPTZ NULL
+);
+CREATE UNIQUE INDEX idx_reminders_todo_id_remind_at ON reminders (todo_id, remind_at);
+CREATE INDEX idx_reminders_due ON reminders (status, next_attempt_at);
@@ -0,0 +1,15 @@
+ALTER TABLE todos ADD COLUMN remind_at DATETIME NULL, ADD INDEX idx_todos_remind_at (remind_at);
+CREATE TABLE reminders (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    todo_id INT NOT NULL,
+    remind_at DATETIME NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP NULL,
+    next_attempt_at TIMESTAMP NULL,
+    UNIQUE INDEX idx_reminders_todo_id_remind_at (todo_id, remind_at),
+    INDEX idx_reminders_due (status, next_attempt_at),
+    FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE
+);
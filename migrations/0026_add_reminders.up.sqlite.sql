@@ -0,0 +1,15 @@
+ALTER TABLE todos ADD COLUMN remind_at TIMESTAMP NULL;
+CREATE INDEX idx_todos_remind_at ON todos (remind_at);
+CREATE TABLE reminders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    remind_at TIMESTAMP NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP NULL,
+    next_attempt_at TIMESTAMP NULL
+);
+CREATE UNIQUE INDEX idx_reminders_todo_id_remind_at ON reminders (todo_id, remind_at);
+CREATE INDEX idx_reminders_due ON reminders (status, next_attempt_at);
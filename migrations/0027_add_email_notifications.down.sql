@@ -0,0 +1,2 @@
+DROP TABLE email_notifications;
+ALTER TABLE users DROP COLUMN email, DROP COLUMN email_notifications;
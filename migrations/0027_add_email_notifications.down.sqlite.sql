@@ -0,0 +1,3 @@
+DROP TABLE email_notifications;
+ALTER TABLE users DROP COLUMN email;
+ALTER TABLE users DROP COLUMN email_notifications;
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN email VARCHAR(255) NULL, ADD COLUMN email_notifications BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE TABLE email_notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    todo_id INT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL,
+    due_date TIMESTAMPTZ NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMPTZ NULL,
+    next_attempt_at TIMESTAMPTZ NULL
+);
+CREATE UNIQUE INDEX idx_email_notifications_todo_id_kind_due_date ON email_notifications (todo_id, kind, due_date);
+CREATE INDEX idx_email_notifications_due ON email_notifications (status, next_attempt_at);
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN email VARCHAR(255) NULL, ADD COLUMN email_notifications BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE TABLE email_notifications (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    todo_id INT NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    due_date DATETIME NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP NULL,
+    next_attempt_at TIMESTAMP NULL,
+    UNIQUE INDEX idx_email_notifications_todo_id_kind_due_date (todo_id, kind, due_date),
+    INDEX idx_email_notifications_due (status, next_attempt_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE webhooks DROP COLUMN list_id, DROP COLUMN format;
@@ -0,0 +1 @@
+ALTER TABLE webhooks DROP FOREIGN KEY fk_webhooks_list, DROP COLUMN list_id, DROP COLUMN format;
@@ -0,0 +1,18 @@
+-- SQLite can't drop a column with a foreign key, so the table is rebuilt
+-- without it. Foreign keys are off meanwhile so webhook_deliveries keeps its
+-- rows.
+PRAGMA foreign_keys = OFF;
+CREATE TABLE webhooks_rebuilt (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner VARCHAR(255) NOT NULL,
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO webhooks_rebuilt SELECT id, owner, user_id, url, secret, events, created_at FROM webhooks;
+DROP TABLE webhooks;
+ALTER TABLE webhooks_rebuilt RENAME TO webhooks;
+CREATE INDEX idx_webhooks_owner ON webhooks (owner);
+PRAGMA foreign_keys = ON;
@@ -0,0 +1,3 @@
+ALTER TABLE webhooks
+    ADD COLUMN format VARCHAR(16) NOT NULL DEFAULT 'json',
+    ADD COLUMN list_id INT NULL REFERENCES lists(id) ON DELETE CASCADE;
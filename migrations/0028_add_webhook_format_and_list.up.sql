@@ -0,0 +1,4 @@
+ALTER TABLE webhooks
+    ADD COLUMN format VARCHAR(16) NOT NULL DEFAULT 'json',
+    ADD COLUMN list_id INT NULL,
+    ADD CONSTRAINT fk_webhooks_list FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE;
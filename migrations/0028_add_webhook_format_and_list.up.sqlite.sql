@@ -0,0 +1,2 @@
+ALTER TABLE webhooks ADD COLUMN format VARCHAR(16) NOT NULL DEFAULT 'json';
+ALTER TABLE webhooks ADD COLUMN list_id INTEGER NULL REFERENCES lists(id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE todos DROP FOREIGN KEY fk_todos_assignee, DROP COLUMN assignee_id;
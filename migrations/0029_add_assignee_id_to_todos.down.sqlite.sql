@@ -0,0 +1,36 @@
+-- SQLite can't drop a column with a foreign key, so the table is rebuilt
+-- without it. Foreign keys are off meanwhile so the rows pointing at todos
+-- are kept.
+PRAGMA foreign_keys = OFF;
+CREATE TABLE todos_rebuilt (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task VARCHAR(255) NOT NULL,
+    done BOOLEAN DEFAULT FALSE,
+    completed_at TIMESTAMP NULL,
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    due_date DATETIME NULL,
+    priority VARCHAR(6) NOT NULL DEFAULT 'medium' CHECK (priority IN ('low', 'medium', 'high', 'urgent')),
+    list_id INTEGER NULL REFERENCES lists(id) ON DELETE SET NULL,
+    parent_id INTEGER NULL REFERENCES todos(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL DEFAULT 1,
+    description TEXT,
+    remind_at TIMESTAMP NULL
+);
+INSERT INTO todos_rebuilt SELECT id, task, done, completed_at, owner, due_date, priority, list_id, parent_id, created_at, updated_at, user_id, version, description, remind_at FROM todos;
+DROP TABLE todos;
+ALTER TABLE todos_rebuilt RENAME TO todos;
+CREATE INDEX idx_todos_owner ON todos (owner);
+CREATE INDEX idx_todos_user_id ON todos (user_id);
+CREATE INDEX idx_todos_remind_at ON todos (remind_at);
+CREATE TRIGGER todos_created_at AFTER INSERT ON todos WHEN NEW.created_at = '1970-01-01 00:00:00'
+BEGIN
+    UPDATE todos SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+CREATE TRIGGER todos_updated_at AFTER UPDATE ON todos WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE todos SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+PRAGMA foreign_keys = ON;
@@ -0,0 +1,2 @@
+ALTER TABLE todos ADD COLUMN assignee_id INT NULL REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX idx_todos_assignee_id ON todos (assignee_id);
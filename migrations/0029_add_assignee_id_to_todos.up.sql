@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    ADD COLUMN assignee_id INT NULL,
+    ADD CONSTRAINT fk_todos_assignee FOREIGN KEY (assignee_id) REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX idx_todos_assignee_id ON todos (assignee_id);
@@ -0,0 +1,13 @@
+CREATE TABLE audit_log (
+    id SERIAL PRIMARY KEY,
+    todo_id INT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    user_id INT NULL,
+    old_values TEXT NULL,
+    new_values TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_audit_log_todo_id ON audit_log (todo_id);
+CREATE INDEX idx_audit_log_actor ON audit_log (actor);
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
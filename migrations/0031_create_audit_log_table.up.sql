@@ -0,0 +1,13 @@
+CREATE TABLE audit_log (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    todo_id INT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    user_id INT NULL,
+    old_values TEXT NULL,
+    new_values TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_log_todo_id (todo_id),
+    INDEX idx_audit_log_actor (actor),
+    INDEX idx_audit_log_created_at (created_at)
+);
@@ -0,0 +1 @@
+ALTER TABLE audit_log DROP COLUMN todo_owner, DROP COLUMN todo_user_id;
@@ -0,0 +1,2 @@
+ALTER TABLE audit_log DROP COLUMN todo_owner;
+ALTER TABLE audit_log DROP COLUMN todo_user_id;
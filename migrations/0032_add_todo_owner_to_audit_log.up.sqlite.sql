@@ -0,0 +1,5 @@
+ALTER TABLE audit_log ADD COLUMN todo_owner VARCHAR(255) NULL;
+ALTER TABLE audit_log ADD COLUMN todo_user_id INT NULL;
+UPDATE audit_log
+SET todo_owner = (SELECT owner FROM todos WHERE todos.id = audit_log.todo_id),
+    todo_user_id = (SELECT user_id FROM todos WHERE todos.id = audit_log.todo_id);
@@ -0,0 +1 @@
+ALTER TABLE todos DROP INDEX idx_todos_archived_at, DROP COLUMN archived_at;
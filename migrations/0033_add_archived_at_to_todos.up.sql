@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN archived_at DATETIME NULL, ADD INDEX idx_todos_archived_at (archived_at);
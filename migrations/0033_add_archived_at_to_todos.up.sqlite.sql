@@ -0,0 +1,2 @@
+ALTER TABLE todos ADD COLUMN archived_at TIMESTAMP NULL;
+CREATE INDEX idx_todos_archived_at ON todos (archived_at);
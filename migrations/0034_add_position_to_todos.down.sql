@@ -0,0 +1 @@
+ALTER TABLE todos DROP INDEX idx_todos_position, DROP COLUMN position;
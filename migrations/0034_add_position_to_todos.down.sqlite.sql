@@ -0,0 +1,2 @@
+DROP INDEX idx_todos_position;
+ALTER TABLE todos DROP COLUMN position;
@@ -0,0 +1,6 @@
+ALTER TABLE todos ADD COLUMN position INT NOT NULL DEFAULT 0;
+CREATE INDEX idx_todos_position ON todos (position);
+-- Todos start out in the order they were created, without counting as updated.
+ALTER TABLE todos DISABLE TRIGGER todos_updated_at;
+UPDATE todos SET position = id;
+ALTER TABLE todos ENABLE TRIGGER todos_updated_at;
@@ -0,0 +1,3 @@
+ALTER TABLE todos ADD COLUMN position INT NOT NULL DEFAULT 0, ADD INDEX idx_todos_position (position);
+-- Todos start out in the order they were created, without counting as updated.
+UPDATE todos SET position = id, updated_at = updated_at;
@@ -0,0 +1,9 @@
+ALTER TABLE todos ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_todos_position ON todos (position);
+-- Todos start out in the order they were created, without counting as updated.
+DROP TRIGGER todos_updated_at;
+UPDATE todos SET position = id;
+CREATE TRIGGER todos_updated_at AFTER UPDATE ON todos WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE todos SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
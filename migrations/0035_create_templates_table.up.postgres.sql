@@ -0,0 +1,9 @@
+CREATE TABLE templates (
+    id SERIAL PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL,
+    user_id INT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    todos TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_templates_owner ON templates (owner);
@@ -0,0 +1,10 @@
+CREATE TABLE templates (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL,
+    user_id INT NULL,
+    name VARCHAR(255) NOT NULL,
+    todos MEDIUMTEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_templates_owner (owner),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE lists DROP COLUMN user_id;
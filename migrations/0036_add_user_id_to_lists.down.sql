@@ -0,0 +1 @@
+ALTER TABLE lists DROP FOREIGN KEY fk_lists_user, DROP COLUMN user_id;
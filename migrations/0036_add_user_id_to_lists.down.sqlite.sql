@@ -0,0 +1,11 @@
+-- SQLite can't drop a column with a foreign key, so the table is rebuilt
+-- without it.
+CREATE TABLE lists_rebuilt (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    name VARCHAR(255) NOT NULL
+);
+INSERT INTO lists_rebuilt SELECT id, owner, name FROM lists;
+DROP TABLE lists;
+ALTER TABLE lists_rebuilt RENAME TO lists;
+CREATE INDEX idx_lists_owner ON lists (owner);
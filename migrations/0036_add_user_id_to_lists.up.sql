@@ -0,0 +1,4 @@
+ALTER TABLE lists
+    ADD COLUMN user_id INT NULL,
+    ADD CONSTRAINT fk_lists_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+UPDATE lists SET user_id = (SELECT id FROM users WHERE users.username = lists.owner);
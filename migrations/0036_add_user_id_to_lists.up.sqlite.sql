@@ -0,0 +1,3 @@
+ALTER TABLE lists ADD COLUMN user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE;
+UPDATE lists SET user_id = (SELECT id FROM users WHERE users.username = lists.owner);
+CREATE INDEX idx_lists_user_id ON lists (user_id);
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	if err := migrate(db); err != nil {
+		t.Fatalf("Second migrate run failed: %v", err)
+	}
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query schema_migrations: %v", err)
+	}
+	if count != len(migrations) {
+		t.Errorf("Expected %d applied migrations, got %d", len(migrations), count)
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	clearTodos(t)
+	seedTodo(t, "Survives a rollback of the newest migration", false)
+
+	if err := migrateDown(db, 1); err != nil {
+		t.Fatalf("Rolling back one migration failed: %v", err)
+	}
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		t.Fatalf("Failed to list pending migrations: %v", err)
+	}
+	if len(pending) != 1 || pending[0].version != migrations[len(migrations)-1].version {
+		t.Errorf("Expected only the newest migration pending, got %+v", pending)
+	}
+	if err = migrate(db); err != nil {
+		t.Fatalf("Reapplying the migration failed: %v", err)
+	}
+	if count := countTodos(t); count != 1 {
+		t.Errorf("Expected the todo to survive, got %d todos", count)
+	}
+
+	if err = migrateDown(db, len(migrations)); err != nil {
+		t.Fatalf("Rolling back every migration failed: %v", err)
+	}
+	if pending, _ = pendingMigrations(db); len(pending) != len(migrations) {
+		t.Errorf("Expected every migration pending, got %d", len(pending))
+	}
+	if err = migrate(db); err != nil {
+		t.Fatalf("Migrating up from scratch failed: %v", err)
+	}
+}
+
+func TestMigrationTxRollsBack(t *testing.T) {
+	if dbDialect == mysqlDialect {
+		t.Skip("MySQL commits schema changes on their own")
+	}
+
+	// A migration applied, but interrupted before it is recorded.
+	ctx := context.Background()
+	errCrash := errors.New("crash")
+	err := migrationTx(ctx, db, func(q dbtx) error {
+		if _, err := q.ExecContext(ctx, "CREATE TABLE half_applied (id INT)"); err != nil {
+			return err
+		}
+		return errCrash
+	})
+	if !errors.Is(err, errCrash) {
+		t.Fatalf("Expected the error back, got %v", err)
+	}
+	if _, err = db.Exec("SELECT COUNT(*) FROM half_applied"); err == nil {
+		db.Exec("DROP TABLE half_applied")
+		t.Error("Expected the schema change rolled back with the migration")
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, m := range migrations {
+		if m.up.statementFor(mysqlDialect) == "" || m.down.statementFor(mysqlDialect) == "" {
+			t.Errorf("Migration %d is missing SQL", m.version)
+		}
+	}
+
+	for name, files := range map[string]fstest.MapFS{
+		"missing down": {
+			"0001_first.up.sql": {Data: []byte("CREATE TABLE a (id INT)")},
+		},
+		"gap in versions": {
+			"0001_first.up.sql":   {Data: []byte("CREATE TABLE a (id INT)")},
+			"0001_first.down.sql": {Data: []byte("DROP TABLE a")},
+			"0003_third.up.sql":   {Data: []byte("CREATE TABLE c (id INT)")},
+			"0003_third.down.sql": {Data: []byte("DROP TABLE c")},
+		},
+		"unknown database": {
+			"0001_first.up.sql":        {Data: []byte("CREATE TABLE a (id INT)")},
+			"0001_first.down.sql":      {Data: []byte("DROP TABLE a")},
+			"0001_first.up.oracle.sql": {Data: []byte("CREATE TABLE a (id INT)")},
+		},
+		"bad name": {
+			"first.up.sql": {Data: []byte("CREATE TABLE a (id INT)")},
+		},
+	} {
+		if _, err := loadMigrations(files); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	loaded, err := loadMigrations(fstest.MapFS{
+		"0001_first.up.sql":        {Data: []byte("CREATE TABLE a (id INT);\n")},
+		"0001_first.up.sqlite.sql": {Data: []byte("CREATE TABLE a (id INTEGER)")},
+		"0001_first.down.sql":      {Data: []byte("DROP TABLE a")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := loaded[0].up.statementFor(postgresDialect); got != "CREATE TABLE a (id INT)" {
+		t.Errorf("Expected the shared statement without its semicolon, got %q", got)
+	}
+	if got := loaded[0].up.statementFor(sqliteDialect); got != "CREATE TABLE a (id INTEGER)" {
+		t.Errorf("Expected the SQLite statement, got %q", got)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcCookie holds the state, nonce and PKCE verifier of a login in
+// progress, between the redirect to the provider and the callback.
+const oidcCookie = "oidc_login"
+
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcLogin is the identity provider users can log in with. It is set up
+// from OIDC_ISSUER_URL and friends; nil disables OIDC login.
+var oidcLogin *oidcConfig
+
+type oidcConfig struct {
+	issuer   string
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// newOIDCConfig discovers the provider at issuerURL.
+func newOIDCConfig(ctx context.Context, issuerURL, clientID, clientSecret, redirectURL string) (*oidcConfig, error) {
+	provider, err := oidc.NewProvider(ctx, issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("discovering OIDC provider %s: %w", issuerURL, err)
+	}
+	return &oidcConfig{
+		issuer: issuerURL,
+		oauth2: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+// cookiePath scopes the login cookie to the callback the provider redirects
+// to, under whichever API version the redirect URL names.
+func (c *oidcConfig) cookiePath() string {
+	u, err := url.Parse(c.oauth2.RedirectURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return path.Dir(u.Path)
+}
+
+// oidcClaims are the claims of an ID token a username is made from.
+type oidcClaims struct {
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+}
+
+// username returns a valid username for a new user from the claims, which
+// may already be taken.
+func (c oidcClaims) username() string {
+	name := c.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(c.Email, "@")
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name))
+	// Leave room for a suffix telling apart users with the same name.
+	if len(name) > 56 {
+		name = name[:56]
+	}
+	if len(name) < 3 {
+		name = "user"
+	}
+	return name
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// OIDCLoginHandler redirects to the identity provider to log in.
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcLogin == nil {
+		writeError(w, r, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, err := randomString()
+	var nonce string
+	if err == nil {
+		nonce, err = randomString()
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating OIDC state", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    state + "." + nonce + "." + verifier,
+		Path:     oidcLogin.cookiePath(),
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, oidcLogin.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), http.StatusFound)
+}
+
+// OIDCCallbackHandler is where the identity provider sends users back to.
+// It exchanges the code for an ID token, finds or creates the local user of
+// its subject, and answers with an access token like LoginHandler.
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcLogin == nil {
+		writeError(w, r, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: oidcLogin.cookiePath(), MaxAge: -1})
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		writeError(w, r, "OIDC login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		writeError(w, r, "No OIDC login in progress", http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(query.Get("state"))) != 1 {
+		writeError(w, r, "Invalid OIDC state", http.StatusBadRequest)
+		return
+	}
+	nonce, verifier := parts[1], parts[2]
+
+	ctx := r.Context()
+	token, err := oidcLogin.oauth2.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		slog.WarnContext(ctx, "Error exchanging OIDC code", "error", err)
+		writeError(w, r, "OIDC login failed", http.StatusUnauthorized)
+		return
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	idToken, err := oidcLogin.verifier.Verify(ctx, rawIDToken)
+	if err != nil || subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		slog.WarnContext(ctx, "Invalid OIDC ID token", "error", err)
+		writeError(w, r, "OIDC login failed", http.StatusUnauthorized)
+		return
+	}
+	var claims oidcClaims
+	if err = idToken.Claims(&claims); err != nil {
+		slog.WarnContext(ctx, "Invalid OIDC ID token claims", "error", err)
+		writeError(w, r, "OIDC login failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := oidcUser(ctx, oidcLogin.issuer, idToken.Subject, claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error finding OIDC user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := issueToken(user, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "Error signing token", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(tokenTTL.Seconds()),
+	})
+}
+
+// oidcUser returns the local user linked to subject at issuer, creating an
+// editor for it on first login. OIDC users have no password.
+func oidcUser(ctx context.Context, issuer, subject string, claims oidcClaims) (User, error) {
+	// Retry when a concurrent login of the same user, or of one with the
+	// same name, got there first.
+	for attempt := 0; ; attempt++ {
+		user, err := findOIDCUser(ctx, issuer, subject)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return user, err
+		}
+
+		user = User{Role: editorRole}
+		err = withTx(ctx, db, func(tx *sql.Tx) error {
+			base := claims.username()
+			user.Username = base
+			for n := 2; ; n++ {
+				var count int
+				if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ?", user.Username).Scan(&count); err != nil {
+					return err
+				}
+				if count == 0 {
+					break
+				}
+				user.Username = base + "-" + strconv.Itoa(n)
+			}
+
+			var err error
+			user.ID, err = dbDialect.insertID(ctx, tx, "INSERT INTO users (username, password_hash, role) VALUES (?, '', ?)", user.Username, user.Role)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO oidc_identities (user_id, issuer, subject) VALUES (?, ?, ?)", user.ID, issuer, subject)
+			return err
+		})
+		if isDuplicateKey(err) && attempt < 3 {
+			continue
+		}
+		if err == nil {
+			slog.InfoContext(ctx, "Registered OIDC user", "ID", user.ID, "username", user.Username)
+		}
+		return user, err
+	}
+}
+
+func findOIDCUser(ctx context.Context, issuer, subject string) (User, error) {
+	var user User
+	err := db.QueryRowContext(ctx, `
+SELECT u.id, u.username, u.role
+FROM oidc_identities i
+JOIN users u ON u.id = i.user_id
+WHERE i.issuer = ? AND i.subject = ?`, issuer, subject).Scan(&user.ID, &user.Username, &user.Role)
+	return user, err
+}
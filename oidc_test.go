@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeOIDCProvider serves discovery, keys and a token endpoint issuing ID
+// tokens for subject, with the nonce of the last authorization request.
+func fakeOIDCProvider(t *testing.T, subject string, nonce *string) *httptest.Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                server.URL,
+			"authorization_endpoint":                server.URL + "/authorize",
+			"token_endpoint":                        server.URL + "/token",
+			"jwks_uri":                              server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                server.URL,
+			"sub":                subject,
+			"aud":                "todo-api",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              *nonce,
+			"preferred_username": "Alice Smith",
+		})
+		idToken.Header["kid"] = "test"
+		signed, err := idToken.SignedString(key)
+		if err != nil {
+			t.Errorf("Failed to sign ID token: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "provider-token",
+			"token_type":   "Bearer",
+			"id_token":     signed,
+		})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// oidcLoginAs goes through the login redirect and calls back with code,
+// returning the callback response.
+func oidcLoginAs(t *testing.T, router http.Handler, nonce *string, code string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	if status := rr.Code; status != http.StatusFound {
+		t.Fatalf("Expected status 302, got %d: %s", status, rr.Body.String())
+	}
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	params := location.Query()
+	*nonce = params.Get("nonce")
+	if params.Get("code_challenge") == "" {
+		t.Errorf("Expected a PKCE challenge in %s", location)
+	}
+
+	req := httptest.NewRequest("GET", "/auth/oidc/callback?code="+code+"&state="+params.Get("state"), nil)
+	for _, cookie := range rr.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestOIDCLogin(t *testing.T) {
+	clearUsers(t)
+	enableJWTAuth(t)
+	var nonce string
+	provider := fakeOIDCProvider(t, "subject-1", &nonce)
+	config, err := newOIDCConfig(context.Background(), provider.URL, "todo-api", "secret", "http://localhost/auth/oidc/callback")
+	if err != nil {
+		t.Fatalf("Failed to discover the provider: %v", err)
+	}
+	oidcLogin = config
+	t.Cleanup(func() { oidcLogin = nil })
+	router := setupRouter()
+	seedUser(t, "alice-smith", editorRole)
+
+	var callers []principal
+	for range 2 {
+		rr := oidcLoginAs(t, router, &nonce, "good-code")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", status, rr.Body.String())
+		}
+		var token tokenResponse
+		json.Unmarshal(rr.Body.Bytes(), &token)
+		caller, err := parseToken(token.AccessToken)
+		if err != nil {
+			t.Fatalf("Expected a valid access token, got %v", err)
+		}
+		callers = append(callers, caller)
+	}
+	if callers[0].owner != "alice-smith-2" || callers[0].role != editorRole {
+		t.Errorf("Expected a new editor named after the claims, got %+v", callers[0])
+	}
+	if callers[1] != callers[0] {
+		t.Errorf("Expected logging in again to find the same user, got %+v and %+v", callers[0], callers[1])
+	}
+
+	if rr := oidcLoginAs(t, router, &nonce, "bad-code"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a rejected code, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/auth/oidc/callback?code=good-code&state=forged", nil)
+	req.AddCookie(&http.Cookie{Name: oidcCookie, Value: "state.nonce.verifier"})
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a forged state, got %d", status)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPISpec describes every route of newRouter. openapi_test.go checks
+// that the two stay in sync and that responses match their schemas.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// openAPIJSON converts the spec to JSON once, pointing its server at the
+// API prefix.
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(openAPISpec, &doc); err != nil {
+		return nil, err
+	}
+	server := "/"
+	if apiPrefix != "" {
+		server = apiPrefix
+	}
+	doc["servers"] = []map[string]string{{"url": server}}
+	return json.Marshal(doc)
+})
+
+// OpenAPIHandler serves the OpenAPI specification of the API.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := openAPIJSON()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error converting OpenAPI spec", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// swaggerUI is the Swagger UI release the docs page loads. It is pinned to
+// an exact version, whose files npm never changes, rather than following
+// the latest 5.x.
+const swaggerUI = "https://unpkg.com/swagger-ui-dist@5.17.14"
+
+// docsPage renders /openapi.json with Swagger UI, loaded from a CDN.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Todo API</title>
+  <link rel="stylesheet" href="` + swaggerUI + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + swaggerUI + `/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// DocsHandler serves interactive API documentation.
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
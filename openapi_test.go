@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("text/csv", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/calendar", openapi3filter.FileBodyDecoder)
+}
+
+// loadOpenAPISpec parses and validates the spec as served.
+func loadOpenAPISpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	data, err := openAPIJSON()
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	doc, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("Invalid spec: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	doc := loadOpenAPISpec(t)
+
+	routes := map[string]bool{}
+	err := setupRouter().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			routes[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+	for route := range routes {
+		// The unversioned paths are deprecated aliases of the legacy
+		// version, documented under its prefix.
+		method, path, _ := strings.Cut(route, " ")
+		if alias := "/" + legacyVersion.name + path; routes[method+" "+alias] {
+			route = method + " " + alias
+		}
+		// HEAD is served wherever GET is, and only worth documenting
+		// where it differs.
+		if path, ok := strings.CutPrefix(route, "HEAD "); ok && documented["GET "+path] {
+			continue
+		}
+		if !documented[route] {
+			t.Errorf("Route %s is missing from the spec", route)
+		}
+	}
+	for op := range documented {
+		if !routes[op] {
+			t.Errorf("Spec documents %s, which isn't routed", op)
+		}
+	}
+}
+
+func TestOpenAPIEndpoints(t *testing.T) {
+	router := setupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil || doc.OpenAPI == "" {
+		t.Errorf("Expected an OpenAPI document, got %q (%v)", rr.Body.String(), err)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/docs", nil))
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if !strings.Contains(rr.Body.String(), "openapi.json") {
+		t.Errorf("Expected the docs page to load the spec, got %q", rr.Body.String())
+	}
+}
+
+// TestResponsesMatchOpenAPISpec sends requests covering every operation and
+// checks both the requests and the responses against the spec.
+func TestResponsesMatchOpenAPISpec(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	adminAPIKey = "test-admin-key"
+	t.Cleanup(func() { adminAPIKey = "" })
+
+	doc := loadOpenAPISpec(t)
+	specRouter, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("Failed to route spec: %v", err)
+	}
+	router := setupRouter()
+	admin := seedUser(t, "admin", adminRole)
+	seedUser(t, "bob", editorRole)
+	token, _ := issueToken(admin, time.Now())
+
+	send := func(method, path, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		newRequest := func() *http.Request {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			if strings.HasPrefix(path, "/admin/") {
+				req.Header.Set(apiKeyHeader, adminAPIKey)
+			}
+			if body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			return req
+		}
+
+		req := newRequest()
+		route, params, err := specRouter.FindRoute(req)
+		if err != nil {
+			t.Fatalf("%s %s isn't in the spec: %v", method, path, err)
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+				IncludeResponseStatus: true,
+			},
+		}
+		// Requests answered with an error are expected to break the spec.
+		if want < 400 {
+			if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil {
+				t.Errorf("%s %s: request doesn't match the spec: %v", method, path, err)
+			}
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest())
+		if rr.Code != want {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, want, rr.Code, rr.Body.String())
+		}
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rr.Code,
+			Header:                 rr.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(rr.Body.Bytes())),
+			Options:                input.Options,
+		})
+		if err != nil {
+			t.Errorf("%s %s: response doesn't match the spec: %v", method, path, err)
+		}
+		return rr
+	}
+	decode := func(rr *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+	}
+
+	var created Todo
+	decode(send("POST", "/v1/todos", `{"task":"Parent","priority":"high","tags":["home"],"due_date":"2030-01-02T15:04:05Z"}`, http.StatusCreated), &created)
+	todo := "/v1/todos/" + strconv.Itoa(created.ID)
+	var sub Todo
+	decode(send("POST", "/v1/todos", `{"task":"Child","parent_id":`+strconv.Itoa(created.ID)+`}`, http.StatusCreated), &sub)
+	var batch []Todo
+	decode(send("POST", "/v1/todos/batch", `[{"task":"One"},{"task":"Two"}]`, http.StatusCreated), &batch)
+
+	send("POST", "/v1/todos", `{"task":""}`, http.StatusUnprocessableEntity)
+	send("POST", "/v1/todos", `{`, http.StatusBadRequest)
+	send("GET", "/v1/todos?limit=2&sort=-priority,id", "", http.StatusOK)
+	send("GET", "/v1/todos?tag=home&done=false&q=Par", "", http.StatusOK)
+	send("GET", "/v1/todos?limit=1&cursor=&sort=-created_at", "", http.StatusOK)
+	send("GET", "/v1/todos?limit=1&format=jsonapi", "", http.StatusOK)
+	send("GET", "/v1/todos?fields=id,done", "", http.StatusOK)
+	send("GET", "/v1/todos?format=jsonapi&fields%5Btodos%5D=done,list", "", http.StatusOK)
+	send("GET", "/v1/todos.csv", "", http.StatusOK)
+	send("GET", "/v1/todos/export?format=csv", "", http.StatusOK)
+	send("GET", "/v1/todos.ics", "", http.StatusOK)
+	send("GET", "/v1/todos/forecast?window=7", "", http.StatusOK)
+	send("GET", "/v1/stats?from=2020-01-01&to=2020-12-31", "", http.StatusOK)
+	send("GET", "/v1/todos/focus?n=2", "", http.StatusOK)
+	send("GET", todo+"?expand=subtasks", "", http.StatusOK)
+	send("GET", todo+"?expand=subtasks&format=jsonapi", "", http.StatusOK)
+	send("GET", todo+"?expand=subtasks&fields=id,subtasks", "", http.StatusOK)
+	send("HEAD", todo, "", http.StatusOK)
+	send("GET", "/v1/todos/999999", "", http.StatusNotFound)
+	send("GET", "/v1/todos/abc", "", http.StatusBadRequest)
+	send("GET", todo+"/subtasks", "", http.StatusOK)
+	decode(send("PUT", todo, `{"id":`+strconv.Itoa(created.ID)+`,"task":"Renamed parent","priority":"urgent","version":`+strconv.Itoa(created.Version)+`}`, http.StatusOK), &created)
+	send("PATCH", todo, `{"due_date":null,"tags":["home","work"],"version":`+strconv.Itoa(created.Version)+`}`, http.StatusOK)
+	send("PUT", todo+"/tags/errands", "", http.StatusOK)
+	send("DELETE", todo+"/tags/errands", "", http.StatusOK)
+	send("PUT", todo+"/assignee", `{"username":"admin"}`, http.StatusOK)
+	send("GET", "/v1/todos?assignee=me", "", http.StatusOK)
+	send("GET", todo+"/history?action=updated&limit=5", "", http.StatusOK)
+	send("GET", "/v1/audit?actor=admin&since=2020-01-01T00:00:00Z", "", http.StatusOK)
+	send("POST", todo+"/undo", "", http.StatusOK)
+	send("POST", todo+"/clone?subtasks=true", "", http.StatusCreated)
+	send("DELETE", todo+"/assignee", "", http.StatusOK)
+	var comment Comment
+	decode(send("POST", todo+"/comments", `{"body":"Started on it"}`, http.StatusCreated), &comment)
+	commentPath := todo + "/comments/" + strconv.Itoa(comment.ID)
+	send("GET", todo+"/comments", "", http.StatusOK)
+	send("GET", commentPath, "", http.StatusOK)
+	send("PUT", commentPath, `{"body":"Almost done"}`, http.StatusOK)
+	send("DELETE", commentPath, "", http.StatusNoContent)
+	send("GET", "/v1/tags", "", http.StatusOK)
+	send("POST", "/v1/todos/complete", `{"ids":[`+strconv.Itoa(sub.ID)+`,999999]}`, http.StatusOK)
+	send("POST", "/v1/todos/"+strconv.Itoa(sub.ID)+"/archive", "", http.StatusOK)
+	send("GET", "/v1/todos?archived=true", "", http.StatusOK)
+	send("POST", "/v1/todos/"+strconv.Itoa(sub.ID)+"/unarchive", "", http.StatusOK)
+	send("POST", "/v1/todos/"+strconv.Itoa(batch[0].ID)+"/archive", "", http.StatusConflict)
+	send("POST", "/v1/todos/archive?completed_before=2030-01-01T00:00:00Z", "", http.StatusOK)
+	send("POST", "/v1/todos/reorder", `{"ids":[`+strconv.Itoa(batch[1].ID)+`,`+strconv.Itoa(batch[0].ID)+`]}`, http.StatusNoContent)
+	send("GET", "/v1/todos?sort=position", "", http.StatusOK)
+	send("POST", "/v1/todos/batch-update", `{"ids":[`+strconv.Itoa(batch[0].ID)+`],"done":true}`, http.StatusOK)
+	send("POST", "/v1/todos/import/todoist", `{"items":[{"content":"Imported","checked":false,"priority":4,"labels":["todoist"]}]}`, http.StatusOK)
+
+	var list List
+	decode(send("POST", "/v1/lists", `{"name":"Groceries"}`, http.StatusCreated), &list)
+	listPath := "/v1/lists/" + strconv.Itoa(list.ID)
+	send("GET", "/v1/lists", "", http.StatusOK)
+	send("GET", listPath, "", http.StatusOK)
+	send("PUT", listPath, `{"name":"Shopping"}`, http.StatusOK)
+	send("GET", listPath+"/todos", "", http.StatusOK)
+	send("PUT", listPath+"/members/bob", `{"permission":"read"}`, http.StatusCreated)
+	send("PUT", listPath+"/members/bob", `{"permission":"write"}`, http.StatusOK)
+	send("GET", listPath+"/members", "", http.StatusOK)
+	send("DELETE", listPath+"/members/bob", "", http.StatusNoContent)
+	send("DELETE", listPath, "", http.StatusNoContent)
+
+	var key APIKey
+	decode(send("POST", "/v1/apikeys", `{"name":"CI"}`, http.StatusCreated), &key)
+	send("GET", "/v1/apikeys", "", http.StatusOK)
+	send("DELETE", "/v1/apikeys/"+strconv.Itoa(key.ID), "", http.StatusNoContent)
+
+	var hook Webhook
+	decode(send("POST", "/v1/webhooks", `{"url":"https://example.com/hook","events":["completed"]}`, http.StatusCreated), &hook)
+	hookPath := "/v1/webhooks/" + strconv.Itoa(hook.ID)
+	send("GET", "/v1/webhooks", "", http.StatusOK)
+	send("GET", hookPath, "", http.StatusOK)
+	send("PUT", hookPath, `{"url":"https://example.com/moved"}`, http.StatusOK)
+	send("GET", hookPath+"/deliveries", "", http.StatusOK)
+	send("DELETE", hookPath, "", http.StatusNoContent)
+
+	var tmpl Template
+	decode(send("POST", "/v1/templates", `{"name":"Release","todos":[{"task":"Tag","subtasks":[{"task":"Push"}]}]}`, http.StatusCreated), &tmpl)
+	tmplPath := "/v1/templates/" + strconv.Itoa(tmpl.ID)
+	send("GET", "/v1/templates", "", http.StatusOK)
+	send("GET", tmplPath, "", http.StatusOK)
+	send("PUT", tmplPath, `{"name":"Hotfix","todos":[{"task":"Patch"}]}`, http.StatusOK)
+	send("POST", tmplPath+"/instantiate", "", http.StatusCreated)
+	send("DELETE", tmplPath, "", http.StatusNoContent)
+
+	send("PUT", "/v1/users/me/notifications", `{"email":"alice@example.com"}`, http.StatusOK)
+	send("GET", "/v1/users/me/notifications", "", http.StatusOK)
+
+	var users []User
+	decode(send("GET", "/v1/users", "", http.StatusOK), &users)
+	bob := "/v1/users/" + strconv.Itoa(users[len(users)-1].ID)
+	send("PATCH", bob, `{"role":"viewer"}`, http.StatusOK)
+	send("DELETE", bob, "", http.StatusNoContent)
+
+	send("POST", "/v1/todos/batch-delete", `{"ids":[`+strconv.Itoa(batch[0].ID)+`]}`, http.StatusOK)
+	send("DELETE", "/v1/todos?ids="+strconv.Itoa(batch[1].ID)+",999999", "", http.StatusOK)
+	send("DELETE", todo, "", http.StatusNoContent)
+
+	send("POST", "/v1/graphql", `{"query":"{ todos { totalCount } }"}`, http.StatusOK)
+
+	send("GET", "/healthz", "", http.StatusOK)
+	send("GET", "/livez", "", http.StatusOK)
+	send("GET", "/readyz", "", http.StatusOK)
+	send("GET", "/admin/query-stats", "", http.StatusOK)
+	send("GET", "/admin/read-only", "", http.StatusOK)
+	send("GET", "/openapi.json", "", http.StatusOK)
+	send("GET", "/docs", "", http.StatusOK)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parseLimit reads the ?limit= page size, defaulting to defaultPageSize.
+func parseLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, fmt.Errorf("Invalid limit! limit must be between 1 and %d", maxPageSize)
+	}
+	return limit, nil
+}
+
+// parseOffset reads the ?offset= number of todos to skip, defaulting to 0.
+func parseOffset(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("offset")
+	if v == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(v)
+	if err != nil || offset < 0 {
+		return 0, errors.New("Invalid offset! offset must be a non-negative integer")
+	}
+	return offset, nil
+}
+
+// pageLink returns the URL of the current request with the given query
+// parameters replaced, for use in a Link header.
+func pageLink(r *http.Request, params map[string]string) string {
+	query := r.URL.Query()
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// todoCursor is where a cursor page left off: the created_at and id of its
+// last todo. Clients get it as an opaque string to pass back in ?cursor=.
+type todoCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        int       `json:"i"`
+}
+
+// cursorColumns are the columns cursor pages may be sorted on, the ones a
+// todoCursor holds.
+var cursorColumns = map[string]bool{"id": true, "created_at": true}
+
+func (c todoCursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseCursor reads a cursor from a previous page's response.
+func parseCursor(v string) (todoCursor, error) {
+	var c todoCursor
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.ID < 1 {
+		return c, errors.New("Invalid cursor! Pass the cursor of a previous page as is")
+	}
+	return c, nil
+}
+
+// cursorOf returns the cursor of the page ending in todo.
+func cursorOf(todo Todo) todoCursor {
+	return todoCursor{CreatedAt: todo.CreatedAt, ID: todo.ID}
+}
+
+// value is the cursor's value of column, one of cursorColumns.
+func (c todoCursor) value(column string) any {
+	if column == "created_at" {
+		return dbDialect.timestamp(c.CreatedAt)
+	}
+	return c.ID
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListHandlerKeysetPagination(t *testing.T) {
+	clearTodos(t)
+	var ids []int
+	for i := 0; i < 5; i++ {
+		ids = append(ids, seedTodo(t, "task "+strconv.Itoa(i), false))
+	}
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos?after_id="+strconv.Itoa(ids[0])+"&limit=2", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 2 || todos[0].ID != ids[1] || todos[1].ID != ids[2] {
+		t.Fatalf("Expected todos %v, got %+v", ids[1:3], todos)
+	}
+
+	wantLink := `</todos?after_id=` + strconv.Itoa(ids[2]) + `&limit=2>; rel="next"`
+	if link := rr.Header().Get("Link"); link != wantLink {
+		t.Errorf("Expected Link %s, got %s", wantLink, link)
+	}
+
+	req = httptest.NewRequest("GET", "/todos?after_id="+strconv.Itoa(ids[2])+"&limit=2", nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 2 || todos[1].ID != ids[4] {
+		t.Fatalf("Expected the last two todos, got %+v", todos)
+	}
+	if link := rr.Header().Get("Link"); link != "" {
+		t.Errorf("Expected no Link on the last page, got %s", link)
+	}
+}
+
+func TestListHandlerCursorPagination(t *testing.T) {
+	clearTodos(t)
+	var ids []int
+	for i := 0; i < 5; i++ {
+		ids = append(ids, seedTodo(t, "task "+strconv.Itoa(i), false))
+	}
+	// Newest first that's 4, then 0 and 1, created at the same time, 2 and 3.
+	base := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, hours := range []int{1, 1, 0, -1, 3} {
+		if _, err := db.Exec("UPDATE todos SET created_at = ? WHERE id = ?", dbDialect.timestamp(base.Add(time.Duration(hours)*time.Hour)), ids[i]); err != nil {
+			t.Fatalf("Failed to set created_at: %v", err)
+		}
+	}
+
+	router := setupRouter()
+	var got []int
+	path := "/todos?sort=-created_at&limit=2&cursor="
+	for pages := 0; path != ""; pages++ {
+		if pages == 3 {
+			t.Fatalf("Expected 3 pages, got more")
+		}
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+
+		var todos []Todo
+		if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		for _, todo := range todos {
+			got = append(got, todo.ID)
+		}
+
+		path = ""
+		if next := rr.Header().Get("X-Next-Cursor"); next != "" {
+			path = "/todos?cursor=" + next + "&limit=2&sort=-created_at"
+			if link := rr.Header().Get("Link"); link != "<"+path+`>; rel="next"` {
+				t.Errorf("Expected a Link to the next page, got %s", link)
+			}
+		}
+	}
+
+	want := []int{ids[4], ids[0], ids[1], ids[2], ids[3]}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected todos %v, got %v", want, got)
+	}
+}
+
+func TestListHandlerRejectsBadCursor(t *testing.T) {
+	router := setupRouter()
+
+	for _, path := range []string{
+		"/todos?cursor=nonsense",
+		"/todos?cursor=&offset=20",
+		"/todos?cursor=&after_id=1",
+		"/todos?cursor=&sort=task",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestListHandlerOffsetPagination(t *testing.T) {
+	clearTodos(t)
+	var ids []int
+	for i := 0; i < 5; i++ {
+		ids = append(ids, seedTodo(t, "task "+strconv.Itoa(i), false))
+	}
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos?limit=2&offset=2", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 2 || todos[0].ID != ids[2] || todos[1].ID != ids[3] {
+		t.Fatalf("Expected todos %v, got %+v", ids[2:4], todos)
+	}
+
+	if total := rr.Header().Get("X-Total-Count"); total != "5" {
+		t.Errorf("Expected X-Total-Count 5, got %q", total)
+	}
+	wantLink := `</todos?limit=2&offset=4>; rel="next", </todos?limit=2&offset=0>; rel="prev"`
+	if link := rr.Header().Get("Link"); link != wantLink {
+		t.Errorf("Expected Link %s, got %s", wantLink, link)
+	}
+}
+
+func TestListHandlerRejectsBadOffset(t *testing.T) {
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos?offset=-1", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", status)
+	}
+}
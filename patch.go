@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// todoPatch holds the fields of a PATCH body. Fields left out of the body
+// stay nil and keep their current value.
+type todoPatch struct {
+	Task        *string   `json:"task"`
+	Description *string   `json:"description"`
+	Done        *bool     `json:"done"`
+	Priority    *string   `json:"priority"`
+	Tags        *[]string `json:"tags"`
+
+	// Version is the version of the todo the patch was made against, or
+	// 0 to patch whatever is stored.
+	Version int `json:"version"`
+
+	// Nullable fields stay raw to tell an explicit null, which clears the
+	// field, from a missing one.
+	DueDate  json.RawMessage `json:"due_date"`
+	RemindAt json.RawMessage `json:"remind_at"`
+	ListID   json.RawMessage `json:"list_id"`
+	ParentID json.RawMessage `json:"parent_id"`
+}
+
+// apply merges the patch into todo.
+func (p todoPatch) apply(todo *Todo) error {
+	if p.Task != nil {
+		todo.Task = *p.Task
+	}
+	if p.Description != nil {
+		todo.Description = *p.Description
+	}
+	if p.Done != nil {
+		todo.Done = *p.Done
+	}
+	if p.Priority != nil {
+		todo.Priority = *p.Priority
+	}
+	if p.Tags != nil {
+		todo.Tags = *p.Tags
+	}
+	if p.DueDate != nil {
+		todo.DueDate = nil
+		if err := json.Unmarshal(p.DueDate, &todo.DueDate); err != nil {
+			return err
+		}
+	}
+	if p.RemindAt != nil {
+		todo.RemindAt = nil
+		if err := json.Unmarshal(p.RemindAt, &todo.RemindAt); err != nil {
+			return err
+		}
+	}
+	if p.ListID != nil {
+		todo.ListID = nil
+		if err := json.Unmarshal(p.ListID, &todo.ListID); err != nil {
+			return err
+		}
+	}
+	if p.ParentID != nil {
+		todo.ParentID = nil
+		if err := json.Unmarshal(p.ParentID, &todo.ParentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PatchHandler updates only the fields present in the body and returns the
+// merged todo.
+func PatchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	var patch todoPatch
+	if err = decodeBody(r, &patch); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	// Check the patch on its own first so a malformed body is a 400 even
+	// when the todo doesn't exist.
+	if err = patch.apply(&Todo{}); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	todo, _, err := todoRepo.Update(r.Context(), principalFrom(r.Context()), id, func(todo *Todo) error {
+		if err := checkUpdatePreconditions(r, *todo, patch.Version); err != nil {
+			return err
+		}
+		before := todo.DueDate
+		if err := patch.apply(todo); err != nil {
+			return err
+		}
+		errs := validateTodo(todo)
+		if errs = append(errs, checkDueDate(*todo, before)...); errs != nil {
+			return errs
+		}
+		return nil
+	}, UpdateOptions{Cascade: cascadeRequested(r)})
+	if writePreconditionError(w, r, err) {
+		return
+	}
+	var errs validationErrors
+	if errors.As(err, &errs) {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error updating todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Patched todo", "ID", id, "Data", todo)
+
+	body, etag, err := encodeWithETag(todo)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPatchHandler(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "original task", false)
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("PATCH", "/todos/"+strconv.Itoa(id), strings.NewReader(`{"done":true,"version":1}`))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if todo.ID != id || todo.Task != "original task" || !todo.Done {
+		t.Errorf("Expected merged todo, got %+v", todo)
+	}
+
+	req = httptest.NewRequest("PATCH", "/todos/"+strconv.Itoa(id), strings.NewReader(`{"task":"  renamed  ","version":2}`))
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	var task string
+	var done bool
+	if err := db.QueryRow("SELECT task, done FROM todos WHERE id = ?", id).Scan(&task, &done); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if task != "renamed" || !done {
+		t.Errorf("Expected task 'renamed' and done=true, got %q and %v", task, done)
+	}
+}
+
+func TestPatchHandlerErrors(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "original task", false)
+
+	router := setupRouter()
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/todos/" + strconv.Itoa(id), `{"task":"   ","version":1}`, http.StatusUnprocessableEntity},
+		{"/todos/999999", `{"done":true}`, http.StatusNotFound},
+		{"/todos/" + strconv.Itoa(id), `not json`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("PATCH", tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.path, tt.body, tt.status, status)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	for _, body := range []string{
+		`{"task":"defaulted"}`,
+		`{"task":"important","priority":"high"}`,
+		`{"task":"whenever","priority":"low"}`,
+	} {
+		req := httptest.NewRequest("POST", "/todos", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusCreated {
+			t.Fatalf("Expected status 201 for %s, got %d", body, status)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task":"bogus","priority":"critical"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown priority, got %d", status)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"?priority=high", "important"},
+		{"?sort=-priority", "important,defaulted,whenever"},
+		{"?sort=priority", "whenever,defaulted,important"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/todos"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var todos []Todo
+		if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", tt.query, err)
+		}
+		var got []string
+		for _, todo := range todos {
+			got = append(got, todo.Task)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%s: expected %s, got %v", tt.query, tt.want, got)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/todos?priority=critical", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 filtering by an unknown priority, got %d", status)
+	}
+}
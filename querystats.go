@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxLatencySamples bounds how many recent durations are kept per endpoint
+// for the percentile estimates.
+const maxLatencySamples = 1024
+
+type endpointStats struct {
+	count   int
+	errors  int
+	samples []time.Duration // ring buffer of the latest durations
+	next    int
+}
+
+// queryStatsRecorder accumulates per-endpoint request statistics in process
+// memory since startup.
+type queryStatsRecorder struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointStats
+}
+
+var queryStats = &queryStatsRecorder{endpoints: make(map[string]*endpointStats)}
+
+// record adds a request to the endpoint's stats. Responses with a 5xx status
+// count as errors.
+func (s *queryStatsRecorder) record(endpoint string, duration time.Duration, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.endpoints[endpoint]
+	if !ok {
+		stats = &endpointStats{}
+		s.endpoints[endpoint] = stats
+	}
+
+	stats.count++
+	if status >= 500 {
+		stats.errors++
+	}
+	if len(stats.samples) < maxLatencySamples {
+		stats.samples = append(stats.samples, duration)
+	} else {
+		stats.samples[stats.next] = duration
+		stats.next = (stats.next + 1) % maxLatencySamples
+	}
+}
+
+type endpointSummary struct {
+	Endpoint  string  `json:"endpoint"`
+	Count     int     `json:"count"`
+	P50Millis float64 `json:"p50_ms"`
+	P95Millis float64 `json:"p95_ms"`
+	P99Millis float64 `json:"p99_ms"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// snapshot summarizes every endpoint, sorted by name.
+func (s *queryStatsRecorder) snapshot() []endpointSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries := make([]endpointSummary, 0, len(s.endpoints))
+	for endpoint, stats := range s.endpoints {
+		sorted := slices.Clone(stats.samples)
+		slices.Sort(sorted)
+		summaries = append(summaries, endpointSummary{
+			Endpoint:  endpoint,
+			Count:     stats.count,
+			P50Millis: percentile(sorted, 0.50),
+			P95Millis: percentile(sorted, 0.95),
+			P99Millis: percentile(sorted, 0.99),
+			ErrorRate: float64(stats.errors) / float64(stats.count),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Endpoint < summaries[j].Endpoint })
+	return summaries
+}
+
+// percentile returns the nearest-rank percentile of sorted in milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
+
+// QueryStatsHandler returns the request statistics gathered since startup.
+func QueryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(queryStats.snapshot())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding JSON", "error", err)
+		return
+	}
+}
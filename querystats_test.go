@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestQueryStatsHandler(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	adminAPIKey = "test-admin-key"
+	t.Cleanup(func() { adminAPIKey = "" })
+
+	router := setupRouter()
+
+	for _, path := range []string{"/todos", "/todos/" + strconv.Itoa(id), "/todos/" + strconv.Itoa(id), "/todos/999999"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	req := httptest.NewRequest("GET", "/admin/query-stats", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without API key, got %d", status)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/query-stats", nil)
+	req.Header.Set("X-API-Key", "test-admin-key")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var stats []endpointSummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	byEndpoint := make(map[string]endpointSummary)
+	for _, s := range stats {
+		byEndpoint[s.Endpoint] = s
+	}
+
+	read, ok := byEndpoint["GET /todos/{id}"]
+	if !ok {
+		t.Fatalf("Expected stats for GET /todos/{id}, got %+v", stats)
+	}
+	if read.Count < 3 {
+		t.Errorf("Expected at least 3 reads recorded, got %d", read.Count)
+	}
+	if read.P99Millis < read.P50Millis {
+		t.Errorf("Expected p99 >= p50, got %+v", read)
+	}
+	if _, ok := byEndpoint["GET /todos"]; !ok {
+		t.Errorf("Expected stats for GET /todos, got %+v", stats)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// queryTimeout bounds how long a single database query may run, set from
+// DB_QUERY_TIMEOUT, so a slow query fails instead of holding on to its
+// connection and the goroutine waiting for it. Queries are canceled with
+// their request too. 0 lets them run for as long as their context allows.
+var queryTimeout time.Duration
+
+type noQueryTimeoutKey struct{}
+
+// withoutQueryTimeout exempts the queries run with ctx from queryTimeout,
+// for migrations, and for exports, which read their rows for as long as
+// the client takes to download them.
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryTimeoutKey{}, true)
+}
+
+// queryContext returns the context to run a query in, with queryTimeout
+// applied, and the function releasing it once the query is done.
+func queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 || ctx.Value(noQueryTimeoutKey{}) != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// timeoutConnector hands out connections that run every query with
+// queryTimeout. Transactions aren't bounded as a whole, only each query
+// in them.
+type timeoutConnector struct {
+	driver.Connector
+}
+
+func (c timeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return timeoutConn{conn}, nil
+}
+
+// dsnConnector is the driver.Connector of drivers that only open
+// connections by DSN.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// timeoutConn forwards to the wrapped connection, like rebindConn, and
+// applies queryTimeout to queries and prepared statements. The rows of a
+// query are read within the timeout too, which ends when they're closed.
+type timeoutConn struct {
+	driver.Conn
+}
+
+func (c timeoutConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return timeoutStmt{stmt}, nil
+}
+
+func (c timeoutConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	p, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	stmt, err := p.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return timeoutStmt{stmt}, nil
+}
+
+func (c timeoutConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c timeoutConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, cancel := queryContext(ctx)
+	rows, err := q.QueryContext(ctx, query, args)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return timeoutRows{rows, cancel}, nil
+}
+
+func (c timeoutConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c timeoutConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c timeoutConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c timeoutConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue lets the wrapped driver convert arguments its own way,
+// as MySQL's does.
+func (c timeoutConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// timeoutStmt is a prepared statement of a timeoutConn. MySQL prepares the
+// queries that have arguments.
+type timeoutStmt struct {
+	driver.Stmt
+}
+
+func (s timeoutStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	return s.Stmt.Exec(namedValues(args))
+}
+
+func (s timeoutStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, cancel := queryContext(ctx)
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValues(args))
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return timeoutRows{rows, cancel}, nil
+}
+
+func (s timeoutStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// timeoutRows releases the timeout of their query when closed.
+type timeoutRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r timeoutRows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
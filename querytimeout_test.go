@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	saved := queryTimeout
+	queryTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { queryTimeout = saved })
+
+	// Counts far enough to take much longer than the timeout.
+	slow := `
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5000000)
+SELECT COUNT(*) FROM n`
+	switch dbDialect {
+	case mysqlDialect:
+		slow = "SELECT SLEEP(2)"
+	case postgresDialect:
+		slow = "SELECT pg_sleep(2)"
+	}
+
+	var n int
+	start := time.Now()
+	if err := db.QueryRowContext(context.Background(), slow).Scan(&n); err == nil {
+		t.Fatalf("Expected the query to time out, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the query to be canceled, it took %v", elapsed)
+	}
+
+	if err := db.QueryRowContext(context.Background(), "SELECT 1").Scan(&n); err != nil {
+		t.Errorf("Expected a quick query to succeed, got %v", err)
+	}
+	queryTimeout = time.Nanosecond
+	if err := db.QueryRowContext(withoutQueryTimeout(context.Background()), "SELECT 1").Scan(&n); err != nil {
+		t.Errorf("Expected no timeout with withoutQueryTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// roleMiddleware only lets viewers make safe requests. What editors may
+// change is limited by todoScope instead.
+func roleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if principalFrom(r.Context()).role == viewerRole {
+				writeErrorCode(w, r, codeReadOnlyRole, "Viewers have read-only access", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin answers 403 to callers that aren't admins.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !principalFrom(r.Context()).isAdmin() {
+			writeErrorCode(w, r, codeAdminRequired, "Only admins can do this", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
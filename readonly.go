@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+)
+
+// readOnly rejects every mutation of todos while set. It starts from
+// READ_ONLY and can be toggled at runtime through /admin/read-only.
+var readOnly atomic.Bool
+
+type readOnlyState struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+// readOnlyMiddleware answers 503 to anything but reads while the service
+// is read-only.
+func readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if readOnly.Load() {
+				writeErrorCode(w, r, codeReadOnlyMode, "Service is read-only for maintenance, try again later", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReadOnlyHandler reports whether the service is read-only, and toggles it
+// when called with PUT and a {"read_only": true|false} body.
+func ReadOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var data readOnlyState
+		if err := decodeBody(r, &data); err != nil {
+			writeBodyError(w, r, err)
+			return
+		}
+		readOnly.Store(data.ReadOnly)
+		slog.InfoContext(r.Context(), "Read-only mode changed", "read_only", data.ReadOnly)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readOnlyState{ReadOnly: readOnly.Load()})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	adminAPIKey = "test-admin-key"
+	t.Cleanup(func() {
+		adminAPIKey = ""
+		readOnly.Store(false)
+	})
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("PUT", "/admin/read-only", strings.NewReader(`{"read_only":true}`))
+	req.Header.Set("X-API-Key", "test-admin-key")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200 toggling read-only, got %d", status)
+	}
+
+	req = httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task":"New task"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 for create, got %d", status)
+	}
+
+	req = httptest.NewRequest("DELETE", "/todos/"+strconv.Itoa(id), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 for delete, got %d", status)
+	}
+
+	req = httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected reads to keep working, got %d", status)
+	}
+}
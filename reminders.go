@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// reminderMaxAttempts is how many times a reminder is dispatched before
+	// it is given up on.
+	reminderMaxAttempts = 6
+	// reminderBatchSize is how many due reminders are dispatched per poll.
+	reminderBatchSize = 10
+	// reminderClaimTimeout is how long a reminder being dispatched is held
+	// back from other pollers, in case its dispatcher dies halfway.
+	reminderClaimTimeout = time.Minute
+	// maxReminderErrorLength caps the error kept for a failed reminder.
+	maxReminderErrorLength = 1000
+)
+
+var (
+	// reminderRetryDelay is the wait after the first failed dispatch of a
+	// reminder, doubling with every further one.
+	reminderRetryDelay = 30 * time.Second
+	// reminderPollInterval is how often due reminders are looked for.
+	reminderPollInterval = 5 * time.Second
+
+	// reminderSinks are where reminders are dispatched to. They are set
+	// from REMINDER_SINKS.
+	reminderSinks = []reminderSink{logReminderSink{}}
+)
+
+// reminder is a todo whose remind_at has come, about to be dispatched.
+type reminder struct {
+	id    int
+	owner principal
+	todo  Todo
+}
+
+// reminderSink notifies the owner of a todo of its reminder. Reminders are
+// dispatched at least once, so a sink may see the same one again after it
+// or another sink failed.
+type reminderSink interface {
+	notify(ctx context.Context, r reminder) error
+}
+
+// logReminderSink logs reminders, for deployments without anything better
+// to send them to.
+type logReminderSink struct{}
+
+func (logReminderSink) notify(ctx context.Context, r reminder) error {
+	slog.InfoContext(ctx, "Reminder due", "ID", r.todo.ID, "Task", r.todo.Task, "owner", r.owner.owner, "remind_at", r.todo.RemindAt)
+	return nil
+}
+
+// webhookReminderSink queues a reminder event for the webhooks subscribed
+// to those, which are then delivered like any other event.
+type webhookReminderSink struct{}
+
+func (webhookReminderSink) notify(ctx context.Context, r reminder) error {
+	event := todoEvent{Type: "reminder", Todo: r.todo, owner: r.owner}
+	return enqueueWebhookDeliveries(ctx, "reminder-"+strconv.Itoa(r.id), event)
+}
+
+// reminderSinkNames are the REMINDER_SINKS values.
+var reminderSinkNames = []string{"log", "webhook", "email"}
+
+// parseReminderSinks reads the comma separated REMINDER_SINKS.
+func parseReminderSinks(v string) ([]reminderSink, error) {
+	var sinks []reminderSink
+	for _, name := range splitList(v) {
+		switch name {
+		case "log":
+			sinks = append(sinks, logReminderSink{})
+		case "webhook":
+			sinks = append(sinks, webhookReminderSink{})
+		case "email":
+			sinks = append(sinks, emailReminderSink{})
+		default:
+			return nil, fmt.Errorf("unknown reminder sink %q, expected some of %s", name, strings.Join(reminderSinkNames, ", "))
+		}
+	}
+	return sinks, nil
+}
+
+// runReminders dispatches reminders as they come due until ctx is done.
+func runReminders(ctx context.Context) {
+	ticker := time.NewTicker(reminderPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := scheduleDueReminders(ctx); err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Error scheduling reminders", "error", err)
+			}
+			continue
+		}
+		for {
+			sent, err := dispatchDueReminders(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Error dispatching reminders", "error", err)
+			}
+			if err != nil || sent < reminderBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// scheduleDueReminders records a pending reminder for every open todo whose
+// remind_at has passed and wasn't reminded of at that time yet. Moving a
+// todo's remind_at schedules it again.
+func scheduleDueReminders(ctx context.Context) error {
+	now := time.Now().UTC()
+	_, err := db.ExecContext(ctx, dbDialect.ignoreDuplicates(`
+INSERT INTO reminders (todo_id, remind_at, status, created_at, next_attempt_at)
+SELECT id, remind_at, 'pending', ?, ?
+FROM todos
+WHERE remind_at <= ? AND done = FALSE
+  AND NOT EXISTS (SELECT 1 FROM reminders r WHERE r.todo_id = todos.id AND r.remind_at = todos.remind_at)`),
+		now, now, now)
+	return err
+}
+
+// dispatchDueReminders makes the next attempt of up to reminderBatchSize
+// due reminders, notifying every sink, and records the outcome, retrying
+// failures with exponential backoff. It returns how many were due.
+func dispatchDueReminders(ctx context.Context) (int, error) {
+	type dueReminder struct {
+		id, todoID, attempts int
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT id, todo_id, attempts
+FROM reminders
+WHERE status = 'pending' AND next_attempt_at <= ?
+ORDER BY next_attempt_at, id
+LIMIT ?`, time.Now().UTC(), reminderBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var due []dueReminder
+	for rows.Next() {
+		var d dueReminder
+		if err = rows.Scan(&d.id, &d.todoID, &d.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range due {
+		// Claiming by attempt count keeps other pollers from dispatching it too.
+		now := time.Now().UTC()
+		result, err := db.ExecContext(ctx, "UPDATE reminders SET attempts = attempts + 1, last_attempt_at = ?, next_attempt_at = ? WHERE id = ? AND attempts = ?",
+			now, now.Add(reminderClaimTimeout), d.id, d.attempts)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		d.attempts++
+
+		r := reminder{id: d.id}
+		var userID sql.NullInt64
+		r.todo, err = scanTodo(db.QueryRowContext(ctx, "SELECT "+todoColumns+", owner, user_id FROM todos WHERE id = ?", d.todoID), &r.owner.owner, &userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted since, which deletes the reminder too.
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.owner.userID = int(userID.Int64)
+		todos := []Todo{r.todo}
+		if err = loadTags(ctx, db, todos); err != nil {
+			return 0, err
+		}
+		r.todo = todos[0]
+
+		var notifyErr error
+		// A todo done since it came due needs no reminding anymore.
+		if !r.todo.Done {
+			for _, sink := range reminderSinks {
+				if err := sink.notify(ctx, r); err != nil {
+					notifyErr = errors.Join(notifyErr, err)
+				}
+			}
+		}
+		if err = recordReminderAttempt(ctx, d.id, d.attempts, notifyErr); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// recordReminderAttempt marks a reminder sent, or schedules its next
+// attempt after a failure until reminderMaxAttempts is reached.
+func recordReminderAttempt(ctx context.Context, id, attempts int, notifyErr error) error {
+	if notifyErr == nil {
+		_, err := db.ExecContext(ctx, "UPDATE reminders SET status = 'sent', error = NULL, next_attempt_at = NULL WHERE id = ?", id)
+		return err
+	}
+
+	message := notifyErr.Error()
+	if len(message) > maxReminderErrorLength {
+		message = message[:maxReminderErrorLength]
+	}
+	if attempts >= reminderMaxAttempts {
+		slog.Warn("Gave up on reminder", "ID", id, "attempts", attempts, "error", message)
+		_, err := db.ExecContext(ctx, "UPDATE reminders SET status = 'failed', error = ?, next_attempt_at = NULL WHERE id = ?", message, id)
+		return err
+	}
+	next := time.Now().UTC().Add(reminderRetryDelay << (attempts - 1))
+	_, err := db.ExecContext(ctx, "UPDATE reminders SET error = ?, next_attempt_at = ? WHERE id = ?", message, next, id)
+	return err
+}
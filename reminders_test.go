@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func clearReminders(t *testing.T) {
+	t.Helper()
+	if _, err := db.Exec("DELETE FROM reminders"); err != nil {
+		t.Fatalf("Failed to clear reminders: %v", err)
+	}
+}
+
+// recordingSink is a reminderSink keeping the reminders it is given, and
+// failing with err when set.
+type recordingSink struct {
+	mu        sync.Mutex
+	reminders []reminder
+	err       error
+}
+
+func (s *recordingSink) notify(ctx context.Context, r reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reminders = append(s.reminders, r)
+	return s.err
+}
+
+// useReminderSink makes sink the only reminder sink for the rest of the test.
+func useReminderSink(t *testing.T, sink reminderSink) {
+	saved := reminderSinks
+	reminderSinks = []reminderSink{sink}
+	t.Cleanup(func() { reminderSinks = saved })
+}
+
+// setRemindAt PATCHes the todo's remind_at, with "null" to clear it, with
+// the ETag of the todo as it is.
+func setRemindAt(t *testing.T, router http.Handler, id int, remindAt string) Todo {
+	t.Helper()
+	path := "/todos/" + strconv.Itoa(id)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	req := httptest.NewRequest("PATCH", path, strings.NewReader(`{"remind_at":`+remindAt+`}`))
+	req.Header.Set("If-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 setting remind_at, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return todo
+}
+
+// runReminderPoll does what one tick of runReminders does.
+func runReminderPoll(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	if err := scheduleDueReminders(ctx); err != nil {
+		t.Fatalf("Failed to schedule reminders: %v", err)
+	}
+	if _, err := dispatchDueReminders(ctx); err != nil {
+		t.Fatalf("Failed to dispatch reminders: %v", err)
+	}
+}
+
+func TestTodoRemindAt(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+	id := seedTodo(t, "Call the plumber", false)
+
+	todo := setRemindAt(t, router, id, `"2030-01-02T17:04:05.9+02:00"`)
+	if want := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC); todo.RemindAt == nil || !todo.RemindAt.Equal(want) {
+		t.Errorf("Expected remind_at %v, got %v", want, todo.RemindAt)
+	}
+	if todo = setRemindAt(t, router, id, "null"); todo.RemindAt != nil {
+		t.Errorf("Expected null to clear remind_at, got %v", todo.RemindAt)
+	}
+}
+
+func TestDispatchDueReminders(t *testing.T) {
+	clearTodos(t)
+	clearReminders(t)
+	router := setupRouter()
+	sink := &recordingSink{}
+	useReminderSink(t, sink)
+
+	past := `"` + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + `"`
+	due := seedTodo(t, "Due", false)
+	setRemindAt(t, router, due, past)
+	setRemindAt(t, router, seedTodo(t, "Later", false), `"`+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+`"`)
+	setRemindAt(t, router, seedTodo(t, "Done already", true), past)
+	seedTodo(t, "No reminder", false)
+
+	runReminderPoll(t)
+	runReminderPoll(t)
+	if len(sink.reminders) != 1 || sink.reminders[0].todo.ID != due || sink.reminders[0].todo.Task != "Due" {
+		t.Fatalf("Expected one reminder of the due todo, got %+v", sink.reminders)
+	}
+	var status string
+	var attempts int
+	if err := db.QueryRow("SELECT status, attempts FROM reminders WHERE todo_id = ?", due).Scan(&status, &attempts); err != nil || status != "sent" || attempts != 1 {
+		t.Errorf("Expected the reminder recorded as sent, got %q after %d attempts: %v", status, attempts, err)
+	}
+
+	// Moving the reminder schedules it again.
+	setRemindAt(t, router, due, `"`+time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)+`"`)
+	runReminderPoll(t)
+	if len(sink.reminders) != 2 {
+		t.Errorf("Expected a second reminder after moving remind_at, got %d", len(sink.reminders))
+	}
+}
+
+func TestDispatchDueRemindersRetries(t *testing.T) {
+	clearTodos(t)
+	clearReminders(t)
+	router := setupRouter()
+	sink := &recordingSink{err: errors.New("mail server down")}
+	useReminderSink(t, sink)
+	saved := reminderRetryDelay
+	reminderRetryDelay = 0
+	t.Cleanup(func() { reminderRetryDelay = saved })
+
+	id := seedTodo(t, "Retry me", false)
+	setRemindAt(t, router, id, `"`+time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)+`"`)
+	for range reminderMaxAttempts + 1 {
+		runReminderPoll(t)
+	}
+	if len(sink.reminders) != reminderMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", reminderMaxAttempts, len(sink.reminders))
+	}
+
+	var status, message string
+	if err := db.QueryRow("SELECT status, error FROM reminders WHERE todo_id = ?", id).Scan(&status, &message); err != nil || status != "failed" || message != "mail server down" {
+		t.Errorf("Expected the reminder given up on, got %q with %q: %v", status, message, err)
+	}
+}
+
+func TestWebhookReminderSink(t *testing.T) {
+	clearTodos(t)
+	clearReminders(t)
+	clearWebhooks(t)
+	router := setupRouter()
+	useReminderSink(t, webhookReminderSink{})
+	hook := createWebhook(t, router, `{"url":"https://example.com/hook","events":["reminder"]}`)
+
+	id := seedTodo(t, "Hear about it", false)
+	setRemindAt(t, router, id, `"`+time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)+`"`)
+	runReminderPoll(t)
+
+	deliveries := webhookDeliveries(t, router, hook)
+	if len(deliveries) != 1 || deliveries[0].Event != "reminder" {
+		t.Fatalf("Expected a reminder delivery, got %+v", deliveries)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(deliveries[0].Payload, &payload); err != nil || payload.Todo.ID != id || !strings.HasPrefix(payload.ID, "reminder-") {
+		t.Errorf("Expected the todo in a reminder payload, got %s", deliveries[0].Payload)
+	}
+}
+
+func TestParseReminderSinks(t *testing.T) {
+	if sinks, err := parseReminderSinks("log, webhook"); err != nil || len(sinks) != 2 {
+		t.Errorf("Expected two sinks, got %v: %v", sinks, err)
+	}
+	if _, err := parseReminderSinks("log,carrier-pigeon"); err == nil {
+		t.Errorf("Expected an unknown sink rejected")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// ReorderHandler arranges the todos listed in {"ids": [...]} in that order,
+// for drag and drop. The todos swap the positions they had among
+// themselves, so todos left out of the list stay where they were. It fails
+// with 404 when any of them doesn't exist or the caller can't change it.
+func ReorderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := decodeBatch(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	seen := make(map[int]bool, len(data.IDs))
+	var errs validationErrors
+	for _, id := range data.IDs {
+		if seen[id] {
+			errs.add("ids", "todo %d is listed more than once", id)
+		}
+		seen[id] = true
+	}
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	scope, scopeArgs := caller.todoWriteScope("")
+	var args []any
+	for _, id := range data.IDs {
+		args = append(args, id)
+	}
+	var events []todoEvent
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT id, position FROM todos WHERE id IN ("+placeholders(len(args))+") AND "+scope+dbDialect.forUpdate(), append(args, scopeArgs...)...)
+		if err != nil {
+			return err
+		}
+		positions := make(map[int]int, len(data.IDs))
+		for rows.Next() {
+			var id, position int
+			if err = rows.Scan(&id, &position); err != nil {
+				rows.Close()
+				return err
+			}
+			positions[id] = position
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		if len(positions) != len(data.IDs) {
+			return errTodoNotFound
+		}
+
+		slots := slices.Sorted(maps.Values(positions))
+		// Todos sharing a position can't be told apart otherwise.
+		for i := 1; i < len(slots); i++ {
+			slots[i] = max(slots[i], slots[i-1]+1)
+		}
+		events, err = trackChanges(ctx, tx, caller, data.IDs, func() error {
+			for i, id := range data.IDs {
+				if positions[id] == slots[i] {
+					continue
+				}
+				if _, err := tx.ExecContext(ctx, "UPDATE todos SET position = ?, version = version + 1 WHERE id = ?", slots[i], id); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	})
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reordering todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	todoEvents.publishAll(events)
+
+	slog.InfoContext(ctx, "Reordered todos", "count", len(data.IDs))
+	w.WriteHeader(http.StatusNoContent)
+}
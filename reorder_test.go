@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestReorder(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+
+	var todos []Todo
+	for _, task := range []string{"A", "B", "C", "D"} {
+		rr := requestAs(router, alice, "POST", "/todos", `{"task": "`+task+`"}`)
+		var todo Todo
+		json.Unmarshal(rr.Body.Bytes(), &todo)
+		todos = append(todos, todo)
+	}
+	a, b, c, d := todos[0], todos[1], todos[2], todos[3]
+	if !(a.Position < b.Position && b.Position < c.Position && c.Position < d.Position) {
+		t.Fatalf("Expected new todos to go last, got %+v", todos)
+	}
+	rr := requestAs(router, bob, "POST", "/todos", `{"task": "Bob's"}`)
+	var bobs Todo
+	json.Unmarshal(rr.Body.Bytes(), &bobs)
+
+	order := func() string {
+		t.Helper()
+		rr := requestAs(router, alice, "GET", "/todos?sort=position", "")
+		var todos []Todo
+		json.Unmarshal(rr.Body.Bytes(), &todos)
+		var tasks string
+		for _, todo := range todos {
+			tasks += todo.Task
+		}
+		return tasks
+	}
+	reorder := func(ids ...int) int {
+		t.Helper()
+		body, _ := json.Marshal(map[string][]int{"ids": ids})
+		return requestAs(router, alice, "POST", "/todos/reorder", string(body)).Code
+	}
+
+	if code := reorder(c.ID, a.ID); code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 reordering, got %d", code)
+	}
+	if got := order(); got != "CBAD" {
+		t.Errorf("Expected C and A to swap places, got %s", got)
+	}
+	rr = requestAs(router, alice, "GET", "/todos/"+strconv.Itoa(a.ID), "")
+	var moved Todo
+	json.Unmarshal(rr.Body.Bytes(), &moved)
+	if moved.Version != a.Version+1 {
+		t.Errorf("Expected moving a todo to bump its version, got %d", moved.Version)
+	}
+	requestAs(router, alice, "PUT", "/todos/"+strconv.Itoa(a.ID), `{"id": `+strconv.Itoa(a.ID)+`, "task": "A", "position": 1, "version": `+strconv.Itoa(moved.Version)+`}`)
+	if got := order(); got != "CBAD" {
+		t.Errorf("Expected the position in a PUT body to be ignored, got %s", got)
+	}
+
+	if code := reorder(d.ID, b.ID, c.ID, a.ID); code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 reordering, got %d", code)
+	}
+	if got := order(); got != "DBCA" {
+		t.Errorf("Expected the new order, got %s", got)
+	}
+
+	if code := reorder(a.ID, a.ID); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a repeated id, got %d", code)
+	}
+	if code := reorder(a.ID, bobs.ID); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 with someone else's todo, got %d", code)
+	}
+	if code := reorder(); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 without ids, got %d", code)
+	}
+	if got := order(); got != "DBCA" {
+		t.Errorf("Expected failed reorders to change nothing, got %s", got)
+	}
+
+	// Todos sharing a position still end up in the requested order.
+	db.Exec("UPDATE todos SET position = 0")
+	if code := reorder(c.ID, b.ID, a.ID, d.ID); code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 reordering, got %d", code)
+	}
+	if got := order(); got != "CBAD" {
+		t.Errorf("Expected the requested order from equal positions, got %s", got)
+	}
+}
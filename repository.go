@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// TodoRepository stores todos. Every method is scoped to the caller: todos
+// it may not see behave as if they didn't exist, and the methods return
+// errTodoNotFound for them. New todos belong to the caller.
+//
+// Create and Update return validationErrors when the todo points at a list
+// or parent todo that doesn't exist or that the caller may not see.
+type TodoRepository interface {
+	// Create stores a new todo along with its tags and returns it with its
+	// ID and timestamps filled in.
+	Create(ctx context.Context, caller principal, todo Todo) (Todo, error)
+
+	// Get returns the todo with its tags.
+	Get(ctx context.Context, caller principal, id int) (Todo, error)
+
+	// List returns the todos matching filter with their tags, along with
+	// how many match regardless of Limit and Offset. The total isn't
+	// counted for keyset pages, where it is always 0.
+	List(ctx context.Context, caller principal, filter TodoFilter) (todos []Todo, total int, err error)
+
+	// Update loads the todo, lets change modify it and stores the result,
+	// tags included, as one atomic step. An error from change is returned
+	// as is and nothing is stored.
+	Update(ctx context.Context, caller principal, id int, change func(*Todo) error, opts UpdateOptions) (todo Todo, created bool, err error)
+
+	// Delete removes the todo along with its subtasks.
+	Delete(ctx context.Context, caller principal, id int) error
+
+	// Owner returns who the todo belongs to, which decides who else may
+	// see it.
+	Owner(ctx context.Context, caller principal, id int) (principal, error)
+}
+
+// UpdateOptions tweak what TodoRepository.Update does besides storing the
+// todo.
+type UpdateOptions struct {
+	// Upsert creates the todo with the requested ID when it doesn't exist,
+	// from what change makes of an empty todo, and reports created.
+	Upsert bool
+
+	// Cascade completes every subtask below the todo when it ends up done.
+	Cascade bool
+}
+
+// todoRepo is where the handlers keep todos. It is set up in main.
+var todoRepo TodoRepository
+
+// TodoFilter selects and orders the todos TodoRepository.List returns. The
+// zero value matches every todo, in id order.
+type TodoFilter struct {
+	Tag      string
+	Done     *bool
+	Search   string // a substring of the task or description
+	Overdue  *bool
+	ListID   *int
+	ParentID *int
+	Priority string
+
+	// AssigneeID keeps the todos assigned to that user, or the unassigned
+	// ones when it is 0.
+	AssigneeID *int
+
+	// Archived keeps the archived todos when true and the others when
+	// false.
+	Archived *bool
+
+	Bounds []timeBound
+	Sort   []sortKey
+
+	// AfterID switches to keyset pagination: only todos with a greater id
+	// are returned, in id order regardless of Sort.
+	AfterID *int
+
+	// After continues a cursor page: only todos past it in Sort order are
+	// returned. Sort may only use cursorColumns then.
+	After *todoCursor
+
+	// Limit caps the number of todos returned, 0 means no cap. Offset
+	// skips that many todos first and only applies with a Limit.
+	Limit  int
+	Offset int
+}
+
+// timeBound keeps todos whose timestamp column is strictly before or after
+// a point in time. Todos without a value never match.
+type timeBound struct {
+	column string
+	before bool
+	at     time.Time
+}
+
+// timeBoundParams are the list filters taking an RFC3339 timestamp.
+var timeBoundParams = []struct {
+	param  string
+	column string
+	before bool
+}{
+	{"due_before", "due_date", true},
+	{"due_after", "due_date", false},
+	{"created_before", "created_at", true},
+	{"created_after", "created_at", false},
+	{"updated_before", "updated_at", true},
+	{"updated_after", "updated_at", false},
+}
+
+// parseTodoFilter reads the filters and sort order of a list request:
+// ?tag=, ?done=, a ?q= substring of the task, ?overdue=, ?priority=,
+// ?list_id= (or the {list_id} of the route), ?archived=, the timeBoundParams
+// and ?sort=. Archived todos are left out unless ?archived=true. Paging is
+// left to the caller.
+func parseTodoFilter(r *http.Request) (TodoFilter, error) {
+	query := r.URL.Query()
+	filter := TodoFilter{
+		Tag:    query.Get("tag"),
+		Search: query.Get("q"),
+	}
+	if v := query.Get("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("Invalid done! done must be true or false")
+		}
+		filter.Done = &done
+	}
+	if v := query.Get("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("Invalid overdue! overdue must be true or false")
+		}
+		filter.Overdue = &overdue
+	}
+	archived := false
+	if v := query.Get("archived"); v != "" {
+		var err error
+		if archived, err = strconv.ParseBool(v); err != nil {
+			return filter, errors.New("Invalid archived! archived must be true or false")
+		}
+	}
+	filter.Archived = &archived
+	listID := mux.Vars(r)["list_id"]
+	if v := query.Get("list_id"); v != "" {
+		listID = v
+	}
+	if listID != "" {
+		id, err := strconv.Atoi(listID)
+		if err != nil {
+			return filter, errors.New("Invalid list_id! list_id must be an integer")
+		}
+		filter.ListID = &id
+	}
+	if v := query.Get("assignee"); v != "" {
+		id, err := parseAssignee(r.Context(), v)
+		if err != nil {
+			return filter, err
+		}
+		filter.AssigneeID = &id
+	}
+	if v := query.Get("priority"); v != "" {
+		if !validPriority(v) {
+			return filter, fmt.Errorf("Invalid priority! priority must be one of %s", strings.Join(priorities, ", "))
+		}
+		filter.Priority = v
+	}
+	for _, bound := range timeBoundParams {
+		v := query.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid %s! %s must be an RFC3339 timestamp", bound.param, bound.param)
+		}
+		filter.Bounds = append(filter.Bounds, timeBound{column: bound.column, before: bound.before, at: t})
+	}
+
+	var err error
+	filter.Sort, err = parseSort(r)
+	return filter, err
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// sqlTodoRepository is the TodoRepository kept in the SQL database.
+type sqlTodoRepository struct {
+	db    *sql.DB
+	stmts *stmtCache
+}
+
+func newSQLTodoRepository(db *sql.DB) *sqlTodoRepository {
+	return &sqlTodoRepository{db: db, stmts: newStmtCache(db)}
+}
+
+// Close releases the statements the repository prepared. The database is
+// left open.
+func (s *sqlTodoRepository) Close() error {
+	return s.stmts.Close()
+}
+
+func (s *sqlTodoRepository) Create(ctx context.Context, caller principal, todo Todo) (Todo, error) {
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		q := s.stmts.on(tx)
+		errs, err := checkTodoRefs(ctx, q, caller, todo)
+		if err != nil {
+			return err
+		}
+		if errs != nil {
+			return errs
+		}
+
+		if todo.ID, err = insertTodo(ctx, q, caller, todo); err != nil {
+			return err
+		}
+		return loadTimestamps(ctx, q, &todo)
+	})
+	return todo, err
+}
+
+func (s *sqlTodoRepository) Get(ctx context.Context, caller principal, id int) (Todo, error) {
+	q := s.stmts.on(s.db)
+	scope, args := caller.todoScope("")
+	todo, err := scanTodo(hot(q).QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = ? AND "+scope, append([]any{id}, args...)...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo, errTodoNotFound
+	}
+	if err != nil {
+		return todo, err
+	}
+
+	todos := []Todo{todo}
+	if err = loadTags(ctx, q, todos); err != nil {
+		return todo, err
+	}
+	return todos[0], nil
+}
+
+func (s *sqlTodoRepository) Owner(ctx context.Context, caller principal, id int) (principal, error) {
+	var owner principal
+	var userID sql.NullInt64
+	scope, args := caller.todoScope("")
+	err := s.db.QueryRowContext(ctx, "SELECT owner, user_id FROM todos WHERE id = ? AND "+scope, append([]any{id}, args...)...).Scan(&owner.owner, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return owner, errTodoNotFound
+	}
+	owner.userID = int(userID.Int64)
+	return owner, err
+}
+
+func (s *sqlTodoRepository) List(ctx context.Context, caller principal, filter TodoFilter) ([]Todo, int, error) {
+	where, args := todoConditions(caller, filter)
+
+	if filter.After != nil {
+		condition, after := keysetCondition(filter.Sort, *filter.After)
+		where += " AND " + condition
+		args = append(args, after...)
+	}
+
+	total := 0
+	if filter.AfterID == nil && filter.After == nil {
+		err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM todos WHERE "+where, args...).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	} else if filter.AfterID != nil {
+		where += " AND id > ?"
+		args = append(args, *filter.AfterID)
+		filter.Sort = nil
+	}
+
+	query := "SELECT " + todoColumns + " FROM todos WHERE " + where + " ORDER BY " + orderBy(filter.Sort)
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	todos, err := queryTodos(ctx, s.db, query, args...)
+	return todos, total, err
+}
+
+func (s *sqlTodoRepository) Update(ctx context.Context, caller principal, id int, change func(*Todo) error, opts UpdateOptions) (todo Todo, created bool, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		q := s.stmts.on(tx)
+		todo, err = findTodo(ctx, q, caller, id)
+		if errors.Is(err, errTodoNotFound) && opts.Upsert {
+			// The id may still be taken by someone else's todo, which
+			// must look like it doesn't exist.
+			var count int
+			if err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM todos WHERE id = ?", id).Scan(&count); err != nil {
+				return err
+			}
+			if count > 0 {
+				return errTodoNotFound
+			}
+			todo, created = Todo{}, true
+		} else if err != nil {
+			return err
+		}
+
+		if err = change(&todo); err != nil {
+			return err
+		}
+		todo.ID = id
+
+		errs, err := checkTodoRefs(ctx, q, caller, todo)
+		if err != nil {
+			return err
+		}
+		if errs != nil {
+			return errs
+		}
+
+		err = auditChanges(ctx, q, caller, []int{id}, func() error {
+			if created {
+				_, err := insertTodoRow(ctx, q, caller, todo)
+				return err
+			}
+			return updateTodo(ctx, q, caller, todo)
+		})
+		if err != nil {
+			return err
+		}
+
+		if todo.Done && opts.Cascade {
+			if err = completeDescendants(ctx, q, caller, id); err != nil {
+				return err
+			}
+		}
+		return loadTimestamps(ctx, q, &todo)
+	})
+	return todo, created, err
+}
+
+// Delete deletes the todo along with its subtasks, which the database
+// deletes with it.
+func (s *sqlTodoRepository) Delete(ctx context.Context, caller principal, id int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		q := s.stmts.on(tx)
+		if _, err := findTodo(ctx, q, caller, id); err != nil {
+			return err
+		}
+		ids, err := withDescendants(ctx, q, []int{id})
+		if err != nil {
+			return err
+		}
+		return auditChanges(ctx, q, caller, ids, func() error {
+			_, err := hot(q).ExecContext(ctx, "DELETE FROM todos WHERE id = ?", id)
+			return err
+		})
+	})
+}
+
+// findTodo returns the caller's todo with its tags, locking the row when q
+// is a transaction. Only todos the caller may change are found.
+func findTodo(ctx context.Context, q dbtx, caller principal, id int) (Todo, error) {
+	scope, args := caller.todoWriteScope("")
+	todo, err := scanTodo(hot(q).QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = ? AND "+scope+dbDialect.forUpdate(), append([]any{id}, args...)...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo, errTodoNotFound
+	}
+	if err != nil {
+		return todo, err
+	}
+
+	todos := []Todo{todo}
+	if err = loadTags(ctx, q, todos); err != nil {
+		return todo, err
+	}
+	return todos[0], nil
+}
+
+// todoConditions returns the WHERE clause and its arguments selecting the
+// caller's todos that match filter. Paging and sorting are left out.
+func todoConditions(caller principal, filter TodoFilter) (string, []any) {
+	scope, args := caller.todoScope("")
+	conditions := []string{scope}
+	if filter.Tag != "" {
+		conditions = append(conditions, "id IN (SELECT tt.todo_id FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE t.name = ?)")
+		args = append(args, filter.Tag)
+	}
+	if filter.Done != nil {
+		conditions = append(conditions, "done = ?")
+		args = append(args, *filter.Done)
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		conditions = append(conditions, "(task "+dbDialect.like()+" ? ESCAPE '!' OR description "+dbDialect.like()+" ? ESCAPE '!')")
+		args = append(args, pattern, pattern)
+	}
+	if filter.Overdue != nil {
+		if *filter.Overdue {
+			conditions = append(conditions, "done = FALSE AND due_date < ?")
+		} else {
+			conditions = append(conditions, "(done = TRUE OR due_date IS NULL OR due_date >= ?)")
+		}
+		args = append(args, time.Now())
+	}
+	if filter.ListID != nil {
+		conditions = append(conditions, "list_id = ?")
+		args = append(args, *filter.ListID)
+	}
+	if filter.ParentID != nil {
+		conditions = append(conditions, "parent_id = ?")
+		args = append(args, *filter.ParentID)
+	}
+	if filter.AssigneeID != nil && *filter.AssigneeID == 0 {
+		conditions = append(conditions, "assignee_id IS NULL")
+	} else if filter.AssigneeID != nil {
+		conditions = append(conditions, "assignee_id = ?")
+		args = append(args, *filter.AssigneeID)
+	}
+	if filter.Archived != nil && *filter.Archived {
+		conditions = append(conditions, "archived_at IS NOT NULL")
+	} else if filter.Archived != nil {
+		conditions = append(conditions, "archived_at IS NULL")
+	}
+	if filter.Priority != "" {
+		conditions = append(conditions, "priority = ?")
+		args = append(args, filter.Priority)
+	}
+	for _, bound := range filter.Bounds {
+		op := " > ?"
+		if bound.before {
+			op = " < ?"
+		}
+		conditions = append(conditions, bound.column+op)
+		args = append(args, bound.at)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// keysetCondition matches the todos after the cursor in the order of keys,
+// which may only use cursorColumns: those past it on the first key, or tied
+// on the first and past it on the second, and so on.
+func keysetCondition(keys []sortKey, after todoCursor) (string, []any) {
+	if len(keys) == 0 {
+		keys = []sortKey{{column: "id"}}
+	}
+
+	var alternatives []string
+	var args []any
+	for i, key := range keys {
+		var terms []string
+		for _, tied := range keys[:i] {
+			terms = append(terms, tied.column+" = ?")
+			args = append(args, after.value(tied.column))
+		}
+		op := " > ?"
+		if key.desc {
+			op = " < ?"
+		}
+		terms = append(terms, key.column+op)
+		args = append(args, after.value(key.column))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally. The
+// escape character is "!" because a backslash is itself an escape in MySQL
+// strings but not in the others.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// queryTodos runs a query selecting todoColumns, and returns the resulting
+// todos with their tags loaded.
+func queryTodos(ctx context.Context, q dbtx, query string, args ...any) ([]Todo, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []Todo
+
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = loadTags(ctx, q, todos); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// insertTodo stores a new todo for the caller along with its tags, logs its
+// creation and returns its ID. Any ID already set on todo is ignored.
+func insertTodo(ctx context.Context, q dbtx, caller principal, todo Todo) (int, error) {
+	todo.ID = 0
+	id, err := insertTodoRow(ctx, q, caller, todo)
+	if err != nil {
+		return 0, err
+	}
+	return id, auditCreation(ctx, q, caller, id)
+}
+
+// insertTodoRow is insertTodo, except that a todo with an ID keeps it.
+func insertTodoRow(ctx context.Context, q dbtx, caller principal, todo Todo) (int, error) {
+	if todo.Priority == "" {
+		todo.Priority = defaultPriority
+	}
+	columns := "owner, user_id, task, description, done, due_date, remind_at, priority, list_id, parent_id, completed_at"
+	values := "?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CASE WHEN ? THEN CURRENT_TIMESTAMP END"
+	args := []any{caller.owner, caller.userIDValue(), todo.Task, todo.Description, todo.Done, todo.DueDate, todo.RemindAt, todo.Priority, todo.ListID, todo.ParentID, todo.Done}
+	if todo.ID != 0 {
+		columns, values = "id, "+columns, "?, "+values
+		args = append([]any{todo.ID}, args...)
+	}
+
+	query := "INSERT INTO todos (" + columns + ") VALUES (" + values + ")"
+	id := todo.ID
+	var err error
+	if id == 0 {
+		id, err = dbDialect.insertID(ctx, hot(q), query, args...)
+	} else if _, err = hot(q).ExecContext(ctx, query, args...); err == nil {
+		err = dbDialect.syncIDSequence(ctx, q, "todos")
+	}
+	if err != nil {
+		return 0, err
+	}
+	// IDs only grow and reordering only moves todos between the positions
+	// they had, so this puts the todo last.
+	if _, err = hot(q).ExecContext(ctx, "UPDATE todos SET position = ? WHERE id = ?", id, id); err != nil {
+		return 0, err
+	}
+
+	if err = setTodoTags(ctx, q, id, todo.Tags); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// updateTodo overwrites the caller's todo with todo.ID, including its tags.
+// Todos that aren't done anymore aren't archived either.
+func updateTodo(ctx context.Context, q dbtx, caller principal, todo Todo) error {
+	scope, scopeArgs := caller.todoWriteScope("")
+	args := append([]any{todo.Task, todo.Description, todo.Done, todo.DueDate, todo.RemindAt, todo.Priority, todo.ListID, todo.ParentID, todo.AssigneeID, todo.Done, todo.Done, todo.ArchivedAt, todo.ID}, scopeArgs...)
+	_, err := hot(q).ExecContext(ctx, `
+UPDATE todos
+SET task = ?, description = ?, done = ?, due_date = ?, remind_at = ?, priority = ?, list_id = ?, parent_id = ?, assignee_id = ?, completed_at = CASE WHEN ? THEN COALESCE(completed_at, CURRENT_TIMESTAMP) END,
+    archived_at = CASE WHEN ? THEN ? END,
+    version = version + 1
+WHERE id = ? AND `+scope, args...)
+	if err != nil {
+		return err
+	}
+	return setTodoTags(ctx, q, todo.ID, todo.Tags)
+}
+
+// loadTimestamps fills in the timestamps and version the database keeps for
+// a todo that was just written, along with its assignee, comment count,
+// archival and position, which request bodies don't set.
+func loadTimestamps(ctx context.Context, q dbtx, todo *Todo) error {
+	var assigneeID sql.NullInt64
+	var archivedAt sql.NullTime
+	err := hot(q).QueryRowContext(ctx, "SELECT created_at, updated_at, version, assignee_id, archived_at, position, "+commentCountColumn+" FROM todos WHERE id = ?", todo.ID).Scan(&todo.CreatedAt, &todo.UpdatedAt, &todo.Version, &assigneeID, &archivedAt, &todo.Position, &todo.CommentCount)
+	todo.AssigneeID, todo.ArchivedAt = nil, nil
+	if assigneeID.Valid {
+		id := int(assigneeID.Int64)
+		todo.AssigneeID = &id
+	}
+	if archivedAt.Valid {
+		todo.ArchivedAt = &archivedAt.Time
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubRepository serves a single fixed todo, for handler tests that don't
+// need the database. Any other method panics.
+type stubRepository struct {
+	TodoRepository
+	todo Todo
+}
+
+func (s stubRepository) Get(ctx context.Context, caller principal, id int) (Todo, error) {
+	if id != s.todo.ID {
+		return Todo{}, errTodoNotFound
+	}
+	return s.todo, nil
+}
+
+func TestReadHandlerWithStubRepository(t *testing.T) {
+	saved := todoRepo
+	todoRepo = stubRepository{todo: Todo{ID: 7, Task: "From the stub", Tags: []string{}}}
+	t.Cleanup(func() { todoRepo = saved })
+
+	router := setupRouter()
+
+	req := httptest.NewRequest("GET", "/todos/7", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if todo.Task != "From the stub" {
+		t.Errorf("Expected the stub's todo, got %+v", todo)
+	}
+
+	req = httptest.NewRequest("GET", "/todos/8", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+}
+
+func TestSQLTodoRepository(t *testing.T) {
+	clearTodos(t)
+	repo := newSQLTodoRepository(db)
+	ctx := context.Background()
+	alice, bob := principal{owner: "alice"}, principal{owner: "bob"}
+
+	created, err := repo.Create(ctx, alice, Todo{Task: "Buy milk", Priority: "medium", Tags: []string{"home"}})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if created.ID == 0 || created.CreatedAt.IsZero() {
+		t.Errorf("Expected an ID and timestamps, got %+v", created)
+	}
+
+	if _, err = repo.Get(ctx, bob, created.ID); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound for another owner, got %v", err)
+	}
+
+	errAbort := errors.New("abort")
+	_, _, err = repo.Update(ctx, alice, created.ID, func(todo *Todo) error {
+		todo.Task = "Buy bread"
+		return errAbort
+	}, UpdateOptions{})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Expected the change's error, got %v", err)
+	}
+
+	updated, wasCreated, err := repo.Update(ctx, alice, created.ID, func(todo *Todo) error {
+		todo.Done = true
+		return nil
+	}, UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if wasCreated || !updated.Done || updated.Task != "Buy milk" || len(updated.Tags) != 1 {
+		t.Errorf("Expected the todo marked done and otherwise unchanged, got %+v", updated)
+	}
+
+	done := true
+	todos, total, err := repo.List(ctx, alice, TodoFilter{Done: &done})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 1 || len(todos) != 1 || todos[0].ID != created.ID {
+		t.Errorf("Expected only the updated todo, got %d of %d", len(todos), total)
+	}
+
+	if err = repo.Delete(ctx, alice, created.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err = repo.Get(ctx, alice, created.ID); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound after delete, got %v", err)
+	}
+	if err = repo.Delete(ctx, alice, created.ID); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound deleting twice, got %v", err)
+	}
+}
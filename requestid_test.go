@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	router := requestIDMiddleware(setupRouter())
+
+	for _, incoming := range []string{"", "bad id\n", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest("GET", "/todos", nil)
+		req.Header.Set(requestIDHeader, incoming)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if id := rr.Header().Get(requestIDHeader); len(id) != 32 {
+			t.Errorf("Expected a generated request ID for %q, got %q", incoming, id)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/todos/abc", nil)
+	req.Header.Set(requestIDHeader, "upstream-42")
+	req.Header.Set("Accept", problemContentType)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if id := rr.Header().Get(requestIDHeader); id != "upstream-42" {
+		t.Errorf("Expected the incoming request ID to be echoed, got %q", id)
+	}
+	var problem problemDetails
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Expected a problem body, got %q: %v", rr.Body.String(), err)
+	}
+	if problem.RequestID != "upstream-42" {
+		t.Errorf("Expected the request ID in the error body, got %q", problem.RequestID)
+	}
+}
+
+func TestRequestIDIsLogged(t *testing.T) {
+	var buf bytes.Buffer
+	handler, _ := newLogHandler("json", "info", &buf)
+	saved := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	router := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "inside")
+		slog.With("ID", 1).InfoContext(r.Context(), "derived")
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(requestIDHeader, "abc123")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %q", buf.String())
+	}
+	for _, line := range lines {
+		var entry map[string]any
+		json.Unmarshal([]byte(line), &entry)
+		if entry["request_id"] != "abc123" {
+			t.Errorf("Expected the request ID in %s", line)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout is how long in-flight requests get to finish once the
+// server is asked to stop. It is set from SHUTDOWN_TIMEOUT.
+var shutdownTimeout = 30 * time.Second
+
+// serverTimeouts bound how long a client may take to send a request and to
+// read the response, and how long idle keep-alive connections stay open,
+// so slow clients can't hold connections forever. They are set from
+// READ_TIMEOUT, READ_HEADER_TIMEOUT, WRITE_TIMEOUT and IDLE_TIMEOUT; zero
+// means no limit.
+var serverTimeouts = struct {
+	read, readHeader, write, idle time.Duration
+}{
+	read:       30 * time.Second,
+	readHeader: 10 * time.Second,
+	write:      60 * time.Second,
+	idle:       120 * time.Second,
+}
+
+// runServer serves handler on listener until ctx is done, then stops
+// accepting connections and waits up to timeout for in-flight requests.
+// Requests still running after that have their context canceled, which
+// aborts their database queries, and are cut off. With a tlsConfig, it
+// serves HTTPS, with the certificates of tlsConfig.
+func runServer(ctx context.Context, listener net.Listener, handler http.Handler, timeout time.Duration, tlsConfig *tls.Config) error {
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       serverTimeouts.read,
+		ReadHeaderTimeout: serverTimeouts.readHeader,
+		WriteTimeout:      serverTimeouts.write,
+		IdleTimeout:       serverTimeouts.idle,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+		TLSConfig:         tlsConfig,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			serveErr <- server.ServeTLS(listener, "", "")
+			return
+		}
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Requests still running at shutdown timeout, canceling them", "error", err)
+		cancelRequests()
+		server.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("Server stopped")
+	return nil
+}
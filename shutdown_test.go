@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startServer runs runServer on a local port with handler, returning its
+// URL, the function stopping it and the channel runServer's result is sent
+// on.
+func startServer(t *testing.T, handler http.Handler, timeout time.Duration) (string, context.CancelFunc, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, listener, handler, timeout, nil) }()
+	return "http://" + listener.Addr().String(), stop, done
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	url, stop, done := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}), 5*time.Second)
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+	stop()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if code := <-status; code != http.StatusNoContent {
+		t.Errorf("Expected the in-flight request to finish with 204, got %d", code)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestShutdownCancelsRequestsAfterTimeout(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	url, stop, done := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(canceled)
+	}), 50*time.Millisecond)
+
+	go http.Get(url)
+	<-started
+	stop()
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the request context to be canceled after the timeout")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected shutdown to finish, got %v", err)
+	}
+}
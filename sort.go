@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// sortableColumns maps the ?sort= field names clients may use to their
+// columns. Only these ever reach the ORDER BY clause.
+var sortableColumns = map[string]string{
+	"id":           "id",
+	"task":         "task",
+	"done":         "done",
+	"completed_at": "completed_at",
+	"due_date":     "due_date",
+	"priority":     "priority",
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"position":     "position",
+}
+
+// sortKey is one column of a sort order.
+type sortKey struct {
+	column string
+	desc   bool
+}
+
+// parseSort turns ?sort=field,-other into sort keys. A leading "-" sorts
+// descending. id is always the final tie-breaker so pages are stable. No
+// ?sort= at all returns no keys, which means id order.
+func parseSort(r *http.Request) ([]sortKey, error) {
+	return parseSortFields(r.URL.Query().Get("sort"))
+}
+
+// parseSortFields is parseSort for the value of ?sort=.
+func parseSortFields(v string) ([]sortKey, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var keys []sortKey
+	sortedByID := false
+	for _, field := range strings.Split(v, ",") {
+		name, desc := strings.CutPrefix(field, "-")
+		column, ok := sortableColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid sort field %q", name)
+		}
+		if column == "id" {
+			sortedByID = true
+		}
+		keys = append(keys, sortKey{column: column, desc: desc})
+	}
+	if !sortedByID {
+		keys = append(keys, sortKey{column: "id"})
+	}
+	return keys, nil
+}
+
+// orderBy renders sort keys as an ORDER BY list.
+func orderBy(keys []sortKey) string {
+	if len(keys) == 0 {
+		return "id"
+	}
+
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "ASC"
+		if key.desc {
+			direction = "DESC"
+		}
+		terms[i] = dbDialect.sortExpression(key.column) + " " + direction
+	}
+	return strings.Join(terms, ", ")
+}
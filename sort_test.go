@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		sort    string
+		want    string
+		wantErr bool
+	}{
+		{"", "id", false},
+		{"task", "task ASC, id ASC", false},
+		{"-done,task", "done DESC, task ASC, id ASC", false},
+		{"-id", "id DESC", false},
+		{"task;DROP TABLE todos", "", true},
+		{"-", "", true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/todos", nil)
+		q := req.URL.Query()
+		q.Set("sort", tt.sort)
+		req.URL.RawQuery = q.Encode()
+
+		keys, err := parseSort(req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSort(%q) error = %v, wantErr %v", tt.sort, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := orderBy(keys); got != tt.want {
+			t.Errorf("parseSort(%q) = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseKeepAliveInterval is how often a comment is sent on idle streams, so
+// proxies don't time them out.
+const sseKeepAliveInterval = 30 * time.Second
+
+// TodoEventsSSEHandler streams a todoEvent for every change the caller may
+// see as Server-Sent Events, named after the event type and with the event
+// ID as id. Clients reconnecting with Last-Event-ID first get the retained
+// events they missed.
+func TodoEventsSSEHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := principalFrom(ctx)
+
+	var sub chan todoEvent
+	var missed []todoEvent
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, r, "Invalid Last-Event-ID! Last-Event-ID must be the id of an event", http.StatusBadRequest)
+			return
+		}
+		sub, missed = todoEvents.subscribeAfter(seq)
+	} else {
+		sub = todoEvents.subscribe()
+	}
+	events := coalesce(sub, eventCoalesceWindow)
+	defer func() {
+		todoEvents.unsubscribe(sub)
+		// coalesce flushes what it holds back once sub is closed.
+		for range events {
+		}
+	}()
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Tells nginx not to buffer the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	slog.InfoContext(ctx, "Event stream client connected", "replayed", len(missed))
+
+	send := func(event todoEvent) error {
+		if !event.visibleTo(ctx, caller) {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.seq, event.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	for _, event := range missed {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				// Clients reconnect by themselves, and catch up from
+				// their Last-Event-ID.
+				slog.WarnContext(ctx, "Dropped event stream client that fell behind")
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
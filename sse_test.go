@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id, name string
+	data     todoEvent
+}
+
+// openTodoEvents starts reading /todos/events of server, resuming after
+// lastEventID when it isn't empty.
+func openTodoEvents(t *testing.T, server *httptest.Server, lastEventID string) <-chan sseEvent {
+	t.Helper()
+	req, _ := http.NewRequest("GET", server.URL+"/todos/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	// The default transport would decompress a gzipped stream, hiding it.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open the stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("Expected an uncompressed event stream, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				event.id = value
+			case "event":
+				event.name = value
+			case "data":
+				json.Unmarshal([]byte(value), &event.data)
+			case "":
+				events <- event
+				event = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("The stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+func TestTodoEventsSSE(t *testing.T) {
+	clearTodos(t)
+	server := httptest.NewServer(requestIDMiddleware(compressMiddleware(setupRouter())))
+	t.Cleanup(server.Close)
+	events := openTodoEvents(t, server, "")
+
+	sendAs(t, server, "", "POST", "/todos", `{"task":"Stream it"}`)
+	created := nextEvent(t, events)
+	if created.name != "created" || created.id == "" || created.data.Todo.Task != "Stream it" {
+		t.Fatalf("Expected a created event with an id, got %+v", created)
+	}
+	sendAs(t, server, "", "DELETE", "/todos/"+strconv.Itoa(created.data.Todo.ID), "")
+	deleted := nextEvent(t, events)
+	createdID, _ := strconv.ParseUint(created.id, 10, 64)
+	deletedID, _ := strconv.ParseUint(deleted.id, 10, 64)
+	if deleted.name != "deleted" || deletedID <= createdID {
+		t.Errorf("Expected a later deleted event, got %+v", deleted)
+	}
+
+	// Resuming after the first event replays the second one.
+	replayed := openTodoEvents(t, server, created.id)
+	if event := nextEvent(t, replayed); event.id != deleted.id || event.name != "deleted" {
+		t.Errorf("Expected the deleted event replayed, got %+v", event)
+	}
+}
+
+func TestTodoEventsSSERejectsBadLastEventID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/todos/events", nil)
+	req.Header.Set("Last-Event-ID", "latest")
+	rr := httptest.NewRecorder()
+	setupRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestEventBusReplaysAfterID(t *testing.T) {
+	bus := newEventBus()
+	for i := range 3 {
+		bus.publish(todoEvent{Type: "created", Todo: Todo{ID: i}})
+	}
+	first := bus.history[0].seq
+
+	sub, missed := bus.subscribeAfter(first)
+	defer bus.unsubscribe(sub)
+	if len(missed) != 2 || missed[0].Todo.ID != 1 || missed[1].Todo.ID != 2 {
+		t.Errorf("Expected the events after the first, got %+v", missed)
+	}
+	older, missed := bus.subscribeAfter(first - 1000)
+	defer bus.unsubscribe(older)
+	if len(missed) != 3 {
+		t.Errorf("Expected every retained event for an older id, got %d", len(missed))
+	}
+}
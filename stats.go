@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+// dayStats is the activity of a single day.
+type dayStats struct {
+	Date      string `json:"date"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+	// CompletionRate is the share of the todos created by the end of the
+	// day that were done by then.
+	CompletionRate float64 `json:"completion_rate"`
+}
+
+// todoStats is how many todos there are in each status now, and what
+// happened to them over a range of days.
+type todoStats struct {
+	Total          int     `json:"total"`
+	Done           int     `json:"done"`
+	Pending        int     `json:"pending"`
+	Overdue        int     `json:"overdue"`
+	CompletionRate float64 `json:"completion_rate"`
+
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+	// AverageCompletionHours is how long the todos completed in the range
+	// took from creation, null when none were.
+	AverageCompletionHours *float64   `json:"average_completion_hours"`
+	Days                   []dayStats `json:"days"`
+}
+
+// parseStatsRange reads the ?from= and ?to= dates, both included, which
+// default to the last 30 days. It returns the start of from and of the day
+// after to, in UTC.
+func parseStatsRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	to := now.UTC().Truncate(24 * time.Hour)
+	if v := query.Get("to"); v != "" {
+		var err error
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			return to, to, fmt.Errorf("Invalid to! to must be a date like %s", time.DateOnly)
+		}
+	}
+	from := to.AddDate(0, 0, 1-defaultStatsDays)
+	if v := query.Get("from"); v != "" {
+		var err error
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			return from, to, fmt.Errorf("Invalid from! from must be a date like %s", time.DateOnly)
+		}
+	}
+	end := to.AddDate(0, 0, 1)
+	if !from.Before(end) {
+		return from, end, fmt.Errorf("Invalid range! from must not be after to")
+	}
+	if end.Sub(from) > maxStatsDays*24*time.Hour {
+		return from, end, fmt.Errorf("Invalid range! It must be at most %d days", maxStatsDays)
+	}
+	return from, end, nil
+}
+
+// countStatuses counts the todos in scope, and how many of those are done
+// and overdue.
+func countStatuses(ctx context.Context, scope string, args []any, stats *todoStats) error {
+	var done, overdue sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+SELECT COUNT(*),
+    SUM(CASE WHEN done THEN 1 ELSE 0 END),
+    SUM(CASE WHEN done = FALSE AND due_date < ? THEN 1 ELSE 0 END)
+FROM todos
+WHERE `+scope, append([]any{time.Now()}, args...)...).Scan(&stats.Total, &done, &overdue)
+	if err != nil {
+		return err
+	}
+	stats.Done, stats.Overdue = int(done.Int64), int(overdue.Int64)
+	stats.Pending = stats.Total - stats.Done
+	if stats.Total > 0 {
+		stats.CompletionRate = float64(stats.Done) / float64(stats.Total)
+	}
+	return nil
+}
+
+// countActivity fills in the todos in scope created and completed each day
+// from from until end.
+func countActivity(ctx context.Context, scope string, args []any, from, end time.Time, stats *todoStats) error {
+	// The running totals the daily completion rates start from.
+	var createdBefore, completedBefore sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+SELECT SUM(CASE WHEN created_at < ? THEN 1 ELSE 0 END), SUM(CASE WHEN completed_at < ? THEN 1 ELSE 0 END)
+FROM todos
+WHERE `+scope, append([]any{from, from}, args...)...).Scan(&createdBefore, &completedBefore)
+	if err != nil {
+		return err
+	}
+	createdBy, completedBy := int(createdBefore.Int64), int(completedBefore.Int64)
+
+	rows, err := db.QueryContext(ctx, `
+SELECT created_at, completed_at
+FROM todos
+WHERE `+scope+` AND ((created_at >= ? AND created_at < ?) OR (completed_at >= ? AND completed_at < ?))`,
+		append(args, from, end, from, end)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	days := int(end.Sub(from) / (24 * time.Hour))
+	stats.Days = make([]dayStats, days)
+	for i := range stats.Days {
+		stats.Days[i].Date = from.AddDate(0, 0, i).Format(time.DateOnly)
+	}
+	day := func(t time.Time) int {
+		return int(t.UTC().Sub(from) / (24 * time.Hour))
+	}
+
+	var completionTime time.Duration
+	for rows.Next() {
+		var createdAt time.Time
+		var completedAt sql.NullTime
+		if err = rows.Scan(&createdAt, &completedAt); err != nil {
+			return err
+		}
+		if !createdAt.Before(from) && createdAt.Before(end) {
+			stats.Days[day(createdAt)].Created++
+			stats.Created++
+		}
+		if completedAt.Valid && !completedAt.Time.Before(from) && completedAt.Time.Before(end) {
+			stats.Days[day(completedAt.Time)].Completed++
+			stats.Completed++
+			completionTime += completedAt.Time.Sub(createdAt)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range stats.Days {
+		createdBy += stats.Days[i].Created
+		completedBy += stats.Days[i].Completed
+		if createdBy > 0 {
+			stats.Days[i].CompletionRate = min(float64(completedBy)/float64(createdBy), 1)
+		}
+	}
+	if stats.Completed > 0 {
+		hours := completionTime.Hours() / float64(stats.Completed)
+		stats.AverageCompletionHours = &hours
+	}
+	return nil
+}
+
+// StatsHandler reports how many of the caller's todos are done, pending and
+// overdue, and how many were created and completed each day of a range of
+// ?from= and ?to= dates (default the last 30 days, at most 366), with the
+// completion rate over time and the average time to completion.
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	from, end, err := parseStatsRange(r, time.Now())
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scope, args := principalFrom(ctx).todoScope("")
+	stats := todoStats{
+		From: from.Format(time.DateOnly),
+		To:   end.AddDate(0, 0, -1).Format(time.DateOnly),
+	}
+	if err = countStatuses(ctx, scope, args, &stats); err != nil {
+		slog.ErrorContext(ctx, "Error counting todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err = countActivity(ctx, scope, args, from, end, &stats); err != nil {
+		slog.ErrorContext(ctx, "Error counting created and completed todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		return
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatsHandler(t *testing.T) {
+	clearTodos(t)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	daysAgo := func(days int, hours time.Duration) time.Time {
+		return today.AddDate(0, 0, -days).Add(hours)
+	}
+	at := func(days int, hours time.Duration) *time.Time {
+		t := daysAgo(days, hours)
+		return &t
+	}
+	seed := []struct {
+		created   time.Time
+		completed *time.Time
+		due       *time.Time
+	}{
+		{created: daysAgo(10, time.Hour), completed: at(9, time.Hour)},
+		{created: daysAgo(10, time.Hour), completed: at(2, time.Hour)},
+		{created: daysAgo(3, time.Hour), completed: at(1, time.Hour)},
+		{created: daysAgo(3, 2*time.Hour), due: at(1, 0)},
+	}
+	for _, todo := range seed {
+		_, err := db.Exec("INSERT INTO todos (task, done, created_at, completed_at, due_date) VALUES (?, ?, ?, ?, ?)",
+			"task", todo.completed != nil, todo.created, todo.completed, todo.due)
+		if err != nil {
+			t.Fatalf("Failed to seed todo: %v", err)
+		}
+	}
+
+	router := setupRouter()
+	from, to := daysAgo(5, 0).Format(time.DateOnly), daysAgo(1, 0).Format(time.DateOnly)
+	req := httptest.NewRequest("GET", "/stats?from="+from+"&to="+to, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var got todoStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if got.Total != 4 || got.Done != 3 || got.Pending != 1 || got.Overdue != 1 || got.CompletionRate != 0.75 {
+		t.Errorf("Unexpected status counts %+v", got)
+	}
+	if got.From != from || got.To != to || got.Created != 2 || got.Completed != 2 {
+		t.Errorf("Unexpected activity in the range %+v", got)
+	}
+	if got.AverageCompletionHours == nil || *got.AverageCompletionHours != 120 {
+		t.Errorf("Expected an average of 120 hours to completion, got %v", got.AverageCompletionHours)
+	}
+	want := []dayStats{
+		{Date: daysAgo(5, 0).Format(time.DateOnly), CompletionRate: 0.5},
+		{Date: daysAgo(4, 0).Format(time.DateOnly), CompletionRate: 0.5},
+		{Date: daysAgo(3, 0).Format(time.DateOnly), Created: 2, CompletionRate: 0.25},
+		{Date: daysAgo(2, 0).Format(time.DateOnly), Completed: 1, CompletionRate: 0.5},
+		{Date: daysAgo(1, 0).Format(time.DateOnly), Completed: 1, CompletionRate: 0.75},
+	}
+	if len(got.Days) != len(want) {
+		t.Fatalf("Expected %d days, got %+v", len(want), got.Days)
+	}
+	for i, day := range got.Days {
+		if day != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], day)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/stats", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if len(got.Days) != defaultStatsDays || got.To != today.Format(time.DateOnly) {
+		t.Errorf("Expected the last %d days by default, got %s to %s", defaultStatsDays, got.From, got.To)
+	}
+
+	for _, query := range []string{"from=yesterday", "to=2026-13-01", "from=2026-02-01&to=2026-01-01", "from=2020-01-01&to=2026-01-01"} {
+		req = httptest.NewRequest("GET", "/stats?"+query, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// stmtCache keeps the hot todo queries, those to read, create, update and
+// delete a todo, prepared, so the database parses and plans them once
+// rather than on every request. database/sql prepares a statement again on
+// each connection it runs on, transactions' included, and keeps it there.
+// Statements are keyed by their SQL, which takes only a few shapes for each
+// query: one per kind of caller.
+type stmtCache struct {
+	db *sql.DB
+
+	mu sync.Mutex
+	// stmts holds the prepared statements, and nil for those still being
+	// prepared. It is nil once the cache is closed.
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: map[string]*sql.Stmt{}}
+}
+
+// on returns q, the cache's database or a transaction on it, for the hot
+// queries run through hot(q) to use the cached statements. A nil cache
+// returns q as is.
+func (c *stmtCache) on(q dbtx) dbtx {
+	if c == nil {
+		return q
+	}
+	return cachingDB{q, c}
+}
+
+// get returns the prepared statement of query, or nil when it isn't
+// prepared yet. Statements are prepared in the background, as preparing one
+// takes a connection of its own, which the pool may not have left while
+// the caller holds one for a transaction. The query runs unprepared
+// meanwhile.
+func (c *stmtCache) get(query string) *sql.Stmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stmt, ok := c.stmts[query]
+	if !ok && c.stmts != nil {
+		c.stmts[query] = nil
+		go c.prepare(query)
+	}
+	return stmt
+}
+
+func (c *stmtCache) prepare(query string) {
+	stmt, err := c.db.PrepareContext(context.Background(), query)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		// The next use tries again.
+		slog.Warn("Failed to prepare statement", "error", err)
+		delete(c.stmts, query)
+		return
+	}
+	if c.stmts == nil {
+		// Closed while preparing.
+		stmt.Close()
+		return
+	}
+	c.stmts[query] = stmt
+}
+
+// Close closes the prepared statements, before the database is closed on
+// shutdown. Queries run after it aren't prepared anymore, and statements
+// still being prepared are closed as soon as they are.
+func (c *stmtCache) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, stmt := range c.stmts {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+	c.stmts = nil
+	return errors.Join(errs...)
+}
+
+// cachingDB passes queries on to the wrapped dbtx, and lets hot() run them
+// as the statements its cache prepared.
+type cachingDB struct {
+	dbtx
+	cache *stmtCache
+}
+
+// preparedDB is a cachingDB that runs every query as a cached statement.
+type preparedDB cachingDB
+
+// hot returns q running queries as cached prepared statements when it came
+// from stmtCache.on, and q itself otherwise.
+func hot(q dbtx) dbtx {
+	if c, ok := q.(cachingDB); ok {
+		return preparedDB(c)
+	}
+	return q
+}
+
+// stmt returns the cached statement of query, on the transaction queries
+// run in if any, or nil when it isn't prepared yet.
+func (p preparedDB) stmt(ctx context.Context, query string) *sql.Stmt {
+	stmt := p.cache.get(query)
+	if tx, ok := p.dbtx.(*sql.Tx); ok && stmt != nil {
+		return tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
+
+func (p preparedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := p.stmt(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return p.dbtx.ExecContext(ctx, query, args...)
+}
+
+func (p preparedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := p.stmt(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return p.dbtx.QueryContext(ctx, query, args...)
+}
+
+func (p preparedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := p.stmt(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return p.dbtx.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitPrepared waits for cache to finish preparing statements in the
+// background.
+func waitPrepared(t testing.TB, cache *stmtCache) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		cache.mu.Lock()
+		pending := 0
+		for _, stmt := range cache.stmts {
+			if stmt == nil {
+				pending++
+			}
+		}
+		cache.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+	}
+	t.Fatal("Statements weren't prepared in time")
+}
+
+func TestStmtCache(t *testing.T) {
+	clearTodos(t)
+	repo := newSQLTodoRepository(db)
+	ctx := context.Background()
+	alice := principal{owner: "alice"}
+
+	// Twice, first with the queries unprepared and then prepared.
+	for i := range 2 {
+		created, err := repo.Create(ctx, alice, Todo{Task: "Buy milk", Priority: "medium", Tags: []string{"home"}})
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if got, err := repo.Get(ctx, alice, created.ID); err != nil || got.Task != "Buy milk" || len(got.Tags) != 1 {
+			t.Errorf("Expected the created todo, got %+v, %v", got, err)
+		}
+		updated, _, err := repo.Update(ctx, alice, created.ID, func(todo *Todo) error {
+			todo.Task = "Buy bread"
+			return nil
+		}, UpdateOptions{})
+		if err != nil || updated.Task != "Buy bread" || updated.Version != created.Version+1 {
+			t.Errorf("Expected the todo updated, got %+v, %v", updated, err)
+		}
+		if err = repo.Delete(ctx, alice, created.ID); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, err = repo.Get(ctx, alice, created.ID); !errors.Is(err, errTodoNotFound) {
+			t.Errorf("Expected the todo deleted, got %v", err)
+		}
+
+		if i == 0 {
+			waitPrepared(t, repo.stmts)
+		}
+	}
+
+	if len(repo.stmts.stmts) < 5 {
+		t.Errorf("Expected the hot queries prepared, got %d statements", len(repo.stmts.stmts))
+	}
+	if _, err := repo.Get(ctx, principal{owner: "bob"}, 1); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("Expected errTodoNotFound with a cached statement, got %v", err)
+	}
+
+	stmts := repo.stmts.stmts
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for query, stmt := range stmts {
+		if _, err := stmt.Exec(); err == nil || !strings.Contains(err.Error(), "closed") {
+			t.Errorf("Expected the statement of %q closed, got %v", query, err)
+		}
+	}
+	created, err := repo.Create(ctx, alice, Todo{Task: "After closing", Priority: "medium"})
+	if err != nil {
+		t.Fatalf("Expected queries to run unprepared after Close, got %v", err)
+	}
+	if _, err = repo.Get(ctx, alice, created.ID); err != nil || len(repo.stmts.stmts) != 0 {
+		t.Errorf("Expected nothing prepared after Close, got %v and %d statements", err, len(repo.stmts.stmts))
+	}
+}
+
+// BenchmarkStmtCache compares the hot todo queries run prepared, as the
+// repository does, with running them as plain SQL.
+func BenchmarkStmtCache(b *testing.B) {
+	ctx := context.Background()
+	caller := principal{owner: "bench"}
+	for _, bench := range []struct {
+		name string
+		repo *sqlTodoRepository
+	}{
+		{"unprepared", &sqlTodoRepository{db: db}},
+		{"prepared", newSQLTodoRepository(db)},
+	} {
+		defer bench.repo.Close()
+		todo, err := bench.repo.Create(ctx, caller, Todo{Task: "Benchmark", Priority: "medium"})
+		if err != nil {
+			b.Fatalf("Create failed: %v", err)
+		}
+		defer bench.repo.Delete(ctx, caller, todo.ID)
+
+		b.Run("Get/"+bench.name, func(b *testing.B) {
+			if _, err := bench.repo.Get(ctx, caller, todo.ID); err != nil {
+				b.Fatalf("Get failed: %v", err)
+			}
+			if bench.repo.stmts != nil {
+				waitPrepared(b, bench.repo.stmts)
+			}
+			for b.Loop() {
+				if _, err := bench.repo.Get(ctx, caller, todo.ID); err != nil {
+					b.Fatalf("Get failed: %v", err)
+				}
+			}
+		})
+		b.Run("Update/"+bench.name, func(b *testing.B) {
+			done := func(todo *Todo) error {
+				todo.Done = !todo.Done
+				return nil
+			}
+			if _, _, err := bench.repo.Update(ctx, caller, todo.ID, done, UpdateOptions{}); err != nil {
+				b.Fatalf("Update failed: %v", err)
+			}
+			if bench.repo.stmts != nil {
+				waitPrepared(b, bench.repo.stmts)
+			}
+			for b.Loop() {
+				if _, _, err := bench.repo.Update(ctx, caller, todo.ID, done, UpdateOptions{}); err != nil {
+					b.Fatalf("Update failed: %v", err)
+				}
+			}
+		})
+	}
+}
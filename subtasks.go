@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// ancestorIDs returns the id of the caller's todo and of every todo above
+// it, nearest first, or nothing when the todo doesn't exist.
+func ancestorIDs(ctx context.Context, q dbtx, caller principal, id int) ([]int, error) {
+	scope, args := caller.todoScope("")
+	return queryIDs(ctx, q, `
+WITH RECURSIVE ancestors (id, parent_id) AS (
+    SELECT id, parent_id FROM todos WHERE id = ? AND `+scope+`
+    UNION ALL
+    SELECT t.id, t.parent_id FROM todos t JOIN ancestors a ON t.id = a.parent_id
+)
+SELECT id FROM ancestors`, append([]any{id}, args...)...)
+}
+
+// descendantIDs returns the ids of every subtask below the todo, at any
+// depth.
+func descendantIDs(ctx context.Context, q dbtx, id int) ([]int, error) {
+	return queryIDs(ctx, q, `
+WITH RECURSIVE descendants (id) AS (
+    SELECT id FROM todos WHERE parent_id = ?
+    UNION ALL
+    SELECT t.id FROM todos t JOIN descendants d ON t.parent_id = d.id
+)
+SELECT id FROM descendants`, id)
+}
+
+func queryIDs(ctx context.Context, q dbtx, query string, args ...any) ([]int, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// completeAssignments mark todos done, bumping the version only of those
+// that weren't already. The version comes first as MySQL sees the new done
+// in later assignments.
+const completeAssignments = "version = CASE WHEN done THEN version ELSE version + 1 END, done = TRUE, completed_at = COALESCE(completed_at, CURRENT_TIMESTAMP)"
+
+// completeDescendants marks every subtask below the todo done as the
+// caller, for the ?cascade=true option when completing a todo.
+func completeDescendants(ctx context.Context, q dbtx, caller principal, id int) error {
+	ids, err := descendantIDs(ctx, q, id)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return auditChanges(ctx, q, caller, ids, func() error {
+		_, err := q.ExecContext(ctx, "UPDATE todos SET "+completeAssignments+" WHERE id IN ("+placeholders(len(ids))+")", args...)
+		return err
+	})
+}
+
+// cascadeRequested reports whether the request asked for ?cascade=true.
+func cascadeRequested(r *http.Request) bool {
+	cascade, _ := strconv.ParseBool(r.URL.Query().Get("cascade"))
+	return cascade
+}
+
+// expandSubtasks loads the direct subtasks of each of the caller's todos, and
+// recursively whatever exp asks for on them.
+func expandSubtasks(ctx context.Context, caller principal, todos []Todo, exp expansion) error {
+	if _, ok := exp["subtasks"]; !ok {
+		return nil
+	}
+	for i := range todos {
+		subtasks, _, err := todoRepo.List(ctx, caller, TodoFilter{ParentID: &todos[i].ID})
+		if err != nil {
+			return err
+		}
+		if subtasks == nil {
+			subtasks = []Todo{}
+		}
+		if err = expandSubtasks(ctx, caller, subtasks, exp["subtasks"]); err != nil {
+			return err
+		}
+		todos[i].Subtasks = subtasks
+	}
+	return nil
+}
+
+// SubtasksHandler lists the direct subtasks of a todo.
+func SubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	_, err = todoRepo.Get(ctx, caller, id)
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error querying todo", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	todos, _, err := todoRepo.List(ctx, caller, TodoFilter{ParentID: &id})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error querying subtasks", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if todos == nil {
+		todos = []Todo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(todos)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// seedSubtask creates a todo under parent through the API and returns its
+// id.
+func seedSubtask(t *testing.T, router http.Handler, parent int, task string) int {
+	t.Helper()
+	body := `{"task":"` + task + `","parent_id":` + strconv.Itoa(parent) + `,"tags":["sub"]}`
+	req := httptest.NewRequest("POST", "/todos", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a subtask, got %d: %s", status, rr.Body.String())
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return todo.ID
+}
+
+func TestSubtasks(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	parent := seedTodo(t, "plan trip", false)
+	child := seedSubtask(t, router, parent, "book flights")
+	grandchild := seedSubtask(t, router, child, "compare prices")
+
+	req := httptest.NewRequest("GET", "/todos/"+strconv.Itoa(parent)+"/subtasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var subtasks []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &subtasks); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(subtasks) != 1 || subtasks[0].ID != child {
+		t.Fatalf("Expected only the direct subtask %d, got %+v", child, subtasks)
+	}
+
+	req = httptest.NewRequest("GET", "/todos/"+strconv.Itoa(parent)+"?expand=subtasks.subtasks.tags", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var expanded Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &expanded); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(expanded.Subtasks) != 1 || len(expanded.Subtasks[0].Subtasks) != 1 {
+		t.Fatalf("Expected two levels of subtasks, got %+v", expanded)
+	}
+	nested := expanded.Subtasks[0].Subtasks[0]
+	if nested.ID != grandchild || !reflect.DeepEqual(nested.Tags, []string{"sub"}) {
+		t.Errorf("Expected grandchild %d with its tags, got %+v", grandchild, nested)
+	}
+
+	// Moving the parent under its own grandchild would make a cycle.
+	req = httptest.NewRequest("PATCH", "/todos/"+strconv.Itoa(parent), strings.NewReader(`{"parent_id":`+strconv.Itoa(grandchild)+`,"version":1}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a cycle, got %d", status)
+	}
+}
+
+func TestSubtasksCascadeAndFocus(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	parent := seedTodo(t, "plan trip", false)
+	child := seedSubtask(t, router, parent, "book flights")
+
+	req := httptest.NewRequest("GET", "/todos/focus", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var focus []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &focus); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(focus) != 1 || focus[0].ID != child {
+		t.Errorf("Expected the blocked parent to be left out of focus, got %+v", focus)
+	}
+
+	req = httptest.NewRequest("PATCH", "/todos/"+strconv.Itoa(parent)+"?cascade=true", strings.NewReader(`{"done":true,"version":1}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var done bool
+	if err := db.QueryRow("SELECT done FROM todos WHERE id = ?", child).Scan(&done); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	if !done {
+		t.Errorf("Expected the subtask to be completed with the parent")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const maxTagLength = 64
+
+// normalizeTags trims and de-duplicates tags, keeping their first-seen order.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// setTodoTags replaces the tags of a todo, creating any tags that don't
+// exist yet.
+func setTodoTags(ctx context.Context, q dbtx, todoID int, tags []string) error {
+	_, err := q.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = ?", todoID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err = addTodoTag(ctx, q, todoID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTodoTag tags a todo, creating the tag when it doesn't exist yet. Adding
+// a tag the todo already has is a no-op.
+func addTodoTag(ctx context.Context, q dbtx, todoID int, tag string) error {
+	_, err := q.ExecContext(ctx, dbDialect.ignoreDuplicates("INSERT INTO tags (name) VALUES (?)"), tag)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, dbDialect.ignoreDuplicates(`
+INSERT INTO todo_tags (todo_id, tag_id)
+SELECT td.id, t.id FROM todos td, tags t WHERE td.id = ? AND t.name = ?`), todoID, tag)
+	return err
+}
+
+// loadTags fills in the Tags field of every todo in the slice.
+func loadTags(ctx context.Context, q dbtx, todos []Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(todos))
+	args := make([]any, len(todos))
+	for i := range todos {
+		todos[i].Tags = []string{}
+		index[todos[i].ID] = i
+		args[i] = todos[i].ID
+	}
+
+	rows, err := q.QueryContext(ctx, `
+SELECT tt.todo_id, t.name
+FROM todo_tags tt
+JOIN tags t ON t.id = tt.tag_id
+WHERE tt.todo_id IN (`+placeholders(len(todos))+`)
+ORDER BY t.name`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID int
+		var name string
+		if err = rows.Scan(&todoID, &name); err != nil {
+			return err
+		}
+		if i, ok := index[todoID]; ok {
+			todos[i].Tags = append(todos[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// tagCount is a tag with the number of the owner's todos carrying it.
+type tagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TagsHandler lists every tag in use on the owner's todos, by name.
+func TagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := queryTagCounts(r.Context(), principalFrom(r.Context()))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying tags", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// queryTagCounts returns every tag on the todos caller may see, by name.
+func queryTagCounts(ctx context.Context, caller principal) ([]tagCount, error) {
+	scope, args := caller.todoScope("td.")
+	rows, err := db.QueryContext(ctx, `
+SELECT t.name, COUNT(*)
+FROM tags t
+JOIN todo_tags tt ON tt.tag_id = t.id
+JOIN todos td ON td.id = tt.todo_id
+WHERE `+scope+`
+GROUP BY t.name
+ORDER BY t.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []tagCount{}
+	for rows.Next() {
+		var tag tagCount
+		if err = rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// TodoTagHandler adds the {tag} in the path to a todo on PUT and removes it
+// on DELETE, and returns the updated todo. Both are idempotent.
+func TodoTagHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	tag := strings.TrimSpace(mux.Vars(r)["tag"])
+	var errs validationErrors
+	errs.tag("tag", tag)
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	var todo Todo
+	var events []todoEvent
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := findTodo(ctx, tx, caller, id); err != nil {
+			return err
+		}
+
+		events, err = trackChanges(ctx, tx, caller, []int{id}, func() error {
+			var err error
+			if r.Method == http.MethodPut {
+				err = addTodoTag(ctx, tx, id, tag)
+			} else {
+				_, err = tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)", id, tag)
+			}
+			if err != nil {
+				return err
+			}
+			// Tags are part of the todo, so changing them makes it a new version.
+			_, err = tx.ExecContext(ctx, "UPDATE todos SET version = version + 1 WHERE id = ?", id)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		todo, err = findTodo(ctx, tx, caller, id)
+		return err
+	})
+	if errors.Is(err, errTodoNotFound) {
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating tags", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	todoEvents.publishAll(events)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(todo)
+}
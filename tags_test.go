@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCreateWithTagsAndFilterByTag(t *testing.T) {
+	clearTodos(t)
+	seedTodo(t, "untagged task", false)
+
+	router := setupRouter()
+
+	body := strings.NewReader(`{"task":"Tagged task","tags":["work"," urgent ","work"]}`)
+	req := httptest.NewRequest("POST", "/todos", body)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	var created Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if want := []string{"work", "urgent"}; !reflect.DeepEqual(created.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, created.Tags)
+	}
+
+	req = httptest.NewRequest("GET", "/todos?tag=work", nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 1 {
+		t.Fatalf("Expected 1 todo tagged work, got %d", len(todos))
+	}
+	if todos[0].ID != created.ID {
+		t.Errorf("Expected todo %d, got %d", created.ID, todos[0].ID)
+	}
+	if want := []string{"urgent", "work"}; !reflect.DeepEqual(todos[0].Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, todos[0].Tags)
+	}
+}
+
+func TestTodoTagHandlerAndTagsHandler(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+	other := seedTodo(t, "other task", false)
+
+	router := setupRouter()
+
+	for _, path := range []string{
+		"/todos/" + strconv.Itoa(id) + "/tags/work",
+		"/todos/" + strconv.Itoa(id) + "/tags/home",
+		"/todos/" + strconv.Itoa(id) + "/tags/work",
+		"/todos/" + strconv.Itoa(other) + "/tags/work",
+	} {
+		req := httptest.NewRequest("PUT", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("PUT %s: expected status 200, got %d", path, status)
+		}
+	}
+
+	req := httptest.NewRequest("DELETE", "/todos/"+strconv.Itoa(id)+"/tags/home", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var todo Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if want := []string{"work"}; !reflect.DeepEqual(todo.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, todo.Tags)
+	}
+
+	req = httptest.NewRequest("GET", "/tags", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var tags []tagCount
+	if err := json.Unmarshal(rr.Body.Bytes(), &tags); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if want := []tagCount{{Name: "work", Count: 2}}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, tags)
+	}
+
+	req = httptest.NewRequest("PUT", "/todos/999999/tags/work", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status 404 tagging a missing todo, got %d", status)
+	}
+}
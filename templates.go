@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const maxTemplateNameLength = 255
+
+// maxTemplateTodos bounds how many todos, subtasks included, a template
+// holds, and so how many todos instantiating it creates.
+const maxTemplateTodos = 500
+
+var errTemplateNotFound = errors.New("template not found")
+
+// Template is a named tree of todos to create again whenever the same work
+// comes up, such as a checklist for every release.
+type Template struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name"`
+	Todos     []TemplateTodo `json:"todos"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// TemplateTodo is what a template keeps of a todo. Todos made from it are
+// open and have no due date.
+type TemplateTodo struct {
+	Task        string         `json:"task"`
+	Description string         `json:"description"`
+	Priority    string         `json:"priority"`
+	Tags        []string       `json:"tags"`
+	Subtasks    []TemplateTodo `json:"subtasks,omitempty"`
+}
+
+// templateRequest is the body of POST and PUT /templates. The todos are
+// either given directly, or saved from one of the caller's todos with its
+// subtasks, or from the todos of a list that aren't archived.
+type templateRequest struct {
+	Name   string         `json:"name"`
+	Todos  []TemplateTodo `json:"todos"`
+	TodoID *int           `json:"todo_id"`
+	ListID *int           `json:"list_id"`
+}
+
+// instantiateRequest is the optional body of POST
+// /templates/{id}/instantiate, saying where the new todos go.
+type instantiateRequest struct {
+	ListID   *int `json:"list_id"`
+	ParentID *int `json:"parent_id"`
+}
+
+// validateTemplateRequest normalizes a template received from a client in
+// place and checks its name and todos, and that it says where its todos
+// come from exactly once.
+func validateTemplateRequest(req *templateRequest) validationErrors {
+	var errs validationErrors
+	errs.requireText("name", &req.Name, maxTemplateNameLength)
+
+	sources := 0
+	for _, given := range []bool{req.Todos != nil, req.TodoID != nil, req.ListID != nil} {
+		if given {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		errs.add("todos", "required without todo_id or list_id")
+	case sources > 1:
+		errs.add("todos", "only one of todos, todo_id and list_id may be given")
+	case req.Todos != nil:
+		if len(req.Todos) == 0 {
+			errs.add("todos", "must not be empty")
+		}
+		count := 0
+		validateTemplateTodos("todos", req.Todos, &count, &errs)
+		if count > maxTemplateTodos {
+			errs.add("todos", "must hold at most %d todos, subtasks included", maxTemplateTodos)
+		}
+	}
+	return errs
+}
+
+// validateTemplateTodos checks todos like validateTodo, naming invalid
+// fields after their place under field, and counts them into count.
+func validateTemplateTodos(field string, todos []TemplateTodo, count *int, errs *validationErrors) {
+	for i := range todos {
+		prefix := fmt.Sprintf("%s[%d].", field, i)
+		todo := Todo{Task: todos[i].Task, Description: todos[i].Description, Priority: todos[i].Priority, Tags: todos[i].Tags}
+		for _, e := range validateTodo(&todo) {
+			e.Field = prefix + e.Field
+			*errs = append(*errs, e)
+		}
+		todos[i].Task, todos[i].Description, todos[i].Priority, todos[i].Tags = todo.Task, todo.Description, todo.Priority, todo.Tags
+		*count++
+		validateTemplateTodos(prefix+"subtasks", todos[i].Subtasks, count, errs)
+	}
+}
+
+// resolveTemplateTodos fills in the todos of a request saving a todo or a
+// list, reading them as the caller sees them.
+func resolveTemplateTodos(ctx context.Context, caller principal, req *templateRequest) (validationErrors, error) {
+	var errs validationErrors
+	count := 0
+	switch {
+	case req.TodoID != nil:
+		todo, err := todoRepo.Get(ctx, caller, *req.TodoID)
+		if errors.Is(err, errTodoNotFound) {
+			errs.add("todo_id", "no such todo")
+			return errs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		saved := templateTodo(todo)
+		count++
+		if saved.Subtasks, err = queryTemplateTodos(ctx, caller, "parent_id = ?", []any{todo.ID}, &count); err != nil {
+			return nil, err
+		}
+		req.Todos = []TemplateTodo{saved}
+		if count > maxTemplateTodos {
+			errs.add("todo_id", "has more than %d subtasks", maxTemplateTodos-1)
+		}
+	case req.ListID != nil:
+		_, err := findList(ctx, db, caller, *req.ListID)
+		if errors.Is(err, errListNotFound) {
+			errs.add("list_id", "no such list")
+			return errs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if req.Todos, err = queryTemplateTodos(ctx, caller, "list_id = ? AND parent_id IS NULL AND archived_at IS NULL", []any{*req.ListID}, &count); err != nil {
+			return nil, err
+		}
+		if len(req.Todos) == 0 {
+			errs.add("list_id", "list has no todos")
+		} else if count > maxTemplateTodos {
+			errs.add("list_id", "has more than %d todos, subtasks included", maxTemplateTodos)
+		}
+	}
+	return errs, nil
+}
+
+// queryTemplateTodos reads the todos matching condition the caller can see
+// into a template, with their subtasks all the way down, in the order they
+// are arranged in. It stops going deeper once count passes
+// maxTemplateTodos.
+func queryTemplateTodos(ctx context.Context, caller principal, condition string, args []any, count *int) ([]TemplateTodo, error) {
+	scope, scopeArgs := caller.todoScope("")
+	rows, err := db.QueryContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE "+condition+" AND "+scope+" ORDER BY position, id", append(args, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	var todos []Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err = loadTags(ctx, db, todos); err != nil {
+		return nil, err
+	}
+
+	saved := make([]TemplateTodo, len(todos))
+	for i, todo := range todos {
+		saved[i] = templateTodo(todo)
+		*count++
+		if *count > maxTemplateTodos {
+			break
+		}
+		if saved[i].Subtasks, err = queryTemplateTodos(ctx, caller, "parent_id = ?", []any{todo.ID}, count); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
+}
+
+// templateTodo is what a template keeps of todo, without its subtasks.
+func templateTodo(todo Todo) TemplateTodo {
+	return TemplateTodo{Task: todo.Task, Description: todo.Description, Priority: todo.Priority, Tags: todo.Tags}
+}
+
+// decodeTemplateRequest reads, validates and resolves the body of POST and
+// PUT /templates, answering the request itself when that fails.
+func decodeTemplateRequest(w http.ResponseWriter, r *http.Request) (templateRequest, bool) {
+	ctx := r.Context()
+	var req templateRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeBodyError(w, r, err)
+		return req, false
+	}
+	if errs := validateTemplateRequest(&req); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return req, false
+	}
+	errs, err := resolveTemplateTodos(ctx, principalFrom(ctx), &req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading template todos", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return req, false
+	}
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return req, false
+	}
+	return req, true
+}
+
+// scanTemplate reads a row of id, name, todos and created_at.
+func scanTemplate(row rowScanner) (Template, error) {
+	var tmpl Template
+	var todos string
+	if err := row.Scan(&tmpl.ID, &tmpl.Name, &todos, &tmpl.CreatedAt); err != nil {
+		return tmpl, err
+	}
+	return tmpl, json.Unmarshal([]byte(todos), &tmpl.Todos)
+}
+
+// findTemplate loads one of the caller's templates.
+func findTemplate(ctx context.Context, caller principal, id int) (Template, error) {
+	tmpl, err := scanTemplate(db.QueryRowContext(ctx, "SELECT id, name, todos, created_at FROM templates WHERE id = ? AND owner = ?", id, caller.owner))
+	if errors.Is(err, sql.ErrNoRows) {
+		return tmpl, errTemplateNotFound
+	}
+	return tmpl, err
+}
+
+// writeTemplateError answers a failed template lookup or change.
+func writeTemplateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errTemplateNotFound) {
+		writeErrorCode(w, r, codeTemplateNotFound, "Template not found", http.StatusNotFound)
+		return
+	}
+	slog.ErrorContext(r.Context(), "Error querying template", "error", err)
+	writeError(w, r, "Internal server error", http.StatusInternalServerError)
+}
+
+// ListTemplatesHandler lists the caller's templates.
+func ListTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.QueryContext(r.Context(), "SELECT id, name, todos, created_at FROM templates WHERE owner = ? ORDER BY id", principalFrom(r.Context()).owner)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying templates", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		tmpl, err := scanTemplate(rows)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error scanning template", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		templates = append(templates, tmpl)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "Error iterating templates", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// CreateTemplateHandler saves a template for the caller.
+func CreateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req, ok := decodeTemplateRequest(w, r)
+	if !ok {
+		return
+	}
+	todos, err := json.Marshal(req.Todos)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	tmpl := Template{Name: req.Name, Todos: req.Todos, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	tmpl.ID, err = dbDialect.insertID(ctx, db, "INSERT INTO templates (owner, user_id, name, todos, created_at) VALUES (?, ?, ?, ?, ?)",
+		caller.owner, caller.userIDValue(), tmpl.Name, string(todos), tmpl.CreatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting template", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Created template", "ID", tmpl.ID, "Name", tmpl.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiBase(ctx)+"/templates/"+strconv.Itoa(tmpl.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tmpl)
+}
+
+// ReadTemplateHandler returns one of the caller's templates.
+func ReadTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	tmpl, err := findTemplate(r.Context(), principalFrom(r.Context()), id)
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tmpl)
+}
+
+// UpdateTemplateHandler replaces the name and todos of a template.
+func UpdateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+	req, ok := decodeTemplateRequest(w, r)
+	if !ok {
+		return
+	}
+	todos, err := json.Marshal(req.Todos)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	stored, err := findTemplate(ctx, caller, id)
+	if err == nil {
+		_, err = db.ExecContext(ctx, "UPDATE templates SET name = ?, todos = ? WHERE id = ? AND owner = ?", req.Name, string(todos), id, caller.owner)
+	}
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+	tmpl := Template{ID: id, Name: req.Name, Todos: req.Todos, CreatedAt: stored.CreatedAt}
+
+	slog.InfoContext(ctx, "Updated template", "ID", id, "Name", tmpl.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tmpl)
+}
+
+// DeleteTemplateHandler removes a template. Todos made from it stay.
+func DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.ExecContext(ctx, "DELETE FROM templates WHERE id = ? AND owner = ?", id, principalFrom(ctx).owner)
+	var n int64
+	if err == nil {
+		n, err = result.RowsAffected()
+	}
+	if err == nil && n == 0 {
+		err = errTemplateNotFound
+	}
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Deleted template", "ID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// instantiateTodo stores an open todo for the caller from a todo of a
+// template, in listID and under parentID, with its subtasks under it.
+// created collects every todo stored.
+func instantiateTodo(ctx context.Context, tx *sql.Tx, caller principal, saved TemplateTodo, listID, parentID *int, created *[]Todo) (Todo, error) {
+	todo := Todo{
+		Task:        saved.Task,
+		Description: saved.Description,
+		Priority:    saved.Priority,
+		Tags:        normalizeTags(saved.Tags),
+		ListID:      listID,
+		ParentID:    parentID,
+	}
+	errs, err := checkTodoRefs(ctx, tx, caller, todo)
+	if err != nil {
+		return todo, err
+	}
+	if errs != nil {
+		return todo, errs
+	}
+	if todo.ID, err = insertTodo(ctx, tx, caller, todo); err != nil {
+		return todo, err
+	}
+	if err = loadTimestamps(ctx, tx, &todo); err != nil {
+		return todo, err
+	}
+	*created = append(*created, todo)
+
+	if len(saved.Subtasks) > 0 {
+		todo.Subtasks = []Todo{}
+	}
+	for _, sub := range saved.Subtasks {
+		subtask, err := instantiateTodo(ctx, tx, caller, sub, listID, &todo.ID, created)
+		if err != nil {
+			return todo, err
+		}
+		todo.Subtasks = append(todo.Subtasks, subtask)
+	}
+	return todo, nil
+}
+
+// InstantiateTemplateHandler creates the todos of one of the caller's
+// templates, open and with their subtasks listed in subtasks. The optional
+// body's list_id and parent_id say where the new top-level todos go.
+func InstantiateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+	var req instantiateRequest
+	if err = decodeBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	todos := []Todo{}
+	var created []Todo
+	tmpl, err := findTemplate(ctx, caller, id)
+	if err == nil {
+		err = withTx(ctx, db, func(tx *sql.Tx) error {
+			for _, saved := range tmpl.Todos {
+				todo, err := instantiateTodo(ctx, tx, caller, saved, req.ListID, req.ParentID, &created)
+				if err != nil {
+					return err
+				}
+				todos = append(todos, todo)
+			}
+			return nil
+		})
+	}
+	var errs validationErrors
+	if errors.As(err, &errs) {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if err != nil {
+		writeTemplateError(w, r, err)
+		return
+	}
+
+	for _, todo := range created {
+		todoEvents.publish(todoEvent{Type: "created", Todo: todo, owner: caller})
+	}
+	slog.InfoContext(ctx, "Instantiated template", "ID", id, "created", len(created))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(todos)
+}
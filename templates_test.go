@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func clearTemplates(t *testing.T) {
+	t.Helper()
+	if _, err := db.Exec("DELETE FROM templates"); err != nil {
+		t.Fatalf("Failed to clear templates: %v", err)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearTemplates(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+
+	rr := requestAs(router, alice, "POST", "/templates", `{"name": " Release process ", "todos": [
+		{"task": "Tag the release", "priority": "high", "tags": ["release"]},
+		{"task": "Publish", "subtasks": [{"task": "Docker image"}, {"task": "Changelog"}]}]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a template, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var release Template
+	json.Unmarshal(rr.Body.Bytes(), &release)
+	if release.Name != "Release process" || len(release.Todos) != 2 || release.Todos[1].Subtasks[0].Priority != defaultPriority {
+		t.Errorf("Expected the normalized template back, got %+v", release)
+	}
+	path := "/templates/" + strconv.Itoa(release.ID)
+	if location := rr.Header().Get("Location"); location != path {
+		t.Errorf("Expected the Location of the template, got %q", location)
+	}
+
+	rr = requestAs(router, alice, "POST", path+"/instantiate", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 instantiating, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var todos []Todo
+	json.Unmarshal(rr.Body.Bytes(), &todos)
+	if len(todos) != 2 || todos[0].Task != "Tag the release" || todos[0].Priority != "high" || !slices.Equal(todos[0].Tags, []string{"release"}) {
+		t.Fatalf("Expected the todos of the template, got %+v", todos)
+	}
+	if subs := todos[1].Subtasks; len(subs) != 2 || subs[1].Task != "Changelog" || subs[1].ParentID == nil || *subs[1].ParentID != todos[1].ID {
+		t.Errorf("Expected the subtasks under their todo, got %+v", subs)
+	}
+	if all := getTodosAs(t, router, alice); len(all) != 4 {
+		t.Errorf("Expected 4 todos created, got %d", len(all))
+	}
+
+	rr = requestAs(router, alice, "POST", "/lists", `{"name": "Releases"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	rr = requestAs(router, alice, "POST", path+"/instantiate", `{"list_id": `+strconv.Itoa(list.ID)+`}`)
+	json.Unmarshal(rr.Body.Bytes(), &todos)
+	if rr.Code != http.StatusCreated || todos[1].Subtasks[0].ListID == nil || *todos[1].Subtasks[0].ListID != list.ID {
+		t.Errorf("Expected the todos created in the list, got %d %+v", rr.Code, todos)
+	}
+
+	// Saving a todo keeps its subtasks; saving a list keeps its todos.
+	rr = requestAs(router, alice, "POST", "/templates", `{"name": "Publish", "todo_id": `+strconv.Itoa(todos[1].ID)+`}`)
+	var saved Template
+	json.Unmarshal(rr.Body.Bytes(), &saved)
+	if rr.Code != http.StatusCreated || len(saved.Todos) != 1 || saved.Todos[0].Task != "Publish" || len(saved.Todos[0].Subtasks) != 2 {
+		t.Errorf("Expected the todo saved with its subtasks, got %d %+v", rr.Code, saved)
+	}
+	rr = requestAs(router, alice, "POST", "/templates", `{"name": "Releases", "list_id": `+strconv.Itoa(list.ID)+`}`)
+	json.Unmarshal(rr.Body.Bytes(), &saved)
+	if rr.Code != http.StatusCreated || len(saved.Todos) != 2 || len(saved.Todos[1].Subtasks) != 2 {
+		t.Errorf("Expected the list saved with its todos, got %d %+v", rr.Code, saved)
+	}
+
+	rr = requestAs(router, alice, "PUT", path, `{"name": "Hotfix", "todos": [{"task": "Patch"}]}`)
+	json.Unmarshal(rr.Body.Bytes(), &saved)
+	if rr.Code != http.StatusOK || saved.Name != "Hotfix" || len(saved.Todos) != 1 || !saved.CreatedAt.Equal(release.CreatedAt) {
+		t.Errorf("Expected the template replaced, got %d %+v", rr.Code, saved)
+	}
+	rr = requestAs(router, alice, "GET", "/templates", "")
+	var templates []Template
+	json.Unmarshal(rr.Body.Bytes(), &templates)
+	if len(templates) != 3 || templates[0].Name != "Hotfix" {
+		t.Errorf("Expected alice's 3 templates, got %+v", templates)
+	}
+
+	for _, body := range []string{
+		`{"todos": [{"task": "A"}]}`,
+		`{"name": "Empty"}`,
+		`{"name": "Empty", "todos": []}`,
+		`{"name": "Both", "todos": [{"task": "A"}], "list_id": ` + strconv.Itoa(list.ID) + `}`,
+		`{"name": "Bad", "todos": [{"task": "A", "subtasks": [{"task": " "}]}]}`,
+		`{"name": "Missing", "todo_id": 999999}`,
+	} {
+		if rr = requestAs(router, alice, "POST", "/templates", body); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", body, rr.Code)
+		}
+	}
+	if rr = requestAs(router, bob, "POST", "/templates", `{"name": "Alice's", "todo_id": `+strconv.Itoa(todos[0].ID)+`}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 saving a todo bob can't see, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "POST", path+"/instantiate", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 instantiating someone else's template, got %d", rr.Code)
+	}
+	if rr = requestAs(router, bob, "POST", "/templates", `{"name": "Mine", "todos": [{"task": "A"}]}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a template, got %d", rr.Code)
+	}
+	json.Unmarshal(rr.Body.Bytes(), &saved)
+	if rr = requestAs(router, bob, "POST", "/templates/"+strconv.Itoa(saved.ID)+"/instantiate", `{"list_id": `+strconv.Itoa(list.ID)+`}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 instantiating into someone else's list, got %d", rr.Code)
+	}
+	if all := getTodosAs(t, router, bob); len(all) != 0 {
+		t.Errorf("Expected a failed instantiation to create nothing, got %+v", all)
+	}
+
+	if rr = requestAs(router, bob, "DELETE", path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting someone else's template, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "DELETE", path, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "GET", path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after deleting, got %d", rr.Code)
+	}
+}
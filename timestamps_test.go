@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestamps(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	before := time.Now().Add(-time.Minute)
+
+	req := httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task":"Stamped"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	var created Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if created.CreatedAt.Before(before) || created.UpdatedAt.Before(before) {
+		t.Fatalf("Expected fresh timestamps, got %v and %v", created.CreatedAt, created.UpdatedAt)
+	}
+
+	// Backdate the todo so the update is visible at second precision.
+	if _, err := db.Exec("UPDATE todos SET created_at = ?, updated_at = ? WHERE id = ?", before, before, created.ID); err != nil {
+		t.Fatalf("Failed to backdate todo: %v", err)
+	}
+
+	req = httptest.NewRequest("PATCH", "/todos/"+strconv.Itoa(created.ID), strings.NewReader(`{"done":true,"version":`+strconv.Itoa(created.Version)+`}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var patched Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &patched); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !patched.UpdatedAt.After(patched.CreatedAt) {
+		t.Errorf("Expected updated_at %v to move past created_at %v", patched.UpdatedAt, patched.CreatedAt)
+	}
+
+	req = httptest.NewRequest("GET", "/todos?updated_after="+before.Add(time.Second).UTC().Format(time.RFC3339), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var todos []Todo
+	if err := json.Unmarshal(rr.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(todos) != 1 || todos[0].ID != created.ID {
+		t.Errorf("Expected the updated todo, got %+v", todos)
+	}
+}
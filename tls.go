@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// loadTLSConfig returns the TLS configuration of the server, or nil to
+// serve plain HTTP. Certificates come either from TLS_CERT_FILE and
+// TLS_KEY_FILE, or from Let's Encrypt for TLS_AUTOCERT_DOMAINS. The
+// returned handler serves the plain HTTP port: it redirects to HTTPS, and
+// with autocert also answers the ACME HTTP-01 challenges.
+func loadTLSConfig() (*tls.Config, http.Handler, error) {
+	certFile, keyFile := conf.get("TLS_CERT_FILE"), conf.get("TLS_KEY_FILE")
+	domains := splitList(conf.get("TLS_AUTOCERT_DOMAINS"))
+
+	switch {
+	case len(domains) > 0 && (certFile != "" || keyFile != ""):
+		return nil, nil, errors.New("TLS_AUTOCERT_DOMAINS can't be combined with TLS_CERT_FILE and TLS_KEY_FILE")
+	case len(domains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(conf.get("TLS_AUTOCERT_CACHE")),
+			Email:      conf.get("TLS_AUTOCERT_EMAIL"),
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler(http.HandlerFunc(redirectToHTTPS)), nil
+	case certFile == "" && keyFile == "":
+		return nil, nil, nil
+	case certFile == "" || keyFile == "":
+		return nil, nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	return tlsConfig, http.HandlerFunc(redirectToHTTPS), nil
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS
+// port. 308 keeps the method and body of non-GET requests.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port := conf.get("PORT"); port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
+
+// splitList splits a comma separated setting, dropping empty entries.
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
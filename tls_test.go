@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and
+// its key to a temporary directory, returning their paths.
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestServeHTTPS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+	tlsConfig, _, err := loadTLSConfig()
+	if err != nil || tlsConfig == nil {
+		t.Fatalf("Expected a TLS configuration, got %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runServer(ctx, listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}), time.Second, tlsConfig)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + listener.Addr().String())
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.TLS == nil {
+		t.Errorf("Expected a 204 over TLS, got %d", resp.StatusCode)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2 over TLS, got %s", resp.Proto)
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestLoadTLSConfigErrors(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	t.Setenv("TLS_CERT_FILE", certFile)
+	if _, _, err := loadTLSConfig(); err == nil {
+		t.Error("Expected a certificate without its key to be rejected")
+	}
+
+	t.Setenv("TLS_KEY_FILE", keyFile)
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "todo.example.com")
+	if _, _, err := loadTLSConfig(); err == nil {
+		t.Error("Expected certificate files and autocert together to be rejected")
+	}
+
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_AUTOCERT_CACHE", t.TempDir())
+	tlsConfig, handler, err := loadTLSConfig()
+	if err != nil || tlsConfig == nil || tlsConfig.GetCertificate == nil || handler == nil {
+		t.Errorf("Expected an autocert configuration, got %v", err)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	t.Setenv("PORT", "8443")
+	req := httptest.NewRequest("POST", "http://todo.example.com/todos?done=true", nil)
+	rr := httptest.NewRecorder()
+	redirectToHTTPS(rr, req)
+
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Errorf("Expected status 308, got %d", rr.Code)
+	}
+	if location := rr.Header().Get("Location"); location != "https://todo.example.com:8443/todos?done=true" {
+		t.Errorf("Expected a redirect to the HTTPS port, got %s", location)
+	}
+}
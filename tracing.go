@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// setupTracing installs the W3C trace context propagator, so incoming trace
+// headers are honored, and when OTEL_EXPORTER_OTLP_ENDPOINT (or its
+// _TRACES_ variant) is set, a tracer provider exporting spans over OTLP/HTTP.
+// The exporter, sampler and resource are configured with the standard
+// OTEL_* variables. The returned function flushes pending spans.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("todo-api")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// untracedPaths are polled too often to be worth a span.
+var untracedPaths = map[string]bool{"/metrics": true, "/healthz": true, "/livez": true, "/readyz": true}
+
+// tracingMiddleware starts a span for every request, continuing the trace
+// of the incoming traceparent header, and names it after the matched route.
+var tracingMiddleware = otelhttp.NewMiddleware("todo-api",
+	otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + routeTemplate(r)
+	}),
+	otelhttp.WithFilter(func(r *http.Request) bool {
+		return !untracedPaths[r.URL.Path]
+	}),
+)
+
+// tracedDBOptions makes every query against the database of d a child span
+// of the request it runs for.
+func tracedDBOptions(d dialect) []otelsql.Option {
+	system := map[dialect]attribute.KeyValue{
+		mysqlDialect:    semconv.DBSystemNameMySQL,
+		postgresDialect: semconv.DBSystemNamePostgreSQL,
+		sqliteDialect:   semconv.DBSystemNameSQLite,
+	}[d]
+	return []otelsql.Option{
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	}
+}
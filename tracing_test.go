@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "Traced", false)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	router := setupRouter()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/todos/"+strconv.Itoa(id), nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+
+	var server *tracetest.SpanStub
+	queries := 0
+	spans := exporter.GetSpans()
+	for i, span := range spans {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("Expected every span in the incoming trace, got %s in %s", span.Name, span.SpanContext.TraceID())
+		}
+		switch {
+		case span.Name == "GET /todos/{id}":
+			server = &spans[i]
+		case span.Name == "sql.conn.query":
+			queries++
+		}
+	}
+	if server == nil {
+		t.Fatalf("Expected a span named after the route, got %+v", spans)
+	}
+	if server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the request span to continue the caller's span, got parent %s", server.Parent.SpanID())
+	}
+	if queries == 0 {
+		t.Errorf("Expected spans for the database queries")
+	}
+}
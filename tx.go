@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// errTodoNotFound is returned by the storage helpers when the todo doesn't
+// exist or belongs to someone else.
+var errTodoNotFound = errors.New("todo not found")
+
+// errListNotFound is the same for lists.
+var errListNotFound = errors.New("list not found")
+
+// dbtx is implemented by both *sql.DB and *sql.Tx, so the storage helpers
+// work inside and outside a transaction.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// txBeginner is implemented by *sql.DB, and by *sql.Conn for transactions
+// on a connection set up beforehand.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// withTx runs fn inside a transaction. The transaction is committed when fn
+// returns nil, and rolled back when it returns an error or panics.
+func withTx(ctx context.Context, db txBeginner, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func countTodos(t *testing.T) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM todos").Scan(&count); err != nil {
+		t.Fatalf("Failed to count todos: %v", err)
+	}
+	return count
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	clearTodos(t)
+
+	errBoom := errors.New("boom")
+	err := withTx(context.Background(), db, func(tx *sql.Tx) error {
+		if _, err := insertTodo(context.Background(), tx, principal{}, Todo{Task: "half written", Tags: []string{"work"}}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("Expected the callback error, got %v", err)
+	}
+	if count := countTodos(t); count != 0 {
+		t.Errorf("Expected nothing committed, found %d todos", count)
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	clearTodos(t)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected the panic to propagate")
+			}
+		}()
+		withTx(context.Background(), db, func(tx *sql.Tx) error {
+			if _, err := insertTodo(context.Background(), tx, principal{}, Todo{Task: "half written"}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	if count := countTodos(t); count != 0 {
+		t.Errorf("Expected nothing committed, found %d todos", count)
+	}
+}
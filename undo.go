@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// undoWindow is how long after a change it can still be undone. It is set
+// from UNDO_WINDOW.
+var undoWindow = 15 * time.Minute
+
+var (
+	errNothingToUndo = errors.New("There is no change to this todo to undo")
+	errUndoExpired   = errors.New("The last change to this todo is older than the undo window")
+)
+
+// loggedChange is the latest entry of the audit log for a todo, with the
+// owner of the todo at the time. The owner is NULL for entries logged
+// before it was, and empty for todos without one, made without X-Owner.
+type loggedChange struct {
+	AuditEntry
+	owner   sql.NullString
+	ownerID int
+}
+
+// expired reports whether the change is too old to undo.
+func (c loggedChange) expired() bool {
+	return time.Since(c.CreatedAt) > undoWindow
+}
+
+// lastChange returns the latest change to the todo with id. It fails with
+// errTodoNotFound when there is none and the caller can't change the todo,
+// and with errNothingToUndo when they can.
+func lastChange(ctx context.Context, caller principal, id int) (loggedChange, error) {
+	change := loggedChange{AuditEntry: AuditEntry{TodoID: id}}
+	var old, values sql.NullString
+	var ownerID sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+SELECT action, old_values, new_values, todo_owner, todo_user_id, created_at
+FROM audit_log
+WHERE todo_id = ?
+ORDER BY id DESC
+LIMIT 1`, id).Scan(&change.Action, &old, &values, &change.owner, &ownerID, &change.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err = findTodo(ctx, db, caller, id); err != nil {
+			return change, err
+		}
+		return change, errNothingToUndo
+	}
+	if err != nil {
+		return change, err
+	}
+	if old.Valid {
+		if err = json.Unmarshal([]byte(old.String), &change.Old); err != nil {
+			return change, err
+		}
+	}
+	if values.Valid {
+		if err = json.Unmarshal([]byte(values.String), &change.New); err != nil {
+			return change, err
+		}
+	}
+	change.ownerID = int(ownerID.Int64)
+	return change, nil
+}
+
+// restoreFields sets the fields of todo to the values the audit log kept.
+func restoreFields(todo *Todo, fields map[string]json.RawMessage) error {
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, todo)
+}
+
+// undoCreation deletes the todo the change created.
+func undoCreation(ctx context.Context, caller principal, change loggedChange) error {
+	if _, err := findTodo(ctx, db, caller, change.TodoID); err != nil {
+		return err
+	}
+	if change.expired() {
+		return errUndoExpired
+	}
+	return todoRepo.Delete(ctx, caller, change.TodoID)
+}
+
+// undoUpdate sets the fields the change changed back to what they were.
+func undoUpdate(r *http.Request, caller principal, change loggedChange) (Todo, error) {
+	todo, _, err := todoRepo.Update(r.Context(), caller, change.TodoID, func(todo *Todo) error {
+		if err := checkPreconditions(r, *todo, 0); err != nil {
+			return err
+		}
+		if change.expired() {
+			return errUndoExpired
+		}
+		return restoreFields(todo, change.Old)
+	}, UpdateOptions{})
+	return todo, err
+}
+
+// undelete recreates the todo the change deleted, with its ID, for its
+// owner. Its subtasks are undeleted on their own.
+func undelete(ctx context.Context, caller principal, change loggedChange) (Todo, error) {
+	if !change.owner.Valid {
+		return Todo{}, errNothingToUndo
+	}
+	owner := principal{owner: change.owner.String, userID: change.ownerID}
+	var todo Todo
+	if err := restoreFields(&todo, change.Old); err != nil {
+		return todo, err
+	}
+	todo.ID = change.TodoID
+
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		// The todo goes back to its owner, so its list and parent must
+		// still be theirs.
+		errs, err := checkTodoRefs(ctx, tx, owner, todo)
+		if err != nil {
+			return err
+		}
+		if errs != nil {
+			return errs
+		}
+		if _, err = insertTodoRow(ctx, tx, owner, todo); err != nil {
+			return err
+		}
+		if todo.AssigneeID != nil {
+			// The assignee may have been deleted since.
+			if _, err = tx.ExecContext(ctx, "UPDATE todos SET assignee_id = (SELECT id FROM users WHERE id = ?) WHERE id = ?", *todo.AssigneeID, todo.ID); err != nil {
+				return err
+			}
+		}
+
+		// Only those who could change the todo can undelete it.
+		if todo, err = findTodo(ctx, tx, caller, todo.ID); err != nil {
+			return err
+		}
+		if change.expired() {
+			return errUndoExpired
+		}
+		return auditCreation(ctx, tx, caller, todo.ID)
+	})
+	if err != nil {
+		return todo, err
+	}
+
+	todoEvents.publish(todoEvent{Type: "created", Todo: todo, owner: owner})
+	return todo, nil
+}
+
+// UndoHandler reverts the last change to a todo, if it was made within the
+// undo window: it deletes a todo that was just created, sets the fields an
+// update changed back, and undeletes a deleted todo. Undoing is a change
+// too, so undoing twice redoes.
+func UndoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	change, err := lastChange(ctx, caller, id)
+	var todo Todo
+	if err == nil {
+		switch change.Action {
+		case auditCreated:
+			err = undoCreation(ctx, caller, change)
+		case auditUpdated:
+			todo, err = undoUpdate(r, caller, change)
+		case auditDeleted:
+			todo, err = undelete(ctx, caller, change)
+		}
+	}
+	if writePreconditionError(w, r, err) {
+		return
+	}
+	var errs validationErrors
+	switch {
+	case errors.As(err, &errs):
+		writeValidationErrors(w, r, errs)
+		return
+	case errors.Is(err, errTodoNotFound):
+		writeErrorCode(w, r, codeTodoNotFound, "Todo not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errNothingToUndo), errors.Is(err, errUndoExpired):
+		writeErrorCode(w, r, codeNothingToUndo, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "Error undoing change", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Undid change", "ID", id, "action", change.Action)
+
+	if change.Action == auditCreated {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	body, etag, err := encodeWithETag(todo)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding JSON", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
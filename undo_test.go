@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUndo(t *testing.T) {
+	clearTodos(t)
+	clearLists(t)
+	clearUsers(t)
+	clearAudit(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	carol := seedUser(t, "carol", editorRole)
+
+	rr := requestAs(router, alice, "POST", "/lists", `{"name": "House"}`)
+	var list List
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	requestAs(router, alice, "PUT", "/lists/"+strconv.Itoa(list.ID)+"/members/bob", `{"permission": "write"}`)
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Paint fence", "list_id": `+strconv.Itoa(list.ID)+`, "tags": ["diy"]}`)
+	var todo Todo
+	json.Unmarshal(rr.Body.Bytes(), &todo)
+	path := "/todos/" + strconv.Itoa(todo.ID)
+
+	requestAs(router, alice, "PATCH", path, `{"priority": "urgent", "done": true, "version": `+strconv.Itoa(todo.Version)+`}`)
+	rr = requestAs(router, alice, "POST", path+"/undo", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 undoing an update, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var undone Todo
+	json.Unmarshal(rr.Body.Bytes(), &undone)
+	if undone.Priority != defaultPriority || undone.Done || undone.Task != "Paint fence" {
+		t.Errorf("Expected the update undone, got %+v", undone)
+	}
+	rr = requestAs(router, alice, "POST", path+"/undo", "")
+	json.Unmarshal(rr.Body.Bytes(), &undone)
+	if undone.Priority != "urgent" || !undone.Done {
+		t.Errorf("Expected undoing twice to redo the update, got %+v", undone)
+	}
+	if rr = requestAs(router, carol, "POST", path+"/undo", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 undoing a change to someone else's todo, got %d", rr.Code)
+	}
+
+	if rr = requestAs(router, bob, "DELETE", path, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting a shared todo, got %d", rr.Code)
+	}
+	if rr = requestAs(router, carol, "POST", path+"/undo", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 undeleting someone else's todo, got %d", rr.Code)
+	}
+	rr = requestAs(router, bob, "POST", path+"/undo", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 undeleting, got %d: %s", rr.Code, rr.Body.String())
+	}
+	json.Unmarshal(rr.Body.Bytes(), &undone)
+	if undone.ID != todo.ID || undone.Task != "Paint fence" || !slices.Equal(undone.Tags, []string{"diy"}) || undone.ListID == nil || *undone.ListID != list.ID {
+		t.Errorf("Expected the todo back as it was, got %+v", undone)
+	}
+	if todos := getTodosAs(t, router, carol); len(todos) != 0 {
+		t.Errorf("Expected carol to still see nothing, got %+v", todos)
+	}
+	var owner string
+	db.QueryRow("SELECT owner FROM todos WHERE id = ?", todo.ID).Scan(&owner)
+	if owner != "alice" {
+		t.Errorf("Expected the todo to be alice's again, got %q", owner)
+	}
+
+	rr = requestAs(router, alice, "POST", "/todos", `{"task": "Oops"}`)
+	var oops Todo
+	json.Unmarshal(rr.Body.Bytes(), &oops)
+	oopsPath := "/todos/" + strconv.Itoa(oops.ID)
+	if rr = requestAs(router, alice, "POST", oopsPath+"/undo", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 undoing a creation, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "GET", oopsPath, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the created todo to be gone, got %d", rr.Code)
+	}
+
+	saved := undoWindow
+	undoWindow = 0
+	t.Cleanup(func() { undoWindow = saved })
+	time.Sleep(time.Millisecond)
+	if rr = requestAs(router, alice, "POST", path+"/undo", ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 undoing a change older than the window, got %d", rr.Code)
+	}
+	undoWindow = saved
+
+	clearAudit(t)
+	if rr = requestAs(router, alice, "POST", path+"/undo", ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 without any change to undo, got %d", rr.Code)
+	}
+	if rr = requestAs(router, alice, "POST", "/todos/999999/undo", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown todo, got %d", rr.Code)
+	}
+
+	// Without JWT auth, todos made without X-Owner have no owner, and can
+	// be undeleted all the same.
+	jwtSecret = nil
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+	rr = send("POST", "/todos", `{"task": "Ownerless"}`)
+	var ownerless Todo
+	json.Unmarshal(rr.Body.Bytes(), &ownerless)
+	ownerlessPath := "/todos/" + strconv.Itoa(ownerless.ID)
+	if rr = send("DELETE", ownerlessPath, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting without an owner, got %d", rr.Code)
+	}
+	if rr = send("POST", ownerlessPath+"/undo", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 undeleting without an owner, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = send("GET", ownerlessPath, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the ownerless todo back, got %d", rr.Code)
+	}
+}
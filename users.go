@@ -0,0 +1,268 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Roles of users. Viewers can only read their todos, editors can also
+// change them, and admins see and change everyone's todos and manage users.
+// New users are editors.
+const (
+	viewerRole = "viewer"
+	editorRole = "editor"
+	adminRole  = "admin"
+)
+
+var roles = []string{viewerRole, editorRole, adminRole}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// usernamePattern is what usernames may look like. They are stored in
+// lowercase.
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,64}$`)
+
+const minPasswordLength = 8
+
+// dummyPasswordHash is compared against when logging in as an unknown
+// user, so that takes as long as a wrong password.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// validate normalizes the username in place and checks the credentials are
+// fit for a new account.
+func (c *credentials) validate() validationErrors {
+	var errs validationErrors
+	c.Username = strings.ToLower(strings.TrimSpace(c.Username))
+	if !usernamePattern.MatchString(c.Username) {
+		errs.add("username", "must be 3 to 64 letters, digits, dots, dashes or underscores")
+	}
+	// bcrypt only looks at the first 72 bytes.
+	if len(c.Password) < minPasswordLength || len(c.Password) > 72 {
+		errs.add("password", "must be %d to 72 bytes long", minPasswordLength)
+	}
+	return errs
+}
+
+// RegisterHandler creates a user account from a username and password.
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	var data credentials
+	if err := decodeBody(r, &data); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if errs := data.validate(); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	user := User{Username: data.Username, Role: editorRole}
+	user.ID, err = dbDialect.insertID(r.Context(), db, "INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)", user.Username, string(hash), user.Role)
+	if isDuplicateKey(err) {
+		writeErrorCode(w, r, codeUsernameTaken, "Username is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error inserting user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Registered user", "ID", user.ID, "username", user.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// LoginHandler exchanges a username and password for an access token.
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var data credentials
+	if err := decodeBody(r, &data); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	user := User{Username: strings.ToLower(strings.TrimSpace(data.Username))}
+
+	var hash string
+	err := db.QueryRowContext(r.Context(), "SELECT id, password_hash, role FROM users WHERE username = ?", user.Username).Scan(&user.ID, &hash, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		hash = string(dummyPasswordHash)
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Error looking up user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(data.Password)) != nil || err != nil {
+		writeErrorCode(w, r, codeBadCredentials, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := issueToken(user, time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error signing token", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(tokenTTL.Seconds()),
+	})
+}
+
+// ListUsersHandler lists every user, for admins.
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.QueryContext(r.Context(), "SELECT id, username, role FROM users ORDER BY id")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying users", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.ID, &user.Username, &user.Role); err != nil {
+			slog.ErrorContext(r.Context(), "Error scanning user", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "Error iterating users", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// targetUserID parses the id route variable. It answers 400 and returns
+// false when it isn't a number, and 409 when it is the caller, since admins
+// can't demote or delete themselves.
+func targetUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return 0, false
+	}
+	if id == principalFrom(r.Context()).userID {
+		writeError(w, r, "Admins can't change or delete their own account", http.StatusConflict)
+		return 0, false
+	}
+	return id, true
+}
+
+// UpdateUserHandler changes the role of a user, given {"role": "viewer"}.
+// It takes effect right away, for the user's access tokens and API keys.
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var data User
+	if err := decodeBody(r, &data); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if !slices.Contains(roles, data.Role) {
+		var errs validationErrors
+		errs.add("role", "must be one of %s", strings.Join(roles, ", "))
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	user := User{ID: id, Role: data.Role}
+	err := db.QueryRowContext(r.Context(), "SELECT username FROM users WHERE id = ?", id).Scan(&user.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeErrorCode(w, r, codeUserNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error looking up user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if _, err = db.ExecContext(r.Context(), "UPDATE users SET role = ? WHERE id = ?", user.Role, id); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Changed user role", "ID", id, "role", user.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeleteUserHandler deletes a user along with their todos, lists and API
+// keys, which the database deletes with them. Todos of others in their lists
+// are kept, in no list.
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := db.ExecContext(r.Context(), "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting user", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting rows affected", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		writeErrorCode(w, r, codeUserNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Deleted user", "ID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
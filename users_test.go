@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func clearUsers(t *testing.T) {
+	t.Helper()
+	if _, err := db.Exec("DELETE FROM users"); err != nil {
+		t.Fatalf("Failed to clear users: %v", err)
+	}
+}
+
+// enableJWTAuth turns on JWT auth for the rest of the test.
+func enableJWTAuth(t *testing.T) {
+	t.Helper()
+	saved := jwtSecret
+	jwtSecret = []byte("0123456789abcdef0123456789abcdef")
+	t.Cleanup(func() { jwtSecret = saved })
+}
+
+// seedUser stores a user with an unusable password.
+func seedUser(t *testing.T, username, role string) User {
+	t.Helper()
+	user := User{Username: username, Role: role}
+	var err error
+	user.ID, err = dbDialect.insertID(context.Background(), db, "INSERT INTO users (username, password_hash, role) VALUES (?, '', ?)", username, role)
+	if err != nil {
+		t.Fatalf("Failed to seed user: %v", err)
+	}
+	return user
+}
+
+// getTodosAs lists the todos visible with a token for user.
+func getTodosAs(t *testing.T, router http.Handler, user User) []Todo {
+	t.Helper()
+	token, err := issueToken(user, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/todos", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	var todos []Todo
+	json.Unmarshal(rr.Body.Bytes(), &todos)
+	return todos
+}
+
+func postCredentials(router http.Handler, path, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(credentials{Username: username, Password: password})
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+
+	rr := postCredentials(router, "/auth/register", "Alice", "correct horse")
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", status, rr.Body.String())
+	}
+	var user User
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	if user.ID == 0 || user.Username != "alice" {
+		t.Errorf("Expected the new user with a lowercase username, got %+v", user)
+	}
+
+	if rr = postCredentials(router, "/auth/register", "alice", "another password"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a taken username, got %d", rr.Code)
+	}
+	if rr = postCredentials(router, "/auth/register", "b", "short"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for invalid credentials, got %d", rr.Code)
+	}
+
+	for _, c := range []credentials{{"alice", "wrong password"}, {"nobody", "correct horse"}} {
+		if rr = postCredentials(router, "/auth/login", c.Username, c.Password); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 logging in as %+v, got %d", c, rr.Code)
+		}
+	}
+
+	rr = postCredentials(router, "/auth/login", "ALICE", "correct horse")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", status, rr.Body.String())
+	}
+	var token tokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &token)
+	if token.TokenType != "Bearer" || token.ExpiresIn != int(tokenTTL.Seconds()) {
+		t.Errorf("Unexpected token response %+v", token)
+	}
+	if caller, err := parseToken(token.AccessToken); err != nil || caller != (principal{owner: "alice", userID: user.ID, role: editorRole}) {
+		t.Errorf("Expected a token for alice, got %+v, %v", caller, err)
+	}
+}
+
+func TestJWTAuthProtectsTodos(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	admin := seedUser(t, "root", adminRole)
+	ctx := context.Background()
+	todoRepo.Create(ctx, principal{owner: alice.Username, userID: alice.ID}, Todo{Task: "Alice's todo"})
+	todoRepo.Create(ctx, principal{owner: bob.Username, userID: bob.ID}, Todo{Task: "Bob's todo"})
+	// A todo from before accounts, owned by the same name, isn't alice's.
+	seedOwnedTodo(t, "alice", "Proxy todo")
+
+	expiredToken, _ := issueToken(alice, time.Now().Add(-2*tokenTTL))
+	noneToken, _ := jwt.NewWithClaims(jwt.SigningMethodNone, tokenClaims{
+		Username: "alice",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(alice.ID),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	for name, header := range map[string]string{
+		"missing":      "",
+		"malformed":    "Bearer not-a-token",
+		"expired":      "Bearer " + expiredToken,
+		"unsigned":     "Bearer " + noneToken,
+		"X-Owner only": ownerHeader,
+	} {
+		req := httptest.NewRequest("GET", "/todos", nil)
+		if header == ownerHeader {
+			req.Header.Set(ownerHeader, "alice")
+		} else if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 with a %s token, got %d", name, status)
+		}
+	}
+
+	if todos := getTodosAs(t, router, alice); len(todos) != 1 || todos[0].Task != "Alice's todo" {
+		t.Errorf("Expected only alice's todo, got %+v", todos)
+	}
+	if todos := getTodosAs(t, router, admin); len(todos) != 3 {
+		t.Errorf("Expected the admin to see every todo, got %+v", todos)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected /metrics to stay open, got %d", status)
+	}
+}
+
+// requestAs serves a request with a token for user.
+func requestAs(router http.Handler, user User, method, path, body string) *httptest.ResponseRecorder {
+	token, _ := issueToken(user, time.Now())
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRoles(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	viewer := seedUser(t, "vera", viewerRole)
+	editor := seedUser(t, "eddie", editorRole)
+	admin := seedUser(t, "root", adminRole)
+
+	if rr := requestAs(router, viewer, "GET", "/todos", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected viewers to read todos, got %d", rr.Code)
+	}
+	if rr := requestAs(router, viewer, "POST", "/todos", `{"task": "Not allowed"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a viewer creating a todo, got %d", rr.Code)
+	}
+	if rr := requestAs(router, editor, "POST", "/todos", `{"task": "Eddie's todo"}`); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for an editor creating a todo, got %d", rr.Code)
+	}
+	var list List
+	json.Unmarshal(requestAs(router, editor, "POST", "/lists", `{"name": "Eddie's list"}`).Body.Bytes(), &list)
+	if rr := requestAs(router, editor, "GET", "/users", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an editor listing users, got %d", rr.Code)
+	}
+
+	rr := requestAs(router, admin, "GET", "/users", "")
+	var users []User
+	json.Unmarshal(rr.Body.Bytes(), &users)
+	if rr.Code != http.StatusOK || len(users) != 3 {
+		t.Errorf("Expected the admin to list all users, got %d: %+v", rr.Code, users)
+	}
+
+	path := "/users/" + strconv.Itoa(viewer.ID)
+	if rr = requestAs(router, admin, "PATCH", path, `{"role": "owner"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown role, got %d", rr.Code)
+	}
+	if rr = requestAs(router, admin, "PATCH", "/users/"+strconv.Itoa(admin.ID), `{"role": "viewer"}`); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for an admin demoting themselves, got %d", rr.Code)
+	}
+	if rr = requestAs(router, admin, "PATCH", path, `{"role": "editor"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 changing a role, got %d: %s", rr.Code, rr.Body.String())
+	}
+	viewer.Role = editorRole
+	if rr = requestAs(router, viewer, "POST", "/todos", `{"task": "Allowed now"}`); rr.Code != http.StatusCreated {
+		t.Errorf("Expected the promoted user to create todos, got %d", rr.Code)
+	}
+
+	if rr = requestAs(router, admin, "DELETE", "/users/"+strconv.Itoa(editor.ID), ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting a user, got %d", rr.Code)
+	}
+	if todos := getTodosAs(t, router, admin); len(todos) != 1 || todos[0].Task != "Allowed now" {
+		t.Errorf("Expected the deleted user's todos to be gone, got %+v", todos)
+	}
+	if rr = requestAs(router, admin, "GET", "/lists/"+strconv.Itoa(list.ID), ""); list.ID == 0 || rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted user's list %d to be gone, got %d", list.ID, rr.Code)
+	}
+	if rr = requestAs(router, admin, "DELETE", "/users/"+strconv.Itoa(editor.ID), ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting twice, got %d", rr.Code)
+	}
+}
+
+func TestRoleChangesApplyToIssuedTokens(t *testing.T) {
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	admin := seedUser(t, "root", adminRole)
+	demoted := seedUser(t, "former", adminRole)
+
+	// Both tokens are issued while the user is still an admin.
+	token, _ := issueToken(demoted, time.Now())
+	send := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := send("GET", "/users"); code != http.StatusOK {
+		t.Fatalf("Expected the admin to list users, got %d", code)
+	}
+
+	if rr := requestAs(router, admin, "PATCH", "/users/"+strconv.Itoa(demoted.ID), `{"role": "viewer"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 demoting the admin, got %d", rr.Code)
+	}
+	if code := send("GET", "/users"); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a demoted admin's token, got %d", code)
+	}
+	if code := send("DELETE", "/users/"+strconv.Itoa(admin.ID)); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a demoted admin deleting a user, got %d", code)
+	}
+
+	if rr := requestAs(router, admin, "DELETE", "/users/"+strconv.Itoa(demoted.ID), ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting the user, got %d", rr.Code)
+	}
+	if code := send("GET", "/todos"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a deleted user's token, got %d", code)
+	}
+}
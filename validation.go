@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// taskColumnLength is how long tasks the database can store are.
+const taskColumnLength = 255
+
+// maxTaskLength is how long tasks may be, set from MAX_TASK_LENGTH up to
+// taskColumnLength.
+var maxTaskLength = taskColumnLength
+
+// maxDescriptionLength keeps descriptions to notes, not documents.
+const maxDescriptionLength = 10000
+
+// priorities are the allowed priority values, lowest first. MySQL sorts the
+// ENUM column in this order too.
+var priorities = []string{"low", "medium", "high", "urgent"}
+
+const defaultPriority = "medium"
+
+func validPriority(p string) bool {
+	return slices.Contains(priorities, p)
+}
+
+// fieldError describes why a single field of a request body is invalid.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+
+	// Suggestion is a valid value close to the rejected one, when there is
+	// an obvious one.
+	Suggestion string `json:"suggestion,omitempty"`
+
+	// Row is the line of an imported CSV file the field was read from.
+	Row int `json:"row,omitempty"`
+}
+
+// validationErrors collects every problem found in a request body, so
+// clients can fix them all at once.
+type validationErrors []fieldError
+
+func (v validationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Field + ": " + e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (v *validationErrors) add(field, format string, args ...any) {
+	*v = append(*v, fieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// requireText trims a text field in place and checks it isn't blank or
+// longer than max characters.
+func (v *validationErrors) requireText(field string, value *string, max int) {
+	*value = strings.TrimSpace(*value)
+	if *value == "" {
+		v.add(field, "required")
+	} else {
+		v.maxLength(field, *value, max)
+	}
+}
+
+// maxLength checks a text field is at most max characters long.
+func (v *validationErrors) maxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		v.add(field, "must be at most %d characters", max)
+	}
+}
+
+// tag checks a tag, already trimmed, isn't empty or too long, and doesn't
+// hold csvTagSeparator, which would split it in two in CSV exports.
+func (v *validationErrors) tag(field, tag string) {
+	switch {
+	case tag == "":
+		v.add(field, "must not be empty")
+	case strings.Contains(tag, csvTagSeparator):
+		v.add(field, "must not contain %q", csvTagSeparator)
+	default:
+		v.maxLength(field, tag, maxTagLength)
+	}
+}
+
+// validateTodo normalizes a todo received from a client in place and checks
+// it's fit to be stored. It is shared by every handler that writes todos
+// and returns every invalid field, or nil when the todo is valid.
+func validateTodo(todo *Todo) validationErrors {
+	var errs validationErrors
+
+	errs.requireText("task", &todo.Task, maxTaskLength)
+
+	todo.Description = strings.TrimSpace(todo.Description)
+	errs.maxLength("description", todo.Description, maxDescriptionLength)
+
+	if todo.Priority == "" {
+		todo.Priority = defaultPriority
+	} else if !validPriority(todo.Priority) {
+		errs.add("priority", "must be one of %s", strings.Join(priorities, ", "))
+	}
+
+	for i, tag := range todo.Tags {
+		errs.tag(fmt.Sprintf("tags[%d]", i), strings.TrimSpace(tag))
+	}
+	todo.Tags = normalizeTags(todo.Tags)
+
+	if todo.DueDate != nil {
+		// Stored with second precision in UTC, so normalize up front and
+		// respond with what a later read returns.
+		due := todo.DueDate.UTC().Truncate(time.Second)
+		todo.DueDate = &due
+
+		if b := enforcedBusinessHours; b != nil && !b.contains(due) {
+			errs = append(errs, fieldError{
+				Field:      "due_date",
+				Message:    "must fall within business hours",
+				Suggestion: b.nextSlot(due).UTC().Format(time.RFC3339),
+			})
+		}
+	}
+	if todo.RemindAt != nil {
+		remind := todo.RemindAt.UTC().Truncate(time.Second)
+		todo.RemindAt = &remind
+	}
+
+	return errs
+}
+
+// checkDueDate checks that a todo isn't given a due date in the past, which
+// is almost always a typo. Todos that are overdue already keep their due
+// date through other changes, so only one that differs from the stored
+// one, before, is checked, and done todos aren't checked at all.
+func checkDueDate(todo Todo, before *time.Time) validationErrors {
+	var errs validationErrors
+	if todo.DueDate == nil || todo.Done || (before != nil && before.Equal(*todo.DueDate)) {
+		return nil
+	}
+	if todo.DueDate.Before(time.Now()) {
+		errs.add("due_date", "must not be in the past")
+	}
+	return errs
+}
+
+// checkTodoRefs checks that the rows a todo points at exist and the caller
+// may use them, and that its parent isn't one of its own subtasks, which
+// validateTodo can't do without the database.
+func checkTodoRefs(ctx context.Context, q dbtx, caller principal, todo Todo) (validationErrors, error) {
+	var errs validationErrors
+	if todo.ListID != nil {
+		list, err := findList(ctx, q, caller, *todo.ListID)
+		switch {
+		case errors.Is(err, errListNotFound):
+			errs.add("list_id", "no such list")
+		case err != nil:
+			return nil, err
+		case list.Permission == readPermission:
+			errs.add("list_id", "list is shared with you read-only")
+		}
+	}
+	if todo.ParentID != nil {
+		ancestors, err := ancestorIDs(ctx, q, caller, *todo.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if len(ancestors) == 0 {
+			errs.add("parent_id", "no such todo")
+		} else if todo.ID != 0 && slices.Contains(ancestors, todo.ID) {
+			errs.add("parent_id", "a todo can't be nested under itself or one of its subtasks")
+		}
+	}
+	return errs, nil
+}
+
+// writeValidationErrors replies with 422 and the list of invalid fields, in
+// the error format the client asked for.
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, errs validationErrors) {
+	writeErrorFields(w, r, codeValidationFailed, "Invalid fields", http.StatusUnprocessableEntity, errs)
+}
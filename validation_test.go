@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreateHandlerReportsAllFieldErrors(t *testing.T) {
+	clearTodos(t)
+
+	router := setupRouter()
+
+	body := strings.NewReader(`{"task":"","tags":["ok"," ","` + strings.Repeat("x", 65) + `"]}`)
+	req := httptest.NewRequest("POST", "/todos", body)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d", status)
+	}
+
+	var response struct {
+		Error  errorBody    `json:"error"`
+		Errors []fieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Error.Code != codeValidationFailed {
+		t.Errorf("Expected code %s, got %q", codeValidationFailed, response.Error.Code)
+	}
+
+	want := []fieldError{
+		{Field: "task", Message: "required"},
+		{Field: "tags[1]", Message: "must not be empty"},
+		{Field: "tags[2]", Message: "must be at most 64 characters"},
+	}
+	if !reflect.DeepEqual(response.Errors, want) {
+		t.Errorf("Expected errors %+v, got %+v", want, response.Errors)
+	}
+}
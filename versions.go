@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// apiVersion is a version of the API, served under its own path prefix such
+// as /v1. Breaking changes go in a new version with its own routes, which
+// may reuse the handlers of older ones, while the older versions keep
+// serving the clients built against them.
+type apiVersion struct {
+	name   string
+	routes func(api *mux.Router)
+}
+
+// latestVersion is the newest API version, which URLs are built for outside
+// of a request.
+const latestVersion = "v1"
+
+// apiVersions are the versions served, oldest first.
+var apiVersions = []apiVersion{
+	{name: latestVersion, routes: v1Routes},
+}
+
+// legacyVersion is also served at the unversioned paths the API had before
+// it was versioned, such as /todos, which are deprecated.
+var legacyVersion = apiVersions[0]
+
+type apiBaseKey struct{}
+
+// apiBase returns the path, such as "/v1", that the API version the
+// request came in on is served under, so URLs in responses keep clients on
+// it. Outside of a request, it is the latestVersion.
+func apiBase(ctx context.Context) string {
+	if base, ok := ctx.Value(apiBaseKey{}).(string); ok {
+		return base
+	}
+	return apiPrefix + "/" + latestVersion
+}
+
+// registerAPIVersions serves every API version on api under its prefix,
+// and the legacy version at the unversioned paths too.
+func registerAPIVersions(api *mux.Router) {
+	for _, version := range apiVersions {
+		versioned := api.PathPrefix("/" + version.name).Subrouter()
+		versioned.Use(apiBaseMiddleware(apiPrefix + "/" + version.name))
+		version.routes(versioned)
+	}
+
+	legacy := api.NewRoute().Subrouter()
+	legacy.Use(apiBaseMiddleware(apiPrefix), deprecatedPathMiddleware)
+	legacyVersion.routes(legacy)
+}
+
+// apiBaseMiddleware records base as the apiBase of requests.
+func apiBaseMiddleware(base string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiBaseKey{}, base)))
+		})
+	}
+}
+
+// deprecatedPathMiddleware answers requests to unversioned paths as usual,
+// but with a Deprecation header and a Warning naming the path to use
+// instead.
+func deprecatedPathMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := apiPrefix + "/" + legacyVersion.name + strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Warning", `299 - "Deprecated API path, use `+successor+` instead"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// notFoundHandler answers requests no route matched. Under path prefixes,
+// such as those of API versions, mux loses track of routes that match the
+// path but not the method, so those are looked for again to answer 405
+// instead of 404.
+func notFoundHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+			if method == r.Method {
+				continue
+			}
+			other := r.Clone(r.Context())
+			other.Method = method
+			var match mux.RouteMatch
+			if router.Match(other, &match) && match.MatchErr == nil {
+				MethodNotAllowedHandler(w, r)
+				return
+			}
+		}
+		NotFoundHandler(w, r)
+	})
+}
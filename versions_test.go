@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAPIVersions(t *testing.T) {
+	clearTodos(t)
+	router := setupRouter()
+
+	req := httptest.NewRequest("POST", "/v1/todos", strings.NewReader(`{"task": "Versioned"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 under /v1, got %d: %s", rr.Code, rr.Body.String())
+	}
+	location := rr.Header().Get("Location")
+	if !strings.HasPrefix(location, "/v1/todos/") {
+		t.Errorf("Expected a Location under /v1, got %q", location)
+	}
+	if rr.Header().Get("Deprecation") != "" || rr.Header().Get("Warning") != "" {
+		t.Errorf("Expected no deprecation under /v1, got %v", rr.Header())
+	}
+	id := strings.TrimPrefix(location, "/v1/todos/")
+
+	req = httptest.NewRequest("GET", "/todos/"+id, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 at the legacy path, got %d", rr.Code)
+	}
+	if rr.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected a Deprecation header at the legacy path, got %q", rr.Header().Get("Deprecation"))
+	}
+	if warning := rr.Header().Get("Warning"); warning != `299 - "Deprecated API path, use /v1/todos/`+id+` instead"` {
+		t.Errorf("Expected a Warning naming the /v1 path, got %q", warning)
+	}
+
+	req = httptest.NewRequest("POST", "/todos", strings.NewReader(`{"task": "Legacy"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if location := rr.Header().Get("Location"); !strings.HasPrefix(location, "/todos/") {
+		t.Errorf("Expected legacy clients to keep legacy Locations, got %q", location)
+	}
+
+	for _, path := range []string{"/v1/nothing", "/v1/healthz", "/v2/todos"} {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for %s, got %d", path, rr.Code)
+		}
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PATCH", "/v1/todos", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for a method /v1 doesn't route, got %d", rr.Code)
+	}
+}
+
+func TestAPIVersionsUnderPrefix(t *testing.T) {
+	clearTodos(t)
+	id := seedTodo(t, "some task", false)
+
+	apiPrefix = "/api"
+	t.Cleanup(func() { apiPrefix = "" })
+	router := setupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/todos/"+strconv.Itoa(id), nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 under the prefix, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/todos", nil))
+	if warning := rr.Header().Get("Warning"); rr.Code != http.StatusOK || warning != `299 - "Deprecated API path, use /api/v1/todos instead"` {
+		t.Errorf("Expected the legacy path deprecated in favor of /api/v1, got %d %q", rr.Code, warning)
+	}
+}
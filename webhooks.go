@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// webhookEvents are the events a webhook can subscribe to: changes, and
+// reminders coming due. Marking a todo done is a completed event for
+// webhooks subscribed to those, and an updated event for the rest.
+var webhookEvents = []string{"created", "updated", "deleted", "completed", "reminder"}
+
+const (
+	webhookSecretPrefix = "whsec_"
+	maxWebhookURLLength = 2048
+
+	// webhookMaxAttempts is how many times a delivery is tried before it is
+	// given up on.
+	webhookMaxAttempts = 6
+	// webhookBatchSize is how many due deliveries are sent per poll.
+	webhookBatchSize = 10
+	// webhookClaimTimeout is how long a delivery being sent is held back
+	// from other pollers, in case its sender dies halfway.
+	webhookClaimTimeout = time.Minute
+	// maxWebhookErrorLength caps the error kept in a delivery's log.
+	maxWebhookErrorLength = 1000
+)
+
+var (
+	// webhookRetryDelay is the wait after the first failed attempt of a
+	// delivery, doubling with every further one.
+	webhookRetryDelay = 30 * time.Second
+	// webhookPollInterval is how often due deliveries are looked for.
+	webhookPollInterval = time.Second
+
+	// allowPrivateWebhooks lets webhooks deliver to loopback, private and
+	// link-local addresses, set from WEBHOOK_ALLOW_PRIVATE. Otherwise users
+	// could reach the services next to the server, such as the database or
+	// a cloud metadata endpoint, and read their answers in delivery logs.
+	allowPrivateWebhooks bool
+
+	// webhookClient sends deliveries. Redirects count as failures rather
+	// than being followed. Addresses are checked as they are dialed, after
+	// DNS resolution, so a host name can't resolve to a private address
+	// after passing validation. Proxies aren't used, as they would dial in
+	// the client's place.
+	webhookClient = &http.Client{
+		Timeout:       10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+				Control:   checkWebhookDial,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+)
+
+// errPrivateWebhookAddress is returned when delivering to a webhook whose
+// host resolves to an address that isn't public.
+var errPrivateWebhookAddress = errors.New("webhook address isn't public")
+
+// nonPublicPrefixes are the ranges besides those netip.Addr classifies
+// that webhooks may not deliver to: "this network" and carrier-grade NAT.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// publicAddress reports whether webhooks may deliver to ip: it isn't
+// loopback, private, link-local, multicast or unspecified.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicHost reports whether the host of a webhook URL may be public. IP
+// addresses are checked right away, and host names once resolved, as
+// deliveries are sent.
+func publicHost(host string) bool {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return publicAddress(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
+
+// checkWebhookDial is the net.Dialer.Control of webhookClient, refusing
+// connections to addresses that aren't public.
+func checkWebhookDial(_, address string, _ syscall.RawConn) error {
+	if allowPrivateWebhooks {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errPrivateWebhookAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+var errWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is a URL receiving a signed POST for every change to the owner's
+// todos it subscribes to, limited to the todos of one list when it has a
+// ListID. Its secret is returned once, when it is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Format    string    `json:"format"`
+	ListID    *int      `json:"list_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// WebhookDelivery is the log of sending one event to a webhook.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // "pending", "succeeded" or "failed"
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status"`
+	Error          *string         `json:"error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+}
+
+// webhookPayload is the body POSTed to webhooks.
+type webhookPayload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Todo      Todo      `json:"todo"`
+}
+
+// validateWebhook normalizes a webhook received from a client in place and
+// checks its URL, events and format. Without events, it subscribes to all
+// of them, or to chatWebhookEvents in a chat format.
+func validateWebhook(hook *Webhook) validationErrors {
+	var errs validationErrors
+	hook.URL = strings.TrimSpace(hook.URL)
+	if hook.URL == "" {
+		errs.add("url", "required")
+	} else if len(hook.URL) > maxWebhookURLLength {
+		errs.add("url", "must be at most %d characters", maxWebhookURLLength)
+	} else if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add("url", "must be an absolute http or https URL")
+	} else if !allowPrivateWebhooks && !publicHost(u.Hostname()) {
+		errs.add("url", "must not point at a private address")
+	}
+
+	if hook.Format == "" {
+		hook.Format = jsonWebhookFormat
+	}
+	if !slices.Contains(webhookFormats, hook.Format) {
+		errs.add("format", "must be one of %s", strings.Join(webhookFormats, ", "))
+	}
+
+	if len(hook.Events) == 0 && hook.Format == jsonWebhookFormat {
+		hook.Events = slices.Clone(webhookEvents)
+	} else if len(hook.Events) == 0 {
+		hook.Events = slices.Clone(chatWebhookEvents)
+	}
+	var events []string
+	for _, event := range hook.Events {
+		if !slices.Contains(webhookEvents, event) {
+			errs.add("events", "must be some of %s", strings.Join(webhookEvents, ", "))
+			break
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	hook.Events = events
+	return errs
+}
+
+// checkWebhookList checks the caller can see the list a webhook is limited
+// to, which validateWebhook can't do without the database.
+func checkWebhookList(ctx context.Context, caller principal, hook Webhook) (validationErrors, error) {
+	if hook.ListID == nil {
+		return nil, nil
+	}
+	var errs validationErrors
+	_, err := findList(ctx, db, caller, *hook.ListID)
+	if errors.Is(err, errListNotFound) {
+		errs.add("list_id", "no such list")
+		err = nil
+	}
+	return errs, err
+}
+
+// newWebhookSecret returns a random secret to sign deliveries with.
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// signWebhook is the hex HMAC-SHA256 of timestamp, a dot and payload, keyed
+// with the webhook's secret.
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// findWebhook loads one of the caller's webhooks, without its secret.
+func findWebhook(ctx context.Context, caller principal, id int) (Webhook, error) {
+	hook := Webhook{ID: id}
+	var events string
+	err := db.QueryRowContext(ctx, "SELECT url, events, format, list_id, created_at FROM webhooks WHERE id = ? AND owner = ?", id, caller.owner).Scan(&hook.URL, &events, &hook.Format, &hook.ListID, &hook.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hook, errWebhookNotFound
+	}
+	hook.Events = strings.Split(events, ",")
+	return hook, err
+}
+
+// writeWebhookError answers a failed webhook lookup or change.
+func writeWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errWebhookNotFound) {
+		writeErrorCode(w, r, codeWebhookNotFound, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	slog.ErrorContext(r.Context(), "Error querying webhook", "error", err)
+	writeError(w, r, "Internal server error", http.StatusInternalServerError)
+}
+
+// ListWebhooksHandler lists the caller's webhooks, without their secrets.
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.QueryContext(r.Context(), "SELECT id, url, events, format, list_id, created_at FROM webhooks WHERE owner = ? ORDER BY id", principalFrom(r.Context()).owner)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying webhooks", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var hook Webhook
+		var events string
+		if err = rows.Scan(&hook.ID, &hook.URL, &events, &hook.Format, &hook.ListID, &hook.CreatedAt); err != nil {
+			slog.ErrorContext(r.Context(), "Error scanning webhook", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		hook.Events = strings.Split(events, ",")
+		hooks = append(hooks, hook)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "Error iterating webhooks", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// CreateWebhookHandler registers a webhook for the caller. The response is
+// the only time its secret is shown.
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var hook Webhook
+	if err := decodeBody(r, &hook); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if errs := validateWebhook(&hook); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	caller := principalFrom(ctx)
+	errs, err := checkWebhookList(ctx, caller, hook)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking webhook list", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if hook.Secret, err = newWebhookSecret(); err != nil {
+		slog.ErrorContext(ctx, "Error generating webhook secret", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	hook.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	hook.ID, err = dbDialect.insertID(ctx, db, "INSERT INTO webhooks (owner, user_id, url, secret, events, format, list_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		caller.owner, caller.userIDValue(), hook.URL, hook.Secret, strings.Join(hook.Events, ","), hook.Format, hook.ListID, hook.CreatedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting webhook", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "Created webhook", "ID", hook.ID, "URL", hook.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", apiBase(ctx)+"/webhooks/"+strconv.Itoa(hook.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// ReadWebhookHandler returns one of the caller's webhooks, without its
+// secret.
+func ReadWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := findWebhook(r.Context(), principalFrom(r.Context()), id)
+	if err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// UpdateWebhookHandler replaces the URL, events, format and list of a
+// webhook, keeping its secret.
+func UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	var hook Webhook
+	if err = decodeBody(r, &hook); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if errs := validateWebhook(&hook); errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	caller := principalFrom(ctx)
+	errs, err := checkWebhookList(ctx, caller, hook)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking webhook list", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if errs != nil {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	stored, err := findWebhook(ctx, caller, id)
+	if err == nil {
+		_, err = db.ExecContext(ctx, "UPDATE webhooks SET url = ?, events = ?, format = ?, list_id = ? WHERE id = ? AND owner = ?",
+			hook.URL, strings.Join(hook.Events, ","), hook.Format, hook.ListID, id, caller.owner)
+	}
+	if err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+	hook.ID, hook.CreatedAt, hook.Secret = id, stored.CreatedAt, ""
+
+	slog.InfoContext(ctx, "Updated webhook", "ID", id, "URL", hook.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhookHandler removes a webhook along with its delivery logs.
+// Deliveries still pending are dropped.
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ? AND owner = ?", id, principalFrom(ctx).owner)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errWebhookNotFound
+		}
+		// Not every database enforces the foreign key.
+		_, err = tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id)
+		return err
+	})
+	if err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Deleted webhook", "ID", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveriesHandler pages through the delivery log of a webhook,
+// newest first.
+func ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorCode(w, r, codeInvalidID, "Invalid ID! ID must be an integer", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err = findWebhook(ctx, principalFrom(ctx), id); err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT id, event, payload, status, attempts, response_status, error, created_at, last_attempt_at, next_attempt_at
+FROM webhook_deliveries
+WHERE webhook_id = ?
+ORDER BY id DESC
+LIMIT ? OFFSET ?`, id, limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error querying webhook deliveries", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload string
+		if err = rows.Scan(&d.ID, &d.Event, &payload, &d.Status, &d.Attempts, &d.ResponseStatus, &d.Error, &d.CreatedAt, &d.LastAttemptAt, &d.NextAttemptAt); err != nil {
+			slog.ErrorContext(ctx, "Error scanning webhook delivery", "error", err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "Error iterating webhook deliveries", "error", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// runWebhooks queues a delivery for every change published on bus that a
+// webhook subscribes to, and sends the due deliveries until ctx is done.
+func runWebhooks(ctx context.Context, bus *eventBus) {
+	go queueWebhookDeliveries(ctx, bus)
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			sent, err := deliverDueWebhooks(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Error delivering webhooks", "error", err)
+			}
+			if err != nil || sent < webhookBatchSize {
+				break
+			}
+		}
+	}
+}
+
+func queueWebhookDeliveries(ctx context.Context, bus *eventBus) {
+	sub := bus.subscribe()
+	defer func() { bus.unsubscribe(sub) }()
+
+	var lastSeq uint64
+	queue := func(event todoEvent) {
+		lastSeq = event.seq
+		if err := enqueueWebhookDeliveries(ctx, strconv.FormatUint(event.seq, 10), event); err != nil && ctx.Err() == nil {
+			slog.Error("Error queueing webhook deliveries", "error", err, "event", event.seq)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub:
+			if ok {
+				queue(event)
+				continue
+			}
+			slog.Warn("Webhook queue fell behind, catching up")
+			var missed []todoEvent
+			sub, missed = bus.subscribeAfter(lastSeq)
+			for _, event := range missed {
+				queue(event)
+			}
+		}
+	}
+}
+
+// enqueueWebhookDeliveries stores a pending delivery of event for every
+// webhook subscribed to it whose owner may see the change. id identifies
+// the event to receivers, so they can tell retries apart.
+func enqueueWebhookDeliveries(ctx context.Context, id string, event todoEvent) error {
+	type subscriber struct {
+		id     int
+		owner  principal
+		events []string
+		format string
+		listID sql.NullInt64
+	}
+	rows, err := db.QueryContext(ctx, "SELECT id, owner, user_id, events, format, list_id FROM webhooks")
+	if err != nil {
+		return err
+	}
+	var subscribers []subscriber
+	for rows.Next() {
+		var s subscriber
+		var userID sql.NullInt64
+		var events string
+		if err = rows.Scan(&s.id, &s.owner.owner, &userID, &events, &s.format, &s.listID); err != nil {
+			rows.Close()
+			return err
+		}
+		s.owner.userID = int(userID.Int64)
+		s.events = strings.Split(events, ",")
+		subscribers = append(subscribers, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, s := range subscribers {
+		name := webhookEventName(event, s.events)
+		if name == "" || !event.visibleTo(ctx, s.owner) {
+			continue
+		}
+		if s.listID.Valid && (event.Todo.ListID == nil || int64(*event.Todo.ListID) != s.listID.Int64) {
+			continue
+		}
+		payload, err := webhookBody(s.format, webhookPayload{ID: id, Event: name, CreatedAt: now, Todo: event.Todo})
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, "INSERT INTO webhook_deliveries (webhook_id, event, payload, status, created_at, next_attempt_at) VALUES (?, ?, ?, 'pending', ?, ?)",
+			s.id, name, string(payload), now, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookEventName is what event is delivered as to a webhook subscribed to
+// events, or "" when it isn't delivered.
+func webhookEventName(event todoEvent, events []string) string {
+	if event.completed && slices.Contains(events, "completed") {
+		return "completed"
+	}
+	if slices.Contains(events, event.Type) {
+		return event.Type
+	}
+	return ""
+}
+
+// dueDelivery is a pending delivery whose next attempt is due.
+type dueDelivery struct {
+	id       int
+	event    string
+	payload  []byte
+	attempts int
+	url      string
+	secret   string
+}
+
+// deliverDueWebhooks makes the next attempt of up to webhookBatchSize due
+// deliveries and records the outcome, retrying failures with exponential
+// backoff. It returns how many deliveries were due.
+func deliverDueWebhooks(ctx context.Context) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id = d.webhook_id
+WHERE d.status = 'pending' AND d.next_attempt_at <= ?
+ORDER BY d.next_attempt_at, d.id
+LIMIT ?`, time.Now().UTC(), webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		var payload string
+		if err = rows.Scan(&d.id, &d.event, &payload, &d.attempts, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		d.payload = []byte(payload)
+		due = append(due, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range due {
+		// Claiming by attempt count keeps other pollers from sending it too.
+		now := time.Now().UTC()
+		result, err := db.ExecContext(ctx, "UPDATE webhook_deliveries SET attempts = attempts + 1, last_attempt_at = ?, next_attempt_at = ? WHERE id = ? AND attempts = ?",
+			now, now.Add(webhookClaimTimeout), d.id, d.attempts)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		d.attempts++
+
+		status, sendErr := sendWebhook(ctx, d)
+		if err = recordWebhookAttempt(ctx, d, status, sendErr); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// sendWebhook POSTs the delivery's payload, signed with the webhook's
+// secret, and returns the response status.
+func sendWebhook(ctx context.Context, d dueDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-api-webhooks")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(d.id))
+	req.Header.Set("X-Webhook-Event", d.event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(d.secret, timestamp, d.payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordWebhookAttempt logs the outcome of an attempt, and schedules the
+// next one after a failure until webhookMaxAttempts is reached.
+func recordWebhookAttempt(ctx context.Context, d dueDelivery, status int, sendErr error) error {
+	var responseStatus any
+	if status != 0 {
+		responseStatus = status
+	}
+	if sendErr == nil {
+		_, err := db.ExecContext(ctx, "UPDATE webhook_deliveries SET status = 'succeeded', response_status = ?, error = NULL, next_attempt_at = NULL WHERE id = ?", responseStatus, d.id)
+		return err
+	}
+
+	message := sendErr.Error()
+	if len(message) > maxWebhookErrorLength {
+		message = message[:maxWebhookErrorLength]
+	}
+	if d.attempts >= webhookMaxAttempts {
+		slog.Warn("Gave up on webhook delivery", "ID", d.id, "attempts", d.attempts, "error", message)
+		_, err := db.ExecContext(ctx, "UPDATE webhook_deliveries SET status = 'failed', response_status = ?, error = ?, next_attempt_at = NULL WHERE id = ?", responseStatus, message, d.id)
+		return err
+	}
+	next := time.Now().UTC().Add(webhookRetryDelay << (d.attempts - 1))
+	_, err := db.ExecContext(ctx, "UPDATE webhook_deliveries SET response_status = ?, error = ?, next_attempt_at = ? WHERE id = ?", responseStatus, message, next, d.id)
+	return err
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func clearWebhooks(t *testing.T) {
+	t.Helper()
+	for _, table := range []string{"webhook_deliveries", "webhooks"} {
+		if _, err := db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("Failed to clear %s: %v", table, err)
+		}
+	}
+}
+
+func createWebhook(t *testing.T, router http.Handler, body string) Webhook {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a webhook, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var hook Webhook
+	if err := json.Unmarshal(rr.Body.Bytes(), &hook); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return hook
+}
+
+// webhookReceiver records the requests POSTed to it, answering each with
+// the next of statuses and 200 once they run out.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	rcv := &webhookReceiver{statuses: statuses}
+	// The receiver listens on loopback.
+	allowPrivateWebhooks = true
+	t.Cleanup(func() { allowPrivateWebhooks = false })
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.requests = append(rcv.requests, r)
+		rcv.bodies = append(rcv.bodies, body)
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *webhookReceiver) received() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.requests)
+}
+
+// publishedEvents collects the events published on todoEvents for the rest
+// of the test.
+func publishedEvents(t *testing.T) <-chan todoEvent {
+	sub := todoEvents.subscribe()
+	t.Cleanup(func() { todoEvents.unsubscribe(sub) })
+	return sub
+}
+
+func webhookDeliveries(t *testing.T, router http.Handler, hook Webhook) []WebhookDelivery {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/webhooks/"+strconv.Itoa(hook.ID)+"/deliveries", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 listing deliveries, got %d", rr.Code)
+	}
+	var deliveries []WebhookDelivery
+	if err := json.Unmarshal(rr.Body.Bytes(), &deliveries); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return deliveries
+}
+
+func TestWebhooksCRUD(t *testing.T) {
+	clearWebhooks(t)
+	router := setupRouter()
+
+	hook := createWebhook(t, router, `{"url":" https://example.com/hook ","events":["completed","deleted","completed"]}`)
+	if !strings.HasPrefix(hook.Secret, webhookSecretPrefix) || hook.URL != "https://example.com/hook" || strings.Join(hook.Events, ",") != "completed,deleted" {
+		t.Errorf("Expected the normalized webhook with a secret, got %+v", hook)
+	}
+	if all := createWebhook(t, router, `{"url":"http://example.com/all"}`); len(all.Events) != len(webhookEvents) {
+		t.Errorf("Expected every event by default, got %v", all.Events)
+	}
+	path := "/webhooks/" + strconv.Itoa(hook.ID)
+
+	req := httptest.NewRequest("PUT", path, strings.NewReader(`{"url":"https://example.com/moved","events":["created"]}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 updating, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/webhooks", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var hooks []Webhook
+	if err := json.Unmarshal(rr.Body.Bytes(), &hooks); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(hooks) != 2 || hooks[0].URL != "https://example.com/moved" || hooks[0].Events[0] != "created" || hooks[0].Secret != "" {
+		t.Errorf("Expected the updated webhook without its secret, got %+v", hooks)
+	}
+
+	req = httptest.NewRequest("DELETE", path, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 deleting, got %d", rr.Code)
+	}
+	req = httptest.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), codeWebhookNotFound) {
+		t.Errorf("Expected 404 %s after deleting, got %d", codeWebhookNotFound, rr.Code)
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	clearWebhooks(t)
+	router := setupRouter()
+
+	tests := map[string]string{
+		"missing url":    `{}`,
+		"relative url":   `{"url":"/hook"}`,
+		"other scheme":   `{"url":"ftp://example.com/hook"}`,
+		"unknown event":  `{"url":"https://example.com","events":["archived"]}`,
+		"unknown format": `{"url":"https://example.com","format":"teams"}`,
+		"unknown list":   `{"url":"https://example.com","list_id":999999}`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Errorf("Expected status 422, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	clearWebhooks(t)
+	router := setupRouter()
+
+	for _, url := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:3306",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://0.0.0.0/hook",
+		"http://localhost:8080/hook",
+	} {
+		req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(`{"url":"`+url+`"}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422, got %d", url, rr.Code)
+		}
+	}
+	if !publicAddress(netip.MustParseAddr("93.184.216.34")) || !publicHost("example.com") {
+		t.Error("Expected public addresses and host names to be allowed")
+	}
+
+	// Host names are checked once resolved, as they are dialed.
+	rcv := newWebhookReceiver(t)
+	allowPrivateWebhooks = false
+	target := strings.Replace(rcv.URL, "127.0.0.1", "localhost", 1)
+	if _, err := webhookClient.Post(target, "application/json", nil); !errors.Is(err, errPrivateWebhookAddress) {
+		t.Errorf("Expected the loopback address refused, got %v", err)
+	}
+	if rcv.received() != 0 {
+		t.Errorf("Expected nothing delivered, got %d requests", rcv.received())
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	clearTodos(t)
+	clearWebhooks(t)
+	router := setupRouter()
+	ctx := context.Background()
+	rcv := newWebhookReceiver(t, http.StatusInternalServerError)
+	hook := createWebhook(t, router, `{"url":"`+rcv.URL+`","events":["completed"]}`)
+	events := publishedEvents(t)
+
+	id := seedTodo(t, "Ship webhooks", false)
+	req := httptest.NewRequest("PATCH", "/todos/"+strconv.Itoa(id), strings.NewReader(`{"done":true,"version":1}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if err := enqueueWebhookDeliveries(ctx, "1", <-events); err != nil {
+		t.Fatalf("Failed to queue deliveries: %v", err)
+	}
+
+	// The first attempt fails and is retried later.
+	if sent, err := deliverDueWebhooks(ctx); err != nil || sent != 1 {
+		t.Fatalf("Expected one due delivery, got %d: %v", sent, err)
+	}
+	deliveries := webhookDeliveries(t, router, hook)
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected one delivery of the completion only, got %+v", deliveries)
+	}
+	d := deliveries[0]
+	if d.Event != "completed" || d.Status != "pending" || d.Attempts != 1 || d.ResponseStatus == nil || *d.ResponseStatus != 500 || d.Error == nil {
+		t.Errorf("Expected a failed first attempt, got %+v", d)
+	}
+	if d.NextAttemptAt == nil || d.NextAttemptAt.Before(time.Now().Add(webhookRetryDelay/2)) {
+		t.Errorf("Expected the retry to be scheduled later, got %v", d.NextAttemptAt)
+	}
+	if sent, _ := deliverDueWebhooks(ctx); sent != 0 {
+		t.Errorf("Expected nothing due before the retry, got %d", sent)
+	}
+
+	saved := webhookRetryDelay
+	webhookRetryDelay = 0
+	t.Cleanup(func() { webhookRetryDelay = saved })
+	db.Exec("UPDATE webhook_deliveries SET next_attempt_at = ?", time.Now().UTC())
+	if sent, err := deliverDueWebhooks(ctx); err != nil || sent != 1 {
+		t.Fatalf("Expected the retry to be due, got %d: %v", sent, err)
+	}
+	if d = webhookDeliveries(t, router, hook)[0]; d.Status != "succeeded" || d.Attempts != 2 || d.Error != nil {
+		t.Errorf("Expected the retry to succeed, got %+v", d)
+	}
+
+	r, body := rcv.requests[1], rcv.bodies[1]
+	if r.Header.Get("X-Webhook-Event") != "completed" || r.Header.Get("X-Webhook-ID") != strconv.Itoa(d.ID) {
+		t.Errorf("Expected the delivery headers, got %v", r.Header)
+	}
+	if want := "sha256=" + signWebhook(hook.Secret, r.Header.Get("X-Webhook-Timestamp"), body); r.Header.Get("X-Webhook-Signature") != want {
+		t.Errorf("Expected signature %s, got %s", want, r.Header.Get("X-Webhook-Signature"))
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Event != "completed" || payload.Todo.ID != id || !payload.Todo.Done {
+		t.Errorf("Expected the completed todo as payload, got %s", body)
+	}
+}
+
+func TestWebhookBulkCompletion(t *testing.T) {
+	clearTodos(t)
+	clearWebhooks(t)
+	router := setupRouter()
+	ctx := context.Background()
+	rcv := newWebhookReceiver(t, http.StatusOK)
+	hook := createWebhook(t, router, `{"url":"`+rcv.URL+`","events":["completed"]}`)
+	events := publishedEvents(t)
+
+	pending := seedTodo(t, "pending", false)
+	done := seedTodo(t, "already done", true)
+	body := strings.NewReader(`{"ids":[` + strconv.Itoa(pending) + `,` + strconv.Itoa(done) + `]}`)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/todos/complete", body))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 completing todos, got %d", rr.Code)
+	}
+
+	// Only the todo that wasn't done yet changed.
+	event := <-events
+	if event.Type != "updated" || !event.completed || event.Todo.ID != pending {
+		t.Fatalf("Expected the completion of todo %d, got %+v", pending, event)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected no event for the todo already done, got %+v", event)
+	default:
+	}
+
+	if err := enqueueWebhookDeliveries(ctx, "1", event); err != nil {
+		t.Fatalf("Failed to queue deliveries: %v", err)
+	}
+	if sent, err := deliverDueWebhooks(ctx); err != nil || sent != 1 {
+		t.Fatalf("Expected one due delivery, got %d: %v", sent, err)
+	}
+	if d := webhookDeliveries(t, router, hook)[0]; d.Event != "completed" || d.Status != "succeeded" {
+		t.Errorf("Expected the completion delivered, got %+v", d)
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	clearWebhooks(t)
+	router := setupRouter()
+	ctx := context.Background()
+	saved := webhookRetryDelay
+	webhookRetryDelay = 0
+	t.Cleanup(func() { webhookRetryDelay = saved })
+	statuses := make([]int, webhookMaxAttempts+1)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	rcv := newWebhookReceiver(t, statuses...)
+	hook := createWebhook(t, router, `{"url":"`+rcv.URL+`"}`)
+
+	if err := enqueueWebhookDeliveries(ctx, "1", todoEvent{Type: "deleted", Todo: Todo{ID: 1}, seq: 1}); err != nil {
+		t.Fatalf("Failed to queue deliveries: %v", err)
+	}
+	for range webhookMaxAttempts + 1 {
+		if _, err := deliverDueWebhooks(ctx); err != nil {
+			t.Fatalf("Failed to deliver: %v", err)
+		}
+	}
+	if rcv.received() != webhookMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", webhookMaxAttempts, rcv.received())
+	}
+	if d := webhookDeliveries(t, router, hook)[0]; d.Status != "failed" || d.NextAttemptAt != nil {
+		t.Errorf("Expected the delivery given up on, got %+v", d)
+	}
+}
+
+func TestRunWebhooks(t *testing.T) {
+	clearTodos(t)
+	clearWebhooks(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	router := setupRouter()
+	saved := webhookPollInterval
+	webhookPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { webhookPollInterval = saved })
+	rcv := newWebhookReceiver(t)
+	other := newWebhookReceiver(t)
+
+	send := func(user User, method, path, body string) *httptest.ResponseRecorder {
+		token, _ := issueToken(user, time.Now())
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	alice := seedUser(t, "alice", editorRole)
+	bob := seedUser(t, "bob", editorRole)
+	send(alice, "POST", "/webhooks", `{"url":"`+rcv.URL+`","events":["created"]}`)
+	send(bob, "POST", "/webhooks", `{"url":"`+other.URL+`"}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runWebhooks(ctx, todoEvents)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	// Let the queue subscribe before publishing.
+	time.Sleep(50 * time.Millisecond)
+
+	if rr := send(alice, "POST", "/todos", `{"task":"Hooked"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", rr.Code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for rcv.received() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rcv.received() != 1 {
+		t.Fatalf("Expected the creation delivered, got %d requests", rcv.received())
+	}
+	if other.received() != 0 {
+		t.Errorf("Expected Bob's webhook not to hear of Alice's todo, got %d requests", other.received())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteTimeout bounds how long sending one message to a client may
+	// take.
+	wsWriteTimeout = 10 * time.Second
+	// wsPingInterval is how often idle connections are pinged. Clients that
+	// don't answer within wsPongTimeout are disconnected.
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = wsPingInterval + wsWriteTimeout
+)
+
+var wsUpgrader = websocket.Upgrader{
+	// Browsers don't apply CORS to WebSockets, so cross-origin pages get the
+	// same treatment here as in corsMiddleware.
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || cors.allows(origin) || sameOrigin(r, origin)
+	},
+}
+
+// sameOrigin reports whether origin is the host the request was sent to.
+func sameOrigin(r *http.Request, origin string) bool {
+	for _, scheme := range []string{"http://", "https://"} {
+		if origin == scheme+r.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// TodoEventsWSHandler upgrades to a WebSocket and sends a JSON todoEvent
+// for every change the caller may see, until either side closes it.
+// Messages from the client are ignored.
+func TodoEventsWSHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	caller := principalFrom(ctx)
+	// Subscribing first means every change made once the client sees the
+	// handshake completed reaches it.
+	sub := todoEvents.subscribe()
+	events := coalesce(sub, eventCoalesceWindow)
+	defer func() {
+		todoEvents.unsubscribe(sub)
+		// coalesce flushes what it holds back once sub is closed.
+		for range events {
+		}
+	}()
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has answered the request already.
+		return
+	}
+	defer conn.Close()
+	slog.InfoContext(ctx, "WebSocket client connected")
+
+	// Reading handles pings and close frames, and notices clients going away.
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				slog.WarnContext(ctx, "Dropped WebSocket client that fell behind")
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "Too far behind"), time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if !event.visibleTo(ctx, caller) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			slog.InfoContext(ctx, "WebSocket client disconnected")
+			return
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Shutting down"), time.Now().Add(wsWriteTimeout))
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTodoEvents connects to /todos/ws of server with the given headers.
+func dialTodoEvents(t *testing.T, server *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/todos/ws", header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("Failed to connect (status %d): %v", status, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) todoEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event todoEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Failed to read event: %v", err)
+	}
+	return event
+}
+
+// sendAs makes a request to server as the holder of token.
+func sendAs(t *testing.T, server *httptest.Server, token, method, path, body string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		t.Fatalf("Expected %s %s to succeed, got %d", method, path, resp.StatusCode)
+	}
+}
+
+func TestTodoEventsWebSocket(t *testing.T) {
+	clearTodos(t)
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	conn := dialTodoEvents(t, server, nil)
+
+	sendAs(t, server, "", "POST", "/todos", `{"task":"Watch the socket"}`)
+	created := readEvent(t, conn)
+	if created.Type != "created" || created.Todo.Task != "Watch the socket" || created.Todo.ID == 0 {
+		t.Fatalf("Expected a created event, got %+v", created)
+	}
+	path := "/todos/" + strconv.Itoa(created.Todo.ID)
+
+	sendAs(t, server, "", "PATCH", path, `{"done":true,"version":`+strconv.Itoa(created.Todo.Version)+`}`)
+	if event := readEvent(t, conn); event.Type != "updated" || !event.Todo.Done {
+		t.Errorf("Expected an updated event, got %+v", event)
+	}
+	sendAs(t, server, "", "DELETE", path, "")
+	if event := readEvent(t, conn); event.Type != "deleted" || event.Todo.ID != created.Todo.ID {
+		t.Errorf("Expected a deleted event, got %+v", event)
+	}
+}
+
+func TestTodoEventsWebSocketOnlySendsVisibleChanges(t *testing.T) {
+	clearTodos(t)
+	clearUsers(t)
+	enableJWTAuth(t)
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	alice, _ := issueToken(seedUser(t, "alice", editorRole), time.Now())
+	bob, _ := issueToken(seedUser(t, "bob", editorRole), time.Now())
+	admin, _ := issueToken(seedUser(t, "root", adminRole), time.Now())
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/todos/ws", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %v", err)
+	}
+	aliceConn := dialTodoEvents(t, server, bearer(alice))
+	bobConn := dialTodoEvents(t, server, bearer(bob))
+	adminConn := dialTodoEvents(t, server, bearer(admin))
+
+	sendAs(t, server, alice, "POST", "/todos", `{"task":"Private"}`)
+	sendAs(t, server, bob, "POST", "/todos", `{"task":"Bob's"}`)
+
+	// Bob's own change is the first he hears of.
+	if event := readEvent(t, bobConn); event.Todo.Task != "Bob's" {
+		t.Errorf("Expected only Bob's todo, got %+v", event)
+	}
+	if first, second := readEvent(t, adminConn), readEvent(t, adminConn); first.Todo.Task != "Private" || second.Todo.Task != "Bob's" {
+		t.Errorf("Expected admins to see every change, got %+v and %+v", first, second)
+	}
+
+	// Changes to Alice's todo reach her whoever makes them.
+	private := readEvent(t, aliceConn)
+	path := "/todos/" + strconv.Itoa(private.Todo.ID)
+	sendAs(t, server, admin, "PATCH", path, `{"done":true,"version":`+strconv.Itoa(private.Todo.Version)+`}`)
+	if event := readEvent(t, aliceConn); event.Type != "updated" || event.Todo.ID != private.Todo.ID || !event.Todo.Done {
+		t.Errorf("Expected Alice to hear of the admin's change to her todo, got %+v", event)
+	}
+	sendAs(t, server, admin, "DELETE", path, "")
+	if event := readEvent(t, aliceConn); event.Type != "deleted" || event.Todo.ID != private.Todo.ID {
+		t.Errorf("Expected Alice to hear of the admin deleting her todo, got %+v", event)
+	}
+	sendAs(t, server, bob, "POST", "/todos", `{"task":"Bob's second"}`)
+	if event := readEvent(t, bobConn); event.Todo.Task != "Bob's second" {
+		t.Errorf("Expected Bob not to hear of changes to Alice's todo, got %+v", event)
+	}
+}
+
+func TestTodoEventsWebSocketChecksOrigin(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/todos/ws"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example"}})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for a foreign origin, got %v", err)
+	}
+	dialTodoEvents(t, server, http.Header{"Origin": {server.URL}})
+}